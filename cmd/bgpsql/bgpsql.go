@@ -2,14 +2,12 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"path"
 
-	_ "github.com/go-sql-driver/mysql"
 	pb "github.com/mellowdrifter/bgp_infrastructure/internal/bgpsql"
 	com "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
 	"google.golang.org/grpc"
@@ -17,16 +15,20 @@ import (
 )
 
 type config struct {
-	port    string
-	logfile string
-	dbname  string
-	user    string
-	pass    string
+	port      string
+	logfile   string
+	driver    string
+	dsn       string
+	address   string
+	dbname    string
+	user      string
+	pass      string
+	timescale bool
 }
 
 type server struct {
-	cfg config
-	db  *sql.DB
+	cfg   config
+	store storage
 }
 
 // readConfig is here to read all the config.ini options. Ensure they are correct.
@@ -45,9 +47,13 @@ func readConfig() config {
 	var cfg config
 	cfg.port = fmt.Sprintf(":%s", cf.Section("grpc").Key("port").String())
 	cfg.logfile = cf.Section("log").Key("file").String()
+	cfg.driver = cf.Section("sql").Key("driver").MustString("mysql")
+	cfg.dsn = cf.Section("sql").Key("dsn").String()
+	cfg.address = cf.Section("sql").Key("address").String()
 	cfg.dbname = cf.Section("sql").Key("database").String()
 	cfg.user = cf.Section("sql").Key("username").String()
 	cfg.pass = cf.Section("sql").Key("password").String()
+	cfg.timescale = cf.Section("sql").Key("timescale").MustBool(false)
 
 	return cfg
 }
@@ -56,6 +62,17 @@ func main() {
 	var bgpinfoServer server
 	bgpinfoServer.cfg = readConfig()
 
+	// Schema changes are run by hand, logging to the terminal.
+	if len(os.Args) > 1 {
+		if os.Args[1] != "migrate" {
+			log.Fatalf("unknown command: %s", os.Args[1])
+		}
+		if err := runMigrate(bgpinfoServer.cfg, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Set up log file
 	f, err := os.OpenFile(bgpinfoServer.cfg.logfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
 	if err != nil {
@@ -64,20 +81,13 @@ func main() {
 	defer f.Close()
 	log.SetOutput(f)
 
-	// Create sql handle and test database connection
-	sqlserver := fmt.Sprintf("%s:%s@tcp(127.0.0.1:3306)/%s",
-		bgpinfoServer.cfg.user, bgpinfoServer.cfg.pass,
-		bgpinfoServer.cfg.dbname)
-	db, err := sql.Open("mysql", sqlserver)
-	if err != nil {
-		log.Fatalf("can't open database. Got %v", err)
-	}
-	err = db.Ping()
+	// Open the database and make sure it's usable
+	store, err := openStorage(bgpinfoServer.cfg)
 	if err != nil {
-		log.Fatalf("can't ping database. Got %v", err)
+		log.Fatalf("can't open %s storage. Got %v", bgpinfoServer.cfg.driver, err)
 	}
-	bgpinfoServer.db = db
-	defer db.Close()
+	bgpinfoServer.store = store
+	defer store.Close()
 
 	// set up gRPC server
 	log.Printf("Listening on port %s\n", bgpinfoServer.cfg.port)
@@ -102,7 +112,7 @@ func (s *server) AddLatest(ctx context.Context, v *pb.Values) (*pb.Result, error
 	update := com.ProtoToStruct(v)
 
 	// update database
-	err := addLatestHelper(update, s.db)
+	err := s.store.addLatest(update)
 	if err != nil {
 		log.Printf("Got error in AddLatest: %s with update %q\n", err, v)
 		return nil, err
@@ -117,7 +127,7 @@ func (s *server) GetPrefixCount(ctx context.Context, e *pb.Empty) (*pb.PrefixCou
 	// Pull prefix counts for tweeting. Latest, 6 hours ago, and a week ago.
 	log.Println("Running GetPrefixCount")
 
-	res, err := getPrefixCountHelper(s.db)
+	res, err := s.store.getPrefixCount()
 	if err != nil {
 		log.Printf("Got error in GetPrefixCount: %s\n", err)
 		return nil, err
@@ -130,7 +140,7 @@ func (s *server) GetPieSubnets(ctx context.Context, e *pb.Empty) (*pb.PieSubnets
 	// Pull subnets counts to create Pie graph.
 	log.Println("Running GetPieSubnets")
 
-	res, err := getPieSubnetsHelper(s.db)
+	res, err := s.store.getPieSubnets()
 	if err != nil {
 		log.Printf("Got error in GetPieSubnets: %s\n", err)
 		return nil, err
@@ -143,7 +153,7 @@ func (s *server) GetMovementTotals(ctx context.Context, t *pb.MovementRequest) (
 	// Pull subnets counts to create Pie graph.
 	log.Println("Running GetMovementTotals")
 
-	res, err := getMovementTotalsHelper(t, s.db)
+	res, err := s.store.getMovementTotals(t)
 	if err != nil {
 		log.Printf("Got error in GetMovementTotals: %s\n", err)
 		return nil, err
@@ -152,12 +162,25 @@ func (s *server) GetMovementTotals(ctx context.Context, t *pb.MovementRequest) (
 	return res, nil
 }
 
+func (s *server) QueryTimeSeries(ctx context.Context, r *pb.TimeSeriesRequest) (*pb.TimeSeriesResponse, error) {
+	// Pull any INFO columns over any period, bucketed for graphing.
+	log.Printf("Running QueryTimeSeries for %v\n", r.GetMetrics())
+
+	res, err := s.store.queryTimeSeries(r)
+	if err != nil {
+		log.Printf("Got error in QueryTimeSeries: %s\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
 func (s *server) UpdateTweetBit(ctx context.Context, t *pb.Timestamp) (*pb.Result, error) {
 	// Set the tweet bit to the provided time.
 	log.Println("Running UpdateTweetBit")
-	res, err := updateTweetBitHelper(t.GetTime(), s.db)
+	res, err := s.store.updateTweetBit(t.GetTime())
 	if err != nil {
-		log.Printf("Got error in updateTweetBitHelper: %s\n", err)
+		log.Printf("Got error in UpdateTweetBit: %s\n", err)
 		return nil, err
 	}
 
@@ -168,7 +191,7 @@ func (s *server) GetRpki(ctx context.Context, e *pb.Empty) (*pb.Roas, error) {
 	// Pull RPKI counts to create Pie graph.
 	log.Println("Running GetRPKI")
 
-	res, err := getRPKIHelper(s.db)
+	res, err := s.store.getRPKI()
 	if err != nil {
 		log.Printf("Got error in GetRPKI: %s\n", err)
 		return nil, err
@@ -177,10 +200,88 @@ func (s *server) GetRpki(ctx context.Context, e *pb.Empty) (*pb.Roas, error) {
 	return res, nil
 }
 
+func (s *server) GetAspas(ctx context.Context, e *pb.Empty) (*pb.Aspas, error) {
+	// Pull ASPA path verification counts to graph alongside RPKI.
+	log.Println("Running GetASPAs")
+
+	res, err := s.store.getASPAs()
+	if err != nil {
+		log.Printf("Got error in GetASPAs: %s\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *server) GetAsPaths(ctx context.Context, e *pb.Empty) (*pb.AsPathsResponse, error) {
+	// Pull AS path stats to graph path lengths and prepending.
+	log.Println("Running GetAsPaths")
+
+	res, err := s.store.getASPaths()
+	if err != nil {
+		log.Printf("Got error in GetAsPaths: %s\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *server) GetCommunities(ctx context.Context, e *pb.Empty) (*pb.CommunitiesResponse, error) {
+	// Pull community usage to graph community types and the most used.
+	log.Println("Running GetCommunities")
+
+	res, err := s.store.getCommunities()
+	if err != nil {
+		log.Printf("Got error in GetCommunities: %s\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *server) GetPeerHistory(ctx context.Context, r *pb.PeerHistoryRequest) (*pb.PeerHistoryResponse, error) {
+	// Pull the state of a peer over time to find what moved the table.
+	log.Printf("Running GetPeerHistory for %s\n", r.GetAddress())
+
+	res, err := s.store.getPeerHistory(r)
+	if err != nil {
+		log.Printf("Got error in GetPeerHistory: %s\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *server) GetBogons(ctx context.Context, e *pb.Empty) (*pb.BogonsResponse, error) {
+	// Pull the routes that shouldn't be in the table, and who originates them.
+	log.Println("Running GetBogons")
+
+	res, err := s.store.getBogons()
+	if err != nil {
+		log.Printf("Got error in GetBogons: %s\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *server) GetOriginEvents(ctx context.Context, r *pb.OriginEventsRequest) (*pb.OriginEventsResponse, error) {
+	// Pull the MOAS, sub-prefix and origin change events seen since a time.
+	log.Printf("Running GetOriginEvents since %d\n", r.GetSince())
+
+	res, err := s.store.getOriginEvents(r)
+	if err != nil {
+		log.Printf("Got error in GetOriginEvents: %s\n", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
 func (s *server) GetAsname(ctx context.Context, a *pb.GetAsnameRequest) (*pb.GetAsnameResponse, error) {
 	log.Println("Running GetAsname")
 
-	res, err := getAsnameHelper(a, s.db)
+	res, err := s.store.getAsname(a)
 	if err != nil {
 		log.Printf("Got error in GetAsname: %s\n", err)
 		return nil, err
@@ -192,7 +293,7 @@ func (s *server) GetAsname(ctx context.Context, a *pb.GetAsnameRequest) (*pb.Get
 func (s *server) GetAsnames(ctx context.Context, e *pb.Empty) (*pb.GetAsnamesResponse, error) {
 	log.Println("Running GetAsNames")
 
-	res, err := getAsnamesHelper(s.db)
+	res, err := s.store.getAsnames()
 	if err != nil {
 		log.Printf("Got error in GetAsnames: %s\n", err)
 		return nil, err
@@ -204,7 +305,7 @@ func (s *server) UpdateAsnames(ctx context.Context, asn *pb.AsnamesRequest) (*pb
 	log.Println("Running UpdateAsname")
 	fmt.Printf("There are a total of %d AS numbers\n", len(asn.GetAsnNames()))
 
-	res, err := updateASNHelper(asn, s.db)
+	res, err := s.store.updateASN(asn)
 	if err != nil {
 		log.Printf("Got error in UpdateAsnnames: %s\n", err)
 		return nil, err
@@ -4,7 +4,6 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
 	"os"
 	"testing"
 
@@ -15,32 +14,34 @@ import (
 	com "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
 )
 
-func readOne(f string) *pb.Values {
+func readOne(t *testing.T, f string) *pb.Values {
+	t.Helper()
 	file := fmt.Sprintf("./testdata/%s", f)
 	in, err := os.ReadFile(file)
 	if err != nil {
-		log.Fatalln("Error reading file:", err)
+		t.Fatal("Error reading file:", err)
 	}
 
 	values := pb.Values{}
 
 	if err := proto.UnmarshalText(string(in), &values); err != nil {
-		log.Fatalln("Failed to parse latest values:", err)
+		t.Fatal("Failed to parse latest values:", err)
 	}
 
 	return &values
 }
 
-func readAnnual(f string) []*com.BgpUpdate {
+func readAnnual(t *testing.T, f string) []*com.BgpUpdate {
+	t.Helper()
 	file := fmt.Sprintf("./testdata/%s", f)
 	in, err := os.ReadFile(file)
 	if err != nil {
-		log.Fatalln("Error reading file:", err)
+		t.Fatal("Error reading file:", err)
 	}
 
 	values := pb.ListOfValues{}
 	if err := proto.UnmarshalText(string(in), &values); err != nil {
-		log.Fatalln("Failed to parse latest values:", err)
+		t.Fatal("Failed to parse latest values:", err)
 	}
 
 	var structValues []*com.BgpUpdate
@@ -52,161 +53,44 @@ func readAnnual(f string) []*com.BgpUpdate {
 	return structValues
 }
 
-func populate(db *sql.DB) {
-	values := readAnnual("annual.pb")
-	stmt, _ := db.Prepare(`INSERT INTO INFO (TIME, V4COUNT, V6COUNT,
-		V4TOTAL, V6TOTAL, PEERS_CONFIGURED,PEERS_UP,
-		PEERS6_CONFIGURED, PEERS6_UP, V4_24, V4_23, V4_22,
-		V4_21, V4_20, V4_19,
-		V4_18, V4_17, V4_16, V4_15, V4_14, V4_13, V4_12,
-		V4_11, V4_10, V4_09, V4_08, V6_48, V6_47, V6_46,
-		V6_45, V6_44, V6_43, V6_42, V6_41, V6_40, V6_39,
-		V6_38, V6_37, V6_36, V6_35, V6_34, V6_33, V6_32,
-		V6_31, V6_30, V6_29, V6_28, V6_27, V6_26, V6_25,
-		V6_24, V6_23, V6_22, V6_21, V6_20, V6_19, V6_18,
-		V6_17, V6_16, V6_15, V6_14, V6_13, V6_12, V6_11,
-		V6_10, V6_09, V6_08, AS4_LEN, AS6_LEN, AS10_LEN,
-		AS4_ONLY, AS6_ONLY, AS_BOTH, LARGEC4, LARGEC6,
-		ROAVALIDV4, ROAINVALIDV4, ROAUNKNOWNV4,
-		ROAVALIDV6, ROAINVALIDV6, ROAUNKNOWNV6) values (?, ?, ?, ?, ?,
-		?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
-		?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
-		?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
-		?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
-	defer stmt.Close()
-	for _, b := range values {
-		_, err := stmt.Exec(b.Time, b.V4Count, b.V6Count, b.V4Total, b.V6Total, b.PeersConfigured,
-			b.PeersUp, b.Peers6Configured, b.Peers6Up, b.V4_24,
-			b.V4_23, b.V4_22, b.V4_21, b.V4_20, b.V4_19, b.V4_18, b.V4_17, b.V4_16,
-			b.V4_15, b.V4_14, b.V4_13, b.V4_12, b.V4_11, b.V4_10, b.V4_09, b.V4_08,
-			b.V6_48, b.V6_47, b.V6_46, b.V6_45, b.V6_44, b.V6_43, b.V6_42, b.V6_41,
-			b.V6_40, b.V6_39, b.V6_38, b.V6_37, b.V6_36, b.V6_35, b.V6_34, b.V6_33,
-			b.V6_32, b.V6_31, b.V6_30, b.V6_29, b.V6_28, b.V6_27, b.V6_26, b.V6_25,
-			b.V6_24, b.V6_23, b.V6_22, b.V6_21, b.V6_20, b.V6_19, b.V6_18, b.V6_17,
-			b.V6_16, b.V6_15, b.V6_14, b.V6_13, b.V6_12, b.V6_11, b.V6_10, b.V6_09,
-			b.V6_08, b.As4, b.As6, b.As10, b.As4Only, b.As6Only, b.AsBoth, b.LargeC4,
-			b.LargeC6, b.Roavalid4, b.Roainvalid4, b.Roaunknown4, b.Roavalid6,
-			b.Roainvalid6, b.Roaunknown6)
-		if err != nil {
-			log.Fatalln("Error on statement:", err)
+func populate(t *testing.T, db *sql.DB) {
+	t.Helper()
+	store := &sqlStore{db: db}
+	for _, b := range readAnnual(t, "annual.pb") {
+		if err := store.addLatest(b); err != nil {
+			t.Fatal("Error on statement:", err)
 		}
 	}
 }
 
-func createTestDatabase() {
-	db, _ := sql.Open("sqlite3", "./testdata/bgpinfo.db")
-
-	tx, _ := db.Begin()
-	tx.Exec(`DROP TABLE IF EXISTS INFO`)
-	tx.Exec(`DROP TABLE IF EXISTS ASNUMNAME`)
-	tx.Exec(`DROP TABLE IF EXISTS ASNUMNAME_NEW`)
-	tx.Exec(`CREATE TABLE INFO (
-		TIME int(12) NOT NULL DEFAULT 0,
-		V4COUNT int(10) NOT NULL,
-		V6COUNT int(7) NOT NULL,
-		PEERS_CONFIGURED int(3) DEFAULT NULL,
-		PEERS_UP int(3) DEFAULT NULL,
-		V4_24 int(10) DEFAULT NULL,
-		V4_23 int(10) DEFAULT NULL,
-		V4_22 int(10) DEFAULT NULL,
-		V4_21 int(10) DEFAULT NULL,
-		V4_20 int(10) DEFAULT NULL,
-		V4_19 int(10) DEFAULT NULL,
-		V4_18 int(10) DEFAULT NULL,
-		V4_17 int(10) DEFAULT NULL,
-		V4_16 int(10) DEFAULT NULL,
-		V4_15 int(10) DEFAULT NULL,
-		V4_14 int(10) DEFAULT NULL,
-		V4_13 int(10) DEFAULT NULL,
-		V4_12 int(10) DEFAULT NULL,
-		V4_11 int(10) DEFAULT NULL,
-		V4_10 int(10) DEFAULT NULL,
-		V4_09 int(10) DEFAULT NULL,
-		V4_08 int(10) DEFAULT NULL,
-		V6_48 int(7) DEFAULT NULL,
-		V6_47 int(7) DEFAULT NULL,
-		V6_46 int(7) DEFAULT NULL,
-		V6_45 int(7) DEFAULT NULL,
-		V6_44 int(7) DEFAULT NULL,
-		V6_43 int(7) DEFAULT NULL,
-		V6_42 int(7) DEFAULT NULL,
-		V6_41 int(7) DEFAULT NULL,
-		V6_40 int(7) DEFAULT NULL,
-		V6_39 int(7) DEFAULT NULL,
-		V6_38 int(7) DEFAULT NULL,
-		V6_37 int(7) DEFAULT NULL,
-		V6_36 int(7) DEFAULT NULL,
-		V6_35 int(7) DEFAULT NULL,
-		V6_34 int(7) DEFAULT NULL,
-		V6_33 int(7) DEFAULT NULL,
-		V6_32 int(7) DEFAULT NULL,
-		V6_31 int(7) DEFAULT NULL,
-		V6_30 int(7) DEFAULT NULL,
-		V6_29 int(7) DEFAULT NULL,
-		V6_28 int(7) DEFAULT NULL,
-		V6_27 int(7) DEFAULT NULL,
-		V6_26 int(7) DEFAULT NULL,
-		V6_25 int(7) DEFAULT NULL,
-		V6_24 int(7) DEFAULT NULL,
-		V6_23 int(7) DEFAULT NULL,
-		V6_22 int(7) DEFAULT NULL,
-		V6_21 int(7) DEFAULT NULL,
-		V6_20 int(7) DEFAULT NULL,
-		V6_19 int(7) DEFAULT NULL,
-		V6_18 int(7) DEFAULT NULL,
-		V6_17 int(7) DEFAULT NULL,
-		V6_16 int(7) DEFAULT NULL,
-		V6_15 int(7) DEFAULT NULL,
-		V6_14 int(7) DEFAULT NULL,
-		V6_13 int(7) DEFAULT NULL,
-		V6_12 int(7) DEFAULT NULL,
-		V6_11 int(7) DEFAULT NULL,
-		V6_10 int(7) DEFAULT NULL,
-		V6_09 int(7) DEFAULT NULL,
-		V6_08 int(7) DEFAULT NULL,
-		PEERS6_UP int(3) DEFAULT NULL,
-		PEERS6_CONFIGURED int(3) DEFAULT NULL,
-		TWEET bit(1) DEFAULT NULL,
-		V4TOTAL int(12) DEFAULT NULL,
-		V6TOTAL int(10) DEFAULT NULL,
-		AS4_LEN int(10) DEFAULT NULL,
-		AS6_LEN int(10) DEFAULT NULL,
-		AS10_LEN int(10) DEFAULT NULL,
-		AS4_ONLY int(10) DEFAULT NULL,
-		AS6_ONLY int(10) DEFAULT NULL,
-		AS_BOTH int(10) DEFAULT NULL,
-		LARGEC4 int(6) DEFAULT NULL,
-		LARGEC6 int(6) DEFAULT NULL,
-		ROAVALIDV4 int(10) DEFAULT NULL,
-		ROAINVALIDV4 int(10) DEFAULT NULL,
-		ROAUNKNOWNV4 int(10) DEFAULT NULL,
-		ROAVALIDV6 int(10) DEFAULT NULL,
-		ROAINVALIDV6 int(10) DEFAULT NULL,
-		ROAUNKNOWNV6 int(10) DEFAULT NULL,
-		PRIMARY KEY (TIME)
-		)`)
-	tx.Exec(`CREATE TABLE ASNUMNAME (
-		ASNUMBER INTEGER NOT NULL,
-        ASNAME TEXT NOT NULL,
-		LOCALE TEXT DEFAULT NULL
-	)`)
-	if err := tx.Commit(); err != nil {
-		log.Panic("Unable to create test database")
+// createTestDatabase returns an empty SQLite database at the latest schema,
+// removed once the test is done.
+func createTestDatabase(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", t.TempDir()+"/bgpinfo.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := migrateLatest(db, "sqlite"); err != nil {
+		t.Fatal(err)
 	}
+	return db
 }
 
 func TestAddLatest(t *testing.T) {
-	createTestDatabase()
+	db := createTestDatabase(t)
 
 	var bgpinfoServer server
+	bgpinfoServer.store = &sqlStore{db: db}
 
-	db, _ := sql.Open("sqlite3", "./testdata/bgpinfo.db")
-	bgpinfoServer.db = db
-
-	want := readOne("latest.pb")
-	bgpinfoServer.AddLatest(context.Background(), want)
+	want := readOne(t, "latest.pb")
+	if _, err := bgpinfoServer.AddLatest(context.Background(), want); err != nil {
+		t.Fatal(err)
+	}
 
 	var gotStruct com.BgpUpdate
+	// TWEET stays NULL until the update is tweeted.
+	var tweet sql.NullInt64
 
 	query := fmt.Sprintf(`SELECT * FROM INFO WHERE TIME = '%d'`, want.GetTime())
 	row := db.QueryRow(query)
@@ -217,67 +101,9 @@ func TestAddLatest(t *testing.T) {
 		&gotStruct.V6Count,
 		&gotStruct.PeersConfigured,
 		&gotStruct.PeersUp,
-		&gotStruct.V4_24,
-		&gotStruct.V4_23,
-		&gotStruct.V4_22,
-		&gotStruct.V4_21,
-		&gotStruct.V4_20,
-		&gotStruct.V4_19,
-		&gotStruct.V4_18,
-		&gotStruct.V4_17,
-		&gotStruct.V4_16,
-		&gotStruct.V4_15,
-		&gotStruct.V4_14,
-		&gotStruct.V4_13,
-		&gotStruct.V4_12,
-		&gotStruct.V4_11,
-		&gotStruct.V4_10,
-		&gotStruct.V4_09,
-		&gotStruct.V4_08,
-		&gotStruct.V6_48,
-		&gotStruct.V6_47,
-		&gotStruct.V6_46,
-		&gotStruct.V6_45,
-		&gotStruct.V6_44,
-		&gotStruct.V6_43,
-		&gotStruct.V6_42,
-		&gotStruct.V6_41,
-		&gotStruct.V6_40,
-		&gotStruct.V6_39,
-		&gotStruct.V6_38,
-		&gotStruct.V6_37,
-		&gotStruct.V6_36,
-		&gotStruct.V6_35,
-		&gotStruct.V6_34,
-		&gotStruct.V6_33,
-		&gotStruct.V6_32,
-		&gotStruct.V6_31,
-		&gotStruct.V6_30,
-		&gotStruct.V6_29,
-		&gotStruct.V6_28,
-		&gotStruct.V6_27,
-		&gotStruct.V6_26,
-		&gotStruct.V6_25,
-		&gotStruct.V6_24,
-		&gotStruct.V6_23,
-		&gotStruct.V6_22,
-		&gotStruct.V6_21,
-		&gotStruct.V6_20,
-		&gotStruct.V6_19,
-		&gotStruct.V6_18,
-		&gotStruct.V6_17,
-		&gotStruct.V6_16,
-		&gotStruct.V6_15,
-		&gotStruct.V6_14,
-		&gotStruct.V6_13,
-		&gotStruct.V6_12,
-		&gotStruct.V6_11,
-		&gotStruct.V6_10,
-		&gotStruct.V6_09,
-		&gotStruct.V6_08,
 		&gotStruct.Peers6Up,
 		&gotStruct.Peers6Configured,
-		&gotStruct.Tweet,
+		&tweet,
 		&gotStruct.V4Total,
 		&gotStruct.V6Total,
 		&gotStruct.As4,
@@ -296,12 +122,504 @@ func TestAddLatest(t *testing.T) {
 		&gotStruct.Roaunknown6,
 	)
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
+	}
+	gotStruct.Tweet = uint32(tweet.Int64)
+	gotStruct.Masks4, gotStruct.Masks6, err = bgpinfoServer.store.(*sqlStore).getMasks(want.GetTime())
+	if err != nil {
+		t.Fatal(err)
 	}
 
 	got := com.StructToProto(&gotStruct)
+	// The rest of the update is kept in its own tables, checked by the
+	// tests of what reads them.
+	got.AsPaths, got.Communities, got.Bogons, got.Aspas = nil, nil, nil, nil
+	// The fixture predates the masks maps, which are always sent now.
+	want.Masks = com.MasksToProto(com.ProtoToMasks(want.GetMasks()))
+
+	if !proto.Equal(got, want) {
+		t.Errorf("Error on TestAddLatest. Got %v, Want %v", got, want)
+	}
+}
+
+func TestAddLatestRollback(t *testing.T) {
+	db := createTestDatabase(t)
+
+	var bgpinfoServer server
+	bgpinfoServer.store = &sqlStore{db: db}
+
+	// The same peer twice fails after INFO and MASKS have been written to.
+	peer := &pb.PeerDetail{Address: "192.0.2.1", Asn: 3356, State: "Established"}
+	v := readOne(t, "latest.pb")
+	v.PeerDetails = []*pb.PeerDetail{peer, peer}
+	if _, err := bgpinfoServer.AddLatest(context.Background(), v); err == nil {
+		t.Fatal("Got no error for a duplicate peer")
+	}
+	for _, table := range []string{"INFO", "MASKS", "PEERS"} {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Errorf("%s: Got %d rows, Wanted 0", table, n)
+		}
+	}
+
+	// So the update can be sent again.
+	v.PeerDetails = []*pb.PeerDetail{peer}
+	if _, err := bgpinfoServer.AddLatest(context.Background(), v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetAsPaths(t *testing.T) {
+	db := createTestDatabase(t)
+
+	var bgpinfoServer server
+	bgpinfoServer.store = &sqlStore{db: db}
+
+	paths := &pb.AsPaths{
+		V4: &pb.AsPathStats{
+			Lengths:       map[uint32]uint32{1: 10, 2: 500, 3: 300, 7: 2},
+			UniqueLengths: map[uint32]uint32{1: 10, 2: 510, 3: 292},
+			Prepended:     12,
+			AsSets:        3,
+		},
+		V6: &pb.AsPathStats{
+			Lengths:       map[uint32]uint32{2: 100, 3: 40},
+			UniqueLengths: map[uint32]uint32{2: 100, 3: 40},
+		},
+	}
+	// An older update, to make sure only the latest is returned.
+	older := readOne(t, "latest.pb")
+	older.Time--
+	older.AsPaths = &pb.AsPaths{V4: &pb.AsPathStats{Lengths: map[uint32]uint32{1: 1}}}
+	latest := readOne(t, "latest.pb")
+	latest.AsPaths = paths
+	for _, v := range []*pb.Values{older, latest} {
+		if _, err := bgpinfoServer.AddLatest(context.Background(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := bgpinfoServer.GetAsPaths(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &pb.AsPathsResponse{AsPaths: paths, Time: latest.GetTime()}
+	if !proto.Equal(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+}
+
+func TestGetCommunities(t *testing.T) {
+	db := createTestDatabase(t)
+
+	var bgpinfoServer server
+	bgpinfoServer.store = &sqlStore{db: db}
 
+	comms := &pb.Communities{
+		V4: &pb.CommunityUse{
+			Standard: 700,
+			Extended: 20,
+			Large:    150,
+			Top: []*pb.CommunityCount{
+				{Community: "3356:100", Prefixes: 400},
+				{Community: "13335:1:100", Prefixes: 90},
+				{Community: "rt:65000:100", Prefixes: 20},
+			},
+			WellKnown: &pb.WellKnownCommunities{NoExport: 5, Blackhole: 2},
+		},
+		V6: &pb.CommunityUse{
+			Standard:  80,
+			Top:       []*pb.CommunityCount{{Community: "6939:666", Prefixes: 80}},
+			WellKnown: &pb.WellKnownCommunities{GracefulShutdown: 1},
+		},
+	}
+	// An older update, to make sure only the latest is returned.
+	older := readOne(t, "latest.pb")
+	older.Time--
+	older.Communities = &pb.Communities{V4: &pb.CommunityUse{Standard: 1}}
+	latest := readOne(t, "latest.pb")
+	latest.Communities = comms
+	for _, v := range []*pb.Values{older, latest} {
+		if _, err := bgpinfoServer.AddLatest(context.Background(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := bgpinfoServer.GetCommunities(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &pb.CommunitiesResponse{Communities: comms, Time: latest.GetTime()}
 	if !proto.Equal(got, want) {
-		t.Errorf("Error on TestAddLatest. Got %#v, Want %#v", got, want)
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+}
+
+func TestGetPeerHistory(t *testing.T) {
+	db := createTestDatabase(t)
+
+	var bgpinfoServer server
+	bgpinfoServer.store = &sqlStore{db: db}
+
+	// Three snapshots where 192.0.2.1 drops, and comes back with fewer prefixes.
+	peer := func(state string, uptime uint64, v4 uint32) *pb.PeerDetail {
+		return &pb.PeerDetail{
+			Address:    "192.0.2.1",
+			Asn:        3356,
+			State:      state,
+			Uptime:     uptime,
+			V4Received: v4,
+			V4Accepted: v4,
+		}
+	}
+	other := &pb.PeerDetail{Address: "2001:db8::1", Asn: 6939, State: "Established", V6Received: 200000, V6Accepted: 200000}
+	snapshots := []*pb.PeerSnapshot{
+		{Peer: peer("Established", 3600, 950000)},
+		{Peer: peer("Active", 0, 0)},
+		{Peer: peer("Established", 300, 900000)},
+	}
+	first := readOne(t, "latest.pb").GetTime()
+	for i, s := range snapshots {
+		v := readOne(t, "latest.pb")
+		v.Time = first + uint64(i)*300
+		v.PeerDetails = []*pb.PeerDetail{s.Peer, other}
+		s.Time = v.Time
+		if _, err := bgpinfoServer.AddLatest(context.Background(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		req  *pb.PeerHistoryRequest
+		want []*pb.PeerSnapshot
+	}{
+		{
+			name: "all",
+			req:  &pb.PeerHistoryRequest{Address: "192.0.2.1"},
+			want: snapshots,
+		},
+		{
+			name: "start",
+			req:  &pb.PeerHistoryRequest{Address: "192.0.2.1", Start: first + 300},
+			want: snapshots[1:],
+		},
+		{
+			name: "end",
+			req:  &pb.PeerHistoryRequest{Address: "192.0.2.1", End: first + 300},
+			want: snapshots[:2],
+		},
+		{
+			name: "unknown peer",
+			req:  &pb.PeerHistoryRequest{Address: "192.0.2.99"},
+		},
+	}
+	for _, tc := range tests {
+		got, err := bgpinfoServer.GetPeerHistory(context.Background(), tc.req)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if want := (&pb.PeerHistoryResponse{Snapshots: tc.want}); !proto.Equal(got, want) {
+			t.Errorf("%s: Got %v, Wanted %v", tc.name, got, want)
+		}
+	}
+
+	if _, err := bgpinfoServer.GetPeerHistory(context.Background(), &pb.PeerHistoryRequest{Address: "bogus"}); err == nil {
+		t.Error("Got no error for an invalid address")
+	}
+}
+
+func TestQueryTimeSeries(t *testing.T) {
+	db := createTestDatabase(t)
+
+	var bgpinfoServer server
+	bgpinfoServer.store = &sqlStore{db: db}
+
+	// Four snapshots, five minutes apart, with the table growing each time.
+	first := readOne(t, "latest.pb").GetTime()
+	for i := range 4 {
+		v := readOne(t, "latest.pb")
+		v.Time = first + uint64(i)*300
+		v.PrefixCount.Active_4 = uint32(i+1) * 10
+		v.PrefixCount.Active_6 = uint32(i + 1)
+		if _, err := bgpinfoServer.AddLatest(context.Background(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	point := func(time uint64, values ...float64) *pb.TimeSeriesPoint {
+		return &pb.TimeSeriesPoint{Time: time, Values: values}
+	}
+
+	tests := []struct {
+		name string
+		req  *pb.TimeSeriesRequest
+		want []*pb.TimeSeriesPoint
+	}{
+		{
+			name: "last",
+			req:  &pb.TimeSeriesRequest{Start: first, Bucket: 600, Metrics: []string{"V4COUNT", "v6count"}},
+			want: []*pb.TimeSeriesPoint{point(first, 20, 2), point(first+600, 40, 4)},
+		},
+		{
+			name: "min",
+			req: &pb.TimeSeriesRequest{Start: first, Bucket: 600, Metrics: []string{"V6COUNT", "V4COUNT"},
+				Aggregation: pb.TimeSeriesRequest_MIN},
+			want: []*pb.TimeSeriesPoint{point(first, 1, 10), point(first+600, 3, 30)},
+		},
+		{
+			name: "max",
+			req: &pb.TimeSeriesRequest{Start: first, Bucket: 900, Metrics: []string{"V4COUNT"},
+				Aggregation: pb.TimeSeriesRequest_MAX},
+			want: []*pb.TimeSeriesPoint{point(first, 30), point(first+900, 40)},
+		},
+		{
+			name: "avg",
+			req: &pb.TimeSeriesRequest{Start: first, Bucket: 600, Metrics: []string{"V4COUNT", "V6COUNT"},
+				Aggregation: pb.TimeSeriesRequest_AVG},
+			want: []*pb.TimeSeriesPoint{point(first, 15, 1.5), point(first+600, 35, 3.5)},
+		},
+		{
+			name: "buckets from start",
+			req:  &pb.TimeSeriesRequest{Start: first + 300, End: first + 600, Bucket: 600, Metrics: []string{"V4COUNT"}},
+			want: []*pb.TimeSeriesPoint{point(first+300, 30)},
+		},
+		{
+			name: "nothing in range",
+			req:  &pb.TimeSeriesRequest{Start: first + 1000, End: first + 2000, Bucket: 600, Metrics: []string{"V4COUNT"}},
+		},
+	}
+	for _, tc := range tests {
+		got, err := bgpinfoServer.QueryTimeSeries(context.Background(), tc.req)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if want := (&pb.TimeSeriesResponse{Points: tc.want}); !proto.Equal(got, want) {
+			t.Errorf("%s: Got %v, Wanted %v", tc.name, got, want)
+		}
+	}
+
+	bad := []*pb.TimeSeriesRequest{
+		{Start: first, Bucket: 600},
+		{Start: first, Bucket: 600, Metrics: []string{"V4COUNT", "BOGUS"}},
+		{Start: first, Bucket: 600, Metrics: []string{"TIME"}},
+		{Start: first, Metrics: []string{"V4COUNT"}},
+		{Start: first + 600, End: first, Bucket: 600, Metrics: []string{"V4COUNT"}},
+		{Start: first, Bucket: 600, Metrics: []string{"V4COUNT"}, Aggregation: 10},
+	}
+	for _, req := range bad {
+		if _, err := bgpinfoServer.QueryTimeSeries(context.Background(), req); err == nil {
+			t.Errorf("%v: Got no error", req)
+		}
+	}
+}
+
+func TestGetBogons(t *testing.T) {
+	db := createTestDatabase(t)
+
+	var bgpinfoServer server
+	bgpinfoServer.store = &sqlStore{db: db}
+
+	bogons := &pb.Bogons{
+		V4: &pb.BogonCount{Martian: 2, Unallocated: 1},
+		V6: &pb.BogonCount{ReservedAsn: 1},
+		Routes: []*pb.Bogon{
+			{Prefix: "9.9.9.0/24", Origin: 19281, Kind: "unallocated"},
+			{Prefix: "10.0.0.0/8", Kind: "martian"},
+			{Prefix: "192.168.0.0/16", Origin: 64512, Kind: "martian"},
+			{Prefix: "2001:4860::/32", Origin: 4200000000, Kind: "reserved_asn"},
+		},
+	}
+	// An older update, to make sure only the latest is returned.
+	older := readOne(t, "latest.pb")
+	older.Time--
+	older.Bogons = &pb.Bogons{
+		V4:     &pb.BogonCount{Martian: 1},
+		Routes: []*pb.Bogon{{Prefix: "10.0.0.0/8", Kind: "martian"}},
+	}
+	latest := readOne(t, "latest.pb")
+	latest.Bogons = bogons
+	for _, v := range []*pb.Values{older, latest} {
+		if _, err := bgpinfoServer.AddLatest(context.Background(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := bgpinfoServer.GetBogons(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &pb.BogonsResponse{Bogons: bogons, Time: latest.GetTime()}
+	if !proto.Equal(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+}
+
+func TestGetOriginEvents(t *testing.T) {
+	db := createTestDatabase(t)
+
+	var bgpinfoServer server
+	bgpinfoServer.store = &sqlStore{db: db}
+
+	first := readOne(t, "latest.pb").GetTime()
+	moas := &pb.OriginEvent{Kind: "moas", Prefix: "1.1.1.0/24", OldOrigin: 13335, NewOrigin: 666, FirstSeen: first}
+	sub := &pb.OriginEvent{Kind: "sub_prefix", Prefix: "2606:4700:1::/48", OldOrigin: 13335, NewOrigin: 666, FirstSeen: first}
+	change := &pb.OriginEvent{Kind: "origin_change", Prefix: "8.0.0.0/9", OldOrigin: 3356, NewOrigin: 174, FirstSeen: first + 300}
+	// The MOAS continues into the second update, the sub-prefix doesn't.
+	updates := [][]*pb.OriginEvent{{moas, sub}, {moas, change}}
+	for i, events := range updates {
+		v := readOne(t, "latest.pb")
+		v.Time = first + uint64(i)*300
+		for _, e := range events {
+			e.LastSeen = v.Time
+		}
+		v.OriginEvents = events
+		if _, err := bgpinfoServer.AddLatest(context.Background(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		since uint64
+		want  []*pb.OriginEvent
+	}{
+		{
+			name: "all",
+			want: []*pb.OriginEvent{moas, sub, change},
+		},
+		{
+			name:  "since",
+			since: first + 300,
+			want:  []*pb.OriginEvent{moas, change},
+		},
+		{
+			name:  "none",
+			since: first + 600,
+		},
+	}
+	for _, tc := range tests {
+		got, err := bgpinfoServer.GetOriginEvents(context.Background(), &pb.OriginEventsRequest{Since: tc.since})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if want := (&pb.OriginEventsResponse{Events: tc.want}); !proto.Equal(got, want) {
+			t.Errorf("%s: Got %v, Wanted %v", tc.name, got, want)
+		}
+	}
+}
+
+func TestGetAspas(t *testing.T) {
+	db := createTestDatabase(t)
+
+	var bgpinfoServer server
+	bgpinfoServer.store = &sqlStore{db: db}
+
+	aspas := &pb.Aspas{V4Valid: 900000, V4Invalid: 2000, V4Unknown: 48000, V6Valid: 190000, V6Unknown: 10000}
+	// A collector without ASPAs loaded, to make sure it doesn't hide the
+	// counts of the one before.
+	without := readOne(t, "latest.pb")
+	without.Time++
+	without.Aspas = nil
+	latest := readOne(t, "latest.pb")
+	latest.Aspas = aspas
+	for _, v := range []*pb.Values{latest, without} {
+		if _, err := bgpinfoServer.AddLatest(context.Background(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := bgpinfoServer.GetAspas(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, aspas) {
+		t.Errorf("Got %v, Wanted %v", got, aspas)
+	}
+}
+
+func TestGetPieSubnets(t *testing.T) {
+	db := createTestDatabase(t)
+
+	var bgpinfoServer server
+	bgpinfoServer.store = &sqlStore{db: db}
+
+	// An older collector only sends the fixed fields, while a newer one
+	// sends every length.
+	older := readOne(t, "latest.pb")
+	older.Masks = &pb.Masks{V4_24: 400000, V6_48: 30000}
+	latest := readOne(t, "latest.pb")
+	latest.Time++
+	latest.Masks = &pb.Masks{
+		V4_24: 452605, V6_48: 34883,
+		V4: map[uint32]uint32{24: 452605, 25: 120, 32: 3},
+		V6: map[uint32]uint32{48: 34883, 64: 12},
+	}
+	for _, v := range []*pb.Values{older, latest} {
+		if _, err := bgpinfoServer.AddLatest(context.Background(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := bgpinfoServer.GetPieSubnets(context.Background(), &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &pb.PieSubnetsResponse{
+		V4Total: latest.GetPrefixCount().GetActive_4(),
+		V6Total: latest.GetPrefixCount().GetActive_6(),
+		Masks:   latest.GetMasks(),
+		Time:    latest.GetTime(),
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+
+	// The counts of the older collector are read from its fixed fields.
+	v4, v6, err := bgpinfoServer.store.(*sqlStore).getMasks(older.GetTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v4[24] != 400000 || v6[48] != 30000 || len(v4)+len(v6) != 2 {
+		t.Errorf("Got %v %v, Wanted /24 and /48 only", v4, v6)
+	}
+}
+
+func TestOpenStorage(t *testing.T) {
+	name := t.TempDir() + "/bgpinfo.db"
+	store, err := openStorage(config{driver: "sqlite", dbname: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bgpinfoServer := server{store: store}
+	want := readOne(t, "latest.pb")
+	if _, err := bgpinfoServer.AddLatest(context.Background(), want); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// Opening it again keeps what's there.
+	store, err = openStorage(config{driver: "sqlite3", dbname: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	got, err := store.getRPKI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, want.GetRoas()) {
+		t.Errorf("Got %v, Wanted %v", got, want.GetRoas())
+	}
+
+	for _, cfg := range []config{
+		{driver: "sqlite"},
+		{driver: "oracle", dbname: name},
+	} {
+		if _, err := openStorage(cfg); err == nil {
+			t.Errorf("%s: expected an error", cfg.driver)
+		}
 	}
 }
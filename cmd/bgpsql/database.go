@@ -4,67 +4,154 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"math"
+	"net"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
 	pb "github.com/mellowdrifter/bgp_infrastructure/internal/bgpsql"
 	com "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
 )
 
-// add latest BGP update information to database
-func addLatestHelper(b *com.BgpUpdate, db *sql.DB) error {
-	if db == nil {
+// add latest BGP update information to database. Everything in the update
+// is added in one transaction, so a failed update can be sent again.
+func (s *sqlStore) addLatest(b *com.BgpUpdate) error {
+	if s.db == nil {
 		log.Fatalf("db object is nil")
 	}
-	stmt, _ := db.Prepare(`INSERT INTO INFO (TIME, V4COUNT, V6COUNT,
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(s.rebind(`INSERT INTO INFO (TIME, V4COUNT, V6COUNT,
 		V4TOTAL, V6TOTAL, PEERS_CONFIGURED,PEERS_UP,
-		PEERS6_CONFIGURED, PEERS6_UP, V4_24, V4_23, V4_22,
-		V4_21, V4_20, V4_19,
-		V4_18, V4_17, V4_16, V4_15, V4_14, V4_13, V4_12,
-		V4_11, V4_10, V4_09, V4_08, V6_48, V6_47, V6_46,
-		V6_45, V6_44, V6_43, V6_42, V6_41, V6_40, V6_39,
-		V6_38, V6_37, V6_36, V6_35, V6_34, V6_33, V6_32,
-		V6_31, V6_30, V6_29, V6_28, V6_27, V6_26, V6_25,
-		V6_24, V6_23, V6_22, V6_21, V6_20, V6_19, V6_18,
-		V6_17, V6_16, V6_15, V6_14, V6_13, V6_12, V6_11,
-		V6_10, V6_09, V6_08, AS4_LEN, AS6_LEN, AS10_LEN,
+		PEERS6_CONFIGURED, PEERS6_UP, AS4_LEN, AS6_LEN, AS10_LEN,
 		AS4_ONLY, AS6_ONLY, AS_BOTH, LARGEC4, LARGEC6,
 		ROAVALIDV4, ROAINVALIDV4, ROAUNKNOWNV4,
 		ROAVALIDV6, ROAINVALIDV6, ROAUNKNOWNV6) values (?, ?, ?, ?, ?,
-		?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
-		?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
-		?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
-		?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
-	defer stmt.Close()
-	res, err := stmt.Exec(b.Time, b.V4Count, b.V6Count, b.V4Total, b.V6Total, b.PeersConfigured,
-		b.PeersUp, b.Peers6Configured, b.Peers6Up, b.V4_24,
-		b.V4_23, b.V4_22, b.V4_21, b.V4_20, b.V4_19, b.V4_18, b.V4_17, b.V4_16,
-		b.V4_15, b.V4_14, b.V4_13, b.V4_12, b.V4_11, b.V4_10, b.V4_09, b.V4_08,
-		b.V6_48, b.V6_47, b.V6_46, b.V6_45, b.V6_44, b.V6_43, b.V6_42, b.V6_41,
-		b.V6_40, b.V6_39, b.V6_38, b.V6_37, b.V6_36, b.V6_35, b.V6_34, b.V6_33,
-		b.V6_32, b.V6_31, b.V6_30, b.V6_29, b.V6_28, b.V6_27, b.V6_26, b.V6_25,
-		b.V6_24, b.V6_23, b.V6_22, b.V6_21, b.V6_20, b.V6_19, b.V6_18, b.V6_17,
-		b.V6_16, b.V6_15, b.V6_14, b.V6_13, b.V6_12, b.V6_11, b.V6_10, b.V6_09,
-		b.V6_08, b.As4, b.As6, b.As10, b.As4Only, b.As6Only, b.AsBoth, b.LargeC4,
-		b.LargeC6, b.Roavalid4, b.Roainvalid4, b.Roaunknown4, b.Roavalid6,
-		b.Roainvalid6, b.Roaunknown6)
+		?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		b.Time, b.V4Count, b.V6Count, b.V4Total, b.V6Total, b.PeersConfigured,
+		b.PeersUp, b.Peers6Configured, b.Peers6Up, b.As4, b.As6, b.As10, b.As4Only,
+		b.As6Only, b.AsBoth, b.LargeC4, b.LargeC6, b.Roavalid4, b.Roainvalid4,
+		b.Roaunknown4, b.Roavalid6, b.Roainvalid6, b.Roaunknown6)
 	if err != nil {
 		return fmt.Errorf("Unable to update database: %w", err)
 	}
+
+	for _, add := range []func(*sql.Tx, *com.BgpUpdate) error{
+		s.addMasks,
+		s.addASPaths,
+		s.addCommunities,
+		s.addPeers,
+		s.addBogons,
+		s.addOriginEvents,
+		s.addASPAs,
+	} {
+		if err := add(tx, b); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to complete transaction: %w", err)
+	}
 	log.Printf("updated database: %v", res)
 	return nil
 }
 
-func getPrefixCountHelper(db *sql.DB) (*pb.PrefixCountResponse, error) {
-	if db == nil {
+// add the mask counts of the update. Each prefix length with routes is a
+// row, keyed by the time of the update and the address family.
+func (s *sqlStore) addMasks(tx *sql.Tx, b *com.BgpUpdate) error {
+	for family, masks := range map[int]map[uint32]uint32{4: b.Masks4, 6: b.Masks6} {
+		for length, count := range masks {
+			if count == 0 {
+				continue
+			}
+			_, err := tx.Exec(s.rebind(`INSERT INTO MASKS (TIME, FAMILY, LENGTH, PREFIXES)
+				VALUES (?, ?, ?, ?)`), b.Time, family, length, count)
+			if err != nil {
+				return fmt.Errorf("unable to add masks: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// getMasks returns the mask counts of the update at time t, for IPv4 and
+// IPv6.
+func (s *sqlStore) getMasks(t uint64) (v4, v6 map[uint32]uint32, err error) {
+	rows, err := s.db.Query(s.rebind(`SELECT FAMILY, LENGTH, PREFIXES FROM MASKS
+		WHERE TIME = ?`), t)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to retrieve masks: %w", err)
+	}
+	defer rows.Close()
+
+	v4 = make(map[uint32]uint32)
+	v6 = make(map[uint32]uint32)
+	for rows.Next() {
+		var family int
+		var length, count uint32
+		if err := rows.Scan(&family, &length, &count); err != nil {
+			return nil, nil, fmt.Errorf("unable to retrieve masks: %w", err)
+		}
+		if family == 4 {
+			v4[length] = count
+		} else {
+			v6[length] = count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("unable to retrieve masks: %w", err)
+	}
+	return v4, v6, nil
+}
+
+// add the AS path histograms of the update. Each length is a row, keyed by
+// the time of the update and the address family.
+func (s *sqlStore) addASPaths(tx *sql.Tx, b *com.BgpUpdate) error {
+	for family, p := range map[int]com.PathStats{4: b.Paths4, 6: b.Paths6} {
+		_, err := tx.Exec(s.rebind(`INSERT INTO ASPATH_SHAPE (TIME, FAMILY, PREPENDED, SETS)
+			VALUES (?, ?, ?, ?)`), b.Time, family, p.Prepended, p.Sets)
+		if err != nil {
+			return fmt.Errorf("unable to add AS path stats: %w", err)
+		}
+
+		// A length may only be in one of the histograms.
+		lengths := make(map[uint32]bool)
+		for l := range p.Lengths {
+			lengths[l] = true
+		}
+		for l := range p.Unique {
+			lengths[l] = true
+		}
+		for l := range lengths {
+			_, err := tx.Exec(s.rebind(`INSERT INTO ASPATH_LENGTH (TIME, FAMILY, LENGTH,
+				PATHS, UNIQUE_PATHS) VALUES (?, ?, ?, ?, ?)`),
+				b.Time, family, l, p.Lengths[l], p.Unique[l])
+			if err != nil {
+				return fmt.Errorf("unable to add AS path lengths: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlStore) getPrefixCount() (*pb.PrefixCountResponse, error) {
+	if s.db == nil {
 		log.Fatalf("db object is nil")
 	}
 	var data pb.PrefixCountResponse
 
 	// Latest data
 	sq1 := `SELECT TIME, V4COUNT, V6COUNT FROM INFO ORDER BY TIME DESC LIMIT 1`
-	err := db.QueryRow(sq1).Scan(
+	err := s.db.QueryRow(sq1).Scan(
 		&data.Time,
 		&data.Active_4,
 		&data.Active_6,
@@ -76,7 +163,7 @@ func getPrefixCountHelper(db *sql.DB) (*pb.PrefixCountResponse, error) {
 	// Six hours ago (last tweeted data)
 	sq2 := `SELECT V4COUNT, V6COUNT FROM INFO WHERE TWEET IS NOT NULL
 			ORDER BY TIME DESC LIMIT 1`
-	err = db.QueryRow(sq2).Scan(
+	err = s.db.QueryRow(sq2).Scan(
 		&data.Sixhoursv4,
 		&data.Sixhoursv6,
 	)
@@ -88,7 +175,7 @@ func getPrefixCountHelper(db *sql.DB) (*pb.PrefixCountResponse, error) {
 	lastWeek := int32(time.Now().Unix()) - 604800
 	sq3 := fmt.Sprintf(`SELECT V4COUNT, V6COUNT FROM INFO WHERE TWEET IS NOT NULL
 				AND TIME < '%d' ORDER BY TIME DESC LIMIT 1`, lastWeek)
-	err = db.QueryRow(sq3).Scan(
+	err = s.db.QueryRow(sq3).Scan(
 		&data.Weekagov4,
 		&data.Weekagov6,
 	)
@@ -97,64 +184,37 @@ func getPrefixCountHelper(db *sql.DB) (*pb.PrefixCountResponse, error) {
 	}
 
 	// /24 and /48 counts
-	sq4 := `SELECT V4_24, V6_48 FROM INFO ORDER BY TIME DESC LIMIT 1`
-	err = db.QueryRow(sq4).Scan(
-		&data.Slash24,
-		&data.Slash48,
-	)
+	v4, v6, err := s.getMasks(data.Time)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to retrieve data: %w", err)
+		return nil, err
 	}
+	data.Slash24 = v4[24]
+	data.Slash48 = v6[48]
 
 	return &data, nil
 }
 
-func getPieSubnetsHelper(db *sql.DB) (*pb.PieSubnetsResponse, error) {
-	var masks pb.Masks
+func (s *sqlStore) getPieSubnets() (*pb.PieSubnetsResponse, error) {
 	var pie pb.PieSubnetsResponse
 
-	err := db.QueryRow(`SELECT V4_08,V4_09,V4_10,V4_11,V4_12,V4_13,V4_14,
-        V4_15,V4_16,V4_17,V4_18,V4_19,V4_20,V4_21,V4_22,
-        V4_23,V4_24,V4COUNT,V6_48,V6_47,V6_46,V6_45,V6_44,
-        V6_43,V6_42,V6_41,V6_40,V6_39,V6_38,V6_37,V6_36,
-        V6_35,V6_34,V6_33,V6_32,V6_31,V6_30,V6_29,V6_28,
-        V6_27,V6_26,V6_25,V6_24,V6_23,V6_22,V6_21,V6_20,
-        V6_19,V6_18,V6_17,V6_16,V6_15,V6_14,V6_13,V6_12,
-		V6_11,V6_10,V6_09,V6_08,V6COUNT,
-        TIME FROM INFO ORDER BY TIME DESC LIMIT 1`).Scan(
-		&masks.V4_08, &masks.V4_09, &masks.V4_10,
-		&masks.V4_11, &masks.V4_12, &masks.V4_13,
-		&masks.V4_14, &masks.V4_15, &masks.V4_16,
-		&masks.V4_17, &masks.V4_18, &masks.V4_19,
-		&masks.V4_20, &masks.V4_21, &masks.V4_22,
-		&masks.V4_23, &masks.V4_24, &pie.V4Total,
-		&masks.V6_48, &masks.V6_47, &masks.V6_46,
-		&masks.V6_45, &masks.V6_44, &masks.V6_43,
-		&masks.V6_42, &masks.V6_41, &masks.V6_40,
-		&masks.V6_39, &masks.V6_38, &masks.V6_37,
-		&masks.V6_36, &masks.V6_35, &masks.V6_34,
-		&masks.V6_33, &masks.V6_32, &masks.V6_31,
-		&masks.V6_30, &masks.V6_29, &masks.V6_28,
-		&masks.V6_27, &masks.V6_26, &masks.V6_25,
-		&masks.V6_24, &masks.V6_23, &masks.V6_22,
-		&masks.V6_21, &masks.V6_20, &masks.V6_19,
-		&masks.V6_18, &masks.V6_17, &masks.V6_16,
-		&masks.V6_15, &masks.V6_14, &masks.V6_13,
-		&masks.V6_12, &masks.V6_11, &masks.V6_10,
-		&masks.V6_09, &masks.V6_08, &pie.V6Total,
-		&pie.Time,
-	)
+	err := s.db.QueryRow(`SELECT V4COUNT, V6COUNT, TIME FROM INFO
+		ORDER BY TIME DESC LIMIT 1`).Scan(&pie.V4Total, &pie.V6Total, &pie.Time)
 	if err != nil {
 		return nil, err
 	}
 
-	// Add masks to the pie response.
-	pie.Masks = &masks
+	// Add masks to the pie response. The fixed fields are filled in too,
+	// for older clients.
+	v4, v6, err := s.getMasks(pie.Time)
+	if err != nil {
+		return nil, err
+	}
+	pie.Masks = com.MasksToProto(v4, v6)
 
 	return &pie, nil
 }
 
-func getMovementTotalsHelper(m *pb.MovementRequest, db *sql.DB) (*pb.MovementTotalsResponse, error) {
+func (s *sqlStore) getMovementTotals(m *pb.MovementRequest) (*pb.MovementTotalsResponse, error) {
 	// time helpers
 	secondsInWeek := 604800
 	secondsInMonth := 2628000
@@ -178,11 +238,18 @@ func getMovementTotalsHelper(m *pb.MovementRequest, db *sql.DB) (*pb.MovementTot
 		start = strconv.Itoa(end - secondsInYear)
 		denomiator = 60
 	}
-	query := fmt.Sprintf(`SELECT TIME, V4COUNT, V6COUNT FROM INFO WHERE TIME >=
-						'%s' AND TIME <= '%d'`, start, end)
+	// With TimescaleDB, longer periods read the hourly buckets rather than
+	// every snapshot. There are 12 snapshots to each bucket.
+	table := "INFO"
+	if s.timescale && denomiator >= 12 {
+		table = "INFO_HOURLY"
+		denomiator /= 12
+	}
+	query := fmt.Sprintf(`SELECT TIME, V4COUNT, V6COUNT FROM %s WHERE TIME >=
+						'%s' AND TIME <= '%d' ORDER BY TIME`, table, start, end)
 
 	var tv []*pb.V4V6Time
-	rows, err := db.Query(query)
+	rows, err := s.db.Query(query)
 	if err != nil {
 		return &pb.MovementTotalsResponse{}, err
 	}
@@ -209,11 +276,115 @@ func getMovementTotalsHelper(m *pb.MovementRequest, db *sql.DB) (*pb.MovementTot
 	}, nil
 }
 
-func getRPKIHelper(db *sql.DB) (*pb.Roas, error) {
+// queryTimeSeries returns the requested INFO columns between two times,
+// with the snapshots in each bucket combined by the database.
+func (s *sqlStore) queryTimeSeries(r *pb.TimeSeriesRequest) (*pb.TimeSeriesResponse, error) {
+	start, end, bucket := r.GetStart(), r.GetEnd(), r.GetBucket()
+	if end == 0 {
+		end = uint64(time.Now().Unix())
+	}
+	if start > end {
+		return nil, fmt.Errorf("start %d is after end %d", start, end)
+	}
+	if bucket == 0 {
+		return nil, fmt.Errorf("bucket must be at least a second")
+	}
+	metrics, err := s.infoColumns(r.GetMetrics())
+	if err != nil {
+		return nil, err
+	}
+
+	// Every bucket starts a whole number of buckets after start. The times
+	// are numbers so are safe to put in the query, which lets the bucket
+	// be grouped on the same way by every database.
+	bucketOf := fmt.Sprintf("TIME - (TIME - %d) %% %d", start, bucket)
+	where := fmt.Sprintf("TIME >= %d AND TIME <= %d", start, end)
+	var query string
+	switch r.GetAggregation() {
+	case pb.TimeSeriesRequest_LAST:
+		// The latest snapshot in each bucket is joined back to INFO.
+		query = fmt.Sprintf(`SELECT B.BUCKET, I.%s FROM INFO I JOIN
+			(SELECT %s AS BUCKET, MAX(TIME) AS LATEST FROM INFO WHERE %s GROUP BY BUCKET) B
+			ON I.TIME = B.LATEST ORDER BY B.BUCKET`,
+			strings.Join(metrics, ", I."), bucketOf, where)
+	case pb.TimeSeriesRequest_MIN, pb.TimeSeriesRequest_MAX, pb.TimeSeriesRequest_AVG:
+		agg := r.GetAggregation().String()
+		columns := make([]string, len(metrics))
+		for i, m := range metrics {
+			columns[i] = fmt.Sprintf("%s(%s)", agg, m)
+		}
+		query = fmt.Sprintf(`SELECT %s AS BUCKET, %s FROM INFO WHERE %s
+			GROUP BY BUCKET ORDER BY BUCKET`, bucketOf, strings.Join(columns, ", "), where)
+	default:
+		return nil, fmt.Errorf("unknown aggregation %v", r.GetAggregation())
+	}
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res pb.TimeSeriesResponse
+	values := make([]sql.NullFloat64, len(metrics))
+	dest := make([]any, len(metrics)+1)
+	for i := range values {
+		dest[i+1] = &values[i]
+	}
+	for rows.Next() {
+		var p pb.TimeSeriesPoint
+		dest[0] = &p.Time
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		p.Values = make([]float64, len(values))
+		for i, v := range values {
+			p.Values[i] = v.Float64
+		}
+		res.Points = append(res.Points, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// infoColumns checks every metric is a column of INFO, returning the column
+// names as the database has them. Metrics are matched ignoring case.
+func (s *sqlStore) infoColumns(metrics []string) ([]string, error) {
+	if len(metrics) == 0 {
+		return nil, fmt.Errorf("no metrics requested")
+	}
+	rows, err := s.db.Query(`SELECT * FROM INFO WHERE 1 = 0`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, m := range metrics {
+		i := slices.IndexFunc(columns, func(c string) bool {
+			return strings.EqualFold(c, m)
+		})
+		// TIME is what's bucketed on, and TWEET is only a flag.
+		if i < 0 || strings.EqualFold(m, "TIME") || strings.EqualFold(m, "TWEET") {
+			return nil, fmt.Errorf("unknown metric %q", m)
+		}
+		names = append(names, columns[i])
+	}
+	return names, nil
+}
+
+func (s *sqlStore) getRPKI() (*pb.Roas, error) {
 	var r pb.Roas
 	query := `select ROAVALIDV4,ROAINVALIDV4,ROAUNKNOWNV4,ROAVALIDV6,ROAINVALIDV6,ROAUNKNOWNV6
 	from INFO ORDER by TIME DESC LIMIT 1`
-	err := db.QueryRow(query).Scan(
+	err := s.db.QueryRow(query).Scan(
 		&r.V4Valid,
 		&r.V4Invalid,
 		&r.V4Unknown,
@@ -227,11 +398,388 @@ func getRPKIHelper(db *sql.DB) (*pb.Roas, error) {
 	return &r, nil
 }
 
-func getAsnameHelper(a *pb.GetAsnameRequest, db *sql.DB) (*pb.GetAsnameResponse, error) {
+// getASPAs returns the ASPA path verification counts of the latest
+// update that carried them.
+func (s *sqlStore) getASPAs() (*pb.Aspas, error) {
+	var a pb.Aspas
+	err := s.db.QueryRow(`SELECT V4_VALID, V4_INVALID, V4_UNKNOWN, V6_VALID, V6_INVALID,
+		V6_UNKNOWN FROM ASPAS ORDER BY TIME DESC LIMIT 1`).Scan(
+		&a.V4Valid,
+		&a.V4Invalid,
+		&a.V4Unknown,
+		&a.V6Valid,
+		&a.V6Invalid,
+		&a.V6Unknown,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// add the community usage of the update. The top communities are a row
+// each, positioned from 1 as the most used.
+func (s *sqlStore) addCommunities(tx *sql.Tx, b *com.BgpUpdate) error {
+	for family, c := range map[int]com.CommunityUse{4: b.Communities4, 6: b.Communities6} {
+		_, err := tx.Exec(s.rebind(`INSERT INTO COMMUNITIES (TIME, FAMILY, STANDARD, EXTENDED,
+			LARGE, NO_EXPORT, NO_ADVERTISE, NO_EXPORT_SUBCONFED, BLACKHOLE,
+			GRACEFUL_SHUTDOWN) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+			b.Time, family, c.Standard, c.Extended, c.Large,
+			c.WellKnown.NoExport, c.WellKnown.NoAdvertise, c.WellKnown.NoExportSubconfed,
+			c.WellKnown.Blackhole, c.WellKnown.GracefulShutdown)
+		if err != nil {
+			return fmt.Errorf("unable to add communities: %w", err)
+		}
+
+		for i, t := range c.Top {
+			_, err := tx.Exec(s.rebind(`INSERT INTO TOP_COMMUNITIES (TIME, FAMILY, POSITION,
+				COMMUNITY, PREFIXES) VALUES (?, ?, ?, ?, ?)`),
+				b.Time, family, i+1, t.Community, t.Prefixes)
+			if err != nil {
+				return fmt.Errorf("unable to add top communities: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// add the state of each peer in the update, keyed by the time of the
+// update and the peer address. The uptime is kept in seconds.
+func (s *sqlStore) addPeers(tx *sql.Tx, b *com.BgpUpdate) error {
+	for _, p := range b.PeerDetails {
+		_, err := tx.Exec(s.rebind(`INSERT INTO PEERS (TIME, ADDRESS, ASN, STATE, UPTIME,
+			V4_RECEIVED, V4_ACCEPTED, V6_RECEIVED, V6_ACCEPTED)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+			b.Time, p.Address, p.ASN, p.State, int64(p.Uptime/time.Second),
+			p.V4Received, p.V4Accepted, p.V6Received, p.V6Accepted)
+		if err != nil {
+			return fmt.Errorf("unable to add peer %s: %w", p.Address, err)
+		}
+	}
+
+	return nil
+}
+
+// add the bogon counts of the update, and every bogon route. The routes
+// keep the order of the update, which is IPv4 first and in address order.
+func (s *sqlStore) addBogons(tx *sql.Tx, b *com.BgpUpdate) error {
+	for family, c := range map[int]com.BogonCount{4: b.Bogons4, 6: b.Bogons6} {
+		_, err := tx.Exec(s.rebind(`INSERT INTO BOGON_COUNTS (TIME, FAMILY, MARTIAN, UNALLOCATED,
+			RESERVED_ASN) VALUES (?, ?, ?, ?, ?)`),
+			b.Time, family, c.Martian, c.Unallocated, c.ReservedASN)
+		if err != nil {
+			return fmt.Errorf("unable to add bogon counts: %w", err)
+		}
+	}
+
+	for i, r := range b.Bogons {
+		_, err := tx.Exec(s.rebind(`INSERT INTO BOGONS (TIME, POSITION, PREFIX, ORIGIN, KIND)
+			VALUES (?, ?, ?, ?, ?)`),
+			b.Time, i+1, r.Prefix, r.Origin, r.Kind)
+		if err != nil {
+			return fmt.Errorf("unable to add bogon %s: %w", r.Prefix, err)
+		}
+	}
+
+	return nil
+}
+
+// add the origin events of the update. An event already stored, as it was
+// seen in an earlier update, only has its last seen time moved on.
+func (s *sqlStore) addOriginEvents(tx *sql.Tx, b *com.BgpUpdate) error {
+	query := `INSERT INTO ORIGIN_EVENTS (KIND, PREFIX, OLD_ORIGIN, NEW_ORIGIN, FIRST_SEEN,
+		LAST_SEEN) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (KIND, PREFIX, OLD_ORIGIN, NEW_ORIGIN, FIRST_SEEN)
+		DO UPDATE SET LAST_SEEN = excluded.LAST_SEEN`
+	if s.mysql {
+		query = `INSERT INTO ORIGIN_EVENTS (KIND, PREFIX, OLD_ORIGIN, NEW_ORIGIN, FIRST_SEEN,
+			LAST_SEEN) VALUES (?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE LAST_SEEN = VALUES(LAST_SEEN)`
+	}
+
+	for _, e := range b.OriginEvents {
+		_, err := tx.Exec(s.rebind(query),
+			e.Kind, e.Prefix, e.OldOrigin, e.NewOrigin, e.FirstSeen, e.LastSeen)
+		if err != nil {
+			return fmt.Errorf("unable to add origin event %s: %w", e.Prefix, err)
+		}
+	}
+
+	return nil
+}
+
+// add the ASPA path verification counts of the update. Collectors without
+// ASPAs loaded send nothing but zeros, which aren't stored.
+func (s *sqlStore) addASPAs(tx *sql.Tx, b *com.BgpUpdate) error {
+	if b.Aspavalid4+b.Aspainvalid4+b.Aspaunknown4+b.Aspavalid6+b.Aspainvalid6+b.Aspaunknown6 == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(s.rebind(`INSERT INTO ASPAS (TIME, V4_VALID, V4_INVALID, V4_UNKNOWN,
+		V6_VALID, V6_INVALID, V6_UNKNOWN) VALUES (?, ?, ?, ?, ?, ?, ?)`),
+		b.Time, b.Aspavalid4, b.Aspainvalid4, b.Aspaunknown4,
+		b.Aspavalid6, b.Aspainvalid6, b.Aspaunknown6)
+	if err != nil {
+		return fmt.Errorf("unable to add ASPA counts: %w", err)
+	}
+	return nil
+}
+
+// getASPaths returns the AS path stats of the latest update.
+func (s *sqlStore) getASPaths() (*pb.AsPathsResponse, error) {
+	var res pb.AsPathsResponse
+	paths := map[int]*com.PathStats{
+		4: {Lengths: make(map[uint32]uint32), Unique: make(map[uint32]uint32)},
+		6: {Lengths: make(map[uint32]uint32), Unique: make(map[uint32]uint32)},
+	}
+
+	err := s.db.QueryRow(`SELECT TIME FROM ASPATH_SHAPE ORDER BY TIME DESC LIMIT 1`).Scan(&res.Time)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve data: %w", err)
+	}
+
+	rows, err := s.db.Query(s.rebind(`SELECT FAMILY, PREPENDED, SETS FROM ASPATH_SHAPE
+		WHERE TIME = ?`), res.Time)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var family int
+		var prepended, sets uint32
+		if err := rows.Scan(&family, &prepended, &sets); err != nil {
+			return nil, err
+		}
+		if p, ok := paths[family]; ok {
+			p.Prepended, p.Sets = prepended, sets
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query(s.rebind(`SELECT FAMILY, LENGTH, PATHS, UNIQUE_PATHS FROM ASPATH_LENGTH
+		WHERE TIME = ?`), res.Time)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var family int
+		var length, count, unique uint32
+		if err := rows.Scan(&family, &length, &count, &unique); err != nil {
+			return nil, err
+		}
+		p, ok := paths[family]
+		if !ok {
+			continue
+		}
+		if count > 0 {
+			p.Lengths[length] = count
+		}
+		if unique > 0 {
+			p.Unique[length] = unique
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	res.AsPaths = &pb.AsPaths{
+		V4: com.PathStatsToProto(*paths[4]),
+		V6: com.PathStatsToProto(*paths[6]),
+	}
+
+	return &res, nil
+}
+
+// getCommunities returns the community usage of the latest update.
+func (s *sqlStore) getCommunities() (*pb.CommunitiesResponse, error) {
+	var res pb.CommunitiesResponse
+	comms := map[int]*com.CommunityUse{4: {}, 6: {}}
+
+	err := s.db.QueryRow(`SELECT TIME FROM COMMUNITIES ORDER BY TIME DESC LIMIT 1`).Scan(&res.Time)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve data: %w", err)
+	}
+
+	rows, err := s.db.Query(s.rebind(`SELECT FAMILY, STANDARD, EXTENDED, LARGE, NO_EXPORT,
+		NO_ADVERTISE, NO_EXPORT_SUBCONFED, BLACKHOLE, GRACEFUL_SHUTDOWN
+		FROM COMMUNITIES WHERE TIME = ?`), res.Time)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var family int
+		var c com.CommunityUse
+		w := &c.WellKnown
+		if err := rows.Scan(&family, &c.Standard, &c.Extended, &c.Large, &w.NoExport,
+			&w.NoAdvertise, &w.NoExportSubconfed, &w.Blackhole, &w.GracefulShutdown); err != nil {
+			return nil, err
+		}
+		if _, ok := comms[family]; ok {
+			comms[family] = &c
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query(s.rebind(`SELECT FAMILY, COMMUNITY, PREFIXES FROM TOP_COMMUNITIES
+		WHERE TIME = ? ORDER BY FAMILY, POSITION`), res.Time)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var family int
+		var t com.CommunityCount
+		if err := rows.Scan(&family, &t.Community, &t.Prefixes); err != nil {
+			return nil, err
+		}
+		if c, ok := comms[family]; ok {
+			c.Top = append(c.Top, t)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	res.Communities = &pb.Communities{
+		V4: com.CommunityUseToProto(*comms[4]),
+		V6: com.CommunityUseToProto(*comms[6]),
+	}
+
+	return &res, nil
+}
+
+// getPeerHistory returns every snapshot of a single peer between the
+// requested times, oldest first.
+func (s *sqlStore) getPeerHistory(r *pb.PeerHistoryRequest) (*pb.PeerHistoryResponse, error) {
+	// Addresses are stored in their canonical form.
+	ip := net.ParseIP(r.GetAddress())
+	if ip == nil {
+		return nil, fmt.Errorf("invalid peer address %q", r.GetAddress())
+	}
+	end := r.GetEnd()
+	if end == 0 {
+		end = math.MaxInt64
+	}
+
+	rows, err := s.db.Query(s.rebind(`SELECT TIME, ADDRESS, ASN, STATE, UPTIME, V4_RECEIVED,
+		V4_ACCEPTED, V6_RECEIVED, V6_ACCEPTED FROM PEERS
+		WHERE ADDRESS = ? AND TIME >= ? AND TIME <= ? ORDER BY TIME`),
+		ip.String(), r.GetStart(), end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res pb.PeerHistoryResponse
+	for rows.Next() {
+		var s pb.PeerSnapshot
+		var p pb.PeerDetail
+		if err := rows.Scan(&s.Time, &p.Address, &p.Asn, &p.State, &p.Uptime, &p.V4Received,
+			&p.V4Accepted, &p.V6Received, &p.V6Accepted); err != nil {
+			return nil, err
+		}
+		s.Peer = &p
+		res.Snapshots = append(res.Snapshots, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// getBogons returns the bogon counts and routes of the latest update.
+func (s *sqlStore) getBogons() (*pb.BogonsResponse, error) {
+	var res pb.BogonsResponse
+	counts := map[int]*com.BogonCount{4: {}, 6: {}}
+
+	err := s.db.QueryRow(`SELECT TIME FROM BOGON_COUNTS ORDER BY TIME DESC LIMIT 1`).Scan(&res.Time)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve data: %w", err)
+	}
+
+	rows, err := s.db.Query(s.rebind(`SELECT FAMILY, MARTIAN, UNALLOCATED, RESERVED_ASN
+		FROM BOGON_COUNTS WHERE TIME = ?`), res.Time)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var family int
+		var c com.BogonCount
+		if err := rows.Scan(&family, &c.Martian, &c.Unallocated, &c.ReservedASN); err != nil {
+			return nil, err
+		}
+		if _, ok := counts[family]; ok {
+			counts[family] = &c
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query(s.rebind(`SELECT PREFIX, ORIGIN, KIND FROM BOGONS
+		WHERE TIME = ? ORDER BY POSITION`), res.Time)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var routes []com.Bogon
+	for rows.Next() {
+		var r com.Bogon
+		if err := rows.Scan(&r.Prefix, &r.Origin, &r.Kind); err != nil {
+			return nil, err
+		}
+		routes = append(routes, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	res.Bogons = com.BogonsToProto(*counts[4], *counts[6], routes)
+
+	return &res, nil
+}
+
+// getOriginEvents returns every origin event last seen at or after the
+// requested time, oldest first.
+func (s *sqlStore) getOriginEvents(r *pb.OriginEventsRequest) (*pb.OriginEventsResponse, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT KIND, PREFIX, OLD_ORIGIN, NEW_ORIGIN, FIRST_SEEN,
+		LAST_SEEN FROM ORIGIN_EVENTS WHERE LAST_SEEN >= ?
+		ORDER BY FIRST_SEEN, KIND, PREFIX, OLD_ORIGIN, NEW_ORIGIN`), r.GetSince())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res pb.OriginEventsResponse
+	for rows.Next() {
+		var e com.OriginEvent
+		if err := rows.Scan(&e.Kind, &e.Prefix, &e.OldOrigin, &e.NewOrigin,
+			&e.FirstSeen, &e.LastSeen); err != nil {
+			return nil, err
+		}
+		res.Events = append(res.Events, com.OriginEventToProto(e))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+func (s *sqlStore) getAsname(a *pb.GetAsnameRequest) (*pb.GetAsnameResponse, error) {
 	var n pb.GetAsnameResponse
 	query := fmt.Sprintf(`select ASNAME, LOCALE from ASNUMNAME WHERE ASNUMBER = '%d'`,
 		a.GetAsNumber())
-	err := db.QueryRow(query).Scan(
+	err := s.db.QueryRow(query).Scan(
 		&n.AsName,
 		&n.AsLocale,
 	)
@@ -250,10 +798,10 @@ func getAsnameHelper(a *pb.GetAsnameRequest, db *sql.DB) (*pb.GetAsnameResponse,
 	}
 }
 
-func getAsnamesHelper(db *sql.DB) (*pb.GetAsnamesResponse, error) {
+func (s *sqlStore) getAsnames() (*pb.GetAsnamesResponse, error) {
 	var n pb.GetAsnamesResponse
 	query := fmt.Sprintf(`select ASNUMBER, ASNAME, LOCALE from ASNUMNAME`)
-	rows, err := db.Query(query)
+	rows, err := s.db.Query(query)
 	if err != nil {
 		return &n, err
 	}
@@ -276,28 +824,30 @@ func getAsnamesHelper(db *sql.DB) (*pb.GetAsnamesResponse, error) {
 	return &n, nil
 }
 
-func updateASNHelper(asn *pb.AsnamesRequest, db *sql.DB) (*pb.Result, error) {
-	// Temp table may be sitting around from a failed attempt.
-	stmt, _ := db.Prepare(`DROP TABLE IF EXISTS ASNUMNAME_NEW`)
-	stmt.Exec()
-
-	// Create temporary holding table.
-	stmt, _ = db.Prepare(`CREATE TABLE ASNUMNAME_NEW (
-  				ASNUMBER INTEGER NOT NULL,
-  				ASNAME TEXT NOT NULL,
-  				LOCALE TEXT DEFAULT NULL)`)
-
-	_, err := stmt.Exec()
+func (s *sqlStore) updateASN(asn *pb.AsnamesRequest) (*pb.Result, error) {
+	// Swap every name in a single transaction, so readers see either the
+	// old names or the new ones. The table itself belongs to the migrations.
+	tx, err := s.db.Begin()
 	if err != nil {
 		return &pb.Result{
 			Success: false,
-		}, fmt.Errorf("unable to create temp database: %w", err)
+		}, fmt.Errorf("unable to start transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	// Dump the new values into the new temp table.
-	tx, _ := db.Begin()
-	stmt, _ = tx.Prepare(`INSERT INTO ASNUMNAME_NEW (
-		ASNUMBER, ASNAME, LOCALE) VALUES (?, ?, ?)`)
+	if _, err := tx.Exec(`DELETE FROM ASNUMNAME`); err != nil {
+		return &pb.Result{
+			Success: false,
+		}, fmt.Errorf("unable to clear AS names: %w", err)
+	}
+	stmt, err := tx.Prepare(s.rebind(`INSERT INTO ASNUMNAME (
+		ASNUMBER, ASNAME, LOCALE) VALUES (?, ?, ?)`))
+	if err != nil {
+		return &pb.Result{
+			Success: false,
+		}, fmt.Errorf("unable to prepare statement: %w", err)
+	}
+	defer stmt.Close()
 	for _, as := range asn.GetAsnNames() {
 		_, err := stmt.Exec(as.GetAsNumber(), as.GetAsName(), as.GetAsLocale())
 		if err != nil {
@@ -312,26 +862,16 @@ func updateASNHelper(asn *pb.AsnamesRequest, db *sql.DB) (*pb.Result, error) {
 		}, fmt.Errorf("unable to complete transaction: %w", err)
 	}
 
-	// Now rename and shift in order to only have one table.
-	tx, _ = db.Begin()
-	tx.Exec(`DROP TABLE IF EXISTS ASNUMNAME`)
-	tx.Exec(`ALTER TABLE ASNUMNAME_NEW RENAME TO ASNUMNAME`)
-	if err := tx.Commit(); err != nil {
-		return &pb.Result{
-			Success: false,
-		}, fmt.Errorf("unable to complete transaction: %w", err)
-	}
-
 	return &pb.Result{
 		Success: true,
 	}, nil
 }
 
-func updateTweetBitHelper(t uint64, db *sql.DB) (*pb.Result, error) {
-	if db == nil {
+func (s *sqlStore) updateTweetBit(t uint64) (*pb.Result, error) {
+	if s.db == nil {
 		log.Fatalf("db object is nil")
 	}
-	_, err := db.Exec(fmt.Sprintf(`UPDATE INFO SET TWEET = 1 WHERE TIME = %d`, t))
+	_, err := s.db.Exec(fmt.Sprintf(`UPDATE INFO SET TWEET = 1 WHERE TIME = %d`, t))
 	if err != nil {
 		return &pb.Result{
 			Success: false,
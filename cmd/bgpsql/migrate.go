@@ -0,0 +1,284 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the schema of every database, as numbered up and
+// down SQL files, named like 0002_add_thing.up.sql, in a directory per
+// dialect. A new column or table is a new pair of files for every dialect.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migration is a single schema change, and how to undo it.
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// schemaVersionTable records the migrations applied to a database, a row
+// per version.
+const schemaVersionTable = `CREATE TABLE IF NOT EXISTS SCHEMA_VERSION (
+	VERSION INTEGER NOT NULL,
+	NAME VARCHAR(64) NOT NULL,
+	APPLIED BIGINT NOT NULL,
+	PRIMARY KEY (VERSION)
+)`
+
+// loadMigrations returns the migrations of dialect, in order. Versions
+// must count up from 1 without gaps, and each needs both an up and a down.
+func loadMigrations(dialect string) ([]migration, error) {
+	dir := path.Join("migrations", dialect)
+	files, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for %s: %w", dialect, err)
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, f := range files {
+		base, ok := strings.CutSuffix(f.Name(), ".sql")
+		if !ok {
+			continue
+		}
+		base, direction, _ := strings.Cut(base, ".")
+		num, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("badly named migration %s", f.Name())
+		}
+		b, err := migrationFiles.ReadFile(path.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+		}
+		if m.name != name {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.name, name)
+		}
+		switch direction {
+		case "up":
+			m.up = string(b)
+		case "down":
+			m.down = string(b)
+		default:
+			return nil, fmt.Errorf("migration %s is neither up nor down", f.Name())
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for v := 1; v <= len(byVersion); v++ {
+		m, ok := byVersion[v]
+		if !ok {
+			return nil, fmt.Errorf("%s migration %d is missing", dialect, v)
+		}
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("%s migration %d needs both an up and a down", dialect, v)
+		}
+		migrations = append(migrations, *m)
+	}
+	return migrations, nil
+}
+
+// splitStatements returns the statements in a migration, which end with a
+// semicolon at the end of a line. Not every driver runs several at once.
+func splitStatements(query string) []string {
+	var stmts []string
+	var b strings.Builder
+	code := false
+	for line := range strings.Lines(query) {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" && !code {
+			continue
+		}
+		if !strings.HasPrefix(trimmed, "--") {
+			code = code || trimmed != ""
+		}
+		b.WriteString(line)
+		if strings.HasSuffix(trimmed, ";") && code {
+			stmts = append(stmts, strings.TrimSuffix(strings.TrimSpace(b.String()), ";"))
+			b.Reset()
+			code = false
+		}
+	}
+	if code {
+		stmts = append(stmts, strings.TrimSpace(b.String()))
+	}
+	return stmts
+}
+
+// schemaVersion returns the latest migration applied to db, 0 if none.
+func schemaVersion(db *sql.DB) (int, error) {
+	if _, err := db.Exec(schemaVersionTable); err != nil {
+		return 0, fmt.Errorf("unable to create schema version table: %w", err)
+	}
+	var version sql.NullInt64
+	if err := db.QueryRow(`SELECT MAX(VERSION) FROM SCHEMA_VERSION`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("unable to read schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
+
+// migrate moves the schema of db up or down to target, applying each
+// migration in a transaction of its own. MySQL commits every change to a
+// table as it's made, so a failed migration there may need tidying by hand.
+func migrate(db *sql.DB, dialect string, target int) error {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return err
+	}
+	if target < 0 || target > len(migrations) {
+		return fmt.Errorf("no migration %d, the latest is %d", target, len(migrations))
+	}
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("database schema is at version %d, newer than the latest known %d", current, len(migrations))
+	}
+	s := sqlStore{numbered: dialect == "postgres"}
+
+	for current < target {
+		m := migrations[current]
+		log.Printf("Migrating %s up to %d_%s", dialect, m.version, m.name)
+		err := applyMigration(db, m.up, func(tx *sql.Tx) error {
+			_, err := tx.Exec(s.rebind(`INSERT INTO SCHEMA_VERSION (VERSION, NAME, APPLIED) VALUES (?, ?, ?)`),
+				m.version, m.name, time.Now().Unix())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("unable to migrate up to %d_%s: %w", m.version, m.name, err)
+		}
+		current++
+	}
+	for current > target {
+		m := migrations[current-1]
+		log.Printf("Migrating %s down from %d_%s", dialect, m.version, m.name)
+		err := applyMigration(db, m.down, func(tx *sql.Tx) error {
+			_, err := tx.Exec(s.rebind(`DELETE FROM SCHEMA_VERSION WHERE VERSION = ?`), m.version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("unable to migrate down from %d_%s: %w", m.version, m.name, err)
+		}
+		current--
+	}
+	return nil
+}
+
+// migrateLatest applies every migration of dialect db doesn't have yet.
+func migrateLatest(db *sql.DB, dialect string) error {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return err
+	}
+	return migrate(db, dialect, len(migrations))
+}
+
+// applyMigration runs the statements of a migration, then record, in a
+// single transaction.
+func applyMigration(db *sql.DB, query string, record func(*sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range splitStatements(query) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if err := record(tx); err != nil {
+		return fmt.Errorf("unable to record schema version: %w", err)
+	}
+	return tx.Commit()
+}
+
+// checkSchema returns an error unless every migration of dialect has been
+// applied to db.
+func checkSchema(db *sql.DB, dialect string) error {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return err
+	}
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if current != len(migrations) {
+		return fmt.Errorf("database schema is at version %d rather than %d, run bgpsql migrate", current, len(migrations))
+	}
+	return nil
+}
+
+// runMigrate is the migrate subcommand. With no arguments, or just up, it
+// applies every migration. Given a version, up or down stop there, with
+// down going back a single migration otherwise. Status prints the version
+// the database is at.
+func runMigrate(cfg config, args []string) error {
+	db, dialect, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return err
+	}
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	if len(args) > 2 {
+		return errors.New("usage: bgpsql migrate [up|down|status] [version]")
+	}
+
+	var target int
+	switch command {
+	case "status":
+		fmt.Printf("%s schema is at version %d of %d\n", dialect, current, len(migrations))
+		return nil
+	case "up":
+		target = len(migrations)
+	case "down":
+		target = max(current-1, 0)
+	default:
+		return fmt.Errorf("unknown migrate command: %s", command)
+	}
+	if len(args) == 2 {
+		if target, err = strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if command == "up" && target < current || command == "down" && target > current {
+			return fmt.Errorf("can't migrate %s from version %d to %d", command, current, target)
+		}
+	}
+
+	if err := migrate(db, dialect, target); err != nil {
+		return err
+	}
+	fmt.Printf("%s schema is at version %d of %d\n", dialect, target, len(migrations))
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	// Every dialect has the same migrations, so none is left behind.
+	mysql, err := loadMigrations("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dialect := range []string{"postgres", "sqlite"} {
+		migrations, err := loadMigrations(dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migrations) != len(mysql) {
+			t.Fatalf("%s: Got %d migrations, Wanted %d", dialect, len(migrations), len(mysql))
+		}
+		for i, m := range migrations {
+			if m.version != i+1 || m.name != mysql[i].name {
+				t.Errorf("%s: Got %d_%s, Wanted %d_%s", dialect, m.version, m.name, i+1, mysql[i].name)
+			}
+		}
+	}
+	if _, err := loadMigrations("oracle"); err == nil {
+		t.Errorf("oracle: expected an error")
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	query := `-- A comment on its own.
+
+CREATE TABLE A (
+    B int(10) NOT NULL -- trailing
+);
+-- Between statements.
+CREATE FUNCTION f() RETURNS BIGINT LANGUAGE SQL AS
+    $$ SELECT 1 $$;
+
+DROP TABLE C
+`
+	want := []string{
+		"-- A comment on its own.\nCREATE TABLE A (\n    B int(10) NOT NULL -- trailing\n)",
+		"-- Between statements.\nCREATE FUNCTION f() RETURNS BIGINT LANGUAGE SQL AS\n    $$ SELECT 1 $$",
+		"DROP TABLE C",
+	}
+	if got := splitStatements(query); !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %q, Wanted %q", got, want)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	name := t.TempDir() + "/bgpinfo.db"
+	db, err := sql.Open("sqlite3", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	migrations, err := loadMigrations("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := len(migrations)
+
+	tables := func() int {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'
+			AND name != 'SCHEMA_VERSION'`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	version := func() int {
+		v, err := schemaVersion(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	if err := checkSchema(db, "sqlite"); err == nil {
+		t.Errorf("an empty database shouldn't pass")
+	}
+	if err := migrateLatest(db, "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	if got := version(); got != latest {
+		t.Errorf("Got %d, Wanted %d", got, latest)
+	}
+	if err := checkSchema(db, "sqlite"); err != nil {
+		t.Error(err)
+	}
+	if tables() == 0 {
+		t.Errorf("no tables were created")
+	}
+	// Applying them again does nothing.
+	if err := migrateLatest(db, "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrate(db, "sqlite", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := version(); got != 0 {
+		t.Errorf("Got %d, Wanted %d", got, 0)
+	}
+	if got := tables(); got != 0 {
+		t.Errorf("Got %d tables, Wanted %d", got, 0)
+	}
+	for _, target := range []int{-1, latest + 1} {
+		if err := migrate(db, "sqlite", target); err == nil {
+			t.Errorf("%d: expected an error", target)
+		}
+	}
+
+	// A database from a newer bgpsql is left alone.
+	if _, err := db.Exec(`INSERT INTO SCHEMA_VERSION (VERSION, NAME, APPLIED) VALUES (?, 'future', 0)`, latest+1); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(db, "sqlite", latest); err == nil {
+		t.Errorf("expected an error migrating a newer schema")
+	}
+}
+
+func TestRunMigrate(t *testing.T) {
+	cfg := config{driver: "sqlite", dbname: t.TempDir() + "/bgpinfo.db"}
+	migrations, err := loadMigrations("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := len(migrations)
+
+	tests := []struct {
+		args    []string
+		version int
+		wantErr bool
+	}{
+		{args: []string{"status"}, version: 0},
+		{args: nil, version: latest},
+		{args: []string{"down"}, version: latest - 1},
+		{args: []string{"down", "0"}, version: 0},
+		{args: []string{"up", "1"}, version: 1},
+		{args: []string{"down", "2"}, version: 1, wantErr: true},
+		{args: []string{"up", "x"}, version: 1, wantErr: true},
+		{args: []string{"sideways"}, version: 1, wantErr: true},
+		{args: []string{"up", "1", "2"}, version: 1, wantErr: true},
+		{args: []string{"up"}, version: latest},
+	}
+	for _, tc := range tests {
+		err := runMigrate(cfg, tc.args)
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("%q: Got %v, Wanted error %t", tc.args, err, tc.wantErr)
+		}
+		db, err := openSQLite(cfg.dbname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := schemaVersion(db)
+		db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.version {
+			t.Errorf("%q: Got %d, Wanted %d", tc.args, got, tc.version)
+		}
+	}
+}
+
+func TestMigrateMasks(t *testing.T) {
+	db, err := sql.Open("sqlite3", t.TempDir()+"/bgpinfo.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// A row from before masks had their own table.
+	if err := migrate(db, "sqlite", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO INFO (TIME, V4COUNT, V6COUNT, V4_08, V4_24, V6_32, V6_48)
+		VALUES (100, 10, 20, 1, 9, 0, 19)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrate(db, "sqlite", 2); err != nil {
+		t.Fatal(err)
+	}
+	store := &sqlStore{db: db}
+	v4, v6, err := store.getMasks(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want4 := map[uint32]uint32{8: 1, 24: 9}
+	want6 := map[uint32]uint32{48: 19}
+	if !reflect.DeepEqual(v4, want4) || !reflect.DeepEqual(v6, want6) {
+		t.Errorf("Got %v %v, Wanted %v %v", v4, v6, want4, want6)
+	}
+
+	// Going back puts the counts in their columns again.
+	if err := migrate(db, "sqlite", 1); err != nil {
+		t.Fatal(err)
+	}
+	var v4_08, v4_24, v6_32, v6_48 uint32
+	if err := db.QueryRow(`SELECT V4_08, V4_24, V6_32, V6_48 FROM INFO WHERE TIME = 100`).Scan(
+		&v4_08, &v4_24, &v6_32, &v6_48); err != nil {
+		t.Fatal(err)
+	}
+	if v4_08 != 1 || v4_24 != 9 || v6_32 != 0 || v6_48 != 19 {
+		t.Errorf("Got %d %d %d %d, Wanted 1 9 0 19", v4_08, v4_24, v6_32, v6_48)
+	}
+}
@@ -0,0 +1,124 @@
+-- Masks outside /8 to /24 and /8 to /48 have no column to go back to, and
+-- are lost.
+
+ALTER TABLE INFO
+    ADD COLUMN V4_08 int(10) DEFAULT NULL,
+    ADD COLUMN V4_09 int(10) DEFAULT NULL,
+    ADD COLUMN V4_10 int(10) DEFAULT NULL,
+    ADD COLUMN V4_11 int(10) DEFAULT NULL,
+    ADD COLUMN V4_12 int(10) DEFAULT NULL,
+    ADD COLUMN V4_13 int(10) DEFAULT NULL,
+    ADD COLUMN V4_14 int(10) DEFAULT NULL,
+    ADD COLUMN V4_15 int(10) DEFAULT NULL,
+    ADD COLUMN V4_16 int(10) DEFAULT NULL,
+    ADD COLUMN V4_17 int(10) DEFAULT NULL,
+    ADD COLUMN V4_18 int(10) DEFAULT NULL,
+    ADD COLUMN V4_19 int(10) DEFAULT NULL,
+    ADD COLUMN V4_20 int(10) DEFAULT NULL,
+    ADD COLUMN V4_21 int(10) DEFAULT NULL,
+    ADD COLUMN V4_22 int(10) DEFAULT NULL,
+    ADD COLUMN V4_23 int(10) DEFAULT NULL,
+    ADD COLUMN V4_24 int(10) DEFAULT NULL,
+    ADD COLUMN V6_08 int(7) DEFAULT NULL,
+    ADD COLUMN V6_09 int(7) DEFAULT NULL,
+    ADD COLUMN V6_10 int(7) DEFAULT NULL,
+    ADD COLUMN V6_11 int(7) DEFAULT NULL,
+    ADD COLUMN V6_12 int(7) DEFAULT NULL,
+    ADD COLUMN V6_13 int(7) DEFAULT NULL,
+    ADD COLUMN V6_14 int(7) DEFAULT NULL,
+    ADD COLUMN V6_15 int(7) DEFAULT NULL,
+    ADD COLUMN V6_16 int(7) DEFAULT NULL,
+    ADD COLUMN V6_17 int(7) DEFAULT NULL,
+    ADD COLUMN V6_18 int(7) DEFAULT NULL,
+    ADD COLUMN V6_19 int(7) DEFAULT NULL,
+    ADD COLUMN V6_20 int(7) DEFAULT NULL,
+    ADD COLUMN V6_21 int(7) DEFAULT NULL,
+    ADD COLUMN V6_22 int(7) DEFAULT NULL,
+    ADD COLUMN V6_23 int(7) DEFAULT NULL,
+    ADD COLUMN V6_24 int(7) DEFAULT NULL,
+    ADD COLUMN V6_25 int(7) DEFAULT NULL,
+    ADD COLUMN V6_26 int(7) DEFAULT NULL,
+    ADD COLUMN V6_27 int(7) DEFAULT NULL,
+    ADD COLUMN V6_28 int(7) DEFAULT NULL,
+    ADD COLUMN V6_29 int(7) DEFAULT NULL,
+    ADD COLUMN V6_30 int(7) DEFAULT NULL,
+    ADD COLUMN V6_31 int(7) DEFAULT NULL,
+    ADD COLUMN V6_32 int(7) DEFAULT NULL,
+    ADD COLUMN V6_33 int(7) DEFAULT NULL,
+    ADD COLUMN V6_34 int(7) DEFAULT NULL,
+    ADD COLUMN V6_35 int(7) DEFAULT NULL,
+    ADD COLUMN V6_36 int(7) DEFAULT NULL,
+    ADD COLUMN V6_37 int(7) DEFAULT NULL,
+    ADD COLUMN V6_38 int(7) DEFAULT NULL,
+    ADD COLUMN V6_39 int(7) DEFAULT NULL,
+    ADD COLUMN V6_40 int(7) DEFAULT NULL,
+    ADD COLUMN V6_41 int(7) DEFAULT NULL,
+    ADD COLUMN V6_42 int(7) DEFAULT NULL,
+    ADD COLUMN V6_43 int(7) DEFAULT NULL,
+    ADD COLUMN V6_44 int(7) DEFAULT NULL,
+    ADD COLUMN V6_45 int(7) DEFAULT NULL,
+    ADD COLUMN V6_46 int(7) DEFAULT NULL,
+    ADD COLUMN V6_47 int(7) DEFAULT NULL,
+    ADD COLUMN V6_48 int(7) DEFAULT NULL;
+
+UPDATE INFO SET
+    V4_08 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 4 AND LENGTH = 8), 0),
+    V4_09 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 4 AND LENGTH = 9), 0),
+    V4_10 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 4 AND LENGTH = 10), 0),
+    V4_11 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 4 AND LENGTH = 11), 0),
+    V4_12 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 4 AND LENGTH = 12), 0),
+    V4_13 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 4 AND LENGTH = 13), 0),
+    V4_14 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 4 AND LENGTH = 14), 0),
+    V4_15 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 4 AND LENGTH = 15), 0),
+    V4_16 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 4 AND LENGTH = 16), 0),
+    V4_17 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 4 AND LENGTH = 17), 0),
+    V4_18 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 4 AND LENGTH = 18), 0),
+    V4_19 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 4 AND LENGTH = 19), 0),
+    V4_20 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 4 AND LENGTH = 20), 0),
+    V4_21 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 4 AND LENGTH = 21), 0),
+    V4_22 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 4 AND LENGTH = 22), 0),
+    V4_23 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 4 AND LENGTH = 23), 0),
+    V4_24 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 4 AND LENGTH = 24), 0),
+    V6_08 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 8), 0),
+    V6_09 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 9), 0),
+    V6_10 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 10), 0),
+    V6_11 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 11), 0),
+    V6_12 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 12), 0),
+    V6_13 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 13), 0),
+    V6_14 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 14), 0),
+    V6_15 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 15), 0),
+    V6_16 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 16), 0),
+    V6_17 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 17), 0),
+    V6_18 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 18), 0),
+    V6_19 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 19), 0),
+    V6_20 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 20), 0),
+    V6_21 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 21), 0),
+    V6_22 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 22), 0),
+    V6_23 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 23), 0),
+    V6_24 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 24), 0),
+    V6_25 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 25), 0),
+    V6_26 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 26), 0),
+    V6_27 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 27), 0),
+    V6_28 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 28), 0),
+    V6_29 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 29), 0),
+    V6_30 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 30), 0),
+    V6_31 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 31), 0),
+    V6_32 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 32), 0),
+    V6_33 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 33), 0),
+    V6_34 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 34), 0),
+    V6_35 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 35), 0),
+    V6_36 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 36), 0),
+    V6_37 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 37), 0),
+    V6_38 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 38), 0),
+    V6_39 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 39), 0),
+    V6_40 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 40), 0),
+    V6_41 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 41), 0),
+    V6_42 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 42), 0),
+    V6_43 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 43), 0),
+    V6_44 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 44), 0),
+    V6_45 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 45), 0),
+    V6_46 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 46), 0),
+    V6_47 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 47), 0),
+    V6_48 = COALESCE((SELECT PREFIXES FROM MASKS WHERE MASKS.TIME = INFO.TIME AND FAMILY = 6 AND LENGTH = 48), 0);
+
+DROP TABLE MASKS;
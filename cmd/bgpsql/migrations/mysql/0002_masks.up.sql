@@ -0,0 +1,187 @@
+-- Mask counts move from a column per prefix length in INFO to a row per
+-- length in MASKS, so that every length can be kept.
+
+CREATE TABLE MASKS (
+    TIME int(12) NOT NULL,
+    FAMILY int(1) NOT NULL,
+    LENGTH int(3) NOT NULL,
+    PREFIXES int(10) NOT NULL,
+    PRIMARY KEY (TIME, FAMILY, LENGTH)
+);
+
+INSERT INTO MASKS (TIME, FAMILY, LENGTH, PREFIXES)
+SELECT TIME, 4, 8, V4_08 FROM INFO WHERE V4_08 > 0
+UNION ALL
+SELECT TIME, 4, 9, V4_09 FROM INFO WHERE V4_09 > 0
+UNION ALL
+SELECT TIME, 4, 10, V4_10 FROM INFO WHERE V4_10 > 0
+UNION ALL
+SELECT TIME, 4, 11, V4_11 FROM INFO WHERE V4_11 > 0
+UNION ALL
+SELECT TIME, 4, 12, V4_12 FROM INFO WHERE V4_12 > 0
+UNION ALL
+SELECT TIME, 4, 13, V4_13 FROM INFO WHERE V4_13 > 0
+UNION ALL
+SELECT TIME, 4, 14, V4_14 FROM INFO WHERE V4_14 > 0
+UNION ALL
+SELECT TIME, 4, 15, V4_15 FROM INFO WHERE V4_15 > 0
+UNION ALL
+SELECT TIME, 4, 16, V4_16 FROM INFO WHERE V4_16 > 0
+UNION ALL
+SELECT TIME, 4, 17, V4_17 FROM INFO WHERE V4_17 > 0
+UNION ALL
+SELECT TIME, 4, 18, V4_18 FROM INFO WHERE V4_18 > 0
+UNION ALL
+SELECT TIME, 4, 19, V4_19 FROM INFO WHERE V4_19 > 0
+UNION ALL
+SELECT TIME, 4, 20, V4_20 FROM INFO WHERE V4_20 > 0
+UNION ALL
+SELECT TIME, 4, 21, V4_21 FROM INFO WHERE V4_21 > 0
+UNION ALL
+SELECT TIME, 4, 22, V4_22 FROM INFO WHERE V4_22 > 0
+UNION ALL
+SELECT TIME, 4, 23, V4_23 FROM INFO WHERE V4_23 > 0
+UNION ALL
+SELECT TIME, 4, 24, V4_24 FROM INFO WHERE V4_24 > 0
+UNION ALL
+SELECT TIME, 6, 8, V6_08 FROM INFO WHERE V6_08 > 0
+UNION ALL
+SELECT TIME, 6, 9, V6_09 FROM INFO WHERE V6_09 > 0
+UNION ALL
+SELECT TIME, 6, 10, V6_10 FROM INFO WHERE V6_10 > 0
+UNION ALL
+SELECT TIME, 6, 11, V6_11 FROM INFO WHERE V6_11 > 0
+UNION ALL
+SELECT TIME, 6, 12, V6_12 FROM INFO WHERE V6_12 > 0
+UNION ALL
+SELECT TIME, 6, 13, V6_13 FROM INFO WHERE V6_13 > 0
+UNION ALL
+SELECT TIME, 6, 14, V6_14 FROM INFO WHERE V6_14 > 0
+UNION ALL
+SELECT TIME, 6, 15, V6_15 FROM INFO WHERE V6_15 > 0
+UNION ALL
+SELECT TIME, 6, 16, V6_16 FROM INFO WHERE V6_16 > 0
+UNION ALL
+SELECT TIME, 6, 17, V6_17 FROM INFO WHERE V6_17 > 0
+UNION ALL
+SELECT TIME, 6, 18, V6_18 FROM INFO WHERE V6_18 > 0
+UNION ALL
+SELECT TIME, 6, 19, V6_19 FROM INFO WHERE V6_19 > 0
+UNION ALL
+SELECT TIME, 6, 20, V6_20 FROM INFO WHERE V6_20 > 0
+UNION ALL
+SELECT TIME, 6, 21, V6_21 FROM INFO WHERE V6_21 > 0
+UNION ALL
+SELECT TIME, 6, 22, V6_22 FROM INFO WHERE V6_22 > 0
+UNION ALL
+SELECT TIME, 6, 23, V6_23 FROM INFO WHERE V6_23 > 0
+UNION ALL
+SELECT TIME, 6, 24, V6_24 FROM INFO WHERE V6_24 > 0
+UNION ALL
+SELECT TIME, 6, 25, V6_25 FROM INFO WHERE V6_25 > 0
+UNION ALL
+SELECT TIME, 6, 26, V6_26 FROM INFO WHERE V6_26 > 0
+UNION ALL
+SELECT TIME, 6, 27, V6_27 FROM INFO WHERE V6_27 > 0
+UNION ALL
+SELECT TIME, 6, 28, V6_28 FROM INFO WHERE V6_28 > 0
+UNION ALL
+SELECT TIME, 6, 29, V6_29 FROM INFO WHERE V6_29 > 0
+UNION ALL
+SELECT TIME, 6, 30, V6_30 FROM INFO WHERE V6_30 > 0
+UNION ALL
+SELECT TIME, 6, 31, V6_31 FROM INFO WHERE V6_31 > 0
+UNION ALL
+SELECT TIME, 6, 32, V6_32 FROM INFO WHERE V6_32 > 0
+UNION ALL
+SELECT TIME, 6, 33, V6_33 FROM INFO WHERE V6_33 > 0
+UNION ALL
+SELECT TIME, 6, 34, V6_34 FROM INFO WHERE V6_34 > 0
+UNION ALL
+SELECT TIME, 6, 35, V6_35 FROM INFO WHERE V6_35 > 0
+UNION ALL
+SELECT TIME, 6, 36, V6_36 FROM INFO WHERE V6_36 > 0
+UNION ALL
+SELECT TIME, 6, 37, V6_37 FROM INFO WHERE V6_37 > 0
+UNION ALL
+SELECT TIME, 6, 38, V6_38 FROM INFO WHERE V6_38 > 0
+UNION ALL
+SELECT TIME, 6, 39, V6_39 FROM INFO WHERE V6_39 > 0
+UNION ALL
+SELECT TIME, 6, 40, V6_40 FROM INFO WHERE V6_40 > 0
+UNION ALL
+SELECT TIME, 6, 41, V6_41 FROM INFO WHERE V6_41 > 0
+UNION ALL
+SELECT TIME, 6, 42, V6_42 FROM INFO WHERE V6_42 > 0
+UNION ALL
+SELECT TIME, 6, 43, V6_43 FROM INFO WHERE V6_43 > 0
+UNION ALL
+SELECT TIME, 6, 44, V6_44 FROM INFO WHERE V6_44 > 0
+UNION ALL
+SELECT TIME, 6, 45, V6_45 FROM INFO WHERE V6_45 > 0
+UNION ALL
+SELECT TIME, 6, 46, V6_46 FROM INFO WHERE V6_46 > 0
+UNION ALL
+SELECT TIME, 6, 47, V6_47 FROM INFO WHERE V6_47 > 0
+UNION ALL
+SELECT TIME, 6, 48, V6_48 FROM INFO WHERE V6_48 > 0;
+
+ALTER TABLE INFO
+    DROP COLUMN V4_08,
+    DROP COLUMN V4_09,
+    DROP COLUMN V4_10,
+    DROP COLUMN V4_11,
+    DROP COLUMN V4_12,
+    DROP COLUMN V4_13,
+    DROP COLUMN V4_14,
+    DROP COLUMN V4_15,
+    DROP COLUMN V4_16,
+    DROP COLUMN V4_17,
+    DROP COLUMN V4_18,
+    DROP COLUMN V4_19,
+    DROP COLUMN V4_20,
+    DROP COLUMN V4_21,
+    DROP COLUMN V4_22,
+    DROP COLUMN V4_23,
+    DROP COLUMN V4_24,
+    DROP COLUMN V6_08,
+    DROP COLUMN V6_09,
+    DROP COLUMN V6_10,
+    DROP COLUMN V6_11,
+    DROP COLUMN V6_12,
+    DROP COLUMN V6_13,
+    DROP COLUMN V6_14,
+    DROP COLUMN V6_15,
+    DROP COLUMN V6_16,
+    DROP COLUMN V6_17,
+    DROP COLUMN V6_18,
+    DROP COLUMN V6_19,
+    DROP COLUMN V6_20,
+    DROP COLUMN V6_21,
+    DROP COLUMN V6_22,
+    DROP COLUMN V6_23,
+    DROP COLUMN V6_24,
+    DROP COLUMN V6_25,
+    DROP COLUMN V6_26,
+    DROP COLUMN V6_27,
+    DROP COLUMN V6_28,
+    DROP COLUMN V6_29,
+    DROP COLUMN V6_30,
+    DROP COLUMN V6_31,
+    DROP COLUMN V6_32,
+    DROP COLUMN V6_33,
+    DROP COLUMN V6_34,
+    DROP COLUMN V6_35,
+    DROP COLUMN V6_36,
+    DROP COLUMN V6_37,
+    DROP COLUMN V6_38,
+    DROP COLUMN V6_39,
+    DROP COLUMN V6_40,
+    DROP COLUMN V6_41,
+    DROP COLUMN V6_42,
+    DROP COLUMN V6_43,
+    DROP COLUMN V6_44,
+    DROP COLUMN V6_45,
+    DROP COLUMN V6_46,
+    DROP COLUMN V6_47,
+    DROP COLUMN V6_48;
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS ASPAS CASCADE;
+DROP TABLE IF EXISTS ORIGIN_EVENTS CASCADE;
+DROP TABLE IF EXISTS BOGONS CASCADE;
+DROP TABLE IF EXISTS BOGON_COUNTS CASCADE;
+DROP TABLE IF EXISTS PEERS CASCADE;
+DROP TABLE IF EXISTS TOP_COMMUNITIES CASCADE;
+DROP TABLE IF EXISTS COMMUNITIES CASCADE;
+DROP TABLE IF EXISTS ASPATH_LENGTH CASCADE;
+DROP TABLE IF EXISTS ASPATH_SHAPE CASCADE;
+DROP TABLE IF EXISTS ASNUMNAME CASCADE;
+DROP TABLE IF EXISTS INFO CASCADE;
@@ -0,0 +1,186 @@
+-- The same tables as MySQL has. Every number is a BIGINT, as ASNs and
+-- times don't fit in an INTEGER.
+
+CREATE TABLE IF NOT EXISTS INFO (
+    TIME BIGINT NOT NULL DEFAULT 0,
+    V4COUNT BIGINT NOT NULL,
+    V6COUNT BIGINT NOT NULL,
+    PEERS_CONFIGURED BIGINT DEFAULT NULL,
+    PEERS_UP BIGINT DEFAULT NULL,
+    V4_24 BIGINT DEFAULT NULL,
+    V4_23 BIGINT DEFAULT NULL,
+    V4_22 BIGINT DEFAULT NULL,
+    V4_21 BIGINT DEFAULT NULL,
+    V4_20 BIGINT DEFAULT NULL,
+    V4_19 BIGINT DEFAULT NULL,
+    V4_18 BIGINT DEFAULT NULL,
+    V4_17 BIGINT DEFAULT NULL,
+    V4_16 BIGINT DEFAULT NULL,
+    V4_15 BIGINT DEFAULT NULL,
+    V4_14 BIGINT DEFAULT NULL,
+    V4_13 BIGINT DEFAULT NULL,
+    V4_12 BIGINT DEFAULT NULL,
+    V4_11 BIGINT DEFAULT NULL,
+    V4_10 BIGINT DEFAULT NULL,
+    V4_09 BIGINT DEFAULT NULL,
+    V4_08 BIGINT DEFAULT NULL,
+    V6_48 BIGINT DEFAULT NULL,
+    V6_47 BIGINT DEFAULT NULL,
+    V6_46 BIGINT DEFAULT NULL,
+    V6_45 BIGINT DEFAULT NULL,
+    V6_44 BIGINT DEFAULT NULL,
+    V6_43 BIGINT DEFAULT NULL,
+    V6_42 BIGINT DEFAULT NULL,
+    V6_41 BIGINT DEFAULT NULL,
+    V6_40 BIGINT DEFAULT NULL,
+    V6_39 BIGINT DEFAULT NULL,
+    V6_38 BIGINT DEFAULT NULL,
+    V6_37 BIGINT DEFAULT NULL,
+    V6_36 BIGINT DEFAULT NULL,
+    V6_35 BIGINT DEFAULT NULL,
+    V6_34 BIGINT DEFAULT NULL,
+    V6_33 BIGINT DEFAULT NULL,
+    V6_32 BIGINT DEFAULT NULL,
+    V6_31 BIGINT DEFAULT NULL,
+    V6_30 BIGINT DEFAULT NULL,
+    V6_29 BIGINT DEFAULT NULL,
+    V6_28 BIGINT DEFAULT NULL,
+    V6_27 BIGINT DEFAULT NULL,
+    V6_26 BIGINT DEFAULT NULL,
+    V6_25 BIGINT DEFAULT NULL,
+    V6_24 BIGINT DEFAULT NULL,
+    V6_23 BIGINT DEFAULT NULL,
+    V6_22 BIGINT DEFAULT NULL,
+    V6_21 BIGINT DEFAULT NULL,
+    V6_20 BIGINT DEFAULT NULL,
+    V6_19 BIGINT DEFAULT NULL,
+    V6_18 BIGINT DEFAULT NULL,
+    V6_17 BIGINT DEFAULT NULL,
+    V6_16 BIGINT DEFAULT NULL,
+    V6_15 BIGINT DEFAULT NULL,
+    V6_14 BIGINT DEFAULT NULL,
+    V6_13 BIGINT DEFAULT NULL,
+    V6_12 BIGINT DEFAULT NULL,
+    V6_11 BIGINT DEFAULT NULL,
+    V6_10 BIGINT DEFAULT NULL,
+    V6_09 BIGINT DEFAULT NULL,
+    V6_08 BIGINT DEFAULT NULL,
+    PEERS6_UP BIGINT DEFAULT NULL,
+    PEERS6_CONFIGURED BIGINT DEFAULT NULL,
+    TWEET SMALLINT DEFAULT NULL,
+    V4TOTAL BIGINT DEFAULT NULL,
+    V6TOTAL BIGINT DEFAULT NULL,
+    AS4_LEN BIGINT DEFAULT NULL,
+    AS6_LEN BIGINT DEFAULT NULL,
+    AS10_LEN BIGINT DEFAULT NULL,
+    AS4_ONLY BIGINT DEFAULT NULL,
+    AS6_ONLY BIGINT DEFAULT NULL,
+    AS_BOTH BIGINT DEFAULT NULL,
+    LARGEC4 BIGINT DEFAULT NULL,
+    LARGEC6 BIGINT DEFAULT NULL,
+    ROAVALIDV4 BIGINT DEFAULT NULL,
+    ROAINVALIDV4 BIGINT DEFAULT NULL,
+    ROAUNKNOWNV4 BIGINT DEFAULT NULL,
+    ROAVALIDV6 BIGINT DEFAULT NULL,
+    ROAINVALIDV6 BIGINT DEFAULT NULL,
+    ROAUNKNOWNV6 BIGINT DEFAULT NULL,
+    PRIMARY KEY (TIME)
+);
+
+CREATE TABLE IF NOT EXISTS ASNUMNAME (
+    ASNUMBER BIGINT NOT NULL,
+    ASNAME TEXT NOT NULL,
+    LOCALE TEXT DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS ASPATH_SHAPE (
+    TIME BIGINT NOT NULL,
+    FAMILY BIGINT NOT NULL,
+    PREPENDED BIGINT NOT NULL,
+    SETS BIGINT NOT NULL,
+    PRIMARY KEY (TIME, FAMILY)
+);
+
+CREATE TABLE IF NOT EXISTS ASPATH_LENGTH (
+    TIME BIGINT NOT NULL,
+    FAMILY BIGINT NOT NULL,
+    LENGTH BIGINT NOT NULL,
+    PATHS BIGINT NOT NULL,
+    UNIQUE_PATHS BIGINT NOT NULL,
+    PRIMARY KEY (TIME, FAMILY, LENGTH)
+);
+
+CREATE TABLE IF NOT EXISTS COMMUNITIES (
+    TIME BIGINT NOT NULL,
+    FAMILY BIGINT NOT NULL,
+    STANDARD BIGINT NOT NULL,
+    EXTENDED BIGINT NOT NULL,
+    LARGE BIGINT NOT NULL,
+    NO_EXPORT BIGINT NOT NULL,
+    NO_ADVERTISE BIGINT NOT NULL,
+    NO_EXPORT_SUBCONFED BIGINT NOT NULL,
+    BLACKHOLE BIGINT NOT NULL,
+    GRACEFUL_SHUTDOWN BIGINT NOT NULL,
+    PRIMARY KEY (TIME, FAMILY)
+);
+
+CREATE TABLE IF NOT EXISTS TOP_COMMUNITIES (
+    TIME BIGINT NOT NULL,
+    FAMILY BIGINT NOT NULL,
+    POSITION BIGINT NOT NULL,
+    COMMUNITY VARCHAR(64) NOT NULL,
+    PREFIXES BIGINT NOT NULL,
+    PRIMARY KEY (TIME, FAMILY, POSITION)
+);
+
+CREATE TABLE IF NOT EXISTS PEERS (
+    TIME BIGINT NOT NULL,
+    ADDRESS VARCHAR(39) NOT NULL,
+    ASN BIGINT NOT NULL,
+    STATE VARCHAR(16) NOT NULL,
+    UPTIME BIGINT NOT NULL,
+    V4_RECEIVED BIGINT NOT NULL,
+    V4_ACCEPTED BIGINT NOT NULL,
+    V6_RECEIVED BIGINT NOT NULL,
+    V6_ACCEPTED BIGINT NOT NULL,
+    PRIMARY KEY (TIME, ADDRESS)
+);
+
+CREATE TABLE IF NOT EXISTS BOGON_COUNTS (
+    TIME BIGINT NOT NULL,
+    FAMILY BIGINT NOT NULL,
+    MARTIAN BIGINT NOT NULL,
+    UNALLOCATED BIGINT NOT NULL,
+    RESERVED_ASN BIGINT NOT NULL,
+    PRIMARY KEY (TIME, FAMILY)
+);
+
+CREATE TABLE IF NOT EXISTS BOGONS (
+    TIME BIGINT NOT NULL,
+    POSITION BIGINT NOT NULL,
+    PREFIX VARCHAR(43) NOT NULL,
+    ORIGIN BIGINT NOT NULL,
+    KIND VARCHAR(16) NOT NULL,
+    PRIMARY KEY (TIME, POSITION)
+);
+
+CREATE TABLE IF NOT EXISTS ORIGIN_EVENTS (
+    KIND VARCHAR(16) NOT NULL,
+    PREFIX VARCHAR(43) NOT NULL,
+    OLD_ORIGIN BIGINT NOT NULL,
+    NEW_ORIGIN BIGINT NOT NULL,
+    FIRST_SEEN BIGINT NOT NULL,
+    LAST_SEEN BIGINT NOT NULL,
+    PRIMARY KEY (KIND, PREFIX, OLD_ORIGIN, NEW_ORIGIN, FIRST_SEEN)
+);
+
+CREATE TABLE IF NOT EXISTS ASPAS (
+    TIME BIGINT NOT NULL,
+    V4_VALID BIGINT NOT NULL,
+    V4_INVALID BIGINT NOT NULL,
+    V4_UNKNOWN BIGINT NOT NULL,
+    V6_VALID BIGINT NOT NULL,
+    V6_INVALID BIGINT NOT NULL,
+    V6_UNKNOWN BIGINT NOT NULL,
+    PRIMARY KEY (TIME)
+);
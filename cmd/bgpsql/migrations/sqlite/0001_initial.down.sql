@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS ASPAS;
+DROP TABLE IF EXISTS ORIGIN_EVENTS;
+DROP TABLE IF EXISTS BOGONS;
+DROP TABLE IF EXISTS BOGON_COUNTS;
+DROP TABLE IF EXISTS PEERS;
+DROP TABLE IF EXISTS TOP_COMMUNITIES;
+DROP TABLE IF EXISTS COMMUNITIES;
+DROP TABLE IF EXISTS ASPATH_LENGTH;
+DROP TABLE IF EXISTS ASPATH_SHAPE;
+DROP TABLE IF EXISTS ASNUMNAME;
+DROP TABLE IF EXISTS INFO;
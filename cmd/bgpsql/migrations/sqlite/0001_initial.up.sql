@@ -0,0 +1,185 @@
+-- The same tables as MySQL has, with SQLite reading the types loosely.
+
+CREATE TABLE IF NOT EXISTS INFO (
+    TIME int(12) NOT NULL DEFAULT 0,
+    V4COUNT int(10) NOT NULL,
+    V6COUNT int(7) NOT NULL,
+    PEERS_CONFIGURED int(3) DEFAULT NULL,
+    PEERS_UP int(3) DEFAULT NULL,
+    V4_24 int(10) DEFAULT NULL,
+    V4_23 int(10) DEFAULT NULL,
+    V4_22 int(10) DEFAULT NULL,
+    V4_21 int(10) DEFAULT NULL,
+    V4_20 int(10) DEFAULT NULL,
+    V4_19 int(10) DEFAULT NULL,
+    V4_18 int(10) DEFAULT NULL,
+    V4_17 int(10) DEFAULT NULL,
+    V4_16 int(10) DEFAULT NULL,
+    V4_15 int(10) DEFAULT NULL,
+    V4_14 int(10) DEFAULT NULL,
+    V4_13 int(10) DEFAULT NULL,
+    V4_12 int(10) DEFAULT NULL,
+    V4_11 int(10) DEFAULT NULL,
+    V4_10 int(10) DEFAULT NULL,
+    V4_09 int(10) DEFAULT NULL,
+    V4_08 int(10) DEFAULT NULL,
+    V6_48 int(7) DEFAULT NULL,
+    V6_47 int(7) DEFAULT NULL,
+    V6_46 int(7) DEFAULT NULL,
+    V6_45 int(7) DEFAULT NULL,
+    V6_44 int(7) DEFAULT NULL,
+    V6_43 int(7) DEFAULT NULL,
+    V6_42 int(7) DEFAULT NULL,
+    V6_41 int(7) DEFAULT NULL,
+    V6_40 int(7) DEFAULT NULL,
+    V6_39 int(7) DEFAULT NULL,
+    V6_38 int(7) DEFAULT NULL,
+    V6_37 int(7) DEFAULT NULL,
+    V6_36 int(7) DEFAULT NULL,
+    V6_35 int(7) DEFAULT NULL,
+    V6_34 int(7) DEFAULT NULL,
+    V6_33 int(7) DEFAULT NULL,
+    V6_32 int(7) DEFAULT NULL,
+    V6_31 int(7) DEFAULT NULL,
+    V6_30 int(7) DEFAULT NULL,
+    V6_29 int(7) DEFAULT NULL,
+    V6_28 int(7) DEFAULT NULL,
+    V6_27 int(7) DEFAULT NULL,
+    V6_26 int(7) DEFAULT NULL,
+    V6_25 int(7) DEFAULT NULL,
+    V6_24 int(7) DEFAULT NULL,
+    V6_23 int(7) DEFAULT NULL,
+    V6_22 int(7) DEFAULT NULL,
+    V6_21 int(7) DEFAULT NULL,
+    V6_20 int(7) DEFAULT NULL,
+    V6_19 int(7) DEFAULT NULL,
+    V6_18 int(7) DEFAULT NULL,
+    V6_17 int(7) DEFAULT NULL,
+    V6_16 int(7) DEFAULT NULL,
+    V6_15 int(7) DEFAULT NULL,
+    V6_14 int(7) DEFAULT NULL,
+    V6_13 int(7) DEFAULT NULL,
+    V6_12 int(7) DEFAULT NULL,
+    V6_11 int(7) DEFAULT NULL,
+    V6_10 int(7) DEFAULT NULL,
+    V6_09 int(7) DEFAULT NULL,
+    V6_08 int(7) DEFAULT NULL,
+    PEERS6_UP int(3) DEFAULT NULL,
+    PEERS6_CONFIGURED int(3) DEFAULT NULL,
+    TWEET bit(1) DEFAULT NULL,
+    V4TOTAL int(12) DEFAULT NULL,
+    V6TOTAL int(10) DEFAULT NULL,
+    AS4_LEN int(10) DEFAULT NULL,
+    AS6_LEN int(10) DEFAULT NULL,
+    AS10_LEN int(10) DEFAULT NULL,
+    AS4_ONLY int(10) DEFAULT NULL,
+    AS6_ONLY int(10) DEFAULT NULL,
+    AS_BOTH int(10) DEFAULT NULL,
+    LARGEC4 int(6) DEFAULT NULL,
+    LARGEC6 int(6) DEFAULT NULL,
+    ROAVALIDV4 int(10) DEFAULT NULL,
+    ROAINVALIDV4 int(10) DEFAULT NULL,
+    ROAUNKNOWNV4 int(10) DEFAULT NULL,
+    ROAVALIDV6 int(10) DEFAULT NULL,
+    ROAINVALIDV6 int(10) DEFAULT NULL,
+    ROAUNKNOWNV6 int(10) DEFAULT NULL,
+    PRIMARY KEY (TIME)
+);
+
+CREATE TABLE IF NOT EXISTS ASNUMNAME (
+    ASNUMBER INTEGER NOT NULL,
+    ASNAME TEXT NOT NULL,
+    LOCALE TEXT DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS ASPATH_SHAPE (
+    TIME int(12) NOT NULL,
+    FAMILY int(1) NOT NULL,
+    PREPENDED int(10) NOT NULL,
+    SETS int(10) NOT NULL,
+    PRIMARY KEY (TIME, FAMILY)
+);
+
+CREATE TABLE IF NOT EXISTS ASPATH_LENGTH (
+    TIME int(12) NOT NULL,
+    FAMILY int(1) NOT NULL,
+    LENGTH int(3) NOT NULL,
+    PATHS int(10) NOT NULL,
+    UNIQUE_PATHS int(10) NOT NULL,
+    PRIMARY KEY (TIME, FAMILY, LENGTH)
+);
+
+CREATE TABLE IF NOT EXISTS COMMUNITIES (
+    TIME int(12) NOT NULL,
+    FAMILY int(1) NOT NULL,
+    STANDARD int(10) NOT NULL,
+    EXTENDED int(10) NOT NULL,
+    LARGE int(10) NOT NULL,
+    NO_EXPORT int(10) NOT NULL,
+    NO_ADVERTISE int(10) NOT NULL,
+    NO_EXPORT_SUBCONFED int(10) NOT NULL,
+    BLACKHOLE int(10) NOT NULL,
+    GRACEFUL_SHUTDOWN int(10) NOT NULL,
+    PRIMARY KEY (TIME, FAMILY)
+);
+
+CREATE TABLE IF NOT EXISTS TOP_COMMUNITIES (
+    TIME int(12) NOT NULL,
+    FAMILY int(1) NOT NULL,
+    POSITION int(3) NOT NULL,
+    COMMUNITY varchar(64) NOT NULL,
+    PREFIXES int(10) NOT NULL,
+    PRIMARY KEY (TIME, FAMILY, POSITION)
+);
+
+CREATE TABLE IF NOT EXISTS PEERS (
+    TIME int(12) NOT NULL,
+    ADDRESS varchar(39) NOT NULL,
+    ASN int(10) NOT NULL,
+    STATE varchar(16) NOT NULL,
+    UPTIME int(12) NOT NULL,
+    V4_RECEIVED int(10) NOT NULL,
+    V4_ACCEPTED int(10) NOT NULL,
+    V6_RECEIVED int(10) NOT NULL,
+    V6_ACCEPTED int(10) NOT NULL,
+    PRIMARY KEY (TIME, ADDRESS)
+);
+
+CREATE TABLE IF NOT EXISTS BOGON_COUNTS (
+    TIME int(12) NOT NULL,
+    FAMILY int(1) NOT NULL,
+    MARTIAN int(10) NOT NULL,
+    UNALLOCATED int(10) NOT NULL,
+    RESERVED_ASN int(10) NOT NULL,
+    PRIMARY KEY (TIME, FAMILY)
+);
+
+CREATE TABLE IF NOT EXISTS BOGONS (
+    TIME int(12) NOT NULL,
+    POSITION int(10) NOT NULL,
+    PREFIX varchar(43) NOT NULL,
+    ORIGIN int(10) NOT NULL,
+    KIND varchar(16) NOT NULL,
+    PRIMARY KEY (TIME, POSITION)
+);
+
+CREATE TABLE IF NOT EXISTS ORIGIN_EVENTS (
+    KIND varchar(16) NOT NULL,
+    PREFIX varchar(43) NOT NULL,
+    OLD_ORIGIN int(10) NOT NULL,
+    NEW_ORIGIN int(10) NOT NULL,
+    FIRST_SEEN int(12) NOT NULL,
+    LAST_SEEN int(12) NOT NULL,
+    PRIMARY KEY (KIND, PREFIX, OLD_ORIGIN, NEW_ORIGIN, FIRST_SEEN)
+);
+
+CREATE TABLE IF NOT EXISTS ASPAS (
+    TIME int(12) NOT NULL,
+    V4_VALID int(10) NOT NULL,
+    V4_INVALID int(10) NOT NULL,
+    V4_UNKNOWN int(10) NOT NULL,
+    V6_VALID int(10) NOT NULL,
+    V6_INVALID int(10) NOT NULL,
+    V6_UNKNOWN int(10) NOT NULL,
+    PRIMARY KEY (TIME)
+);
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// openPostgres connects to a PostgreSQL database.
+func openPostgres(cfg config) (*sql.DB, error) {
+	dsn := cfg.dsn
+	if dsn == "" {
+		u := url.URL{
+			Scheme: "postgres",
+			User:   url.UserPassword(cfg.user, cfg.pass),
+			Host:   cmp.Or(cfg.address, "127.0.0.1:5432"),
+			Path:   "/" + cfg.dbname,
+		}
+		dsn = u.String()
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("can't open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("can't ping database: %w", err)
+	}
+	return db, nil
+}
+
+// setupTimescale makes INFO a TimescaleDB hypertable with hourly buckets
+// kept up to date, so that long movement periods are quick to read. It
+// sits outside the migrations as it's optional, and continuous aggregates
+// can't be created in a transaction, but is safe to run every time.
+func setupTimescale(db *sql.DB) error {
+	for _, stmt := range timescaleSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("unable to set up TimescaleDB: %w", err)
+		}
+	}
+	return nil
+}
+
+// timescaleSchema turns INFO into a hypertable of weekly chunks, and keeps
+// the last counts of every hour in INFO_HOURLY, including the hour not yet
+// materialised. TIME is in seconds, so TimescaleDB is told how to find the
+// current time for the refresh policy.
+var timescaleSchema = []string{
+	`CREATE EXTENSION IF NOT EXISTS timescaledb`,
+	`SELECT create_hypertable('info', by_range('time', 604800),
+		if_not_exists => TRUE, migrate_data => TRUE)`,
+	`CREATE OR REPLACE FUNCTION unix_now() RETURNS BIGINT LANGUAGE SQL STABLE AS
+		$$ SELECT extract(epoch FROM now())::BIGINT $$`,
+	`SELECT set_integer_now_func('info', 'unix_now', replace_if_exists => TRUE)`,
+	`CREATE MATERIALIZED VIEW IF NOT EXISTS INFO_HOURLY
+		WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+		SELECT time_bucket(3600, TIME) AS TIME,
+			last(V4COUNT, TIME) AS V4COUNT,
+			last(V6COUNT, TIME) AS V6COUNT
+		FROM INFO GROUP BY 1
+		WITH NO DATA`,
+	`SELECT add_continuous_aggregate_policy('info_hourly',
+		start_offset => NULL, end_offset => 3600,
+		schedule_interval => INTERVAL '1 hour', if_not_exists => TRUE)`,
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+
+	pb "github.com/mellowdrifter/bgp_infrastructure/internal/bgpsql"
+)
+
+// postgresImage is the PostgreSQL server the tests run against. It comes
+// with TimescaleDB, so both setups are tested on the same server.
+const postgresImage = "timescale/timescaledb:2.19.3-pg17"
+
+// postgresServer starts the server in Docker on first use, returning the DSN
+// of its default database. It's shared by every test, and removed by
+// testcontainers once they finish.
+var postgresServer = sync.OnceValues(func() (dsn string, err error) {
+	// testcontainers panics rather than failing without Docker.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("unable to start %s: %v", postgresImage, r)
+		}
+	}()
+	ctx := context.Background()
+	ctr, err := postgres.Run(ctx, postgresImage,
+		postgres.WithDatabase("bgpsql"),
+		postgres.WithUsername("bgpsql"),
+		postgres.WithPassword("bgpsql"),
+		postgres.BasicWaitStrategies())
+	if err != nil {
+		return "", fmt.Errorf("unable to start %s: %w", postgresImage, err)
+	}
+	return ctr.ConnectionString(ctx, "sslmode=disable")
+})
+
+// postgresDSN returns the DSN of a new database for t alone, which is
+// dropped once t finishes. Without Docker the test is skipped, other than
+// in CI, where it must run.
+func postgresDSN(t *testing.T) string {
+	t.Helper()
+	if os.Getenv("CI") == "" {
+		testcontainers.SkipIfProviderIsNotHealthy(t)
+	}
+	dsn, err := postgresServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := fmt.Sprintf("bgpsql_test_%x", rand.Uint64())
+	if _, err := db.Exec("CREATE DATABASE " + name); err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		defer db.Close()
+		if _, err := db.Exec("DROP DATABASE " + name + " WITH (FORCE)"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Path = "/" + name
+	return u.String()
+}
+
+func TestPostgresStorage(t *testing.T) {
+	store, err := openStorage(config{driver: "postgres", dsn: postgresDSN(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	bgpinfoServer := server{store: store}
+	ctx := context.Background()
+
+	first := readOne(t, "latest.pb").GetTime()
+	moas := &pb.OriginEvent{Kind: "moas", Prefix: "1.1.1.0/24", OldOrigin: 13335, NewOrigin: 4200000000, FirstSeen: first}
+	paths := &pb.AsPaths{
+		V4: &pb.AsPathStats{Lengths: map[uint32]uint32{1: 10, 2: 500}, UniqueLengths: map[uint32]uint32{2: 510}, Prepended: 12},
+		V6: &pb.AsPathStats{Lengths: map[uint32]uint32{2: 100}, UniqueLengths: map[uint32]uint32{2: 100}},
+	}
+	aspas := &pb.Aspas{V4Valid: 900000, V4Invalid: 2000, V6Valid: 190000}
+	peer := &pb.PeerDetail{Address: "192.0.2.1", Asn: 3356, State: "Established", Uptime: 3600, V4Received: 950000, V4Accepted: 950000}
+	for i := range 2 {
+		v := readOne(t, "latest.pb")
+		v.Time = first + uint64(i)*300
+		moas.LastSeen = v.Time
+		v.OriginEvents = []*pb.OriginEvent{moas}
+		v.AsPaths = paths
+		v.Aspas = aspas
+		v.PeerDetails = []*pb.PeerDetail{peer}
+		if _, err := bgpinfoServer.AddLatest(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	roas, err := bgpinfoServer.GetRpki(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := readOne(t, "latest.pb").GetRoas(); !proto.Equal(roas, want) {
+		t.Errorf("Got %v, Wanted %v", roas, want)
+	}
+
+	gotPaths, err := bgpinfoServer.GetAsPaths(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&pb.AsPathsResponse{AsPaths: paths, Time: first + 300}); !proto.Equal(gotPaths, want) {
+		t.Errorf("Got %v, Wanted %v", gotPaths, want)
+	}
+
+	gotASPAs, err := bgpinfoServer.GetAspas(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(gotASPAs, aspas) {
+		t.Errorf("Got %v, Wanted %v", gotASPAs, aspas)
+	}
+
+	// The event seen in both updates is stored once.
+	events, err := bgpinfoServer.GetOriginEvents(ctx, &pb.OriginEventsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&pb.OriginEventsResponse{Events: []*pb.OriginEvent{moas}}); !proto.Equal(events, want) {
+		t.Errorf("Got %v, Wanted %v", events, want)
+	}
+
+	history, err := bgpinfoServer.GetPeerHistory(ctx, &pb.PeerHistoryRequest{Address: "192.0.2.1", Start: first + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&pb.PeerHistoryResponse{Snapshots: []*pb.PeerSnapshot{{Time: first + 300, Peer: peer}}}); !proto.Equal(history, want) {
+		t.Errorf("Got %v, Wanted %v", history, want)
+	}
+
+	series, err := bgpinfoServer.QueryTimeSeries(ctx, &pb.TimeSeriesRequest{Start: first, End: first + 300,
+		Bucket: 600, Aggregation: pb.TimeSeriesRequest_AVG, Metrics: []string{"V4COUNT", "V6COUNT"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&pb.TimeSeriesResponse{Points: []*pb.TimeSeriesPoint{{Time: first, Values: []float64{785490, 73288}}}}); !proto.Equal(series, want) {
+		t.Errorf("Got %v, Wanted %v", series, want)
+	}
+
+	if _, err := bgpinfoServer.UpdateTweetBit(ctx, &pb.Timestamp{Time: first}); err != nil {
+		t.Fatal(err)
+	}
+	counts, err := bgpinfoServer.GetPrefixCount(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCounts := &pb.PrefixCountResponse{
+		Time:       first + 300,
+		Active_4:   785490,
+		Active_6:   73288,
+		Sixhoursv4: 785490,
+		Sixhoursv6: 73288,
+		Weekagov4:  785490,
+		Weekagov6:  73288,
+		Slash24:    452605,
+		Slash48:    34883,
+	}
+	if !proto.Equal(counts, wantCounts) {
+		t.Errorf("Got %v, Wanted %v", counts, wantCounts)
+	}
+
+	names := &pb.AsnamesRequest{AsnNames: []*pb.AsnName{
+		{AsNumber: 13335, AsName: "CLOUDFLARENET", AsLocale: "US"},
+		{AsNumber: 4200000000, AsName: "PRIVATE", AsLocale: ""},
+	}}
+	if _, err := bgpinfoServer.UpdateAsnames(ctx, names); err != nil {
+		t.Fatal(err)
+	}
+	name, err := bgpinfoServer.GetAsname(ctx, &pb.GetAsnameRequest{AsNumber: 4200000000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&pb.GetAsnameResponse{AsName: "PRIVATE", Exists: true}); !proto.Equal(name, want) {
+		t.Errorf("Got %v, Wanted %v", name, want)
+	}
+}
+
+func TestPostgresTimescale(t *testing.T) {
+	cfg := config{driver: "postgres", dsn: postgresDSN(t), timescale: true}
+	store, err := openStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	bgpinfoServer := server{store: store}
+	ctx := context.Background()
+
+	// Setting up TimescaleDB again is harmless.
+	again, err := openStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again.Close()
+
+	db, err := sql.Open("pgx", cfg.dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var hypertables int
+	err = db.QueryRow(`SELECT COUNT(*) FROM timescaledb_information.hypertables
+		WHERE hypertable_name = 'info'`).Scan(&hypertables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hypertables != 1 {
+		t.Errorf("Got %d hypertables, Wanted 1", hypertables)
+	}
+
+	// Ten hourly snapshots, ending before the last movement period does.
+	last := (time.Now().Unix() - 66600) / 3600 * 3600
+	for i := range 10 {
+		v := readOne(t, "latest.pb")
+		v.Time = uint64(last - int64(9-i)*3600)
+		v.PrefixCount.Active_4 = uint32(i)
+		if _, err := bgpinfoServer.AddLatest(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A week reads every other snapshot from INFO. A year reads every fifth
+	// hour from INFO_HOURLY, where INFO alone would give every sixtieth
+	// snapshot, so none.
+	tests := []struct {
+		period pb.MovementRequest_TimePeriod
+		want   []uint32
+	}{
+		{period: pb.MovementRequest_WEEK, want: []uint32{1, 3, 5, 7, 9}},
+		{period: pb.MovementRequest_ANNUAL, want: []uint32{4, 9}},
+	}
+	for _, tc := range tests {
+		res, err := bgpinfoServer.GetMovementTotals(ctx, &pb.MovementRequest{Period: tc.period})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []uint32
+		for _, v := range res.GetValues() {
+			got = append(got, v.GetV4Values())
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: Got %v, Wanted %v", tc.period, got, tc.want)
+		}
+	}
+}
+
+func TestRebind(t *testing.T) {
+	query := `SELECT A FROM B WHERE C = ? AND D >= ? AND E <= ?`
+	if got := (&sqlStore{}).rebind(query); got != query {
+		t.Errorf("Got %q, Wanted %q", got, query)
+	}
+	want := `SELECT A FROM B WHERE C = $1 AND D >= $2 AND E <= $3`
+	if got := (&sqlStore{numbered: true}).rebind(query); got != want {
+		t.Errorf("Got %q, Wanted %q", got, want)
+	}
+}
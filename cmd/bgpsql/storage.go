@@ -0,0 +1,152 @@
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
+	pb "github.com/mellowdrifter/bgp_infrastructure/internal/bgpsql"
+	com "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
+)
+
+// storage keeps the updates sent by collectors, and answers the queries of
+// everything graphing and tweeting them.
+type storage interface {
+	addLatest(*com.BgpUpdate) error
+	getPrefixCount() (*pb.PrefixCountResponse, error)
+	getPieSubnets() (*pb.PieSubnetsResponse, error)
+	getMovementTotals(*pb.MovementRequest) (*pb.MovementTotalsResponse, error)
+	queryTimeSeries(*pb.TimeSeriesRequest) (*pb.TimeSeriesResponse, error)
+	getRPKI() (*pb.Roas, error)
+	getASPAs() (*pb.Aspas, error)
+	getASPaths() (*pb.AsPathsResponse, error)
+	getCommunities() (*pb.CommunitiesResponse, error)
+	getPeerHistory(*pb.PeerHistoryRequest) (*pb.PeerHistoryResponse, error)
+	getBogons() (*pb.BogonsResponse, error)
+	getOriginEvents(*pb.OriginEventsRequest) (*pb.OriginEventsResponse, error)
+	getAsname(*pb.GetAsnameRequest) (*pb.GetAsnameResponse, error)
+	getAsnames() (*pb.GetAsnamesResponse, error)
+	updateASN(*pb.AsnamesRequest) (*pb.Result, error)
+	updateTweetBit(uint64) (*pb.Result, error)
+	Close() error
+}
+
+// sqlStore is storage in an SQL database. The queries are plain enough
+// that MySQL, SQLite and PostgreSQL share them.
+type sqlStore struct {
+	db *sql.DB
+	// numbered is set for PostgreSQL, which uses $1, $2 and so on rather
+	// than ? for placeholders.
+	numbered bool
+	// mysql is set for MySQL, which has its own syntax for upserts.
+	mysql bool
+	// timescale is set when INFO is a TimescaleDB hypertable, with hourly
+	// buckets in INFO_HOURLY.
+	timescale bool
+}
+
+// rebind returns query with its placeholders in the form the database uses.
+// Queries must not hold a ? other than as a placeholder.
+func (s *sqlStore) rebind(query string) string {
+	if !s.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// Close closes the database.
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+// openStorage returns the storage chosen by the driver in the config.
+// SQLite and PostgreSQL databases are migrated to the latest schema, while
+// MySQL ones must already be there, as they're shared and long lived.
+func openStorage(cfg config) (storage, error) {
+	db, dialect, err := openDatabase(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if dialect == "mysql" {
+		err = checkSchema(db, dialect)
+	} else {
+		err = migrateLatest(db, dialect)
+	}
+	if err == nil && dialect == "postgres" && cfg.timescale {
+		err = setupTimescale(db)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqlStore{
+		db:        db,
+		numbered:  dialect == "postgres",
+		mysql:     dialect == "mysql",
+		timescale: cfg.timescale,
+	}, nil
+}
+
+// openDatabase connects to the database chosen by the driver in the config,
+// returning it along with the dialect of SQL it speaks.
+func openDatabase(cfg config) (*sql.DB, string, error) {
+	switch cfg.driver {
+	case "", "mysql":
+		db, err := openMySQL(cfg)
+		return db, "mysql", err
+	case "sqlite", "sqlite3":
+		db, err := openSQLite(cfg.dbname)
+		return db, "sqlite", err
+	case "postgres", "postgresql":
+		db, err := openPostgres(cfg)
+		return db, "postgres", err
+	}
+	return nil, "", fmt.Errorf("unknown sql driver: %s", cfg.driver)
+}
+
+// openMySQL connects to a MySQL database.
+func openMySQL(cfg config) (*sql.DB, error) {
+	dsn := cfg.dsn
+	if dsn == "" {
+		dsn = fmt.Sprintf("%s:%s@tcp(%s)/%s", cfg.user, cfg.pass,
+			cmp.Or(cfg.address, "127.0.0.1:3306"), cfg.dbname)
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("can't open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("can't ping database: %w", err)
+	}
+	return db, nil
+}
+
+// openSQLite opens the SQLite database at name, creating the file if needed.
+func openSQLite(name string) (*sql.DB, error) {
+	if name == "" {
+		return nil, fmt.Errorf("no sqlite database file configured")
+	}
+	db, err := sql.Open("sqlite3", name)
+	if err != nil {
+		return nil, fmt.Errorf("can't open database: %w", err)
+	}
+	// SQLite only has a single writer, so queue writes here rather than
+	// have them fail as the database is locked.
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
@@ -1,136 +1,369 @@
 package clidecode
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
-	c "github.com/mellowdrifter/bgp_infrastructure/common"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/bird"
+	c "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
 )
 
-// Bird2Conn will be a connection to a Bird2 instance. In reality this
-// will need to be on the local server
-type Bird2Conn struct{}
+// Bird2Conn is a connection to a Bird2 instance over its control socket.
+// The zero value uses the default socket location.
+type Bird2Conn struct {
+	socket string
+}
 
-// GetBGPTotal returns rib, fib ipv4. rib, fib ipv6
-func (b Bird2Conn) GetBGPTotal() (Totals, error) {
-	cmd := "/usr/sbin/birdc show route count | grep routes | awk {'print $3, $6'}"
+// NewBird2Conn returns a Bird2Conn using the control socket at socket. If
+// socket is empty, bird.DefaultSocket is used.
+func NewBird2Conn(socket string) Bird2Conn {
+	return Bird2Conn{socket: socket}
+}
 
-	var t Totals
-	out, err := c.GetOutput(cmd)
+// command connects to bird and runs each command in turn, returning the
+// reply to each. The connection is closed once ctx is done.
+func (b Bird2Conn) command(ctx context.Context, cmds ...string) ([][]bird.Line, error) {
+	socket := b.socket
+	if socket == "" {
+		socket = bird.DefaultSocket
+	}
+	cl, err := bird.DialContext(ctx, socket)
 	if err != nil {
-		return t, err
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, c.ContextError("connecting to bird", ctxErr)
+		}
+		return nil, fmt.Errorf("%w: unable to connect to bird: %w", ErrUnreachable, err)
 	}
-	numbers := strings.Fields(out)
+	defer cl.Close()
 
-	t.V4Rib = c.StringToUint32(numbers[0])
-	t.V4Fib = c.StringToUint32(numbers[1])
-	t.V6Rib = c.StringToUint32(numbers[2])
-	t.V6Fib = c.StringToUint32(numbers[3])
+	var replies [][]bird.Line
+	for _, cmd := range cmds {
+		lines, err := cl.CommandContext(ctx, cmd)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, c.ContextError(fmt.Sprintf("bird %q", cmd), ctxErr)
+			}
+			// Errors from bird itself mean it's up, but the command failed.
+			var birdErr *bird.Error
+			if errors.As(err, &birdErr) {
+				return nil, fmt.Errorf("unable to run %q: %w", cmd, err)
+			}
+			return nil, unreachable(cmd, err)
+		}
+		replies = append(replies, lines)
+	}
 
-	return t, nil
+	return replies, nil
 }
 
-// GetPeers returns ipv4 peer configured, established. ipv6 peers configured, established
-func (b Bird2Conn) GetPeers() (Peers, error) {
-	var peers []uint32
-	cmds := []string{
-		"/usr/sbin/birdc show protocols | awk {'print $1'} | grep _v4 | grep -Ev 'BIRD|device1|name|info|kernel1' | wc -l",
-		"/usr/sbin/birdc show protocols | awk {'print $1 $6'} | grep _v4 | grep Estab | wc -l",
-		"/usr/sbin/birdc show protocols | awk {'print $1'} | grep _v6 | grep -Ev 'BIRD|device1|name|info|kernel1' | wc -l",
-		"/usr/sbin/birdc show protocols | awk {'print $1 $6'} | grep _v6 | grep Estab | wc -l",
+// birdOrigin matches the origin shown at the end of each route, i.e. [AS13335i]
+// The ASN is missing when bird can't work out the origin, i.e. when the path
+// ends in an AS-SET.
+var birdOrigin = regexp.MustCompile(`^\[(?:AS(\d+))?[ie?]\]$`)
+
+// birdRoutes decodes the output of 'show route'. The first line of each
+// route looks like this:
+// 1.1.1.0/24           unicast [r1_v4 2023-10-17 from 192.0.2.1] * (100) [AS13335i]
+// Only the origin ASN is shown, so that's the only ASN in the path of the
+// routes returned.
+func birdRoutes(lines []bird.Line) ([]route, error) {
+	var routes []route
+	for _, line := range lines {
+		fields := strings.Fields(line.Text)
+		if len(fields) == 0 {
+			continue
+		}
+		// Table headers, next hops and attributes don't start with a prefix.
+		_, prefix, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			continue
+		}
+		r := route{prefix: prefix}
+		if m := birdOrigin.FindStringSubmatch(fields[len(fields)-1]); m != nil && m[1] != "" {
+			asn, err := strconv.ParseUint(m[1], 10, 32)
+			if err != nil {
+				return nil, outputError("show route", line.Text, err)
+			}
+			r.path.Path = []uint32{uint32(asn)}
+		}
+		routes = append(routes, r)
 	}
 
-	var p Peers
+	return routes, nil
+}
 
-	for _, cmd := range cmds {
-		out, err := c.GetOutput(cmd)
-		if err != nil {
-			return p, err
+// birdTableCount is a single table from 'show route count'
+type birdTableCount struct {
+	shown, routes, networks uint32
+}
+
+// birdCounts decodes the output of 'show route count', which has a line like
+// this for each table:
+// 950000 of 1900000 routes for 940000 networks in table master4
+// Filtered output shows the amount of routes matching the filter first.
+func birdCounts(lines []bird.Line) map[string]birdTableCount {
+	counts := make(map[string]birdTableCount)
+	for _, line := range lines {
+		var t birdTableCount
+		var table string
+		if _, err := fmt.Sscanf(line.Text, "%d of %d routes for %d networks in table %s", &t.shown, &t.routes, &t.networks, &table); err != nil {
+			// i.e. the Total line
+			continue
 		}
-		peers = append(peers, c.StringToUint32(out))
+		counts[table] = t
 	}
 
-	p.V4c = peers[0]
-	p.V4e = peers[1]
-	p.V6c = peers[2]
-	p.V6e = peers[3]
+	return counts
+}
 
-	return p, nil
+// shown returns the amount of routes matching a filtered count of table.
+func shown(lines []bird.Line, table string) (uint32, error) {
+	t, ok := birdCounts(lines)[table]
+	if !ok {
+		return 0, outputError("show route count", "", fmt.Errorf("no count for table %s", table))
+	}
+	return t.shown, nil
 }
 
-// GetTotalSourceASNs returns total amount of unique ASNs
-// as4:     ASNs originating IPv4
-// as6:     ASNs originating IPv6
-// as10:    ASNs originating either v4, v6, or both
-// as4Only: ASNs originating IPv4 only
-// as6Only: ASNs originaring IPv6 only
-// asBoth:  ASNs originating both IPv4 and IPv6
-func (b Bird2Conn) GetTotalSourceASNs() (ASNs, error) {
-	cmd1 := "/usr/sbin/birdc show route primary table master4 | awk '{print $NF}' | tr -d '[]ASie?' | sed -e '1,2d'"
-	cmd2 := "/usr/sbin/birdc show route primary table master6 | awk '{print $NF}' | tr -d '[]ASie?' | sed -e '1,2d'"
-
-	var s ASNs
-	as4, err := c.GetOutput(cmd1)
+// birdTotals returns the rib and fib of each address family from the reply
+// to 'show route count'.
+func birdTotals(lines []bird.Line) (Totals, error) {
+	var t Totals
+	counts := birdCounts(lines)
+	v4, ok4 := counts["master4"]
+	v6, ok6 := counts["master6"]
+	if !ok4 || !ok6 {
+		return t, outputError("show route count", "", errors.New("master4 or master6 missing"))
+	}
+
+	t.V4Rib = v4.routes
+	t.V4Fib = v4.networks
+	t.V6Rib = v6.routes
+	t.V6Fib = v6.networks
+
+	return t, nil
+}
+
+// GetPeers returns ipv4 peer configured, established. ipv6 peers configured, established
+// Peers are BGP protocols with a name containing _v4 or _v6
+func (b Bird2Conn) GetPeers(ctx context.Context) (Peers, error) {
+	var p Peers
+	out, err := b.command(ctx, "show protocols")
 	if err != nil {
-		return s, err
+		return p, err
 	}
-	as6, err := c.GetOutput(cmd2)
+
+	// Name       Proto      Table      State  Since         Info
+	// r1_v4      BGP        ---        up     2023-10-17    Established
+	var header bool
+	for _, line := range out[0] {
+		fields := strings.Fields(line.Text)
+		if len(fields) >= 2 && fields[0] == "Name" && fields[1] == "Proto" {
+			header = true
+			continue
+		}
+		if len(fields) < 2 || fields[1] != "BGP" {
+			continue
+		}
+		up := len(fields) > 5 && fields[5] == "Established"
+		switch {
+		case strings.Contains(fields[0], "_v4"):
+			p.V4c++
+			if up {
+				p.V4e++
+			}
+		case strings.Contains(fields[0], "_v6"):
+			p.V6c++
+			if up {
+				p.V6e++
+			}
+		}
+	}
+	if !header {
+		return Peers{}, outputError("show protocols", "", errors.New("no protocol table"))
+	}
+
+	return p, nil
+}
+
+// GetPeerDetails returns the state of each peer, and the amount of
+// prefixes received from it for each address family.
+func (b Bird2Conn) GetPeerDetails(ctx context.Context) ([]PeerDetail, error) {
+	out, err := b.command(ctx, "show protocols all")
 	if err != nil {
-		return s, err
+		return nil, err
 	}
 
-	// asNSet is the list of unique source AS numbers in each address family
-	as4Set := c.SetListOfStrings(strings.Fields(as4))
-	as6Set := c.SetListOfStrings(strings.Fields(as6))
+	return birdPeerDetails(out[0], time.Now())
+}
 
-	// as10Set is the total number of unique source AS numbers.
-	var as10 []string
-	as10 = append(as10, as4Set...)
-	as10 = append(as10, as6Set...)
-	as10Set := c.SetListOfStrings(as10)
+// birdSince is the format of the time a protocol changed state, with
+// 'timeformat protocol iso long'. Any other format only gives the date or
+// the time, so the uptime is left as zero.
+const birdSince = "2006-01-02 15:04:05"
+
+// birdPeerDetails decodes the output of 'show protocols all'. Each protocol
+// is a line of the protocol table followed by its details, i.e.
+// r1_v4      BGP        ---        up     2023-10-17 10:00:00  Established
+//
+//	BGP state:          Established
+//	Neighbor address: 192.0.2.1
+//	Neighbor AS:      3356
+//	Channel ipv4
+//	  Routes:         4 imported, 1 filtered, 0 exported, 3 preferred
+//
+// Filtered routes are only counted with 'import keep filtered'.
+func birdPeerDetails(lines []bird.Line, now time.Time) ([]PeerDetail, error) {
+	var peers []PeerDetail
+	var peer *PeerDetail
+	var channel string
+	for _, line := range lines {
+		fields := strings.Fields(line.Text)
+		if line.Code == bird.CodeProtocol {
+			peer = nil
+			if len(fields) < 2 || fields[1] != "BGP" {
+				continue
+			}
+			peers = append(peers, PeerDetail{})
+			peer = &peers[len(peers)-1]
+			if len(fields) > 5 {
+				if since, err := time.ParseInLocation(birdSince, fields[4]+" "+fields[5], now.Location()); err == nil {
+					peer.Uptime = now.Sub(since)
+				}
+			}
+			continue
+		}
+		if peer == nil || line.Code != bird.CodeProtocolDetails {
+			continue
+		}
 
-	// as4Only is the set of ASs that only source IPv4
-	as4Only := c.InFirstButNotSecond(as4Set, as6Set)
+		key, value, ok := strings.Cut(strings.TrimSpace(line.Text), ":")
+		value = strings.TrimSpace(value)
+		if !ok {
+			// Channels have no value, i.e. 'Channel ipv4'
+			if len(fields) == 2 && fields[0] == "Channel" {
+				channel = fields[1]
+			}
+			continue
+		}
+		switch key {
+		case "BGP state":
+			peer.State = peerState(value)
+		case "Neighbor address":
+			peer.Address = net.ParseIP(value)
+			if peer.Address == nil {
+				return nil, outputError("show protocols all", line.Text, errors.New("invalid neighbor address"))
+			}
+		case "Neighbor AS":
+			asn, err := c.ParseUint32(value)
+			if err != nil {
+				return nil, outputError("show protocols all", line.Text, err)
+			}
+			peer.ASN = asn
+		case "Routes":
+			imported, filtered, err := birdRouteCounts(value)
+			if err != nil {
+				return nil, outputError("show protocols all", line.Text, err)
+			}
+			switch channel {
+			case "ipv4":
+				peer.V4Received, peer.V4Accepted = imported+filtered, imported
+			case "ipv6":
+				peer.V6Received, peer.V6Accepted = imported+filtered, imported
+			}
+		}
+	}
 
-	// as6Only is the set of ASs that only source IPv6
-	as6Only := c.InFirstButNotSecond(as6Set, as4Set)
+	for i := range peers {
+		if peers[i].Address == nil {
+			return nil, outputError("show protocols all", "", errors.New("BGP protocol without a neighbor address"))
+		}
+		if peers[i].State != StateEstablished {
+			peers[i].Uptime = 0
+		}
+	}
+	sortPeers(peers)
 
-	// asBoth is the set of ASs that source both IPv4 and IPv6
-	asBoth := c.Intersection(as4Set, as6Set)
+	return peers, nil
+}
 
-	s.As4 = uint32(len(as4Set))
-	s.As6 = uint32(len(as6Set))
-	s.As10 = uint32(len(as10Set))
-	s.As4Only = uint32(len(as4Only))
-	s.As6Only = uint32(len(as6Only))
-	s.AsBoth = uint32(len(asBoth))
+// birdRouteCounts returns the imported and filtered routes of a channel,
+// i.e. 4 imported, 1 filtered, 0 exported, 3 preferred
+func birdRouteCounts(in string) (uint32, uint32, error) {
+	var imported, filtered uint32
+	for _, count := range strings.Split(in, ",") {
+		fields := strings.Fields(count)
+		if len(fields) != 2 {
+			return 0, 0, fmt.Errorf("invalid route count %q", count)
+		}
+		n, err := c.ParseUint32(fields[0])
+		if err != nil {
+			return 0, 0, err
+		}
+		switch fields[1] {
+		case "imported":
+			imported = n
+		case "filtered":
+			filtered = n
+		}
+	}
 
-	return s, nil
+	return imported, filtered, nil
 }
 
-// GetROAs returns total amount of all ROA states
-func (b Bird2Conn) GetROAs() (Roas, error) {
-	var r Roas
-	var roas []uint32
-	cmds := []string{
-		"/usr/sbin/birdc 'show route primary table master4 where roa_check(roa_v4) = ROA_VALID count' | sed -e '1d'",
-		"/usr/sbin/birdc 'show route primary table master4 where roa_check(roa_v4) = ROA_INVALID count' | sed -e '1d'",
-		"/usr/sbin/birdc 'show route primary table master4 where roa_check(roa_v4) = ROA_UNKNOWN count' | sed -e '1d'",
-		"/usr/sbin/birdc 'show route primary table master6 where roa_check(roa_v6) = ROA_VALID count' | sed -e '1d'",
-		"/usr/sbin/birdc 'show route primary table master6 where roa_check(roa_v6) = ROA_INVALID count' | sed -e '1d'",
-		"/usr/sbin/birdc 'show route primary table master6 where roa_check(roa_v6) = ROA_UNKNOWN count' | sed -e '1d'",
+// tables returns the primary routes of the IPv4 and IPv6 tables, each
+// filtered by its filter if not empty.
+func (b Bird2Conn) tables(ctx context.Context, filter4, filter6 string) ([]route, []route, error) {
+	out, err := b.command(ctx,
+		strings.TrimSpace("show route primary table master4 "+filter4),
+		strings.TrimSpace("show route primary table master6 "+filter6),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	v4, err := birdRoutes(out[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	v6, err := birdRoutes(out[1])
+	if err != nil {
+		return nil, nil, err
 	}
 
-	for _, cmd := range cmds {
-		out, err := c.GetOutput(cmd)
+	return v4, v6, nil
+}
+
+// birdROACounts counts the best routes in each ROA state, as the state of
+// each route isn't shown in the table.
+var birdROACounts = []string{
+	"show route primary table master4 where roa_check(roa_v4) = ROA_VALID count",
+	"show route primary table master4 where roa_check(roa_v4) = ROA_INVALID count",
+	"show route primary table master4 where roa_check(roa_v4) = ROA_UNKNOWN count",
+	"show route primary table master6 where roa_check(roa_v6) = ROA_VALID count",
+	"show route primary table master6 where roa_check(roa_v6) = ROA_INVALID count",
+	"show route primary table master6 where roa_check(roa_v6) = ROA_UNKNOWN count",
+}
+
+// birdROAs returns the ROA states from the replies to birdROACounts.
+func birdROAs(out [][]bird.Line) (Roas, error) {
+	var r Roas
+	var roas []uint32
+	for i, lines := range out {
+		table := "master4"
+		if i > 2 {
+			table = "master6"
+		}
+		n, err := shown(lines, table)
 		if err != nil {
 			return r, err
 		}
-		split := strings.Split(out, " ")
-		roas = append(roas, c.StringToUint32(split[0]))
+		roas = append(roas, n)
 	}
 
 	r.V4v = roas[0]
@@ -145,149 +378,284 @@ func (b Bird2Conn) GetROAs() (Roas, error) {
 
 // GetInvalids returns a map of ASNs that are advertising RPKI invalid prefixes.
 // It also includes all those prefixes being advertised.
-func (b Bird2Conn) GetInvalids() (map[string][]string, error) {
+// Invalids are ignored when bird doesn't show the source ASN (when AS-SET is used)
+func (b Bird2Conn) GetInvalids(ctx context.Context) (map[string][]string, error) {
 	inv := make(map[string][]string)
-	num := regexp.MustCompile(`[\d]+`)
-	cmds := []string{
-		"/usr/sbin/birdc 'show route primary table master4 where roa_check(roa_v4) = ROA_INVALID' | sed -e '1,2d' | awk {'print $NF,$1'}",
-		"/usr/sbin/birdc 'show route primary table master6 where roa_check(roa_v6) = ROA_INVALID' | sed -e '1,2d' | awk {'print $NF,$1'}",
+	v4, v6, err := b.tables(ctx,
+		"where roa_check(roa_v4) = ROA_INVALID",
+		"where roa_check(roa_v6) = ROA_INVALID",
+	)
+	if err != nil {
+		return inv, err
 	}
 
-	for _, cmd := range cmds {
-		out, err := c.GetOutput(cmd)
-		if err != nil {
-			return inv, err
-		}
-		lines := strings.Split(out, "\n")
-		for _, v := range lines {
-			split := strings.Split(v, " ")
-			asn := num.FindString(split[0])
-			// Ignore invalids when bird doesn't show the source ASN (when AS-SET is used)
-			if asn != "" {
-				inv[asn] = append(inv[asn], split[1])
-			}
+	for _, routes := range [][]route{v4, v6} {
+		for i := range routes {
+			routes[i].roa = RInvalid
 		}
+		invalids(routes, inv)
 	}
 
 	return inv, nil
 }
 
-// GetMasks returns the total count of each mask value
-// First item is IPv4, second item is IPv6
-func (b Bird2Conn) GetMasks() ([]map[string]uint32, error) {
-	v6 := make(map[string]uint32)
-	v4 := make(map[string]uint32)
-	var m []map[string]uint32
-
-	cmd := "/usr/sbin/birdc show route primary table master6 | awk {'print $1'} | sed -e '1,2d'"
-	subnetsV6, err := c.GetOutput(cmd)
+// tablesAll returns the primary routes of the IPv4 and IPv6 tables with all
+// of their attributes. Only the origin is shown without 'all'.
+func (b Bird2Conn) tablesAll(ctx context.Context) ([]route, []route, error) {
+	out, err := b.command(ctx,
+		"show route primary table master4 all",
+		"show route primary table master6 all",
+	)
 	if err != nil {
-		return m, err
+		return nil, nil, err
 	}
-	for _, s := range strings.Fields(subnetsV6) {
-		mask := strings.Split(s, "::/")[1]
-		v6[mask]++
-	}
-
-	cmd2 := "/usr/sbin/birdc show route primary table master4 | awk {'print $1'} | sed -e '1,2d'"
-	subnetsV4, err := c.GetOutput(cmd2)
+	v4, err := birdRoutesAll(out[0], nil)
 	if err != nil {
-		return m, err
+		return nil, nil, err
 	}
-	for _, s := range strings.Fields(subnetsV4) {
-		mask := strings.Split(s, "/")[1]
-		v4[mask]++
+	v6, err := birdRoutesAll(out[1], nil)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	m = append(m, v4)
-	m = append(m, v6)
-
-	return m, nil
+	return v4, v6, nil
 }
 
-// GetLargeCommunities returns the amount of prefixes that have large communities attached (RFC8092)
-// TODO: Not sure this is doing the right thing
-func (b Bird2Conn) GetLargeCommunities() (Large, error) {
-	var l Large
-	var comm []uint32
-	cmds := []string{
-		"/usr/sbin/birdc 'show route primary table master4 where bgp_large_community ~ [(*,*,*)]' | sed -e '1,2d' | wc -l",
-		"/usr/sbin/birdc 'show route primary table master6 where bgp_large_community ~ [(*,*,*)]' | sed -e '1,2d' | wc -l",
+// GetTransit returns how many prefixes an ASN transits, and the ASNs
+// seen directly upstream and downstream of it.
+func (b Bird2Conn) GetTransit(ctx context.Context, asn uint32) (Transit, error) {
+	v4, v6, err := b.tablesAll(ctx)
+	if err != nil {
+		return Transit{}, err
 	}
 
-	for _, cmd := range cmds {
-		out, err := c.GetOutput(cmd)
-		if err != nil {
-			return l, err
-		}
-		comm = append(comm, c.StringToUint32(out))
+	return transit(v4, v6, asn), nil
+}
+
+// GetTable returns the best path of every IPv4 and IPv6 route, with all of
+// their attributes. Every path is shown, so that the origin of each is kept
+// and a prefix announced by more than one origin is seen. bird counts the
+// paths and ROA states itself in the same session.
+func (b Bird2Conn) GetTable(ctx context.Context) (*Table, error) {
+	cmds := append([]string{
+		"show route table master4 all",
+		"show route table master6 all",
+		"show route count",
+	}, birdROACounts...)
+	out, err := b.command(ctx, cmds...)
+	if err != nil {
+		return nil, err
+	}
+	o := make(map[string][]uint32)
+	v4, err := birdRoutesAll(out[0], o)
+	if err != nil {
+		return nil, err
 	}
-	l.V4 = comm[0]
-	l.V6 = comm[1]
+	v6, err := birdRoutesAll(out[1], o)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := birdTotals(out[2])
+	if err != nil {
+		return nil, err
+	}
+	roas, err := birdROAs(out[3:])
+	if err != nil {
+		return nil, err
+	}
+
+	table := newTable(v4, v6, o)
+	table.totals = totals
+	table.roas = &roas
 
-	return l, nil
+	return table, nil
 }
 
 // GetIPv4FromSource returns all the IPv4 networks sourced from a source ASN.
-func (b Bird2Conn) GetIPv4FromSource(asn uint32) ([]*net.IPNet, error) {
-	cmd := fmt.Sprintf("/usr/sbin/birdc 'show route primary table master4 where bgp_path ~ [= * %d =]' | grep -Ev 'BIRD|device1|name|info|kernel1|Table' | awk '{print $1}'", asn)
-	out, err := c.GetOutput(cmd)
+func (b Bird2Conn) GetIPv4FromSource(ctx context.Context, asn uint32) ([]*net.IPNet, error) {
+	return b.fromSource(ctx, "master4", asn)
+}
+
+// GetIPv6FromSource returns all the IPv6 networks sourced from a source ASN.
+func (b Bird2Conn) GetIPv6FromSource(ctx context.Context, asn uint32) ([]*net.IPNet, error) {
+	return b.fromSource(ctx, "master6", asn)
+}
+
+// fromSource returns all networks in table where the path ends in asn.
+func (b Bird2Conn) fromSource(ctx context.Context, table string, asn uint32) ([]*net.IPNet, error) {
+	out, err := b.command(ctx, fmt.Sprintf("show route primary table %s where bgp_path ~ [= * %d =]", table, asn))
 	if err != nil {
-		return []*net.IPNet{}, err
+		return nil, err
+	}
+	routes, err := birdRoutes(out[0])
+	if err != nil {
+		return nil, err
 	}
 
 	var ips []*net.IPNet
-
-	for _, address := range strings.Fields(out) {
-		_, net, _ := net.ParseCIDR(address)
-		ips = append(ips, net)
+	for _, r := range routes {
+		ips = append(ips, r.prefix)
 	}
 
 	return ips, nil
 }
 
-// GetIPv6FromSource returns all the IPv6 networks sourced from a source ASN.
-func (b Bird2Conn) GetIPv6FromSource(asn uint32) ([]*net.IPNet, error) {
-	cmd := fmt.Sprintf("/usr/sbin/birdc 'show route primary table master6 where bgp_path ~ [= * %d =]' | grep -Ev 'BIRD|device1|name|info|kernel1|Table' | awk '{print $1}'", asn)
-	out, err := c.GetOutput(cmd)
+// lookup returns the primary route for ip, including the full AS path.
+func (b Bird2Conn) lookup(ctx context.Context, ip net.IP) (route, bool, error) {
+	out, err := b.command(ctx, fmt.Sprintf("show route primary all for %s", ip))
+	var birdErr *bird.Error
+	if errors.As(err, &birdErr) && birdErr.Code == bird.CodeNetworkNotFound {
+		return route{}, false, nil
+	}
 	if err != nil {
-		return nil, err
+		return route{}, false, err
 	}
 
-	var ips []*net.IPNet
+	routes, err := birdRoutesAll(out[0], nil)
+	if err != nil {
+		return route{}, false, err
+	}
+	if len(routes) == 0 {
+		return route{}, false, nil
+	}
+
+	return routes[0], true, nil
+}
+
+// birdPath matches the first line of each path in 'show route all'. Only the
+// first path to a network shows the prefix, and the primary path is marked
+// with a '*', i.e.
+//
+//	1.1.1.0/24           unicast [r1 2023-10-17 from 192.0.2.1] * (100) [AS13335i]
+//	                     unicast [r3 2023-10-17 from 192.0.2.3] (100) [AS64496i]
+var birdPath = regexp.MustCompile(`^(?:(\S+/\d+)\s+)?\w+\s+\[[^\]]*\]\s+(\*)?`)
+
+// birdRoutesAll decodes the output of 'show route all', returning the primary
+// path to each network. Attributes follow each path, so the full AS path and
+// communities are taken from those, i.e.
+// BGP.as_path: 3356 12345 {1212 3434}
+// BGP.community: (3356,2) (65535,65281)
+// BGP.ext_community: (rt, 65000, 100)
+// BGP.large_community: (13335, 1, 100)
+// Routes not from BGP have no AS path. The origin of every path is added to
+// o, unless it's nil.
+func birdRoutesAll(lines []bird.Line, o map[string][]uint32) ([]route, error) {
+	var (
+		paths   []route
+		primary []bool
+	)
+	for _, line := range lines {
+		text := strings.TrimSpace(line.Text)
+		attr, value, ok := strings.Cut(text, ": ")
+		if ok && strings.HasPrefix(attr, "BGP.") {
+			if len(paths) == 0 {
+				return nil, outputError("show route all", line.Text, errors.New("attributes before any route"))
+			}
+			if err := birdAttribute(&paths[len(paths)-1], attr, value); err != nil {
+				return nil, outputError("show route all", line.Text, err)
+			}
+			continue
+		}
+
+		// Table headers and next hops aren't paths.
+		m := birdPath.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		var prefix *net.IPNet
+		if m[1] != "" {
+			var err error
+			if _, prefix, err = net.ParseCIDR(m[1]); err != nil {
+				return nil, outputError("show route all", line.Text, err)
+			}
+		} else {
+			if len(paths) == 0 {
+				return nil, outputError("show route all", line.Text, errors.New("path before any route"))
+			}
+			prefix = paths[len(paths)-1].prefix
+		}
+		paths = append(paths, route{prefix: prefix})
+		primary = append(primary, m[2] != "")
+	}
 
-	for _, address := range strings.Fields(out) {
-		_, net, _ := net.ParseCIDR(address)
-		ips = append(ips, net)
+	var routes []route
+	for i, r := range paths {
+		if o != nil {
+			addOrigin(o, r)
+		}
+		if primary[i] {
+			routes = append(routes, r)
+		}
 	}
 
-	return ips, nil
+	return routes, nil
 }
 
-// GetASPathFromIP will return the AS path, as well as as-set if any from a source IP.
-func (b Bird2Conn) GetASPathFromIP(ip net.IP) (ASPath, bool, error) {
-	var aspath ASPath
+// birdCommunity matches each community in a community attribute.
+var birdCommunity = regexp.MustCompile(`\(([^)]*)\)`)
+
+// birdAttribute adds a single BGP attribute to r. Attributes that aren't
+// needed are ignored.
+func birdAttribute(r *route, attr, value string) error {
+	var comms [][]string
+	for _, m := range birdCommunity.FindAllStringSubmatch(value, -1) {
+		fields := strings.Split(m[1], ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		comms = append(comms, fields)
+	}
 
-	cmd := fmt.Sprintf("/usr/sbin/birdc show route primary all for %s | grep -Ev 'BIRD|device1|name|info|kernel1|Table' | grep as_path | awk '{$1=\"\"; print $0}'", ip.String())
-	out, err := c.GetOutput(cmd)
-	if err != nil {
-		return aspath, false, err
+	var err error
+	switch attr {
+	case "BGP.as_path":
+		r.path.Path, r.path.Set, err = decodeASPaths(value)
+		return err
+	case "BGP.community":
+		for _, comm := range comms {
+			std, err := parseCommunity(strings.Join(comm, ":"))
+			if err != nil {
+				return err
+			}
+			r.comms.standard = append(r.comms.standard, std)
+		}
+	case "BGP.ext_community":
+		for _, comm := range comms {
+			if len(comm) < 2 {
+				return fmt.Errorf("invalid extended community %q", comm)
+			}
+			r.comms.extended = append(r.comms.extended, extCommunity(comm[0], strings.Join(comm[1:], ":")))
+		}
+	case "BGP.large_community":
+		for _, comm := range comms {
+			large, err := parseLargeCommunity(strings.Join(comm, ":"))
+			if err != nil {
+				return err
+			}
+			r.comms.large = append(r.comms.large, large)
+		}
 	}
 
-	// If no route exists, no as-path will exist
-	if out == "" {
-		return aspath, false, nil
+	return nil
+}
+
+// GetASPathFromIP will return the matched prefix and its AS path, as well as as-set if any from a source IP.
+func (b Bird2Conn) GetASPathFromIP(ctx context.Context, ip net.IP) (*net.IPNet, ASPath, bool, error) {
+	r, ok, err := b.lookup(ctx, ip)
+	if err != nil || !ok {
+		return nil, ASPath{}, false, err
 	}
 
-	path, set := decodeASPaths(out)
-	aspath.Path = path
-	aspath.Set = set
+	// If the route is not from BGP, no as-path will exist
+	if len(r.path.Path) == 0 && len(r.path.Set) == 0 {
+		return nil, ASPath{}, false, nil
+	}
 
-	return aspath, true, nil
+	return r.prefix, r.path, true, nil
 }
 
 // decodeASPaths will return a slice of AS & AS-Sets from a string as-path output.
-func decodeASPaths(in string) ([]uint32, []uint32) {
+func decodeASPaths(in string) ([]uint32, []uint32, error) {
 	if strings.ContainsAny(in, "{}") {
 		in = strings.Replace(in, "{", "{ ", 1)
 		in = strings.Replace(in, "}", " }", 1)
@@ -303,74 +671,66 @@ func decodeASPaths(in string) ([]uint32, []uint32) {
 			continue
 		}
 
+		asn, err := c.ParseUint32(as)
+		if err != nil {
+			return nil, nil, err
+		}
 		switch {
 		case isSet == false:
-			path = append(path, c.StringToUint32(as))
+			path = append(path, asn)
 		case isSet == true:
-			set = append(set, c.StringToUint32(as))
+			set = append(set, asn)
 		}
 	}
 
-	return path, set
+	return path, set, nil
 }
 
 // GetRoute will return the current FIB entry, if any, from a source IP.
-func (b Bird2Conn) GetRoute(ip net.IP) (*net.IPNet, bool, error) {
-	cmd := fmt.Sprintf("/usr/sbin/birdc show route primary for %s | grep -Ev 'BIRD|device1|name|info|kernel1|Table' | awk '{print $1}'", ip.String())
-	out, err := c.GetOutput(cmd)
-	if err != nil {
+func (b Bird2Conn) GetRoute(ctx context.Context, ip net.IP) (*net.IPNet, bool, error) {
+	r, ok, err := b.lookup(ctx, ip)
+	if err != nil || !ok {
 		return nil, false, err
 	}
 
-	_, net, err := net.ParseCIDR(out)
-	if err != nil {
-		return nil, false, nil
-	}
-
-	return net, true, nil
+	return r.prefix, true, nil
 }
 
 // GetOriginFromIP will return the origin ASN from a source IP.
-func (b Bird2Conn) GetOriginFromIP(ip net.IP) (uint32, bool, error) {
-	cmd := fmt.Sprintf("/usr/sbin/birdc show route primary all for %s | grep -Ev 'BIRD|device1|name|info|kernel1|Table' | grep as_path | sed 's/{.*}//' | awk {'print $NF'}", ip.String())
-	out, err := c.GetOutput(cmd)
-	if err != nil {
+func (b Bird2Conn) GetOriginFromIP(ctx context.Context, ip net.IP) (uint32, bool, error) {
+	r, ok, err := b.lookup(ctx, ip)
+	if err != nil || !ok {
 		return 0, false, err
 	}
+	o, ok := r.origin()
 
-	num := regexp.MustCompile("[0-9]+")
-	o := num.FindString(out)
-	if o == "" {
-		return 0, false, nil
-	}
-
-	source, err := strconv.Atoi(o)
-	if err != nil {
-		return 0, true, err
-	}
-
-	return uint32(source), true, nil
+	return o, ok, nil
 }
 
+// birdEnum matches the output of evaluating an enum, i.e. (enum 35)1
+var birdEnum = regexp.MustCompile(`^\(enum [0-9a-f]+\)(\d+)$`)
+
 // GetROA will return the ROA status from a prefix and ASN.
 // This function does not check for the existance of the prefix in the table.
-func (b Bird2Conn) GetROA(prefix *net.IPNet, asn uint32) (int, bool, error) {
-	var table string
-	if strings.Contains(prefix.String(), ":") {
+func (b Bird2Conn) GetROA(ctx context.Context, prefix *net.IPNet, asn uint32) (int, bool, error) {
+	table := "roa_v4"
+	if prefix.IP.To4() == nil {
 		table = "roa_v6"
-	} else {
-		table = "roa_v4"
 	}
 
-	cmd := fmt.Sprintf("/usr/sbin/birdc 'eval roa_check(%s, %s, %d)'", table, prefix, asn)
-	out, err := c.GetOutput(cmd)
+	cmd := fmt.Sprintf("eval roa_check(%s, %s, %d)", table, prefix, asn)
+	out, err := b.command(ctx, cmd)
 	if err != nil {
 		return 0, false, err
 	}
-
-	// Get the enum value
-	// example output - (enum 35)1
-	val := out[len(out)-1:]
+	if len(out[0]) == 0 {
+		return 0, false, outputError(cmd, "", errors.New("no result"))
+	}
+	last := out[0][len(out[0])-1].Text
+	m := birdEnum.FindStringSubmatch(strings.TrimSpace(last))
+	if m == nil {
+		return 0, false, outputError(cmd, last, nil)
+	}
 
 	// Check for an existing ROA
 	// 0 = ROA_UNKNOWN
@@ -381,38 +741,44 @@ func (b Bird2Conn) GetROA(prefix *net.IPNet, asn uint32) (int, bool, error) {
 		"2": RInvalid,
 		"1": RValid,
 	}
+	status, ok := statuses[m[1]]
+	if !ok {
+		return 0, false, outputError(cmd, last, errors.New("unknown ROA state"))
+	}
 
-	return statuses[val], true, nil
+	return status, true, nil
 }
 
 // GetVRPs will return all Validated ROA Payloads for an ASN.
-func (b Bird2Conn) GetVRPs(asn uint32) ([]VRP, error) {
-	var VRPs []VRP
-	cmds := []string{
-		fmt.Sprintf("/usr/sbin/birdc show route all table roa_v4 where net.asn=%d | grep -Ev 'BIRD|device1|name|info|kernel1|Table' | grep / | awk {'print $1'}", asn),
-		fmt.Sprintf("/usr/sbin/birdc show route all table roa_v6 where net.asn=%d | grep -Ev 'BIRD|device1|name|info|kernel1|Table' | grep / | awk {'print $1'}", asn),
+// Each ROA is shown like this:
+// 1.1.1.0/24-24 AS13335  [rpki1 2023-10-17] * (100)
+func (b Bird2Conn) GetVRPs(ctx context.Context, asn uint32) ([]VRP, error) {
+	out, err := b.command(ctx,
+		fmt.Sprintf("show route table roa_v4 where net.asn=%d", asn),
+		fmt.Sprintf("show route table roa_v6 where net.asn=%d", asn),
+	)
+	if err != nil {
+		return nil, err
 	}
-	for _, cmd := range cmds {
-		out, err := c.GetOutput(cmd)
-		if err != nil {
-			return VRPs, err
-		}
-		// If the ASN has no VRPS, for either address family or both, continue onwards to prevent trying to split empty output
-		if out == "" {
-			continue
-		}
-		for _, line := range strings.Split(out, "\n") {
-			split := strings.Split(line, "-")
-			_, prefix, err := net.ParseCIDR(split[0])
+
+	var VRPs []VRP
+	for _, lines := range out {
+		for _, line := range lines {
+			fields := strings.Fields(line.Text)
+			if len(fields) == 0 || !strings.Contains(fields[0], "/") {
+				continue
+			}
+			i := strings.LastIndex(fields[0], "-")
+			if i == -1 {
+				return nil, outputError("show route table roa", line.Text, errors.New("no max length"))
+			}
+			_, prefix, err := net.ParseCIDR(fields[0][:i])
 			if err != nil {
-				// Set slice to nil to prevent us sending back a half-filled struct
-				VRPs = nil
-				return VRPs, err
+				return nil, outputError("show route table roa", line.Text, err)
 			}
-			max, err := strconv.Atoi(split[1])
+			max, err := strconv.Atoi(fields[0][i+1:])
 			if err != nil {
-				VRPs = nil
-				return VRPs, err
+				return nil, outputError("show route table roa", line.Text, err)
 			}
 
 			VRPs = append(VRPs, VRP{Prefix: prefix, Max: max})
@@ -1,10 +1,271 @@
 package clidecode
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
 	"reflect"
+	"sort"
 	"testing"
+	"time"
+
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/bird/birdtest"
+	c "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
 )
 
+// birdFixtures maps each bird command to a captured reply in testdata/bird,
+// or to the reply itself for short replies.
+var birdFixtures = map[string]string{
+	"show protocols":                       "protocols.txt",
+	"show protocols all":                   "protocols_all.txt",
+	"show route count":                     "count.txt",
+	"show route primary table master4 all": "master4_all.txt",
+	"show route primary table master6 all": "master6_all.txt",
+	"show route table master4 all":         "master4_paths.txt",
+	"show route table master6 all":         "master6_all.txt",
+	"show route primary table master4 where roa_check(roa_v4) = ROA_VALID count":   "1007-2 of 6 routes for 4 networks in table master4\n0000 \n",
+	"show route primary table master4 where roa_check(roa_v4) = ROA_INVALID count": "1007-1 of 6 routes for 4 networks in table master4\n0000 \n",
+	"show route primary table master4 where roa_check(roa_v4) = ROA_UNKNOWN count": "1007-1 of 6 routes for 4 networks in table master4\n0000 \n",
+	"show route primary table master6 where roa_check(roa_v6) = ROA_VALID count":   "1007-1 of 2 routes for 2 networks in table master6\n0000 \n",
+	"show route primary table master6 where roa_check(roa_v6) = ROA_INVALID count": "1007-1 of 2 routes for 2 networks in table master6\n0000 \n",
+	"show route primary table master6 where roa_check(roa_v6) = ROA_UNKNOWN count": "1007-0 of 2 routes for 2 networks in table master6\n0000 \n",
+	"show route primary table master4 where roa_check(roa_v4) = ROA_INVALID":       "invalid4.txt",
+	"show route primary table master6 where roa_check(roa_v6) = ROA_INVALID":       "invalid6.txt",
+	"show route primary table master4 where bgp_path ~ [= * 3356 =]":               "source4_3356.txt",
+	"show route primary table master6 where bgp_path ~ [= * 13335 =]":              "source6_13335.txt",
+	"show route primary all for 8.8.8.8":                                           "lookup_8.8.8.8.txt",
+	"show route primary all for 9.9.9.9":                                           "lookup_9.9.9.9.txt",
+	"show route primary all for 192.0.2.1":                                         "8001 Network not found\n",
+	"eval roa_check(roa_v4, 1.1.1.0/24, 3356)":                                     "0000 (enum 35)2\n",
+	"eval roa_check(roa_v6, 2606:4700::/32, 13335)":                                "0000 (enum 35)1\n",
+	"show route table roa_v4 where net.asn=13335":                                  "vrps4_13335.txt",
+	"show route table roa_v6 where net.asn=13335":                                  "vrps6_13335.txt",
+}
+
+// newFakeBird starts a fake bird answering from birdFixtures.
+func newFakeBird(t *testing.T) Bird2Conn {
+	t.Helper()
+	replies := make(map[string]string)
+	for cmd, reply := range birdFixtures {
+		if _, err := os.Stat("testdata/bird/" + reply); err == nil {
+			out, err := os.ReadFile("testdata/bird/" + reply)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reply = string(out)
+		}
+		replies[cmd] = reply
+	}
+	srv, err := birdtest.NewServer(replies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+
+	return NewBird2Conn(srv.Socket)
+}
+
+func TestBird2Table(t *testing.T) {
+	got, err := newFakeBird(t).GetTable(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1.1.1.0/24 is prepended in the full table. bird counts the ROA
+	// states itself rather than showing the state of each route.
+	want := withoutROAs(testTable())
+	want.v4[0].path.Path = []uint32{3356, 13335, 13335, 13335}
+	want.roas = &Roas{V4v: 2, V4i: 1, V4u: 1, V6v: 1, V6i: 1}
+	checkTable(t, got, want)
+}
+
+func TestBird2Peers(t *testing.T) {
+	b := newFakeBird(t)
+
+	peers, err := b.GetPeers(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Peers{V4c: 3, V4e: 2, V6c: 1, V6e: 1}); peers != want {
+		t.Errorf("Got %#v, Wanted %#v", peers, want)
+	}
+
+	for asn, want := range tableTransits {
+		got, err := b.GetTransit(t.Context(), asn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d: Got %v, Wanted %v", asn, got, want)
+		}
+	}
+}
+
+func TestBird2PeerDetails(t *testing.T) {
+	b := newFakeBird(t)
+
+	got, err := b.GetPeerDetails(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The uptime depends on the time the test is run, so is only checked
+	// to be set for established peers.
+	for i, p := range got {
+		if (p.Uptime > 0) != (p.State == StateEstablished) {
+			t.Errorf("%s: Got uptime %v when %s", p.Address, p.Uptime, p.State)
+		}
+		got[i].Uptime = 0
+	}
+	want := []PeerDetail{
+		{Address: net.ParseIP("192.0.2.1"), ASN: 3356, State: StateEstablished, V4Received: 5, V4Accepted: 4},
+		{Address: net.ParseIP("192.0.2.2"), ASN: 174, State: StateActive},
+		{Address: net.ParseIP("192.0.2.3"), ASN: 6939, State: StateEstablished, V4Received: 3, V4Accepted: 3},
+		{Address: net.ParseIP("2001:db8::1"), ASN: 6939, State: StateEstablished, V6Received: 2, V6Accepted: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+}
+
+func TestBird2Lookups(t *testing.T) {
+	b := newFakeBird(t)
+
+	route, ok, err := b.GetRoute(t.Context(), net.ParseIP("8.8.8.8"))
+	if err != nil || !ok || route.String() != "8.8.8.0/24" {
+		t.Errorf("GetRoute: got %v, %t, %v", route, ok, err)
+	}
+	origin, ok, err := b.GetOriginFromIP(t.Context(), net.ParseIP("8.8.8.8"))
+	if err != nil || !ok || origin != 15169 {
+		t.Errorf("GetOriginFromIP: got %d, %t, %v", origin, ok, err)
+	}
+	if _, ok, err := b.GetRoute(t.Context(), net.ParseIP("192.0.2.1")); err != nil || ok {
+		t.Errorf("GetRoute for missing route: got %t, %v", ok, err)
+	}
+	if _, _, ok, err := b.GetASPathFromIP(t.Context(), net.ParseIP("192.0.2.1")); err != nil || ok {
+		t.Errorf("GetASPathFromIP for missing route: got %t, %v", ok, err)
+	}
+
+	prefix, path, ok, err := b.GetASPathFromIP(t.Context(), net.ParseIP("9.9.9.9"))
+	wantPath := ASPath{Path: []uint32{6939, 19281}, Set: []uint32{1, 2}}
+	if err != nil || !ok || prefix.String() != "9.9.9.0/24" || !reflect.DeepEqual(path, wantPath) {
+		t.Errorf("GetASPathFromIP: got %v, %v, %t, %v", prefix, path, ok, err)
+	}
+
+	v4, err := b.GetIPv4FromSource(t.Context(), 3356)
+	if err != nil || len(v4) != 1 || v4[0].String() != "8.0.0.0/9" {
+		t.Errorf("GetIPv4FromSource: got %v, %v", v4, err)
+	}
+	v6, err := b.GetIPv6FromSource(t.Context(), 13335)
+	if err != nil || len(v6) != 1 || v6[0].String() != "2606:4700::/32" {
+		t.Errorf("GetIPv6FromSource: got %v, %v", v6, err)
+	}
+
+	// 9.9.9.0/24 is invalid too, but bird doesn't show the origin.
+	inv, err := b.GetInvalids(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantInv := map[string][]string{"15169": {"2001:4860::/32"}}
+	if !reflect.DeepEqual(inv, wantInv) {
+		t.Errorf("GetInvalids: got %v, wanted %v", inv, wantInv)
+	}
+}
+
+func TestBird2ROA(t *testing.T) {
+	b := newFakeBird(t)
+
+	_, prefix, _ := net.ParseCIDR("1.1.1.0/24")
+	if got, ok, err := b.GetROA(t.Context(), prefix, 3356); err != nil || !ok || got != RInvalid {
+		t.Errorf("GetROA: got %d, %t, %v", got, ok, err)
+	}
+	_, prefix, _ = net.ParseCIDR("2606:4700::/32")
+	if got, ok, err := b.GetROA(t.Context(), prefix, 13335); err != nil || !ok || got != RValid {
+		t.Errorf("GetROA: got %d, %t, %v", got, ok, err)
+	}
+
+	vrps, err := b.GetVRPs(t.Context(), 13335)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range vrps {
+		got = append(got, fmt.Sprintf("%s-%d", v.Prefix, v.Max))
+	}
+	sort.Strings(got)
+	if want := []string{"1.1.1.0/24-24", "2606:4700::/32-48"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetVRPs: got %v, wanted %v", got, want)
+	}
+}
+
+func TestBird2Errors(t *testing.T) {
+	b := newFakeBird(t)
+
+	// Not in the fixtures, so the fake returns a syntax error.
+	if _, err := b.GetVRPs(t.Context(), 3356); err == nil {
+		t.Error("expected error on syntax error")
+	}
+	_, prefix, _ := net.ParseCIDR("8.8.8.0/24")
+	if _, ok, err := b.GetROA(t.Context(), prefix, 15169); err == nil || ok {
+		t.Errorf("GetROA: got %t, %v", ok, err)
+	}
+
+	missing := NewBird2Conn(t.TempDir() + "/bird.ctl")
+	if _, err := missing.GetPeers(t.Context()); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Got %v, Wanted %v", err, ErrUnreachable)
+	}
+
+	// Replies bird could never send, i.e. from a half broken bird.
+	replies := map[string]string{
+		"show route table master4 all": "0000 \n",
+		"show route table master6 all": "0000 \n",
+		"show route count":             "0014 Total: 0 of 0 routes for 0 networks in 0 tables\n",
+		"show protocols":               "0000 \n",
+		"show route primary table master4 where bgp_path ~ [= * 13335 =]": "1007-1.1.1.0/24 unicast [r1_v4 2023-10-17] * (100) [AS99999999999i]\n0000 \n",
+		"eval roa_check(roa_v4, 8.8.8.0/24, 15169)":                       "0000 \n",
+	}
+	for _, cmd := range birdROACounts {
+		replies[cmd] = "0000 \n"
+	}
+	srv, err := birdtest.NewServer(replies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	broken := NewBird2Conn(srv.Socket)
+	if _, err := broken.GetTable(t.Context()); !errors.Is(err, ErrUnexpectedOutput) {
+		t.Errorf("GetTable: Got %v, Wanted %v", err, ErrUnexpectedOutput)
+	}
+	if _, err := broken.GetPeers(t.Context()); !errors.Is(err, ErrUnexpectedOutput) {
+		t.Errorf("GetPeers: Got %v, Wanted %v", err, ErrUnexpectedOutput)
+	}
+	if _, err := broken.GetIPv4FromSource(t.Context(), 13335); !errors.Is(err, ErrUnexpectedOutput) {
+		t.Errorf("GetIPv4FromSource: Got %v, Wanted %v", err, ErrUnexpectedOutput)
+	}
+	if _, _, err := broken.GetROA(t.Context(), prefix, 15169); !errors.Is(err, ErrUnexpectedOutput) {
+		t.Errorf("GetROA: Got %v, Wanted %v", err, ErrUnexpectedOutput)
+	}
+}
+
+func TestBird2Timeout(t *testing.T) {
+	// An empty reply is never answered, like a hung bird.
+	srv, err := birdtest.NewServer(map[string]string{"show protocols": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	b := NewBird2Conn(srv.Socket)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+	_, err = b.GetPeers(ctx)
+	var timeout *c.TimeoutError
+	if !errors.As(err, &timeout) {
+		t.Errorf("Got %v, Wanted a TimeoutError", err)
+	}
+}
+
 func TestDecodeASPaths(t *testing.T) {
 	tests := []struct {
 		Name     string
@@ -37,7 +298,10 @@ func TestDecodeASPaths(t *testing.T) {
 	}
 
 	for _, tc := range tests {
-		gotPath, gotSet := decodeASPaths(tc.path)
+		gotPath, gotSet, err := decodeASPaths(tc.path)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.Name, err)
+		}
 		if !reflect.DeepEqual(gotPath, tc.wantPath) {
 			t.Errorf("Got %v, Wanted %v", gotPath, tc.wantPath)
 		}
@@ -47,6 +311,20 @@ func TestDecodeASPaths(t *testing.T) {
 	}
 }
 
+func TestDecodeASPathsErrors(t *testing.T) {
+	// A path that can't be decoded must never be returned as ASN 0.
+	for _, path := range []string{
+		"3356 AS12345",
+		"3356 4294967296",
+		"3356 -1",
+		"3356 {1212 x}",
+	} {
+		if _, _, err := decodeASPaths(path); err == nil {
+			t.Errorf("%s: expected error", path)
+		}
+	}
+}
+
 func BenchmarkDecodeASPaths(b *testing.B) {
 	tests := []struct {
 		Name     string
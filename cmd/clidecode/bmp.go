@@ -0,0 +1,598 @@
+package clidecode
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	c "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+	"github.com/osrg/gobgp/v3/pkg/packet/bmp"
+)
+
+// maxBMPMessage is the largest BMP message accepted. A route monitoring
+// message holds a single BGP update, which is at most 64k even when using
+// extended messages.
+const maxBMPMessage = 1 << 20
+
+// BMPStation is a BGP Monitoring Protocol (RFC7854) station. Routers connect
+// to it and stream the routes received from each of their peers. Each peer's
+// Adj-RIB-In is kept in memory, and a best path is picked for each prefix
+// across all peers so the station can answer the same queries as a router.
+//
+// The best path is the one with the shortest AS path, with ties going to
+// the lowest peer address. Only peers of the global routing table are
+// monitored, so VRF and Loc-RIB peers are ignored.
+//
+// BMP carries no validation state, so all routes are RPKI unknown.
+type BMPStation struct {
+	// PostPolicy uses post-policy route monitoring rather than pre-policy.
+	// Routers may send both, but only one can be used.
+	PostPolicy bool
+
+	mu    sync.RWMutex
+	peers map[bmpPeerKey]*bmpPeer
+	best  c.Trie[route]
+}
+
+// bmpPeerKey identifies a peer. The same peer address can be monitored by
+// more than one router.
+type bmpPeerKey struct {
+	router, addr string
+}
+
+func (k bmpPeerKey) less(o bmpPeerKey) bool {
+	if k.addr != o.addr {
+		return k.addr < o.addr
+	}
+	return k.router < o.router
+}
+
+type bmpPeer struct {
+	addr   net.IP
+	asn    uint32
+	up     bool
+	since  time.Time
+	routes map[string]route
+	stats  map[uint16]uint64
+}
+
+// BMPPeer is the state of a single monitored peer.
+type BMPPeer struct {
+	Router  string
+	Address net.IP
+	ASN     uint32
+	Up      bool
+	// Routes is the amount of routes in the Adj-RIB-In.
+	Routes int
+	// Stats are the counters from the last statistics report, keyed by
+	// stat type. Per AFI/SAFI counters are summed.
+	Stats map[uint16]uint64
+}
+
+// NewBMPStation returns an empty BMPStation.
+func NewBMPStation() *BMPStation {
+	return &BMPStation{
+		peers: make(map[bmpPeerKey]*bmpPeer),
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and then calls Serve.
+func (s *BMPStation) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts BMP sessions on l until l is closed. The routes from a
+// router are dropped when its session ends, as they can no longer be kept
+// up to date.
+func (s *BMPStation) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			router := conn.RemoteAddr().String()
+			if err := s.session(router, conn); err != nil {
+				log.Printf("BMP session from %s failed: %v", router, err)
+			}
+			s.dropRouter(router)
+		}()
+	}
+}
+
+// Replay reads a captured BMP stream as if it was sent by router. Unlike a
+// live session, the routes are kept once the stream has been read.
+func (s *BMPStation) Replay(router string, r io.Reader) error {
+	return s.session(router, r)
+}
+
+// session reads BMP messages from r until the stream ends or the router
+// terminates the session.
+func (s *BMPStation) session(router string, r io.Reader) error {
+	hdr := make([]byte, bmp.BMP_HEADER_SIZE)
+	for {
+		if _, err := io.ReadFull(r, hdr); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("unable to read BMP header: %w", err)
+		}
+		var h bmp.BMPHeader
+		if err := h.DecodeFromBytes(hdr); err != nil {
+			return outputError("BMP from "+router, "", fmt.Errorf("invalid header: %w", err))
+		}
+		if h.Length < bmp.BMP_HEADER_SIZE || h.Length > maxBMPMessage {
+			return outputError("BMP from "+router, "", fmt.Errorf("invalid message length %d", h.Length))
+		}
+		data := make([]byte, h.Length)
+		copy(data, hdr)
+		if _, err := io.ReadFull(r, data[bmp.BMP_HEADER_SIZE:]); err != nil {
+			return fmt.Errorf("unable to read BMP message: %w", err)
+		}
+
+		msg, err := bmp.ParseBMPMessage(data)
+		if err != nil {
+			return outputError("BMP from "+router, "", err)
+		}
+		if msg.Header.Type == bmp.BMP_MSG_TERMINATION {
+			return nil
+		}
+		if err := s.handle(router, msg); err != nil {
+			return err
+		}
+	}
+}
+
+// handle applies a single message to the RIB. Initiation and route mirroring
+// messages carry nothing of use, so are ignored.
+func (s *BMPStation) handle(router string, msg *bmp.BMPMessage) error {
+	switch msg.Header.Type {
+	case bmp.BMP_MSG_ROUTE_MONITORING, bmp.BMP_MSG_PEER_UP_NOTIFICATION,
+		bmp.BMP_MSG_PEER_DOWN_NOTIFICATION, bmp.BMP_MSG_STATISTICS_REPORT:
+	default:
+		return nil
+	}
+	ph := msg.PeerHeader
+	if ph.PeerType != bmp.BMP_PEER_TYPE_GLOBAL {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := bmpPeerKey{router: router, addr: ph.PeerAddress.String()}
+	p, ok := s.peers[key]
+	if !ok {
+		// Routes can be monitored before the peer up is seen, i.e. when
+		// the station restarts.
+		p = &bmpPeer{
+			addr:   ph.PeerAddress,
+			up:     true,
+			routes: make(map[string]route),
+		}
+		s.peers[key] = p
+	}
+	p.asn = ph.PeerAS
+
+	switch body := msg.Body.(type) {
+	case *bmp.BMPPeerUpNotification:
+		p.up = true
+		// The timestamp is optional, and zero when not given.
+		p.since = time.Time{}
+		if ph.Timestamp > 0 {
+			p.since = time.UnixMilli(int64(ph.Timestamp * 1000))
+		}
+	case *bmp.BMPPeerDownNotification:
+		p.up = false
+		p.since = time.Time{}
+		s.flush(p)
+	case *bmp.BMPStatisticsReport:
+		stats := make(map[uint16]uint64)
+		for _, stat := range body.Stats {
+			switch st := stat.(type) {
+			case *bmp.BMPStatsTLV32:
+				stats[st.Type] = uint64(st.Value)
+			case *bmp.BMPStatsTLV64:
+				stats[st.Type] = st.Value
+			case *bmp.BMPStatsTLVPerAfiSafi64:
+				stats[st.Type] += st.Value
+			}
+		}
+		p.stats = stats
+	case *bmp.BMPRouteMonitoring:
+		if ph.IsAdjRIBOut() || ph.IsPostPolicy() != s.PostPolicy {
+			return nil
+		}
+		update, ok := body.BGPUpdate.Body.(*bgp.BGPUpdate)
+		if !ok {
+			return outputError("BMP from "+router, key.addr, errors.New("route monitoring without a BGP update"))
+		}
+		return s.update(p, update)
+	}
+
+	return nil
+}
+
+// update applies a BGP update to the Adj-RIB-In of a peer.
+func (s *BMPStation) update(p *bmpPeer, u *bgp.BGPUpdate) error {
+	var withdrawn, nlri []bgp.AddrPrefixInterface
+	for _, w := range u.WithdrawnRoutes {
+		withdrawn = append(withdrawn, w)
+	}
+	for _, n := range u.NLRI {
+		nlri = append(nlri, n)
+	}
+
+	var r route
+	var as4 *bgp.PathAttributeAs4Path
+	for _, attr := range u.PathAttributes {
+		switch a := attr.(type) {
+		case *bgp.PathAttributeAsPath:
+			r.path = decodeASPathAttr(a)
+		case *bgp.PathAttributeAs4Path:
+			as4 = a
+		case *bgp.PathAttributeMpReachNLRI:
+			if isUnicast(a.AFI, a.SAFI) {
+				nlri = append(nlri, a.Value...)
+			}
+		case *bgp.PathAttributeMpUnreachNLRI:
+			if isUnicast(a.AFI, a.SAFI) {
+				withdrawn = append(withdrawn, a.Value...)
+			}
+		default:
+			addCommunityAttr(&r, a)
+		}
+	}
+	if as4 != nil {
+		r.path = mergeAS4Path(r.path, as4)
+	}
+
+	for _, w := range withdrawn {
+		prefix, err := parseNLRI(w)
+		if err != nil {
+			return err
+		}
+		delete(p.routes, prefix.String())
+		s.bestPath(prefix)
+	}
+	for _, n := range nlri {
+		prefix, err := parseNLRI(n)
+		if err != nil {
+			return err
+		}
+		r.prefix = prefix
+		p.routes[prefix.String()] = r
+		s.bestPath(prefix)
+	}
+
+	return nil
+}
+
+func isUnicast(afi uint16, safi uint8) bool {
+	return (afi == bgp.AFI_IP || afi == bgp.AFI_IP6) && safi == bgp.SAFI_UNICAST
+}
+
+func parseNLRI(n bgp.AddrPrefixInterface) (*net.IPNet, error) {
+	_, prefix, err := net.ParseCIDR(n.String())
+	if err != nil {
+		return nil, outputError("BMP", n.String(), err)
+	}
+	return prefix, nil
+}
+
+// mergeAS4Path rebuilds the full AS path from a 2-byte AS_PATH and AS4_PATH
+// (RFC6793 4.2.3). The leading ASNs of AS_PATH that are missing from AS4_PATH
+// are kept, and AS4_PATH is used for the rest. An AS4_PATH longer than
+// AS_PATH is invalid, so is ignored.
+func mergeAS4Path(p ASPath, attr *bgp.PathAttributeAs4Path) ASPath {
+	var as4 ASPath
+	for _, seg := range attr.Value {
+		switch seg.Type {
+		case bgp.BGP_ASPATH_ATTR_TYPE_SEQ:
+			as4.Path = append(as4.Path, seg.AS...)
+		case bgp.BGP_ASPATH_ATTR_TYPE_SET:
+			as4.Set = append(as4.Set, seg.AS...)
+		}
+	}
+	keep := pathLen(p) - pathLen(as4)
+	if keep < 0 {
+		return p
+	}
+	keep = min(keep, len(p.Path))
+
+	var merged ASPath
+	merged.Path = append(merged.Path, p.Path[:keep]...)
+	merged.Path = append(merged.Path, as4.Path...)
+	merged.Set = as4.Set
+
+	return merged
+}
+
+// bestPath picks the best path for prefix across all peers. It must be
+// called with the lock held.
+func (s *BMPStation) bestPath(prefix *net.IPNet) {
+	key, ok := toPrefix(prefix)
+	if !ok {
+		return
+	}
+
+	var best route
+	var bestPeer bmpPeerKey
+	var found bool
+	for peer, p := range s.peers {
+		r, ok := p.routes[prefix.String()]
+		if !ok {
+			continue
+		}
+		if found {
+			l, bestLen := pathLen(r.path), pathLen(best.path)
+			if l > bestLen || (l == bestLen && !peer.less(bestPeer)) {
+				continue
+			}
+		}
+		best, bestPeer, found = r, peer, true
+	}
+
+	if found {
+		s.best.Insert(key, best)
+	} else {
+		s.best.Delete(key)
+	}
+}
+
+// flush removes every route of a peer. It must be called with the lock held.
+func (s *BMPStation) flush(p *bmpPeer) {
+	for key, r := range p.routes {
+		delete(p.routes, key)
+		s.bestPath(r.prefix)
+	}
+}
+
+// dropRouter removes all peers monitored by router.
+func (s *BMPStation) dropRouter(router string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, p := range s.peers {
+		if key.router != router {
+			continue
+		}
+		s.flush(p)
+		delete(s.peers, key)
+	}
+}
+
+// Peers returns the state of every monitored peer, ordered by router and
+// then peer address.
+func (s *BMPStation) Peers() []BMPPeer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var peers []BMPPeer
+	for key, p := range s.peers {
+		stats := make(map[uint16]uint64, len(p.stats))
+		for k, v := range p.stats {
+			stats[k] = v
+		}
+		peers = append(peers, BMPPeer{
+			Router:  key.router,
+			Address: p.addr,
+			ASN:     p.asn,
+			Up:      p.up,
+			Routes:  len(p.routes),
+			Stats:   stats,
+		})
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		if peers[i].Router != peers[j].Router {
+			return peers[i].Router < peers[j].Router
+		}
+		return bytes.Compare(peers[i].Address.To16(), peers[j].Address.To16()) < 0
+	})
+
+	return peers
+}
+
+// routes returns the best paths for IPv4 and IPv6.
+func (s *BMPStation) routes() ([]route, []route) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var v4, v6 []route
+	for _, r := range s.best.All() {
+		if r.prefix.IP.To4() != nil {
+			v4 = append(v4, r)
+		} else {
+			v6 = append(v6, r)
+		}
+	}
+
+	return v4, v6
+}
+
+// GetPeers returns ipv4 peer configured, established. ipv6 peers configured, established
+// The address family of a peer is the family of the peer address.
+func (s *BMPStation) GetPeers(context.Context) (Peers, error) {
+	var p Peers
+	for _, peer := range s.Peers() {
+		if peer.Address.To4() != nil {
+			p.V4c++
+			if peer.Up {
+				p.V4e++
+			}
+			continue
+		}
+		p.V6c++
+		if peer.Up {
+			p.V6e++
+		}
+	}
+
+	return p, nil
+}
+
+// GetPeerDetails returns the state of each peer, and the amount of
+// prefixes received from it for each address family.
+// Only one Adj-RIB-In is kept, so received and accepted are the same. A
+// peer monitored by more than one router is shown as the first router
+// sees it.
+func (s *BMPStation) GetPeerDetails(context.Context) ([]PeerDetail, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]bmpPeerKey, 0, len(s.peers))
+	for key := range s.peers {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].router != keys[j].router {
+			return keys[i].router < keys[j].router
+		}
+		return keys[i].addr < keys[j].addr
+	})
+
+	var peers []PeerDetail
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if seen[key.addr] {
+			continue
+		}
+		seen[key.addr] = true
+
+		p := s.peers[key]
+		d := PeerDetail{Address: p.addr, ASN: p.asn, State: StateIdle}
+		if p.up {
+			d.State = StateEstablished
+			if !p.since.IsZero() {
+				d.Uptime = time.Since(p.since).Truncate(time.Second)
+			}
+		}
+		for _, r := range p.routes {
+			if r.prefix.IP.To4() != nil {
+				d.V4Received++
+			} else {
+				d.V6Received++
+			}
+		}
+		d.V4Accepted, d.V6Accepted = d.V4Received, d.V6Received
+		peers = append(peers, d)
+	}
+	sortPeers(peers)
+
+	return peers, nil
+}
+
+// GetTransit returns how many prefixes an ASN transits, and the ASNs
+// seen directly upstream and downstream of it.
+func (s *BMPStation) GetTransit(_ context.Context, asn uint32) (Transit, error) {
+	v4, v6 := s.routes()
+	return transit(v4, v6, asn), nil
+}
+
+// GetTable returns the best path of every IPv4 and IPv6 route, with all of
+// their attributes.
+// The origin of every path in the Adj-RIB-In of every peer is kept, and each
+// of those paths is counted in the rib.
+func (s *BMPStation) GetTable(context.Context) (*Table, error) {
+	v4, v6 := s.routes()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	o := make(map[string][]uint32)
+	var rib4, rib6 uint32
+	for _, p := range s.peers {
+		for _, r := range p.routes {
+			addOrigin(o, r)
+			if r.prefix.IP.To4() != nil {
+				rib4++
+			} else {
+				rib6++
+			}
+		}
+	}
+
+	table := newTable(v4, v6, o)
+	table.totals.V4Rib, table.totals.V6Rib = rib4, rib6
+
+	return table, nil
+}
+
+// GetIPv4FromSource returns all the IPv4 networks sourced from a source ASN.
+func (s *BMPStation) GetIPv4FromSource(_ context.Context, asn uint32) ([]*net.IPNet, error) {
+	v4, _ := s.routes()
+	return fromSource(v4, asn), nil
+}
+
+// GetIPv6FromSource returns all the IPv6 networks sourced from a source ASN.
+func (s *BMPStation) GetIPv6FromSource(_ context.Context, asn uint32) ([]*net.IPNet, error) {
+	_, v6 := s.routes()
+	return fromSource(v6, asn), nil
+}
+
+// GetOriginFromIP will return the origin ASN from a source IP.
+func (s *BMPStation) GetOriginFromIP(_ context.Context, ip net.IP) (uint32, bool, error) {
+	r, ok := s.lookup(ip)
+	if !ok {
+		return 0, false, nil
+	}
+	o, ok := r.origin()
+
+	return o, ok, nil
+}
+
+// GetASPathFromIP will return the matched prefix and its AS path, as well as as-set if any from a source IP.
+func (s *BMPStation) GetASPathFromIP(_ context.Context, ip net.IP) (*net.IPNet, ASPath, bool, error) {
+	r, ok := s.lookup(ip)
+	if !ok {
+		return nil, ASPath{}, false, nil
+	}
+
+	return r.prefix, r.path, true, nil
+}
+
+// GetRoute will return the current FIB entry, if any, from a source IP.
+func (s *BMPStation) GetRoute(_ context.Context, ip net.IP) (*net.IPNet, bool, error) {
+	r, ok := s.lookup(ip)
+	if !ok {
+		return nil, false, nil
+	}
+
+	return r.prefix, true, nil
+}
+
+// lookup returns the best path for the longest prefix covering ip.
+func (s *BMPStation) lookup(ip net.IP) (route, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return longestMatch(&s.best, ip)
+}
+
+// GetROA will return the ROA status from a prefix and ASN.
+// BMP has no VRPs, so the status is never known.
+func (s *BMPStation) GetROA(context.Context, *net.IPNet, uint32) (int, bool, error) {
+	return RUnknown, false, nil
+}
+
+// GetVRPs will return all Validated ROA Payloads for an ASN.
+// BMP has no VRPs, so there are never any.
+func (s *BMPStation) GetVRPs(context.Context, uint32) ([]VRP, error) {
+	return nil, nil
+}
+
+// GetInvalids returns a map of ASNs that are advertising RPKI invalid prefixes.
+// BMP carries no validation state, so there are never any.
+func (s *BMPStation) GetInvalids(context.Context) (map[string][]string, error) {
+	return map[string][]string{}, nil
+}
@@ -0,0 +1,307 @@
+package clidecode
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+	"github.com/osrg/gobgp/v3/pkg/packet/bmp"
+)
+
+func replayBMP(t *testing.T, s *BMPStation) {
+	t.Helper()
+	f, err := os.Open("testdata/bmp/session.bmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := s.Replay("rtr1", f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBMPTable(t *testing.T) {
+	s := NewBMPStation()
+	replayBMP(t, s)
+	got, err := s.GetTable(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Routes carry no validation state, each peer has a single path, and
+	// the stream only carries large communities.
+	want := withoutROAs(testTable())
+	want.origins = nil
+	want.v4[0].comms = communities{large: []string{"3356:1:0"}}
+	want.v4[1].comms = communities{}
+	want.v4[2].comms = communities{}
+	want.v4[3].comms = communities{large: []string{"6939:1:1", "6939:1:2"}}
+	want.v6[0].comms = communities{large: []string{"6939:1:0"}}
+	want.v6[1].comms = communities{}
+	checkTable(t, got, want)
+}
+
+func TestBMP(t *testing.T) {
+	s := NewBMPStation()
+	replayBMP(t, s)
+
+	peers, _ := s.GetPeers(t.Context())
+	if want := (Peers{V4c: 3, V4e: 2, V6c: 1, V6e: 1}); peers != want {
+		t.Errorf("Got %#v, Wanted %#v", peers, want)
+	}
+	for asn, want := range tableTransits {
+		got, _ := s.GetTransit(t.Context(), asn)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d: Got %v, Wanted %v", asn, got, want)
+		}
+	}
+	wantPeers := []BMPPeer{
+		{
+			Router:  "rtr1",
+			Address: net.ParseIP("192.0.2.1").To4(),
+			ASN:     3356,
+			Up:      true,
+			Routes:  3,
+			Stats: map[uint16]uint64{
+				bmp.BMP_STAT_TYPE_REJECTED:                5,
+				bmp.BMP_STAT_TYPE_ADJ_RIB_IN:              3,
+				bmp.BMP_STAT_TYPE_PER_AFI_SAFI_ADJ_RIB_IN: 3,
+			},
+		},
+		{Router: "rtr1", Address: net.ParseIP("192.0.2.2").To4(), ASN: 6939, Up: true, Routes: 3, Stats: map[uint16]uint64{}},
+		{Router: "rtr1", Address: net.ParseIP("192.0.2.3").To4(), ASN: 64500, Stats: map[uint16]uint64{}},
+		{Router: "rtr1", Address: net.ParseIP("2001:db8::1"), ASN: 6939, Up: true, Routes: 2, Stats: map[uint16]uint64{}},
+	}
+	if got := s.Peers(); !reflect.DeepEqual(got, wantPeers) {
+		t.Errorf("Got %+v, Wanted %+v", got, wantPeers)
+	}
+
+	// The uptime is from the peer up timestamp, so depends on when the
+	// test is run.
+	details, _ := s.GetPeerDetails(t.Context())
+	for i, p := range details {
+		if (p.Uptime > 0) != (p.State == StateEstablished) {
+			t.Errorf("%s: Got uptime %v when %s", p.Address, p.Uptime, p.State)
+		}
+		details[i].Uptime = 0
+	}
+	wantDetails := []PeerDetail{
+		{Address: net.ParseIP("192.0.2.1").To4(), ASN: 3356, State: StateEstablished, V4Received: 3, V4Accepted: 3},
+		{Address: net.ParseIP("192.0.2.2").To4(), ASN: 6939, State: StateEstablished, V4Received: 3, V4Accepted: 3},
+		{Address: net.ParseIP("192.0.2.3").To4(), ASN: 64500, State: StateIdle},
+		{Address: net.ParseIP("2001:db8::1"), ASN: 6939, State: StateEstablished, V6Received: 2, V6Accepted: 2},
+	}
+	if !reflect.DeepEqual(details, wantDetails) {
+		t.Errorf("Got %v, Wanted %v", details, wantDetails)
+	}
+}
+
+func TestBMPLookups(t *testing.T) {
+	s := NewBMPStation()
+	replayBMP(t, s)
+
+	tests := []struct {
+		ip     string
+		route  string
+		origin uint32
+		path   ASPath
+	}{
+		{
+			// Both paths are the same length, so the lowest peer wins.
+			ip:     "1.1.1.1",
+			route:  "1.1.1.0/24",
+			origin: 13335,
+			path:   ASPath{Path: []uint32{3356, 13335}},
+		},
+		{
+			// The shorter path went away with its peer.
+			ip:     "8.8.8.8",
+			route:  "8.8.8.0/24",
+			origin: 15169,
+			path:   ASPath{Path: []uint32{3356, 15169}},
+		},
+		{
+			ip:     "9.9.9.9",
+			route:  "9.9.9.0/24",
+			origin: 19281,
+			path:   ASPath{Path: []uint32{6939, 19281}, Set: []uint32{1, 2}},
+		},
+		{
+			ip:     "2606:4700::1111",
+			route:  "2606:4700::/32",
+			origin: 13335,
+			path:   ASPath{Path: []uint32{6939, 13335}},
+		},
+	}
+	for _, tc := range tests {
+		ip := net.ParseIP(tc.ip)
+		route, ok, err := s.GetRoute(t.Context(), ip)
+		if err != nil || !ok || route.String() != tc.route {
+			t.Errorf("GetRoute(%s): got %v, %t, %v", tc.ip, route, ok, err)
+		}
+		origin, ok, err := s.GetOriginFromIP(t.Context(), ip)
+		if err != nil || !ok || origin != tc.origin {
+			t.Errorf("GetOriginFromIP(%s): got %d, %t, %v", tc.ip, origin, ok, err)
+		}
+		prefix, path, ok, err := s.GetASPathFromIP(t.Context(), ip)
+		if err != nil || !ok || prefix.String() != tc.route || !reflect.DeepEqual(path, tc.path) {
+			t.Errorf("GetASPathFromIP(%s): got %v, %v, %t, %v", tc.ip, prefix, path, ok, err)
+		}
+	}
+
+	// Withdrawn, post-policy and never announced routes.
+	for _, ip := range []string{"203.0.113.1", "10.0.0.1", "2001:db8:ffff::1", "192.0.2.1"} {
+		if _, ok, err := s.GetRoute(t.Context(), net.ParseIP(ip)); err != nil || ok {
+			t.Errorf("GetRoute(%s): got %t, %v", ip, ok, err)
+		}
+	}
+
+	v6, err := s.GetIPv6FromSource(t.Context(), 15169)
+	if err != nil || len(v6) != 1 || v6[0].String() != "2001:4860::/32" {
+		t.Errorf("GetIPv6FromSource: got %v, %v", v6, err)
+	}
+}
+
+func TestBMPPostPolicy(t *testing.T) {
+	s := NewBMPStation()
+	s.PostPolicy = true
+	replayBMP(t, s)
+
+	table, _ := s.GetTable(t.Context())
+	totals := table.Totals()
+	if want := (Totals{V4Rib: 1, V4Fib: 1}); totals != want {
+		t.Errorf("Got %#v, Wanted %#v", totals, want)
+	}
+	if _, ok, _ := s.GetRoute(t.Context(), net.ParseIP("10.0.0.1")); !ok {
+		t.Error("expected post-policy route")
+	}
+}
+
+func TestBMPServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s := NewBMPStation()
+	go s.Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := *bmp.NewBMPPeerHeader(bmp.BMP_PEER_TYPE_GLOBAL, 0, 0, "192.0.2.1", 3356, "192.0.2.1", 0)
+	update := bgp.NewBGPUpdateMessage(nil, []bgp.PathAttributeInterface{
+		bgp.NewPathAttributeOrigin(0),
+		bgp.NewPathAttributeAsPath([]bgp.AsPathParamInterface{
+			bgp.NewAs4PathParam(bgp.BGP_ASPATH_ATTR_TYPE_SEQ, []uint32{3356, 13335}),
+		}),
+		bgp.NewPathAttributeNextHop("192.0.2.1"),
+	}, []*bgp.IPAddrPrefix{bgp.NewIPAddrPrefix(24, "1.1.1.0")})
+	for _, msg := range []*bmp.BMPMessage{
+		bmp.NewBMPInitiation(nil),
+		bmp.NewBMPPeerUpNotification(peer, "192.0.2.254", 179, 40000,
+			bgp.NewBGPOpenMessage(65000, 90, "192.0.2.254", nil),
+			bgp.NewBGPOpenMessage(3356, 90, "192.0.2.1", nil)),
+		bmp.NewBMPRouteMonitoring(peer, update),
+	} {
+		b, err := msg.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitFor := func(want Totals) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			table, _ := s.GetTable(t.Context())
+			got := table.Totals()
+			if got == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Got %#v, Wanted %#v", got, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor(Totals{V4Rib: 1, V4Fib: 1})
+
+	// Routes can't be kept up to date once the router goes away.
+	conn.Close()
+	waitFor(Totals{})
+	if peers := s.Peers(); len(peers) != 0 {
+		t.Errorf("Got %v, Wanted no peers", peers)
+	}
+}
+
+func TestBMPBadStream(t *testing.T) {
+	stream, err := os.ReadFile("testdata/bmp/session.bmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	badVersion := append([]byte{}, stream...)
+	badVersion[0] = 1
+	badLength := append([]byte{}, stream...)
+	copy(badLength[1:5], []byte{0, 0, 0, 2})
+
+	tests := []struct {
+		desc   string
+		stream []byte
+	}{
+		{desc: "truncated stream", stream: stream[:len(stream)-10]},
+		{desc: "truncated header", stream: stream[:3]},
+		{desc: "wrong version", stream: badVersion},
+		{desc: "length shorter than the header", stream: badLength},
+	}
+	for _, tc := range tests {
+		if err := NewBMPStation().Replay("rtr1", bytes.NewReader(tc.stream)); err == nil {
+			t.Errorf("%s: expected error", tc.desc)
+		}
+	}
+}
+
+func TestMergeAS4Path(t *testing.T) {
+	tests := []struct {
+		desc string
+		path ASPath
+		as4  []uint32
+		want ASPath
+	}{
+		{
+			desc: "new speakers at the end",
+			path: ASPath{Path: []uint32{23456, 23456}},
+			as4:  []uint32{4200000000, 4200000001},
+			want: ASPath{Path: []uint32{4200000000, 4200000001}},
+		},
+		{
+			desc: "old speakers at the start",
+			path: ASPath{Path: []uint32{6939, 3356, 23456}},
+			as4:  []uint32{3356, 4200000000},
+			want: ASPath{Path: []uint32{6939, 3356, 4200000000}},
+		},
+		{
+			desc: "AS4_PATH longer than AS_PATH is ignored",
+			path: ASPath{Path: []uint32{23456}},
+			as4:  []uint32{3356, 4200000000},
+			want: ASPath{Path: []uint32{23456}},
+		},
+	}
+	for _, tc := range tests {
+		attr := bgp.NewPathAttributeAs4Path([]*bgp.As4PathParam{
+			bgp.NewAs4PathParam(bgp.BGP_ASPATH_ATTR_TYPE_SEQ, tc.as4),
+		})
+		if got := mergeAS4Path(tc.path, attr); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: Got %v, Wanted %v", tc.desc, got, tc.want)
+		}
+	}
+}
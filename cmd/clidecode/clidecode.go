@@ -1,54 +1,63 @@
 package clidecode
 
-import "net"
+import (
+	"context"
+	"net"
+	"time"
 
-// Decoder is an interface that represents a router to interrogate
-type Decoder interface {
-	// GetBGPTotal returns rib, fib ipv4. rib, fib ipv6
-	GetBGPTotal() (Totals, error)
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/bogon"
+)
 
+// Decoder is an interface that represents a router to interrogate.
+// Every method gives up once ctx is done, killing any command it's running.
+// When ctx passes its deadline, the error returned wraps a *common.TimeoutError.
+type Decoder interface {
 	// GetPeers returns ipv4 peer configured, established. ipv6 peers configured, established
-	GetPeers() (Peers, error)
+	GetPeers(context.Context) (Peers, error)
 
-	// GetTotalSourceASNs returns total amount of unique ASNs
-	GetTotalSourceASNs() (ASNs, error)
+	// GetPeerDetails returns the state of each peer, and the amount of
+	// prefixes received from it for each address family.
+	GetPeerDetails(context.Context) ([]PeerDetail, error)
 
-	// GetMasks returns the total count of each mask value
-	// First item is IPv4, second item is IPv6
-	GetMasks() ([]map[string]uint32, error)
+	// GetTransit returns how many prefixes an ASN transits, and the ASNs
+	// seen directly upstream and downstream of it.
+	GetTransit(context.Context, uint32) (Transit, error)
 
-	// GetROAs returns total amount of all ROA states
-	GetROAs() (Roas, error)
-
-	// GetLargeCommunities returns the amount of prefixes that have large communities attached (RFC8092)
-	GetLargeCommunities() (Large, error)
+	// GetTable returns the best path of every route, with all of their
+	// attributes. Every statistic of the table is worked out from the one copy.
+	GetTable(context.Context) (*Table, error)
 
 	// GetIPv4FromSource returns all the IPv4 networks sourced from a source ASN.
-	GetIPv4FromSource(uint32) ([]*net.IPNet, error)
+	GetIPv4FromSource(context.Context, uint32) ([]*net.IPNet, error)
 
 	// GetIPv6FromSource returns all the IPv6 networks sourced from a source ASN.
-	GetIPv6FromSource(uint32) ([]*net.IPNet, error)
+	GetIPv6FromSource(context.Context, uint32) ([]*net.IPNet, error)
 
 	// GetOriginFromIP will return the origin ASN from a source IP.
-	GetOriginFromIP(net.IP) (uint32, bool, error)
+	GetOriginFromIP(context.Context, net.IP) (uint32, bool, error)
 
-	// GetASPathFromIP will return the AS path, as well as as-set if any from a source IP.
-	GetASPathFromIP(net.IP) (ASPath, bool, error)
+	// GetASPathFromIP will return the matched prefix and its AS path, as well as as-set if any from a source IP.
+	GetASPathFromIP(context.Context, net.IP) (*net.IPNet, ASPath, bool, error)
 
 	// GetRoute will return the current FIB entry, if any, from a source IP.
-	GetRoute(net.IP) (*net.IPNet, bool, error)
+	GetRoute(context.Context, net.IP) (*net.IPNet, bool, error)
 
 	// GetROA will return the ROA status, if any, from a source IP and ASN.
-	GetROA(*net.IPNet, uint32) (int, bool, error)
+	GetROA(context.Context, *net.IPNet, uint32) (int, bool, error)
 
 	// GetVRPs will return all Validated ROA Payloads for an ASN.
-	GetVRPs(uint32) ([]VRP, error)
+	GetVRPs(context.Context, uint32) ([]VRP, error)
 
 	// GetInvalids returns a map of ASNs that are advertising RPKI invalid prefixes.
 	// It also includes all those prefixes being advertised.
-	GetInvalids() (map[string][]string, error)
+	GetInvalids(context.Context) (map[string][]string, error)
 }
 
+// Runner runs a router CLI command and returns its output. Decoders that
+// shell out take a Runner so they can be tested against captured output.
+// The command must be killed once ctx is done.
+type Runner func(ctx context.Context, cmd string) ([]byte, error)
+
 // Totals holds the total BGP route count.
 type Totals struct {
 	V4Rib, V4Fib uint32
@@ -63,6 +72,21 @@ type Peers struct {
 	V6c, V6e uint32
 }
 
+// PeerDetail holds the state of a single peer.
+// State:    the session state, named as in RFC4271, i.e. Established
+// Uptime:   how long the session has been established, if known
+// Received: prefixes received from the peer, before import policy
+// Accepted: prefixes received from the peer, after import policy
+// Routers that don't keep rejected prefixes show the same for both.
+type PeerDetail struct {
+	Address                net.IP
+	ASN                    uint32
+	State                  string
+	Uptime                 time.Duration
+	V4Received, V4Accepted uint32
+	V6Received, V6Accepted uint32
+}
+
 // ASNs holds counts for all types of ASNs.
 // as4:     ASNs originating IPv4
 // as6:     ASNs originating IPv6
@@ -85,11 +109,99 @@ type Roas struct {
 	V6v, V6i, V6u uint32
 }
 
+// ASPAs holds the ASPA path verification state.
+// v = valid
+// i = invalid
+// u = unknown
+type ASPAs struct {
+	V4v, V4i, V4u uint32
+	V6v, V6i, V6u uint32
+}
+
 // Large contains the amount of prefixes with large communities.
 type Large struct {
 	V4, V6 uint32
 }
 
+// TopCommunities is the amount of most used communities returned.
+const TopCommunities = 20
+
+// CommunityUse holds the community usage of one address family.
+// Standard:  prefixes carrying standard communities (RFC1997)
+// Extended:  prefixes carrying extended communities (RFC4360)
+// Large:     prefixes carrying large communities (RFC8092)
+// Top:       the most used communities of any type, most used first
+// WellKnown: prefixes carrying each well-known community
+type CommunityUse struct {
+	Standard, Extended, Large uint32
+	Top                       []CommunityCount
+	WellKnown                 WellKnown
+}
+
+// CommunityCount is the amount of prefixes carrying a single community.
+// Communities are shown as 3356:100, rt:3356:100 or 3356:1:100.
+type CommunityCount struct {
+	Community string
+	Prefixes  uint32
+}
+
+// WellKnown holds the amount of prefixes carrying each well-known community.
+type WellKnown struct {
+	NoExport, NoAdvertise, NoExportSubconfed uint32
+	Blackhole, GracefulShutdown              uint32
+}
+
+// Communities contains the community usage for IPv4 and IPv6.
+type Communities struct {
+	V4, V6 CommunityUse
+}
+
+// PathStats holds the shape of the best AS paths of one address family.
+// Lengths:   prefixes of each AS path length, prepends included
+// Unique:    prefixes of each AS path length, prepends removed
+// Prepended: prefixes where any ASN is prepended
+// Sets:      prefixes carrying an AS-SET
+// An AS-SET counts as a single ASN in both lengths.
+type PathStats struct {
+	Lengths, Unique map[uint32]uint32
+	Prepended, Sets uint32
+}
+
+// ASPathStats contains the AS path stats for IPv4 and IPv6.
+type ASPathStats struct {
+	V4, V6 PathStats
+}
+
+// Transit holds what is seen of a single ASN providing transit.
+// V4, V6:      prefixes with the ASN in the path, but not as the origin
+// Upstreams:   ASNs directly before it in any path, i.e. closer to us
+// Downstreams: ASNs directly after it in any path, i.e. closer to the origin
+// Prepends are ignored, and ASNs in an AS-SET are never neighbours.
+type Transit struct {
+	V4, V6                 uint32
+	Upstreams, Downstreams []uint32
+}
+
+// Bogon is a route that shouldn't be in the table.
+// Origin is 0 for locally originated routes.
+type Bogon struct {
+	Prefix *net.IPNet
+	Origin uint32
+	Kind   bogon.Kind
+}
+
+// BogonCount holds the amount of bogons of each kind in one address family.
+type BogonCount struct {
+	Martian, Unallocated, ReservedASN uint32
+}
+
+// Bogons contains the bogon counts for IPv4 and IPv6, and every bogon,
+// IPv4 first and in address order.
+type Bogons struct {
+	V4, V6 BogonCount
+	Routes []Bogon
+}
+
 // ASPath contains a regular AS path and an AS Set, if it exists.
 type ASPath struct {
 	Path []uint32
@@ -0,0 +1,197 @@
+package clidecode
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	c "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+// communities are all the communities attached to a route. Extended and
+// large communities are kept in the form they're shown in CommunityCount.
+type communities struct {
+	standard []uint32
+	extended []string
+	large    []string
+}
+
+// Well-known communities (RFC1997, RFC7999 and RFC8326).
+const (
+	commGracefulShutdown  = 0xFFFF0000
+	commBlackhole         = 0xFFFF029A
+	commNoExport          = 0xFFFFFF01
+	commNoAdvertise       = 0xFFFFFF02
+	commNoExportSubconfed = 0xFFFFFF03
+)
+
+// wellKnownNames are the names routers show well-known communities as,
+// normalised to upper case with underscores.
+var wellKnownNames = map[string]uint32{
+	"GRACEFUL_SHUTDOWN":   commGracefulShutdown,
+	"BLACKHOLE":           commBlackhole,
+	"NO_EXPORT":           commNoExport,
+	"NO_ADVERTISE":        commNoAdvertise,
+	"NO_EXPORT_SUBCONFED": commNoExportSubconfed,
+	"LOCAL_AS":            commNoExportSubconfed,
+}
+
+// parseCommunity parses a standard community, i.e. 3356:100 or no-export.
+func parseCommunity(s string) (uint32, error) {
+	if comm, ok := wellKnownNames[strings.ToUpper(strings.ReplaceAll(s, "-", "_"))]; ok {
+		return comm, nil
+	}
+	asn, val, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid community %q", s)
+	}
+	a, err := c.ParseUint32(asn)
+	if err != nil || a > 0xFFFF {
+		return 0, fmt.Errorf("invalid community %q", s)
+	}
+	v, err := c.ParseUint32(val)
+	if err != nil || v > 0xFFFF {
+		return 0, fmt.Errorf("invalid community %q", s)
+	}
+	return a<<16 | v, nil
+}
+
+// formatCommunity returns a standard community as ASN:value.
+func formatCommunity(comm uint32) string {
+	return fmt.Sprintf("%d:%d", comm>>16, comm&0xFFFF)
+}
+
+// parseLargeCommunity checks a large community is three numbers, i.e.
+// 13335:1:100, and returns it in that form.
+func parseLargeCommunity(s string) (string, error) {
+	fields := strings.Split(s, ":")
+	if len(fields) != 3 {
+		return "", fmt.Errorf("invalid large community %q", s)
+	}
+	for _, f := range fields {
+		if _, err := c.ParseUint32(f); err != nil {
+			return "", fmt.Errorf("invalid large community %q", s)
+		}
+	}
+	return s, nil
+}
+
+// extCommunity returns an extended community as kind:value. Routers name
+// the kinds differently, so route targets are always rt and route origins
+// always soo, i.e. rt:65000:100.
+func extCommunity(kind, value string) string {
+	kind = strings.ToLower(kind)
+	switch kind {
+	case "ro", "origin":
+		kind = "soo"
+	case "target":
+		kind = "rt"
+	}
+	return kind + ":" + value
+}
+
+// addCommunityAttr adds the communities of a decoded path attribute to r.
+// Any other attribute is ignored.
+func addCommunityAttr(r *route, attr bgp.PathAttributeInterface) {
+	switch a := attr.(type) {
+	case *bgp.PathAttributeCommunities:
+		r.comms.standard = append(r.comms.standard, a.Value...)
+	case *bgp.PathAttributeExtendedCommunities:
+		for _, e := range a.Value {
+			r.comms.extended = append(r.comms.extended, bgpExtCommunity(e))
+		}
+	case *bgp.PathAttributeLargeCommunities:
+		for _, l := range a.Values {
+			r.comms.large = append(r.comms.large, fmt.Sprintf("%d:%d:%d", l.ASN, l.LocalData1, l.LocalData2))
+		}
+	}
+}
+
+// bgpExtCommunity returns a decoded extended community in the same form
+// as extCommunity. GoBGP shows four octet ASNs as asdot, but every router
+// shows them as a plain number.
+func bgpExtCommunity(e bgp.ExtendedCommunityInterface) string {
+	_, sub := e.GetTypes()
+	value := e.String()
+	switch ec := e.(type) {
+	case *bgp.FourOctetAsSpecificExtended:
+		value = fmt.Sprintf("%d:%d", ec.AS, ec.LocalAdmin)
+	case *bgp.TwoOctetAsSpecificExtended, *bgp.IPv4AddressSpecificExtended:
+	default:
+		return value
+	}
+	switch sub {
+	case bgp.EC_SUBTYPE_ROUTE_TARGET:
+		return extCommunity("rt", value)
+	case bgp.EC_SUBTYPE_ROUTE_ORIGIN:
+		return extCommunity("soo", value)
+	}
+	return value
+}
+
+// communityUse returns the community usage of routes. Each community is
+// only counted once per route, however many times it's attached.
+func communityUse(routes []route) CommunityUse {
+	var u CommunityUse
+	prefixes := make(map[string]uint32)
+	for _, r := range routes {
+		if len(r.comms.standard) > 0 {
+			u.Standard++
+		}
+		if len(r.comms.extended) > 0 {
+			u.Extended++
+		}
+		if len(r.comms.large) > 0 {
+			u.Large++
+		}
+
+		seen := make(map[string]bool)
+		for _, comm := range r.comms.standard {
+			s := formatCommunity(comm)
+			if seen[s] {
+				continue
+			}
+			seen[s] = true
+			switch comm {
+			case commNoExport:
+				u.WellKnown.NoExport++
+			case commNoAdvertise:
+				u.WellKnown.NoAdvertise++
+			case commNoExportSubconfed:
+				u.WellKnown.NoExportSubconfed++
+			case commBlackhole:
+				u.WellKnown.Blackhole++
+			case commGracefulShutdown:
+				u.WellKnown.GracefulShutdown++
+			}
+		}
+		for _, s := range r.comms.extended {
+			seen[s] = true
+		}
+		for _, s := range r.comms.large {
+			seen[s] = true
+		}
+		for s := range seen {
+			prefixes[s]++
+		}
+	}
+
+	for comm, n := range prefixes {
+		u.Top = append(u.Top, CommunityCount{Community: comm, Prefixes: n})
+	}
+	// Most used first. Ties are in order of the community, so the result
+	// is the same every time.
+	slices.SortFunc(u.Top, func(a, b CommunityCount) int {
+		if n := cmp.Compare(b.Prefixes, a.Prefixes); n != 0 {
+			return n
+		}
+		return strings.Compare(a.Community, b.Community)
+	})
+	if len(u.Top) > TopCommunities {
+		u.Top = u.Top[:TopCommunities]
+	}
+
+	return u
+}
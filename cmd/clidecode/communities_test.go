@@ -0,0 +1,108 @@
+package clidecode
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+func TestParseCommunity(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint32
+		wantErr bool
+	}{
+		{in: "3356:100", want: 3356<<16 | 100},
+		{in: "no-export", want: commNoExport},
+		{in: "NO_EXPORT", want: commNoExport},
+		{in: "local-AS", want: commNoExportSubconfed},
+		{in: "blackhole", want: commBlackhole},
+		{in: "65535:666", want: commBlackhole},
+		{in: "3356", wantErr: true},
+		{in: "65536:1", wantErr: true},
+		{in: "1:65536", wantErr: true},
+		{in: "a:b", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := parseCommunity(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: Got error %v, Wanted error %t", tc.in, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: Got %d, Wanted %d", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestExtCommunity(t *testing.T) {
+	tests := []struct {
+		kind, value, want string
+	}{
+		{"RT", "65000:100", "rt:65000:100"},
+		{"target", "65000:100", "rt:65000:100"},
+		{"SoO", "65000:1", "soo:65000:1"},
+		{"ro", "65000:1", "soo:65000:1"},
+		{"generic", "0x1:0x2", "generic:0x1:0x2"},
+	}
+	for _, tc := range tests {
+		if got := extCommunity(tc.kind, tc.value); got != tc.want {
+			t.Errorf("Got %s, Wanted %s", got, tc.want)
+		}
+	}
+}
+
+func TestAddCommunityAttr(t *testing.T) {
+	var r route
+	attrs := []bgp.PathAttributeInterface{
+		bgp.NewPathAttributeCommunities([]uint32{3356<<16 | 100, commNoExport}),
+		bgp.NewPathAttributeExtendedCommunities([]bgp.ExtendedCommunityInterface{
+			bgp.NewTwoOctetAsSpecificExtended(bgp.EC_SUBTYPE_ROUTE_TARGET, 65000, 100, true),
+			bgp.NewFourOctetAsSpecificExtended(bgp.EC_SUBTYPE_ROUTE_ORIGIN, 4200000000, 1, true),
+		}),
+		bgp.NewPathAttributeLargeCommunities([]*bgp.LargeCommunity{bgp.NewLargeCommunity(13335, 1, 100)}),
+		// Anything else is ignored.
+		bgp.NewPathAttributeOrigin(0),
+	}
+	for _, a := range attrs {
+		addCommunityAttr(&r, a)
+	}
+	want := communities{
+		standard: []uint32{3356<<16 | 100, commNoExport},
+		extended: []string{"rt:65000:100", "soo:4200000000:1"},
+		large:    []string{"13335:1:100"},
+	}
+	if !reflect.DeepEqual(r.comms, want) {
+		t.Errorf("Got %v, Wanted %v", r.comms, want)
+	}
+}
+
+func TestCommunityUse(t *testing.T) {
+	_, prefix, _ := net.ParseCIDR("192.0.2.0/24")
+	// The same community twice on a route is only counted once.
+	routes := []route{
+		{prefix: prefix, comms: communities{standard: []uint32{commBlackhole, commBlackhole}}},
+		{prefix: prefix, comms: communities{standard: []uint32{commGracefulShutdown}, large: []string{"1:2:3"}}},
+		{prefix: prefix},
+	}
+	for i := range TopCommunities + 5 {
+		routes = append(routes, route{prefix: prefix, comms: communities{extended: []string{fmt.Sprintf("rt:65000:%d", i)}}})
+	}
+
+	got := communityUse(routes)
+	if got.Standard != 2 || got.Extended != TopCommunities+5 || got.Large != 1 {
+		t.Errorf("Got %d/%d/%d, Wanted 2/%d/1", got.Standard, got.Extended, got.Large, TopCommunities+5)
+	}
+	if want := (WellKnown{Blackhole: 1, GracefulShutdown: 1}); got.WellKnown != want {
+		t.Errorf("Got %#v, Wanted %#v", got.WellKnown, want)
+	}
+	if len(got.Top) != TopCommunities {
+		t.Fatalf("Got %d top communities, Wanted %d", len(got.Top), TopCommunities)
+	}
+	if want := (CommunityCount{"1:2:3", 1}); got.Top[0] != want {
+		t.Errorf("Got %v, Wanted %v", got.Top[0], want)
+	}
+}
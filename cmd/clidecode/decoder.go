@@ -0,0 +1,64 @@
+package clidecode
+
+import (
+	"fmt"
+	"log"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Config holds where each decoder finds its router. Only the fields of the
+// chosen decoder are used.
+type Config struct {
+	// Bird is the path to the bird control socket.
+	Bird string
+	// GoBGP is the address of the gobgpd gRPC API.
+	GoBGP string
+	// MRT is the RIB dump to read.
+	MRT string
+	// BMP is the address to accept BMP sessions on.
+	BMP string
+	// Fake is the JSON fixture to answer from. Without one, every answer
+	// is empty.
+	Fake string
+}
+
+// NewDecoder returns the router implementation called name.
+// The BMP station is served in the background, and the program exits if it
+// stops.
+func NewDecoder(name string, cfg Config) (Decoder, error) {
+	switch name {
+	case "bird2":
+		return NewBird2Conn(cfg.Bird), nil
+	case "gobgp":
+		conn, err := grpc.NewClient(cfg.GoBGP, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return nil, fmt.Errorf("unable to dial gobgpd: %w", err)
+		}
+		return NewGoBGPConn(conn), nil
+	case "frr":
+		return NewFRRConn(nil), nil
+	case "openbgpd":
+		return NewOpenBGPDConn(nil, ""), nil
+	case "mrt":
+		return NewMRTConn(cfg.MRT)
+	case "bmp":
+		l, err := net.Listen("tcp", cfg.BMP)
+		if err != nil {
+			return nil, fmt.Errorf("unable to listen for BMP: %w", err)
+		}
+		station := NewBMPStation()
+		go func() {
+			log.Fatalf("BMP station stopped: %v", station.Serve(l))
+		}()
+		return station, nil
+	case "fake":
+		if cfg.Fake == "" {
+			return FakeConn{}, nil
+		}
+		return LoadFakeConn(cfg.Fake)
+	}
+	return nil, fmt.Errorf("unknown decoder: %s", name)
+}
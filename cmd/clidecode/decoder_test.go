@@ -0,0 +1,46 @@
+package clidecode
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestNewDecoder(t *testing.T) {
+	cfg := Config{
+		Bird:  "/run/bird/bird.ctl",
+		GoBGP: "127.0.0.1:50051",
+		MRT:   "testdata/mrt/rib.mrt",
+		BMP:   "127.0.0.1:0",
+		Fake:  "testdata/fake/table.json",
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "bird2", want: "clidecode.Bird2Conn"},
+		{name: "gobgp", want: "clidecode.GoBGPConn"},
+		{name: "frr", want: "clidecode.FRRConn"},
+		{name: "openbgpd", want: "clidecode.OpenBGPDConn"},
+		{name: "mrt", want: "clidecode.MRTConn"},
+		{name: "bmp", want: "*clidecode.BMPStation"},
+		{name: "fake", want: "clidecode.FakeConn"},
+	}
+	for _, tc := range tests {
+		d, err := NewDecoder(tc.name, cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := fmt.Sprintf("%T", d); got != tc.want {
+			t.Errorf("%s: Got %s, Wanted %s", tc.name, got, tc.want)
+		}
+	}
+
+	if _, err := NewDecoder("junos", cfg); err == nil {
+		t.Error("Got no error for an unknown decoder")
+	}
+	cfg.MRT = "testdata/mrt/missing.mrt"
+	if _, err := NewDecoder("mrt", cfg); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v, Wanted %v", err, ErrNotFound)
+	}
+}
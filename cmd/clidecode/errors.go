@@ -0,0 +1,78 @@
+package clidecode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	c "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
+)
+
+// Errors returned by decoders. They're wrapped with the details of what
+// failed, so check for them with errors.Is.
+var (
+	// ErrUnreachable means the router couldn't be queried at all, i.e. it's
+	// not running or its CLI couldn't be run.
+	ErrUnreachable = errors.New("router unreachable")
+
+	// ErrUnexpectedOutput means the router answered, but with output that
+	// couldn't be decoded. The output is in the *OutputError.
+	ErrUnexpectedOutput = errors.New("unexpected output")
+
+	// ErrNotFound means something the query relies on doesn't exist, i.e. a
+	// ROA file that hasn't been written or an MRT dump that's missing.
+	ErrNotFound = errors.New("not found")
+)
+
+// maxErrorOutput is the most output kept in an OutputError. Full tables
+// are far too large to log.
+const maxErrorOutput = 256
+
+// OutputError is returned when the output of a command can't be decoded.
+// errors.Is matches it to ErrUnexpectedOutput.
+type OutputError struct {
+	// Cmd is the command run, or the file read.
+	Cmd string
+	// Output is the part of the output that couldn't be decoded, if any.
+	Output string
+	Err    error
+}
+
+// outputError returns an *OutputError, truncating output if needed.
+func outputError(cmd, output string, err error) error {
+	if len(output) > maxErrorOutput {
+		output = output[:maxErrorOutput] + "..."
+	}
+	return &OutputError{Cmd: cmd, Output: output, Err: err}
+}
+
+func (e *OutputError) Error() string {
+	msg := fmt.Sprintf("unexpected output from %q", e.Cmd)
+	if e.Output != "" {
+		msg += fmt.Sprintf(" %q", e.Output)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is reports whether target is ErrUnexpectedOutput.
+func (e *OutputError) Is(target error) bool {
+	return target == ErrUnexpectedOutput
+}
+
+func (e *OutputError) Unwrap() error {
+	return e.Err
+}
+
+// unreachable wraps err from running cmd with ErrUnreachable. Errors from
+// the context being done are returned as they are, as the router may be
+// fine but slow.
+func unreachable(cmd string, err error) error {
+	var timeout *c.TimeoutError
+	if errors.As(err, &timeout) || errors.Is(err, context.Canceled) {
+		return fmt.Errorf("unable to run %q: %w", cmd, err)
+	}
+	return fmt.Errorf("%w: unable to run %q: %w", ErrUnreachable, cmd, err)
+}
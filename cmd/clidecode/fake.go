@@ -1,78 +1,352 @@
 package clidecode
 
-import "net"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
 
-// FakeConn will be a connection to a fake instance.
-type FakeConn struct{}
+	c "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
+)
 
-// GetBGPTotal returns rib, fib ipv4. rib, fib ipv6
-func (f FakeConn) GetBGPTotal() (Totals, error) {
-	return Totals{}, nil
+// FakeConn is a fake router. Every answer is derived from a table of routes
+// and peers, the same way as for a real router, so anything using a Decoder
+// can be tested against meaningful data. The zero value has no routes or
+// peers at all.
+type FakeConn struct {
+	peers      []FakePeer
+	details    []PeerDetail
+	v4, v6     []route
+	rib4, rib6 uint32
+	roas       []roa
+	// routes and vrps hold the routes and VRPs by prefix, for lookups.
+	routes c.Trie[route]
+	vrps   c.Trie[[]roa]
 }
 
-// GetPeers returns ipv4 peer configured, established. ipv6 peers configured, established
-func (f FakeConn) GetPeers() (Peers, error) {
-	return Peers{}, nil
+// FakeTable is the table a FakeConn answers from. It's usually loaded from
+// a JSON fixture with LoadFakeConn.
+type FakeTable struct {
+	Peers  []FakePeer  `json:"peers"`
+	Routes []FakeRoute `json:"routes"`
+	// VRPs are only needed for GetROA and GetVRPs. The state of each route
+	// is set on the route itself.
+	VRPs []FakeVRP `json:"vrps"`
+}
+
+// FakePeer is a single BGP peer.
+type FakePeer struct {
+	Address     string `json:"address"`
+	ASN         uint32 `json:"asn"`
+	Established bool   `json:"established"`
+	// Uptime is a duration such as 26h3m. It's ignored unless the peer
+	// is established.
+	Uptime string `json:"uptime"`
+	// Prefixes received from the peer, before and after import policy.
+	V4Received uint32 `json:"v4_received"`
+	V4Accepted uint32 `json:"v4_accepted"`
+	V6Received uint32 `json:"v6_received"`
+	V6Accepted uint32 `json:"v6_accepted"`
 }
 
-// GetTotalSourceASNs returns total amount of unique ASNs
-func (f FakeConn) GetTotalSourceASNs() (ASNs, error) {
-	return ASNs{}, nil
+// FakeRoute is the best path for a single prefix.
+type FakeRoute struct {
+	Prefix string   `json:"prefix"`
+	Path   []uint32 `json:"path"`
+	Set    []uint32 `json:"set"`
+	// Communities are in the form of 3356:100, or the name of a
+	// well-known community such as no-export.
+	Communities []string `json:"communities"`
+	// ExtendedCommunities are in the form of rt:3356:100
+	ExtendedCommunities []string `json:"extended_communities"`
+	// LargeCommunities are in the form of 13335:1:100
+	LargeCommunities []string `json:"large_communities"`
+	// ROA is one of valid, invalid or unknown. Empty is unknown.
+	ROA string `json:"roa"`
+	// Paths is the amount of paths received for the prefix, including the
+	// best path. Zero is taken as one.
+	Paths uint32 `json:"paths"`
 }
 
-// GetMasks returns the total count of each mask value
-// First item is IPv4, second item is IPv6
-func (f FakeConn) GetMasks() ([]map[string]uint32, error) {
-	v4 := make(map[string]uint32)
-	v6 := make(map[string]uint32)
-	return []map[string]uint32{v4, v6}, nil
+// FakeVRP is a single Validated ROA Payload.
+type FakeVRP struct {
+	Prefix string `json:"prefix"`
+	Max    int    `json:"max"`
+	ASN    uint32 `json:"asn"`
 }
 
-// GetROAs returns total amount of all ROA states
-func (f FakeConn) GetROAs() (Roas, error) {
-	return Roas{}, nil
+var fakeROAStates = map[string]int{
+	"":        RUnknown,
+	"unknown": RUnknown,
+	"valid":   RValid,
+	"invalid": RInvalid,
 }
 
-// GetLargeCommunities returns the amount of prefixes that have large communities attached (RFC8092)
-func (f FakeConn) GetLargeCommunities() (Large, error) {
-	return Large{}, nil
+// LoadFakeConn returns a FakeConn answering from the JSON fixture in file.
+// Unknown fields are an error, so a typo can't silently leave out data.
+func LoadFakeConn(file string) (FakeConn, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return FakeConn{}, fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	if err != nil {
+		return FakeConn{}, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var t FakeTable
+	if err := dec.Decode(&t); err != nil {
+		return FakeConn{}, outputError(file, "", err)
+	}
+
+	f, err := NewFakeConn(t)
+	if err != nil {
+		return FakeConn{}, fmt.Errorf("%s: %w", file, err)
+	}
+
+	return f, nil
+}
+
+// NewFakeConn returns a FakeConn answering from t.
+func NewFakeConn(t FakeTable) (FakeConn, error) {
+	var f FakeConn
+	for _, p := range t.Peers {
+		d, err := p.detail()
+		if err != nil {
+			return FakeConn{}, err
+		}
+		f.peers = append(f.peers, p)
+		f.details = append(f.details, d)
+	}
+	sortPeers(f.details)
+
+	for _, fr := range t.Routes {
+		r, err := fr.route()
+		if err != nil {
+			return FakeConn{}, fmt.Errorf("invalid route %s: %w", fr.Prefix, err)
+		}
+		paths := max(fr.Paths, 1)
+		if r.prefix.IP.To4() != nil {
+			f.v4 = append(f.v4, r)
+			f.rib4 += paths
+		} else {
+			f.v6 = append(f.v6, r)
+			f.rib6 += paths
+		}
+	}
+
+	for _, v := range t.VRPs {
+		_, prefix, err := net.ParseCIDR(v.Prefix)
+		if err != nil {
+			return FakeConn{}, fmt.Errorf("invalid VRP: %w", err)
+		}
+		f.roas = append(f.roas, roa{prefix: prefix, max: v.Max, asn: v.ASN})
+	}
+	addRoutes(&f.routes, f.v4)
+	addRoutes(&f.routes, f.v6)
+	addROAs(&f.vrps, f.roas)
+
+	return f, nil
+}
+
+// detail returns the PeerDetail of a fake peer.
+func (fp FakePeer) detail() (PeerDetail, error) {
+	d := PeerDetail{
+		Address:    net.ParseIP(fp.Address),
+		ASN:        fp.ASN,
+		State:      StateIdle,
+		V4Received: fp.V4Received,
+		V4Accepted: fp.V4Accepted,
+		V6Received: fp.V6Received,
+		V6Accepted: fp.V6Accepted,
+	}
+	if d.Address == nil {
+		return d, fmt.Errorf("invalid peer address %q", fp.Address)
+	}
+	if fp.Uptime != "" {
+		uptime, err := time.ParseDuration(fp.Uptime)
+		if err != nil {
+			return d, fmt.Errorf("invalid uptime for peer %s: %w", fp.Address, err)
+		}
+		d.Uptime = uptime
+	}
+	if fp.Established {
+		d.State = StateEstablished
+	} else {
+		d.Uptime = 0
+	}
+
+	return d, nil
+}
+
+// route checks a FakeRoute and converts it to a route.
+func (fr FakeRoute) route() (route, error) {
+	_, prefix, err := net.ParseCIDR(fr.Prefix)
+	if err != nil {
+		return route{}, err
+	}
+	state, ok := fakeROAStates[fr.ROA]
+	if !ok {
+		return route{}, fmt.Errorf("unknown ROA state %q", fr.ROA)
+	}
+	r := route{
+		prefix: prefix,
+		path:   ASPath{Path: fr.Path, Set: fr.Set},
+		roa:    state,
+	}
+	for _, comm := range fr.Communities {
+		std, err := parseCommunity(comm)
+		if err != nil {
+			return route{}, err
+		}
+		r.comms.standard = append(r.comms.standard, std)
+	}
+	for _, comm := range fr.ExtendedCommunities {
+		kind, value, ok := strings.Cut(comm, ":")
+		if !ok {
+			return route{}, fmt.Errorf("invalid extended community %q", comm)
+		}
+		r.comms.extended = append(r.comms.extended, extCommunity(kind, value))
+	}
+	for _, comm := range fr.LargeCommunities {
+		large, err := parseLargeCommunity(comm)
+		if err != nil {
+			return route{}, err
+		}
+		r.comms.large = append(r.comms.large, large)
+	}
+
+	return r, nil
+}
+
+// GetPeers returns ipv4 peer configured, established. ipv6 peers configured, established
+// The address family of a peer is the family of the peer address.
+func (f FakeConn) GetPeers(context.Context) (Peers, error) {
+	var p Peers
+	for _, peer := range f.peers {
+		if net.ParseIP(peer.Address).To4() != nil {
+			p.V4c++
+			if peer.Established {
+				p.V4e++
+			}
+			continue
+		}
+		p.V6c++
+		if peer.Established {
+			p.V6e++
+		}
+	}
+
+	return p, nil
+}
+
+// GetPeerDetails returns the state of each peer, and the amount of
+// prefixes received from it for each address family.
+// A peer that isn't established is idle.
+func (f FakeConn) GetPeerDetails(context.Context) ([]PeerDetail, error) {
+	return slices.Clone(f.details), nil
+}
+
+// GetTransit returns how many prefixes an ASN transits, and the ASNs
+// seen directly upstream and downstream of it.
+func (f FakeConn) GetTransit(_ context.Context, asn uint32) (Transit, error) {
+	return transit(f.v4, f.v6, asn), nil
+}
+
+// GetTable returns the best path of every IPv4 and IPv6 route, with all of
+// their attributes.
+func (f FakeConn) GetTable(context.Context) (*Table, error) {
+	table := newTable(f.v4, f.v6, nil)
+	table.totals.V4Rib, table.totals.V6Rib = f.rib4, f.rib6
+
+	return table, nil
 }
 
 // GetIPv4FromSource returns all the IPv4 networks sourced from a source ASN.
-func (f FakeConn) GetIPv4FromSource(uint32) ([]*net.IPNet, error) {
-	return nil, nil
+func (f FakeConn) GetIPv4FromSource(_ context.Context, asn uint32) ([]*net.IPNet, error) {
+	return fromSource(f.v4, asn), nil
 }
 
 // GetIPv6FromSource returns all the IPv6 networks sourced from a source ASN.
-func (f FakeConn) GetIPv6FromSource(uint32) ([]*net.IPNet, error) {
-	return nil, nil
+func (f FakeConn) GetIPv6FromSource(_ context.Context, asn uint32) ([]*net.IPNet, error) {
+	return fromSource(f.v6, asn), nil
 }
 
 // GetOriginFromIP will return the origin ASN from a source IP.
-func (f FakeConn) GetOriginFromIP(net.IP) (uint32, bool, error) {
-	return 0, false, nil
+func (f FakeConn) GetOriginFromIP(_ context.Context, ip net.IP) (uint32, bool, error) {
+	r, ok := f.lookup(ip)
+	if !ok {
+		return 0, false, nil
+	}
+	o, ok := r.origin()
+
+	return o, ok, nil
 }
 
-// GetASPathFromIP will return the AS path, as well as as-set if any from a source IP.
-func (f FakeConn) GetASPathFromIP(net.IP) (ASPath, bool, error) {
-	return ASPath{}, false, nil
+// GetASPathFromIP will return the matched prefix and its AS path, as well as as-set if any from a source IP.
+func (f FakeConn) GetASPathFromIP(_ context.Context, ip net.IP) (*net.IPNet, ASPath, bool, error) {
+	r, ok := f.lookup(ip)
+	if !ok {
+		return nil, ASPath{}, false, nil
+	}
+
+	return r.prefix, r.path, true, nil
 }
 
 // GetRoute will return the current FIB entry, if any, from a source IP.
-func (f FakeConn) GetRoute(net.IP) (*net.IPNet, bool, error) {
-	return nil, false, nil
+func (f FakeConn) GetRoute(_ context.Context, ip net.IP) (*net.IPNet, bool, error) {
+	r, ok := f.lookup(ip)
+	if !ok {
+		return nil, false, nil
+	}
+
+	return r.prefix, true, nil
 }
 
-// GetROA will return the ROA status, if any, from a source IP.
-func (f FakeConn) GetROA(*net.IPNet, uint32) (int, bool, error) {
-	return 0, false, nil
+// lookup returns the route for the longest prefix covering ip.
+func (f FakeConn) lookup(ip net.IP) (route, bool) {
+	return longestMatch(&f.routes, ip)
+}
+
+// GetROA will return the ROA status from a prefix and ASN.
+// Without VRPs, the state of a matching route is used instead.
+func (f FakeConn) GetROA(_ context.Context, prefix *net.IPNet, asn uint32) (int, bool, error) {
+	if len(f.roas) > 0 {
+		return roaState(&f.vrps, prefix, asn), true, nil
+	}
+
+	routes := f.v6
+	if prefix.IP.To4() != nil {
+		routes = f.v4
+	}
+	for _, r := range routes {
+		if o, ok := r.origin(); ok && o == asn && r.prefix.String() == prefix.String() {
+			return r.roa, true, nil
+		}
+	}
+
+	return RUnknown, false, nil
 }
 
 // GetVRPs will return all Validated ROA Payloads for an ASN.
-func (f FakeConn) GetVRPs(uint32) {}
+func (f FakeConn) GetVRPs(_ context.Context, asn uint32) ([]VRP, error) {
+	return vrpsFor(f.roas, asn), nil
+}
 
 // GetInvalids returns a map of ASNs that are advertising RPKI invalid prefixes.
 // It also includes all those prefixes being advertised.
-func (f FakeConn) GetInvalids() (map[string][]string, error) {
-	return nil, nil
+func (f FakeConn) GetInvalids(context.Context) (map[string][]string, error) {
+	inv := make(map[string][]string)
+	invalids(f.v4, inv)
+	invalids(f.v6, inv)
+
+	return inv, nil
 }
@@ -0,0 +1,170 @@
+package clidecode
+
+import (
+	"errors"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFakeTable(t *testing.T) {
+	f, err := LoadFakeConn("testdata/fake/table.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.GetTable(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fixture has only best paths, and 1.1.1.0/24 is prepended.
+	want := testTable()
+	want.origins = nil
+	want.v4[0].path.Path = []uint32{3356, 13335, 13335}
+	checkTable(t, got, want)
+}
+
+func TestFake(t *testing.T) {
+	f, err := LoadFakeConn("testdata/fake/table.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fixture has the same routes and peers as the MRT dump.
+	peers, _ := f.GetPeers(t.Context())
+	if want := (Peers{V4c: 3, V4e: 2, V6c: 1, V6e: 1}); peers != want {
+		t.Errorf("Got %#v, Wanted %#v", peers, want)
+	}
+	for asn, want := range tableTransits {
+		got, _ := f.GetTransit(t.Context(), asn)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d: Got %v, Wanted %v", asn, got, want)
+		}
+	}
+	invalids, _ := f.GetInvalids(t.Context())
+	wantInvalids := map[string][]string{
+		"19281": {"9.9.9.0/24"},
+		"15169": {"2001:4860::/32"},
+	}
+	if !reflect.DeepEqual(invalids, wantInvalids) {
+		t.Errorf("Got %v, Wanted %v", invalids, wantInvalids)
+	}
+	details, _ := f.GetPeerDetails(t.Context())
+	wantDetails := []PeerDetail{
+		{Address: net.ParseIP("192.0.2.1"), ASN: 3356, State: StateEstablished, Uptime: 26*time.Hour + 3*time.Minute, V4Received: 4, V4Accepted: 3},
+		{Address: net.ParseIP("192.0.2.2"), ASN: 6939, State: StateEstablished, Uptime: 7801 * time.Second, V4Received: 3, V4Accepted: 3},
+		{Address: net.ParseIP("192.0.2.3"), ASN: 64500, State: StateIdle},
+		{Address: net.ParseIP("2001:db8::1"), ASN: 6939, State: StateEstablished, Uptime: 7801 * time.Second, V6Received: 2, V6Accepted: 2},
+	}
+	if !reflect.DeepEqual(details, wantDetails) {
+		t.Errorf("Got %v, Wanted %v", details, wantDetails)
+	}
+}
+
+func TestFakeLookups(t *testing.T) {
+	f, err := LoadFakeConn("testdata/fake/table.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	route, ok, err := f.GetRoute(t.Context(), net.ParseIP("8.8.4.4"))
+	if err != nil || !ok || route.String() != "8.0.0.0/9" {
+		t.Errorf("GetRoute: got %v, %t, %v", route, ok, err)
+	}
+	origin, ok, err := f.GetOriginFromIP(t.Context(), net.ParseIP("8.8.8.8"))
+	if err != nil || !ok || origin != 15169 {
+		t.Errorf("GetOriginFromIP: got %d, %t, %v", origin, ok, err)
+	}
+	prefix, path, ok, err := f.GetASPathFromIP(t.Context(), net.ParseIP("9.9.9.9"))
+	want := ASPath{Path: []uint32{6939, 19281}, Set: []uint32{1, 2}}
+	if err != nil || !ok || prefix.String() != "9.9.9.0/24" || !reflect.DeepEqual(path, want) {
+		t.Errorf("GetASPathFromIP: got %v, %v, %t, %v", prefix, path, ok, err)
+	}
+	if _, ok, err := f.GetRoute(t.Context(), net.ParseIP("192.0.2.1")); err != nil || ok {
+		t.Errorf("GetRoute for missing route: got %t, %v", ok, err)
+	}
+
+	v6, err := f.GetIPv6FromSource(t.Context(), 13335)
+	if err != nil || len(v6) != 1 || v6[0].String() != "2606:4700::/32" {
+		t.Errorf("GetIPv6FromSource: got %v, %v", v6, err)
+	}
+
+	_, prefix, _ = net.ParseCIDR("2001:4860::/32")
+	state, ok, err := f.GetROA(t.Context(), prefix, 15169)
+	if err != nil || !ok || state != RInvalid {
+		t.Errorf("GetROA: got %d, %t, %v", state, ok, err)
+	}
+	vrps, err := f.GetVRPs(t.Context(), 13335)
+	if err != nil || len(vrps) != 2 {
+		t.Errorf("GetVRPs: got %v, %v", vrps, err)
+	}
+
+	// Without VRPs, the state is taken from the route itself.
+	f.roas = nil
+	_, prefix, _ = net.ParseCIDR("1.1.1.0/24")
+	state, ok, err = f.GetROA(t.Context(), prefix, 13335)
+	if err != nil || !ok || state != RValid {
+		t.Errorf("GetROA: got %d, %t, %v", state, ok, err)
+	}
+}
+
+func TestFakeBadTable(t *testing.T) {
+	tests := []struct {
+		name  string
+		table FakeTable
+	}{
+		{
+			name:  "peer address",
+			table: FakeTable{Peers: []FakePeer{{Address: "192.0.2"}}},
+		},
+		{
+			name:  "peer uptime",
+			table: FakeTable{Peers: []FakePeer{{Address: "192.0.2.1", Uptime: "1 day"}}},
+		},
+		{
+			name:  "prefix",
+			table: FakeTable{Routes: []FakeRoute{{Prefix: "1.1.1.0"}}},
+		},
+		{
+			name:  "ROA state",
+			table: FakeTable{Routes: []FakeRoute{{Prefix: "1.1.1.0/24", ROA: "bogus"}}},
+		},
+		{
+			name:  "community",
+			table: FakeTable{Routes: []FakeRoute{{Prefix: "1.1.1.0/24", Communities: []string{"3356"}}}},
+		},
+		{
+			name:  "large community",
+			table: FakeTable{Routes: []FakeRoute{{Prefix: "1.1.1.0/24", LargeCommunities: []string{"1:2:x"}}}},
+		},
+		{
+			name:  "VRP",
+			table: FakeTable{VRPs: []FakeVRP{{Prefix: "1.1.1.0/33"}}},
+		},
+	}
+	for _, tc := range tests {
+		if _, err := NewFakeConn(tc.table); err == nil {
+			t.Errorf("%s: expected error", tc.name)
+		}
+	}
+
+	// A typo in a field name must not silently drop data.
+	file := t.TempDir() + "/table.json"
+	if err := os.WriteFile(file, []byte(`{"routes": [{"prefx": "1.1.1.0/24"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFakeConn(file); !errors.Is(err, ErrUnexpectedOutput) {
+		t.Errorf("Got %v, Wanted %v", err, ErrUnexpectedOutput)
+	}
+	if _, err := LoadFakeConn("testdata/fake/missing.json"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v, Wanted %v", err, ErrNotFound)
+	}
+
+	// The zero value is an empty router.
+	table, _ := (FakeConn{}).GetTable(t.Context())
+	if totals := table.Totals(); totals != (Totals{}) {
+		t.Errorf("Got %#v, Wanted %#v", totals, Totals{})
+	}
+}
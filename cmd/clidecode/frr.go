@@ -0,0 +1,480 @@
+package clidecode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	c "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
+)
+
+// FRRConn is a connection to an FRRouting instance. All output is
+// requested from vtysh as JSON.
+type FRRConn struct {
+	run Runner
+}
+
+// NewFRRConn returns an FRRConn that runs commands with run. If run is
+// nil, commands are passed to the local vtysh.
+func NewFRRConn(run Runner) FRRConn {
+	if run == nil {
+		run = vtysh
+	}
+	return FRRConn{run: run}
+}
+
+// vtysh runs a single command in the local vtysh.
+func vtysh(ctx context.Context, cmd string) ([]byte, error) {
+	return c.CommandOutput(ctx, "/usr/bin/vtysh", "-c", cmd)
+}
+
+// frrSummary is the output of 'show bgp summary json'
+type frrSummary struct {
+	IPv4 frrAFISummary `json:"ipv4Unicast"`
+	IPv6 frrAFISummary `json:"ipv6Unicast"`
+}
+
+type frrAFISummary struct {
+	Peers map[string]struct {
+		RemoteAs       uint32 `json:"remoteAs"`
+		State          string `json:"state"`
+		PeerUptimeMsec int64  `json:"peerUptimeMsec"`
+		// PfxRcd is after import policy. The count before is only
+		// kept with soft-reconfiguration inbound.
+		PfxRcd uint32 `json:"pfxRcd"`
+	} `json:"peers"`
+}
+
+// frrTable is the output of 'show bgp <afi> unicast json', as well as
+// any of the filtered versions of that command.
+type frrTable struct {
+	Routes map[string][]frrTablePath `json:"routes"`
+}
+
+type frrTablePath struct {
+	Valid    bool   `json:"valid"`
+	Bestpath bool   `json:"bestpath"`
+	Path     string `json:"path"`
+}
+
+// frrLookup is the output of 'show bgp <afi> unicast <ip> json'
+type frrLookup struct {
+	Prefix string          `json:"prefix"`
+	Paths  []frrDetailPath `json:"paths"`
+}
+
+// frrDetail is the output of 'show bgp <afi> unicast detail json'. Each
+// prefix is shown the same way as a lookup.
+type frrDetail struct {
+	Routes map[string]frrLookup `json:"routes"`
+}
+
+type frrDetailPath struct {
+	ASPath   frrString `json:"aspath"`
+	Bestpath struct {
+		Overall bool `json:"overall"`
+	} `json:"bestpath"`
+	// Well-known communities are shown by name, i.e. no-export, and
+	// extended ones as RT:65000:100
+	Community         frrString `json:"community"`
+	ExtendedCommunity frrString `json:"extendedCommunity"`
+	LargeCommunity    frrString `json:"largeCommunity"`
+	// Only shown when FRR has an RPKI cache. One of valid, invalid or
+	// not found.
+	RPKIValidationState string `json:"rpkiValidationState"`
+}
+
+type frrString struct {
+	String string `json:"string"`
+}
+
+// frrPrefixTable is the output of 'show rpki prefix-table json', and of
+// 'show rpki prefix <prefix> json'
+type frrPrefixTable struct {
+	Prefixes []struct {
+		Prefix       string `json:"prefix"`
+		PrefixLenMin int    `json:"prefixLenMin"`
+		PrefixLenMax int    `json:"prefixLenMax"`
+		ASN          uint32 `json:"asn"`
+	} `json:"prefixes"`
+}
+
+// command runs cmd and decodes the JSON output into v.
+func (f FRRConn) command(ctx context.Context, cmd string, v any) error {
+	out, err := f.run(ctx, cmd)
+	if err != nil {
+		return unreachable(cmd, err)
+	}
+	if err := json.Unmarshal(out, v); err != nil {
+		return outputError(cmd, string(out), err)
+	}
+	return nil
+}
+
+// table runs a 'show bgp' command and returns the output as routes.
+func (f FRRConn) table(ctx context.Context, cmd string) ([]route, error) {
+	var t frrTable
+	if err := f.command(ctx, cmd, &t); err != nil {
+		return nil, err
+	}
+
+	var routes []route
+	for prefix, paths := range t.Routes {
+		for _, p := range paths {
+			if !p.Bestpath {
+				continue
+			}
+			_, ipnet, err := net.ParseCIDR(prefix)
+			if err != nil {
+				return nil, outputError(cmd, prefix, err)
+			}
+			path, set, err := decodeFRRPath(p.Path)
+			if err != nil {
+				return nil, outputError(cmd, p.Path, err)
+			}
+			routes = append(routes, route{prefix: ipnet, path: ASPath{Path: path, Set: set}})
+		}
+	}
+
+	return routes, nil
+}
+
+// decodeFRRPath returns the AS path and AS-SET from an FRR path string.
+// FRR shows AS-SETs comma separated, i.e. 3356 12345 {1212,3434}
+func decodeFRRPath(in string) ([]uint32, []uint32, error) {
+	return decodeASPaths(strings.ReplaceAll(in, ",", " "))
+}
+
+// GetPeers returns ipv4 peer configured, established. ipv6 peers configured, established
+func (f FRRConn) GetPeers(ctx context.Context) (Peers, error) {
+	var p Peers
+	var s frrSummary
+	if err := f.command(ctx, "show bgp summary json", &s); err != nil {
+		return p, err
+	}
+
+	for _, peer := range s.IPv4.Peers {
+		p.V4c++
+		if peer.State == "Established" {
+			p.V4e++
+		}
+	}
+	for _, peer := range s.IPv6.Peers {
+		p.V6c++
+		if peer.State == "Established" {
+			p.V6e++
+		}
+	}
+
+	return p, nil
+}
+
+// GetPeerDetails returns the state of each peer, and the amount of
+// prefixes received from it for each address family.
+// A peer is shown under each address family it's configured for.
+func (f FRRConn) GetPeerDetails(ctx context.Context) ([]PeerDetail, error) {
+	var s frrSummary
+	if err := f.command(ctx, "show bgp summary json", &s); err != nil {
+		return nil, err
+	}
+
+	details := make(map[string]*PeerDetail)
+	for i, afi := range []frrAFISummary{s.IPv4, s.IPv6} {
+		for addr, peer := range afi.Peers {
+			d, ok := details[addr]
+			if !ok {
+				ip := net.ParseIP(addr)
+				if ip == nil {
+					return nil, outputError("show bgp summary json", addr, errors.New("invalid neighbor address"))
+				}
+				d = &PeerDetail{
+					Address: ip,
+					ASN:     peer.RemoteAs,
+					State:   peerState(peer.State),
+				}
+				if d.State == StateEstablished {
+					d.Uptime = time.Duration(peer.PeerUptimeMsec) * time.Millisecond
+				}
+				details[addr] = d
+			}
+			if i == 0 {
+				d.V4Received, d.V4Accepted = peer.PfxRcd, peer.PfxRcd
+			} else {
+				d.V6Received, d.V6Accepted = peer.PfxRcd, peer.PfxRcd
+			}
+		}
+	}
+
+	var peers []PeerDetail
+	for _, d := range details {
+		peers = append(peers, *d)
+	}
+	sortPeers(peers)
+
+	return peers, nil
+}
+
+// GetTable returns the best path of every IPv4 and IPv6 route, with all of
+// their attributes. Communities are only shown in the detailed output, which
+// has every path, so the origin of each is kept.
+func (f FRRConn) GetTable(ctx context.Context) (*Table, error) {
+	o := make(map[string][]uint32)
+	rib4, v4, err := f.detail(ctx, "show bgp ipv4 unicast detail json", o)
+	if err != nil {
+		return nil, err
+	}
+	rib6, v6, err := f.detail(ctx, "show bgp ipv6 unicast detail json", o)
+	if err != nil {
+		return nil, err
+	}
+
+	table := newTable(v4, v6, o)
+	table.totals.V4Rib, table.totals.V6Rib = rib4, rib6
+
+	return table, nil
+}
+
+// detail runs a 'show bgp detail' command and returns the amount of paths,
+// and the best path for each prefix as a route, along with its communities
+// and ROA state. The origin of every path is added to o.
+func (f FRRConn) detail(ctx context.Context, cmd string, o map[string][]uint32) (uint32, []route, error) {
+	var d frrDetail
+	if err := f.command(ctx, cmd, &d); err != nil {
+		return 0, nil, err
+	}
+
+	var paths uint32
+	var routes []route
+	for prefix, l := range d.Routes {
+		_, ipnet, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return 0, nil, outputError(cmd, prefix, err)
+		}
+		for _, p := range l.Paths {
+			paths++
+			path, set, err := decodeFRRPath(p.ASPath.String)
+			if err != nil {
+				return 0, nil, outputError(cmd, p.ASPath.String, err)
+			}
+			r := route{prefix: ipnet, path: ASPath{Path: path, Set: set}}
+			addOrigin(o, r)
+			if !p.Bestpath.Overall {
+				continue
+			}
+			if r.comms, err = frrCommunities(p); err != nil {
+				return 0, nil, outputError(cmd, prefix, err)
+			}
+			r.roa = frrROAState(p.RPKIValidationState)
+			routes = append(routes, r)
+		}
+	}
+
+	return paths, routes, nil
+}
+
+// frrROAState converts the RPKI state FRR shows for a path.
+func frrROAState(state string) int {
+	switch state {
+	case "valid":
+		return RValid
+	case "invalid":
+		return RInvalid
+	}
+	return RUnknown
+}
+
+// frrCommunities returns all the communities of a path.
+func frrCommunities(p frrDetailPath) (communities, error) {
+	var comms communities
+	for _, comm := range strings.Fields(p.Community.String) {
+		std, err := parseCommunity(comm)
+		if err != nil {
+			return comms, err
+		}
+		comms.standard = append(comms.standard, std)
+	}
+	for _, comm := range strings.Fields(p.ExtendedCommunity.String) {
+		kind, value, ok := strings.Cut(comm, ":")
+		if !ok {
+			return comms, fmt.Errorf("invalid extended community %q", comm)
+		}
+		comms.extended = append(comms.extended, extCommunity(kind, value))
+	}
+	for _, comm := range strings.Fields(p.LargeCommunity.String) {
+		large, err := parseLargeCommunity(comm)
+		if err != nil {
+			return comms, err
+		}
+		comms.large = append(comms.large, large)
+	}
+
+	return comms, nil
+}
+
+// GetTransit returns how many prefixes an ASN transits, and the ASNs
+// seen directly upstream and downstream of it.
+func (f FRRConn) GetTransit(ctx context.Context, asn uint32) (Transit, error) {
+	v4, err := f.table(ctx, "show bgp ipv4 unicast json")
+	if err != nil {
+		return Transit{}, err
+	}
+	v6, err := f.table(ctx, "show bgp ipv6 unicast json")
+	if err != nil {
+		return Transit{}, err
+	}
+
+	return transit(v4, v6, asn), nil
+}
+
+// GetIPv4FromSource returns all the IPv4 networks sourced from a source ASN.
+func (f FRRConn) GetIPv4FromSource(ctx context.Context, asn uint32) ([]*net.IPNet, error) {
+	routes, err := f.table(ctx, fmt.Sprintf("show bgp ipv4 unicast regexp _%d$ json", asn))
+	if err != nil {
+		return nil, err
+	}
+
+	return fromSource(routes, asn), nil
+}
+
+// GetIPv6FromSource returns all the IPv6 networks sourced from a source ASN.
+func (f FRRConn) GetIPv6FromSource(ctx context.Context, asn uint32) ([]*net.IPNet, error) {
+	routes, err := f.table(ctx, fmt.Sprintf("show bgp ipv6 unicast regexp _%d$ json", asn))
+	if err != nil {
+		return nil, err
+	}
+
+	return fromSource(routes, asn), nil
+}
+
+// GetOriginFromIP will return the origin ASN from a source IP.
+func (f FRRConn) GetOriginFromIP(ctx context.Context, ip net.IP) (uint32, bool, error) {
+	r, ok, err := f.lookup(ctx, ip)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	o, ok := r.origin()
+
+	return o, ok, nil
+}
+
+// GetASPathFromIP will return the matched prefix and its AS path, as well as as-set if any from a source IP.
+func (f FRRConn) GetASPathFromIP(ctx context.Context, ip net.IP) (*net.IPNet, ASPath, bool, error) {
+	r, ok, err := f.lookup(ctx, ip)
+	if err != nil || !ok {
+		return nil, ASPath{}, false, err
+	}
+
+	return r.prefix, r.path, true, nil
+}
+
+// GetRoute will return the current FIB entry, if any, from a source IP.
+func (f FRRConn) GetRoute(ctx context.Context, ip net.IP) (*net.IPNet, bool, error) {
+	r, ok, err := f.lookup(ctx, ip)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	return r.prefix, true, nil
+}
+
+// lookup returns the best path for the longest prefix covering ip.
+func (f FRRConn) lookup(ctx context.Context, ip net.IP) (route, bool, error) {
+	afi := "ipv6"
+	if ip.To4() != nil {
+		afi = "ipv4"
+	}
+
+	var l frrLookup
+	cmd := fmt.Sprintf("show bgp %s unicast %s json", afi, ip)
+	if err := f.command(ctx, cmd, &l); err != nil {
+		return route{}, false, err
+	}
+	// FRR returns an empty object, or a warning, when there is no route.
+	if l.Prefix == "" {
+		return route{}, false, nil
+	}
+	_, prefix, err := net.ParseCIDR(l.Prefix)
+	if err != nil {
+		return route{}, false, outputError(cmd, l.Prefix, err)
+	}
+
+	for _, p := range l.Paths {
+		if !p.Bestpath.Overall {
+			continue
+		}
+		path, set, err := decodeFRRPath(p.ASPath.String)
+		if err != nil {
+			return route{}, false, outputError(cmd, p.ASPath.String, err)
+		}
+		return route{prefix: prefix, path: ASPath{Path: path, Set: set}}, true, nil
+	}
+
+	return route{}, false, nil
+}
+
+// GetROA will return the ROA status from a prefix and ASN.
+// This function does not check for the existence of the prefix in the table.
+// Only the ROAs covering the prefix are asked for.
+func (f FRRConn) GetROA(ctx context.Context, prefix *net.IPNet, asn uint32) (int, bool, error) {
+	roas, err := f.roas(ctx, fmt.Sprintf("show rpki prefix %s json", prefix))
+	if err != nil {
+		return RUnknown, false, err
+	}
+
+	var t c.Trie[[]roa]
+	addROAs(&t, roas)
+
+	return roaState(&t, prefix, asn), true, nil
+}
+
+// GetVRPs will return all Validated ROA Payloads for an ASN.
+func (f FRRConn) GetVRPs(ctx context.Context, asn uint32) ([]VRP, error) {
+	roas, err := f.roas(ctx, "show rpki prefix-table json")
+	if err != nil {
+		return nil, err
+	}
+
+	return vrpsFor(roas, asn), nil
+}
+
+// roas returns the ROAs listed by cmd, which is either the full RPKI prefix
+// table or the ROAs covering a single prefix.
+func (f FRRConn) roas(ctx context.Context, cmd string) ([]roa, error) {
+	var t frrPrefixTable
+	if err := f.command(ctx, cmd, &t); err != nil {
+		return nil, err
+	}
+
+	var roas []roa
+	for _, p := range t.Prefixes {
+		_, prefix, err := net.ParseCIDR(fmt.Sprintf("%s/%d", p.Prefix, p.PrefixLenMin))
+		if err != nil {
+			return nil, outputError(cmd, p.Prefix, err)
+		}
+		roas = append(roas, roa{prefix: prefix, max: p.PrefixLenMax, asn: p.ASN})
+	}
+
+	return roas, nil
+}
+
+// GetInvalids returns a map of ASNs that are advertising RPKI invalid prefixes.
+// It also includes all those prefixes being advertised.
+func (f FRRConn) GetInvalids(ctx context.Context) (map[string][]string, error) {
+	inv := make(map[string][]string)
+	for _, cmd := range []string{"show bgp ipv4 unicast rpki invalid json", "show bgp ipv6 unicast rpki invalid json"} {
+		routes, err := f.table(ctx, cmd)
+		if err != nil {
+			return inv, err
+		}
+		for i := range routes {
+			routes[i].roa = RInvalid
+		}
+		invalids(routes, inv)
+	}
+
+	return inv, nil
+}
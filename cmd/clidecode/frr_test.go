@@ -0,0 +1,188 @@
+package clidecode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// frrFixtures maps each vtysh command to captured output in testdata/frr.
+var frrFixtures = map[string]string{
+	"show bgp summary json":                     "summary.json",
+	"show bgp ipv4 unicast json":                "ipv4.json",
+	"show bgp ipv6 unicast json":                "ipv6.json",
+	"show bgp ipv4 unicast rpki invalid json":   "ipv4_rpki_invalid.json",
+	"show bgp ipv6 unicast rpki invalid json":   "ipv6_rpki_invalid.json",
+	"show bgp ipv4 unicast regexp _3356$ json":  "ipv4_regexp_3356.json",
+	"show bgp ipv6 unicast regexp _13335$ json": "ipv6_regexp_13335.json",
+	"show bgp ipv4 unicast 8.8.8.8 json":        "lookup_8.8.8.8.json",
+	"show bgp ipv4 unicast 9.9.9.9 json":        "lookup_9.9.9.9.json",
+	"show bgp ipv4 unicast 192.0.2.1 json":      "lookup_missing.json",
+	"show bgp ipv4 unicast detail json":         "ipv4_detail.json",
+	"show bgp ipv6 unicast detail json":         "ipv6_detail.json",
+	"show rpki prefix-table json":               "prefix_table.json",
+	"show rpki prefix 1.1.1.0/24 json":          "rpki_prefix_1.1.1.0.json",
+	"show rpki prefix 192.0.2.0/24 json":        "rpki_prefix_missing.json",
+}
+
+func frrFixture(_ context.Context, cmd string) ([]byte, error) {
+	f, ok := frrFixtures[cmd]
+	if !ok {
+		return nil, fmt.Errorf("no fixture for %q", cmd)
+	}
+	return os.ReadFile("testdata/frr/" + f)
+}
+
+func TestFRRTable(t *testing.T) {
+	got, err := NewFRRConn(frrFixture).GetTable(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTable(t, got, testTable())
+}
+
+func TestFRRPeers(t *testing.T) {
+	f := NewFRRConn(frrFixture)
+
+	peers, err := f.GetPeers(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Peers{V4c: 3, V4e: 2, V6c: 1, V6e: 1}); peers != want {
+		t.Errorf("Got %#v, Wanted %#v", peers, want)
+	}
+
+	for asn, want := range tableTransits {
+		got, err := f.GetTransit(t.Context(), asn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d: Got %v, Wanted %v", asn, got, want)
+		}
+	}
+}
+
+func TestFRRPeerDetails(t *testing.T) {
+	f := NewFRRConn(frrFixture)
+
+	got, err := f.GetPeerDetails(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PeerDetail{
+		{Address: net.ParseIP("192.0.2.1"), ASN: 3356, State: StateEstablished, Uptime: 65741 * time.Second, V4Received: 4, V4Accepted: 4},
+		{Address: net.ParseIP("192.0.2.2"), ASN: 174, State: StateActive},
+		{Address: net.ParseIP("192.0.2.3"), ASN: 6939, State: StateEstablished, Uptime: 7801 * time.Second, V4Received: 3, V4Accepted: 3},
+		{Address: net.ParseIP("2001:db8::1"), ASN: 6939, State: StateEstablished, Uptime: 7801 * time.Second, V6Received: 2, V6Accepted: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+}
+
+func TestFRRLookups(t *testing.T) {
+	f := NewFRRConn(frrFixture)
+
+	route, ok, err := f.GetRoute(t.Context(), net.ParseIP("8.8.8.8"))
+	if err != nil || !ok || route.String() != "8.8.8.0/24" {
+		t.Errorf("GetRoute: got %v, %t, %v", route, ok, err)
+	}
+	origin, ok, err := f.GetOriginFromIP(t.Context(), net.ParseIP("8.8.8.8"))
+	if err != nil || !ok || origin != 15169 {
+		t.Errorf("GetOriginFromIP: got %d, %t, %v", origin, ok, err)
+	}
+	if _, ok, err := f.GetRoute(t.Context(), net.ParseIP("192.0.2.1")); err != nil || ok {
+		t.Errorf("GetRoute for missing route: got %t, %v", ok, err)
+	}
+
+	prefix, path, ok, err := f.GetASPathFromIP(t.Context(), net.ParseIP("9.9.9.9"))
+	wantPath := ASPath{Path: []uint32{6939, 19281}, Set: []uint32{1, 2}}
+	if err != nil || !ok || prefix.String() != "9.9.9.0/24" || !reflect.DeepEqual(path, wantPath) {
+		t.Errorf("GetASPathFromIP: got %v, %v, %t, %v", prefix, path, ok, err)
+	}
+
+	v4, err := f.GetIPv4FromSource(t.Context(), 3356)
+	if err != nil || len(v4) != 1 || v4[0].String() != "8.0.0.0/9" {
+		t.Errorf("GetIPv4FromSource: got %v, %v", v4, err)
+	}
+	v6, err := f.GetIPv6FromSource(t.Context(), 13335)
+	if err != nil || len(v6) != 1 || v6[0].String() != "2606:4700::/32" {
+		t.Errorf("GetIPv6FromSource: got %v, %v", v6, err)
+	}
+
+	inv, err := f.GetInvalids(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantInv := map[string][]string{"19281": {"9.9.9.0/24"}, "15169": {"2001:4860::/32"}}
+	if !reflect.DeepEqual(inv, wantInv) {
+		t.Errorf("GetInvalids: got %v, wanted %v", inv, wantInv)
+	}
+}
+
+func TestFRRROA(t *testing.T) {
+	f := NewFRRConn(frrFixture)
+
+	tests := []struct {
+		prefix string
+		asn    uint32
+		want   int
+	}{
+		{prefix: "1.1.1.0/24", asn: 13335, want: RValid},
+		{prefix: "1.1.1.0/24", asn: 3356, want: RInvalid},
+		{prefix: "192.0.2.0/24", asn: 64496, want: RUnknown},
+	}
+	for _, tc := range tests {
+		_, prefix, _ := net.ParseCIDR(tc.prefix)
+		got, ok, err := f.GetROA(t.Context(), prefix, tc.asn)
+		if err != nil || !ok || got != tc.want {
+			t.Errorf("GetROA(%s, %d): got %d, %t, %v. Wanted %d", tc.prefix, tc.asn, got, ok, err, tc.want)
+		}
+	}
+
+	vrps, err := f.GetVRPs(t.Context(), 13335)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range vrps {
+		got = append(got, fmt.Sprintf("%s-%d", v.Prefix, v.Max))
+	}
+	sort.Strings(got)
+	if want := []string{"1.1.1.0/24-24", "2606:4700::/32-48"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetVRPs: got %v, wanted %v", got, want)
+	}
+}
+
+func TestFRRBadOutput(t *testing.T) {
+	f := NewFRRConn(func(context.Context, string) ([]byte, error) {
+		return []byte("% Unknown command: show bgp summary json"), nil
+	})
+	if _, err := f.GetPeers(t.Context()); !errors.Is(err, ErrUnexpectedOutput) {
+		t.Errorf("Got %v, Wanted %v", err, ErrUnexpectedOutput)
+	}
+
+	// A path that can't be decoded fails the whole table, rather than
+	// returning ASN 0.
+	f = NewFRRConn(func(context.Context, string) ([]byte, error) {
+		return []byte(`{"routes": {"1.1.1.0/24": [{"valid": true, "bestpath": true, "path": "3356 x"}]}}`), nil
+	})
+	var outErr *OutputError
+	if _, err := f.GetTransit(t.Context(), 3356); !errors.As(err, &outErr) || outErr.Output != "3356 x" {
+		t.Errorf("Got %v, Wanted an OutputError for the path", err)
+	}
+
+	f = NewFRRConn(func(context.Context, string) ([]byte, error) {
+		return nil, errors.New("exit status 1")
+	})
+	if _, err := f.GetPeers(t.Context()); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Got %v, Wanted %v", err, ErrUnreachable)
+	}
+}
@@ -0,0 +1,467 @@
+package clidecode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	c "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/apiutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// gobgpTimeout is the maximum time allowed for any single call to GoBGP,
+// if the caller's context doesn't have a shorter deadline. Streaming the
+// full table can take a while.
+const gobgpTimeout = 2 * time.Minute
+
+// gobgpVRPTime is how long the VRPs fetched from GoBGP are used to look up
+// the ROA state of a prefix before they're fetched again. GoBGP can only
+// list every VRP, so they're kept rather than fetched for every lookup.
+const gobgpVRPTime = time.Minute
+
+var (
+	gobgpV4 = &api.Family{Afi: api.Family_AFI_IP, Safi: api.Family_SAFI_UNICAST}
+	gobgpV6 = &api.Family{Afi: api.Family_AFI_IP6, Safi: api.Family_SAFI_UNICAST}
+)
+
+// gobgpError returns err from a gRPC call made with ctx. gRPC replaces the
+// context error with its own status, so it's put back when ctx is done.
+func gobgpError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return c.ContextError(fmt.Sprintf("gobgp: %v", err), ctxErr)
+	}
+	switch status.Code(err) {
+	case codes.Unavailable:
+		return fmt.Errorf("%w: gobgp: %w", ErrUnreachable, err)
+	case codes.NotFound:
+		return fmt.Errorf("%w: gobgp: %w", ErrNotFound, err)
+	}
+	return err
+}
+
+// GoBGPConn is a connection to a GoBGP instance over its gRPC API.
+type GoBGPConn struct {
+	client api.GobgpApiClient
+	vrps   *vrpCache
+}
+
+// vrpCache holds every VRP of both families by prefix, and when they were
+// fetched. The trie is replaced rather than changed, so it can be read
+// without holding mu.
+type vrpCache struct {
+	mu      sync.Mutex
+	t       *c.Trie[[]roa]
+	fetched time.Time
+}
+
+// NewGoBGPConn returns a GoBGPConn using an existing gRPC connection
+// to gobgpd. The caller is responsible for closing the connection.
+func NewGoBGPConn(cc grpc.ClientConnInterface) GoBGPConn {
+	return GoBGPConn{client: api.NewGobgpApiClient(cc), vrps: new(vrpCache)}
+}
+
+// GetPeers returns ipv4 peer configured, established. ipv6 peers configured, established
+func (g GoBGPConn) GetPeers(ctx context.Context) (Peers, error) {
+	var p Peers
+	peers, err := g.listPeers(ctx)
+	if err != nil {
+		return p, err
+	}
+	for _, peer := range peers {
+		ip := net.ParseIP(peer.GetConf().GetNeighborAddress())
+		if ip == nil {
+			return Peers{}, outputError("ListPeer", peer.GetConf().GetNeighborAddress(), errors.New("invalid neighbor address"))
+		}
+		up := peer.GetState().GetSessionState() == api.PeerState_ESTABLISHED
+		switch {
+		case ip.To4() != nil:
+			p.V4c++
+			if up {
+				p.V4e++
+			}
+		default:
+			p.V6c++
+			if up {
+				p.V6e++
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// GetPeerDetails returns the state of each peer, and the amount of
+// prefixes received from it for each address family.
+func (g GoBGPConn) GetPeerDetails(ctx context.Context) ([]PeerDetail, error) {
+	peers, err := g.listPeers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var details []PeerDetail
+	for _, peer := range peers {
+		ip := net.ParseIP(peer.GetConf().GetNeighborAddress())
+		if ip == nil {
+			return nil, outputError("ListPeer", peer.GetConf().GetNeighborAddress(), errors.New("invalid neighbor address"))
+		}
+		d := PeerDetail{
+			Address: ip,
+			ASN:     peer.GetConf().GetPeerAsn(),
+			State:   peerState(peer.GetState().GetSessionState().String()),
+		}
+		if up := peer.GetTimers().GetState().GetUptime(); d.State == StateEstablished && up != nil {
+			d.Uptime = time.Since(up.AsTime()).Truncate(time.Second)
+		}
+		for _, afi := range peer.GetAfiSafis() {
+			state := afi.GetState()
+			switch {
+			case sameFamily(state.GetFamily(), gobgpV4):
+				d.V4Received, d.V4Accepted = uint32(state.GetReceived()), uint32(state.GetAccepted())
+			case sameFamily(state.GetFamily(), gobgpV6):
+				d.V6Received, d.V6Accepted = uint32(state.GetReceived()), uint32(state.GetAccepted())
+			}
+		}
+		details = append(details, d)
+	}
+	sortPeers(details)
+
+	return details, nil
+}
+
+func sameFamily(a, b *api.Family) bool {
+	return a.GetAfi() == b.GetAfi() && a.GetSafi() == b.GetSafi()
+}
+
+// listPeers returns every configured peer.
+func (g GoBGPConn) listPeers(ctx context.Context) ([]*api.Peer, error) {
+	ctx, cancel := context.WithTimeout(ctx, gobgpTimeout)
+	defer cancel()
+
+	stream, err := g.client.ListPeer(ctx, &api.ListPeerRequest{})
+	if err != nil {
+		return nil, gobgpError(ctx, err)
+	}
+	var peers []*api.Peer
+	for {
+		res, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, gobgpError(ctx, err)
+		}
+		peers = append(peers, res.GetPeer())
+	}
+
+	return peers, nil
+}
+
+// GetTransit returns how many prefixes an ASN transits, and the ASNs
+// seen directly upstream and downstream of it.
+func (g GoBGPConn) GetTransit(ctx context.Context, asn uint32) (Transit, error) {
+	v4, err := g.bestRoutes(ctx, gobgpV4, nil)
+	if err != nil {
+		return Transit{}, err
+	}
+	v6, err := g.bestRoutes(ctx, gobgpV6, nil)
+	if err != nil {
+		return Transit{}, err
+	}
+
+	return transit(v4, v6, asn), nil
+}
+
+// GetTable returns the best path of every IPv4 and IPv6 route, with all of
+// their attributes. The origin of every path is kept.
+func (g GoBGPConn) GetTable(ctx context.Context) (*Table, error) {
+	o := make(map[string][]uint32)
+	rib4, v4, err := g.rib(ctx, gobgpV4, nil, o)
+	if err != nil {
+		return nil, err
+	}
+	rib6, v6, err := g.rib(ctx, gobgpV6, nil, o)
+	if err != nil {
+		return nil, err
+	}
+
+	table := newTable(v4, v6, o)
+	table.totals.V4Rib, table.totals.V6Rib = rib4, rib6
+
+	return table, nil
+}
+
+// GetIPv4FromSource returns all the IPv4 networks sourced from a source ASN.
+func (g GoBGPConn) GetIPv4FromSource(ctx context.Context, asn uint32) ([]*net.IPNet, error) {
+	routes, err := g.bestRoutes(ctx, gobgpV4, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return fromSource(routes, asn), nil
+}
+
+// GetIPv6FromSource returns all the IPv6 networks sourced from a source ASN.
+func (g GoBGPConn) GetIPv6FromSource(ctx context.Context, asn uint32) ([]*net.IPNet, error) {
+	routes, err := g.bestRoutes(ctx, gobgpV6, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return fromSource(routes, asn), nil
+}
+
+// GetOriginFromIP will return the origin ASN from a source IP.
+func (g GoBGPConn) GetOriginFromIP(ctx context.Context, ip net.IP) (uint32, bool, error) {
+	p, ok, err := g.lookup(ctx, ip)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	o, ok := p.origin()
+
+	return o, ok, nil
+}
+
+// GetASPathFromIP will return the matched prefix and its AS path, as well as as-set if any from a source IP.
+func (g GoBGPConn) GetASPathFromIP(ctx context.Context, ip net.IP) (*net.IPNet, ASPath, bool, error) {
+	p, ok, err := g.lookup(ctx, ip)
+	if err != nil || !ok {
+		return nil, ASPath{}, false, err
+	}
+
+	return p.prefix, p.path, true, nil
+}
+
+// GetRoute will return the current FIB entry, if any, from a source IP.
+func (g GoBGPConn) GetRoute(ctx context.Context, ip net.IP) (*net.IPNet, bool, error) {
+	p, ok, err := g.lookup(ctx, ip)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	return p.prefix, true, nil
+}
+
+// GetROA will return the ROA status from a prefix and ASN.
+// This function does not check for the existence of the prefix in the table.
+func (g GoBGPConn) GetROA(ctx context.Context, prefix *net.IPNet, asn uint32) (int, bool, error) {
+	t, err := g.vrpTrie(ctx)
+	if err != nil {
+		return RUnknown, false, err
+	}
+
+	return roaState(t, prefix, asn), true, nil
+}
+
+// vrpTrie returns every VRP by prefix, fetching them again once they're
+// older than gobgpVRPTime.
+func (g GoBGPConn) vrpTrie(ctx context.Context) (*c.Trie[[]roa], error) {
+	g.vrps.mu.Lock()
+	defer g.vrps.mu.Unlock()
+	if g.vrps.t != nil && time.Since(g.vrps.fetched) < gobgpVRPTime {
+		return g.vrps.t, nil
+	}
+
+	t := new(c.Trie[[]roa])
+	for _, family := range []*api.Family{gobgpV4, gobgpV6} {
+		roas, err := g.listROAs(ctx, family)
+		if err != nil {
+			return nil, err
+		}
+		addROAs(t, roas)
+	}
+	g.vrps.t, g.vrps.fetched = t, time.Now()
+
+	return t, nil
+}
+
+// GetVRPs will return all Validated ROA Payloads for an ASN.
+func (g GoBGPConn) GetVRPs(ctx context.Context, asn uint32) ([]VRP, error) {
+	var VRPs []VRP
+	for _, family := range []*api.Family{gobgpV4, gobgpV6} {
+		roas, err := g.listROAs(ctx, family)
+		if err != nil {
+			return nil, err
+		}
+		VRPs = append(VRPs, vrpsFor(roas, asn)...)
+	}
+
+	return VRPs, nil
+}
+
+// GetInvalids returns a map of ASNs that are advertising RPKI invalid prefixes.
+// It also includes all those prefixes being advertised.
+func (g GoBGPConn) GetInvalids(ctx context.Context) (map[string][]string, error) {
+	inv := make(map[string][]string)
+	for _, family := range []*api.Family{gobgpV4, gobgpV6} {
+		routes, err := g.bestRoutes(ctx, family, nil)
+		if err != nil {
+			return inv, err
+		}
+		invalids(routes, inv)
+	}
+
+	return inv, nil
+}
+
+// lookup returns the best path for the longest prefix covering ip.
+func (g GoBGPConn) lookup(ctx context.Context, ip net.IP) (route, bool, error) {
+	family := familyOf(ip)
+	bits := 128
+	if family == gobgpV4 {
+		bits = 32
+	}
+	host := &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	routes, err := g.bestRoutes(ctx, family, []*api.TableLookupPrefix{{
+		Prefix: host.String(),
+		Type:   api.TableLookupPrefix_SHORTER,
+	}})
+	if err != nil {
+		return route{}, false, err
+	}
+
+	var t c.Trie[route]
+	addRoutes(&t, routes)
+	r, ok := longestMatch(&t, ip)
+	return r, ok, nil
+}
+
+// bestRoutes returns the best path of every destination in the global
+// table for the family. If prefixes is not nil, only those destinations
+// matching the lookup are returned.
+func (g GoBGPConn) bestRoutes(ctx context.Context, family *api.Family, prefixes []*api.TableLookupPrefix) ([]route, error) {
+	_, routes, err := g.rib(ctx, family, prefixes, nil)
+	return routes, err
+}
+
+// rib returns the amount of paths in the global table for the family, and
+// the best path of every destination. If prefixes is not nil, only those
+// destinations matching the lookup are returned. Every path is listed, and
+// the origin of each is added to o, unless it's nil.
+func (g GoBGPConn) rib(ctx context.Context, family *api.Family, prefixes []*api.TableLookupPrefix, o map[string][]uint32) (uint32, []route, error) {
+	ctx, cancel := context.WithTimeout(ctx, gobgpTimeout)
+	defer cancel()
+
+	stream, err := g.client.ListPath(ctx, &api.ListPathRequest{
+		TableType: api.TableType_GLOBAL,
+		Family:    family,
+		Prefixes:  prefixes,
+	})
+	if err != nil {
+		return 0, nil, gobgpError(ctx, err)
+	}
+
+	var paths uint32
+	var routes []route
+	for {
+		res, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return paths, routes, nil
+		}
+		if err != nil {
+			return 0, nil, gobgpError(ctx, err)
+		}
+		dst := res.GetDestination()
+		for _, path := range dst.GetPaths() {
+			paths++
+			r, err := decodeGoBGPPath(dst.GetPrefix(), path)
+			if err != nil {
+				return 0, nil, err
+			}
+			if o != nil {
+				addOrigin(o, r)
+			}
+			if path.GetBest() {
+				routes = append(routes, r)
+			}
+		}
+	}
+}
+
+// decodeGoBGPPath converts the GoBGP path attributes into a route.
+func decodeGoBGPPath(prefix string, path *api.Path) (route, error) {
+	var p route
+	_, ipnet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return p, outputError("ListPath", prefix, err)
+	}
+	p.prefix = ipnet
+
+	for _, attr := range path.GetPattrs() {
+		m, err := attr.UnmarshalNew()
+		if err != nil {
+			return p, outputError("ListPath", prefix, err)
+		}
+		switch a := m.(type) {
+		case *api.AsPathAttribute:
+			for _, seg := range a.GetSegments() {
+				switch seg.GetType() {
+				case api.AsSegment_AS_SEQUENCE:
+					p.path.Path = append(p.path.Path, seg.GetNumbers()...)
+				case api.AsSegment_AS_SET:
+					p.path.Set = append(p.path.Set, seg.GetNumbers()...)
+				}
+			}
+		case *api.CommunitiesAttribute, *api.ExtendedCommunitiesAttribute, *api.LargeCommunitiesAttribute:
+			comms, err := apiutil.UnmarshalAttribute(attr)
+			if err != nil {
+				return p, outputError("ListPath", prefix, err)
+			}
+			addCommunityAttr(&p, comms)
+		}
+	}
+
+	switch path.GetValidation().GetState() {
+	case api.Validation_STATE_VALID:
+		p.roa = RValid
+	case api.Validation_STATE_INVALID:
+		p.roa = RInvalid
+	default:
+		p.roa = RUnknown
+	}
+
+	return p, nil
+}
+
+// listROAs returns every ROA GoBGP has received from its RPKI caches.
+func (g GoBGPConn) listROAs(ctx context.Context, family *api.Family) ([]roa, error) {
+	ctx, cancel := context.WithTimeout(ctx, gobgpTimeout)
+	defer cancel()
+
+	stream, err := g.client.ListRpkiTable(ctx, &api.ListRpkiTableRequest{Family: family})
+	if err != nil {
+		return nil, gobgpError(ctx, err)
+	}
+
+	var roas []roa
+	for {
+		res, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return roas, nil
+		}
+		if err != nil {
+			return nil, gobgpError(ctx, err)
+		}
+		r := res.GetRoa()
+		_, prefix, err := net.ParseCIDR(fmt.Sprintf("%s/%d", r.GetPrefix(), r.GetPrefixlen()))
+		if err != nil {
+			return nil, outputError("ListRpkiTable", r.GetPrefix(), err)
+		}
+		roas = append(roas, roa{prefix: prefix, max: int(r.GetMaxlen()), asn: r.GetAsn()})
+	}
+}
+
+// familyOf returns the GoBGP address family of an IP.
+func familyOf(ip net.IP) *api.Family {
+	if ip.To4() != nil {
+		return gobgpV4
+	}
+	return gobgpV6
+}
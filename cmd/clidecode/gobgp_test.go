@@ -0,0 +1,344 @@
+package clidecode
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fakeGoBGP is an in-process GoBGP API server with a small fixed table.
+type fakeGoBGP struct {
+	api.UnimplementedGobgpApiServer
+	peers []*api.Peer
+	v4    []*api.Destination
+	v6    []*api.Destination
+	roas  []*api.Roa
+	// rpki counts the calls to ListRpkiTable.
+	rpki atomic.Int32
+}
+
+func gobgpDest(t *testing.T, prefix string, state api.Validation_State, large int, segs ...*api.AsSegment) *api.Destination {
+	t.Helper()
+	asPath, err := anypb.New(&api.AsPathAttribute{Segments: segs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs := []*anypb.Any{asPath}
+	if large > 0 {
+		var comms []*api.LargeCommunity
+		for i := 0; i < large; i++ {
+			comms = append(comms, &api.LargeCommunity{GlobalAdmin: 65000, LocalData1: uint32(i)})
+		}
+		lc, err := anypb.New(&api.LargeCommunitiesAttribute{Communities: comms})
+		if err != nil {
+			t.Fatal(err)
+		}
+		attrs = append(attrs, lc)
+	}
+	return &api.Destination{
+		Prefix: prefix,
+		Paths: []*api.Path{
+			// A non-best path with no attributes, which must always be ignored.
+			{Pattrs: []*anypb.Any{}, Best: false},
+			{Pattrs: attrs, Best: true, Validation: &api.Validation{State: state}},
+		},
+	}
+}
+
+func seq(asns ...uint32) *api.AsSegment {
+	return &api.AsSegment{Type: api.AsSegment_AS_SEQUENCE, Numbers: asns}
+}
+
+func set(asns ...uint32) *api.AsSegment {
+	return &api.AsSegment{Type: api.AsSegment_AS_SET, Numbers: asns}
+}
+
+func newFakeGoBGP(t *testing.T) *fakeGoBGP {
+	peer := func(addr string, asn uint32, state api.PeerState_SessionState, family *api.Family, received, accepted uint64) *api.Peer {
+		p := &api.Peer{
+			Conf:  &api.PeerConf{NeighborAddress: addr, PeerAsn: asn},
+			State: &api.PeerState{SessionState: state},
+			AfiSafis: []*api.AfiSafi{{
+				State: &api.AfiSafiState{Family: family, Received: received, Accepted: accepted},
+			}},
+		}
+		if state == api.PeerState_ESTABLISHED {
+			p.Timers = &api.Timers{State: &api.TimersState{Uptime: timestamppb.New(time.Now().Add(-time.Hour))}}
+		}
+		return p
+	}
+	f := &fakeGoBGP{
+		peers: []*api.Peer{
+			peer("192.0.2.1", 3356, api.PeerState_ESTABLISHED, gobgpV4, 5, 4),
+			peer("192.0.2.2", 174, api.PeerState_ACTIVE, gobgpV4, 0, 0),
+			peer("2001:db8::1", 6939, api.PeerState_ESTABLISHED, gobgpV6, 2, 2),
+		},
+		v4: []*api.Destination{
+			gobgpDest(t, "1.1.1.0/24", api.Validation_STATE_VALID, 1, seq(3356, 13335)),
+			gobgpDest(t, "8.0.0.0/9", api.Validation_STATE_NOT_FOUND, 0, seq(3356)),
+			gobgpDest(t, "8.8.8.0/24", api.Validation_STATE_VALID, 0, seq(3356, 15169)),
+			gobgpDest(t, "9.9.9.0/24", api.Validation_STATE_INVALID, 2, seq(174, 19281), set(1, 2)),
+		},
+		v6: []*api.Destination{
+			gobgpDest(t, "2606:4700::/32", api.Validation_STATE_VALID, 0, seq(6939, 13335)),
+			gobgpDest(t, "2001:4860::/32", api.Validation_STATE_INVALID, 1, seq(6939, 15169)),
+		},
+		roas: []*api.Roa{
+			{Asn: 13335, Prefix: "1.1.1.0", Prefixlen: 24, Maxlen: 24},
+			{Asn: 15169, Prefix: "8.8.8.0", Prefixlen: 24, Maxlen: 24},
+			{Asn: 13335, Prefix: "2606:4700::", Prefixlen: 32, Maxlen: 48},
+		},
+	}
+
+	// 1.1.1.0/24 is also announced by 64496 on a path that isn't the best.
+	moas, err := anypb.New(&api.AsPathAttribute{Segments: []*api.AsSegment{seq(6939, 64496)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.v4[0].Paths = append(f.v4[0].Paths, &api.Path{Pattrs: []*anypb.Any{moas}})
+
+	return f
+}
+
+func (f *fakeGoBGP) table(family *api.Family) []*api.Destination {
+	if family.GetAfi() == api.Family_AFI_IP {
+		return f.v4
+	}
+	return f.v6
+}
+
+func (f *fakeGoBGP) ListPeer(r *api.ListPeerRequest, s api.GobgpApi_ListPeerServer) error {
+	for _, p := range f.peers {
+		if err := s.Send(&api.ListPeerResponse{Peer: p}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeGoBGP) ListPath(r *api.ListPathRequest, s api.GobgpApi_ListPathServer) error {
+	for _, d := range f.table(r.GetFamily()) {
+		_, dnet, _ := net.ParseCIDR(d.GetPrefix())
+		match := len(r.GetPrefixes()) == 0
+		for _, lookup := range r.GetPrefixes() {
+			ip, _, _ := net.ParseCIDR(lookup.GetPrefix())
+			if lookup.GetType() == api.TableLookupPrefix_SHORTER && dnet.Contains(ip) {
+				match = true
+			}
+		}
+		if !match {
+			continue
+		}
+		if err := s.Send(&api.ListPathResponse{Destination: d}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeGoBGP) ListRpkiTable(r *api.ListRpkiTableRequest, s api.GobgpApi_ListRpkiTableServer) error {
+	f.rpki.Add(1)
+	for _, roa := range f.roas {
+		v4 := !strings.Contains(roa.GetPrefix(), ":")
+		if v4 != (r.GetFamily().GetAfi() == api.Family_AFI_IP) {
+			continue
+		}
+		if err := s.Send(&api.ListRpkiTableResponse{Roa: roa}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dialFakeGoBGP starts the fake server and returns a GoBGPConn connected to it.
+func dialFakeGoBGP(t *testing.T) GoBGPConn {
+	t.Helper()
+	return dialGoBGP(t, newFakeGoBGP(t))
+}
+
+// dialGoBGP starts a server for f and returns a GoBGPConn connected to it.
+func dialGoBGP(t *testing.T, f *fakeGoBGP) GoBGPConn {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	api.RegisterGobgpApiServer(srv, f)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	cc, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+
+	return NewGoBGPConn(cc)
+}
+
+func TestGoBGPTable(t *testing.T) {
+	got, err := dialFakeGoBGP(t).GetTable(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 9.9.9.0/24 is learnt through 174 rather than 6939, the table only
+	// carries large communities, and every prefix has more paths.
+	want := testTable()
+	want.v4[0].comms = communities{large: []string{"65000:0:0"}}
+	want.v4[1].comms = communities{}
+	want.v4[2].comms = communities{}
+	want.v4[3].path.Path = []uint32{174, 19281}
+	want.v4[3].comms = communities{large: []string{"65000:0:0", "65000:1:0"}}
+	want.v6[0].comms = communities{large: []string{"65000:0:0"}}
+	want.v6[1].comms = communities{}
+	want.totals.V4Rib, want.totals.V6Rib = 9, 4
+	checkTable(t, got, want)
+}
+
+func TestGoBGPPeers(t *testing.T) {
+	g := dialFakeGoBGP(t)
+
+	peers, err := g.GetPeers(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Peers{V4c: 2, V4e: 1, V6c: 1, V6e: 1}); peers != want {
+		t.Errorf("Got %#v, Wanted %#v", peers, want)
+	}
+
+	// 9.9.9.0/24 is learnt through 174 rather than 6939.
+	wantTransits := map[uint32]Transit{
+		6939:  {V6: 2, Downstreams: []uint32{13335, 15169}},
+		13335: tableTransits[13335],
+		174:   {V4: 1, Downstreams: []uint32{19281}},
+	}
+	for asn, want := range wantTransits {
+		got, err := g.GetTransit(t.Context(), asn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d: Got %v, Wanted %v", asn, got, want)
+		}
+	}
+}
+
+func TestGoBGPPeerDetails(t *testing.T) {
+	g := dialFakeGoBGP(t)
+
+	got, err := g.GetPeerDetails(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Established peers came up an hour before the test started.
+	for i, p := range got {
+		if p.State == StateEstablished && (p.Uptime < time.Hour || p.Uptime > time.Hour+time.Minute) {
+			t.Errorf("%s: Got uptime %v, Wanted an hour", p.Address, p.Uptime)
+		}
+		got[i].Uptime = 0
+	}
+	want := []PeerDetail{
+		{Address: net.ParseIP("192.0.2.1"), ASN: 3356, State: StateEstablished, V4Received: 5, V4Accepted: 4},
+		{Address: net.ParseIP("192.0.2.2"), ASN: 174, State: StateActive},
+		{Address: net.ParseIP("2001:db8::1"), ASN: 6939, State: StateEstablished, V6Received: 2, V6Accepted: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+}
+
+func TestGoBGPLookups(t *testing.T) {
+	g := dialFakeGoBGP(t)
+
+	// 8.8.8.8 is covered by both 8.0.0.0/9 and 8.8.8.0/24
+	route, ok, err := g.GetRoute(t.Context(), net.ParseIP("8.8.8.8"))
+	if err != nil || !ok || route.String() != "8.8.8.0/24" {
+		t.Errorf("GetRoute: got %v, %t, %v", route, ok, err)
+	}
+	origin, ok, err := g.GetOriginFromIP(t.Context(), net.ParseIP("8.8.4.4"))
+	if err != nil || !ok || origin != 3356 {
+		t.Errorf("GetOriginFromIP: got %d, %t, %v", origin, ok, err)
+	}
+	if _, ok, err := g.GetRoute(t.Context(), net.ParseIP("192.0.2.1")); err != nil || ok {
+		t.Errorf("GetRoute for missing route: got %t, %v", ok, err)
+	}
+
+	prefix, path, ok, err := g.GetASPathFromIP(t.Context(), net.ParseIP("9.9.9.9"))
+	wantPath := ASPath{Path: []uint32{174, 19281}, Set: []uint32{1, 2}}
+	if err != nil || !ok || prefix.String() != "9.9.9.0/24" || !reflect.DeepEqual(path, wantPath) {
+		t.Errorf("GetASPathFromIP: got %v, %v, %t, %v", prefix, path, ok, err)
+	}
+
+	v6, err := g.GetIPv6FromSource(t.Context(), 13335)
+	if err != nil || len(v6) != 1 || v6[0].String() != "2606:4700::/32" {
+		t.Errorf("GetIPv6FromSource: got %v, %v", v6, err)
+	}
+	v4, err := g.GetIPv4FromSource(t.Context(), 3356)
+	if err != nil || len(v4) != 1 || v4[0].String() != "8.0.0.0/9" {
+		t.Errorf("GetIPv4FromSource: got %v, %v", v4, err)
+	}
+
+	inv, err := g.GetInvalids(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantInv := map[string][]string{"19281": {"9.9.9.0/24"}, "15169": {"2001:4860::/32"}}
+	if !reflect.DeepEqual(inv, wantInv) {
+		t.Errorf("GetInvalids: got %v, wanted %v", inv, wantInv)
+	}
+}
+
+func TestGoBGPROA(t *testing.T) {
+	f := newFakeGoBGP(t)
+	g := dialGoBGP(t, f)
+
+	tests := []struct {
+		prefix string
+		asn    uint32
+		want   int
+	}{
+		{prefix: "1.1.1.0/24", asn: 13335, want: RValid},
+		{prefix: "1.1.1.0/24", asn: 3356, want: RInvalid},
+		{prefix: "1.1.1.128/25", asn: 13335, want: RInvalid},
+		{prefix: "9.9.9.0/24", asn: 19281, want: RUnknown},
+		{prefix: "2606:4700:10::/48", asn: 13335, want: RValid},
+	}
+	for _, tc := range tests {
+		_, prefix, _ := net.ParseCIDR(tc.prefix)
+		got, ok, err := g.GetROA(t.Context(), prefix, tc.asn)
+		if err != nil || !ok || got != tc.want {
+			t.Errorf("GetROA(%s, %d): got %d, %t, %v. Wanted %d", tc.prefix, tc.asn, got, ok, err, tc.want)
+		}
+	}
+	// The VRPs of each family are only listed once for every lookup.
+	if got := f.rpki.Load(); got != 2 {
+		t.Errorf("Got %d ListRpkiTable calls, Wanted 2", got)
+	}
+
+	vrps, err := g.GetVRPs(t.Context(), 13335)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range vrps {
+		got = append(got, v.Prefix.String())
+	}
+	sort.Strings(got)
+	if want := []string{"1.1.1.0/24", "2606:4700::/32"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetVRPs: got %v, wanted %v", got, want)
+	}
+}
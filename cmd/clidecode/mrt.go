@@ -0,0 +1,305 @@
+package clidecode
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"slices"
+
+	c "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+	"github.com/osrg/gobgp/v3/pkg/packet/mrt"
+)
+
+// maxMRTRecord is the largest single MRT record accepted. A RIB record holds
+// every path for a prefix, so on a large route collector it can be quite big.
+const maxMRTRecord = 16 << 20
+
+// MRTConn answers queries from an MRT TABLE_DUMP_V2 RIB dump (RFC6396).
+// The dump is loaded into memory once, so the statistics are for the time
+// the dump was taken rather than now.
+//
+// A dump holds every path received from every peer, but doesn't say which
+// one the collector chose. The best path is taken to be the one with the
+// shortest AS path, with ties going to the lowest peer index.
+type MRTConn struct {
+	v4, v6       []route
+	v4Rib, v6Rib uint32
+	peers        Peers
+	details      []PeerDetail
+	origins      map[string][]uint32
+	// routes holds the best path of every route by prefix, for lookups.
+	routes c.Trie[route]
+}
+
+// NewMRTConn loads the RIB dump in file. The file may be gzip or bzip2
+// compressed, which is worked out from the content rather than the name.
+func NewMRTConn(file string) (MRTConn, error) {
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return MRTConn{}, fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	if err != nil {
+		return MRTConn{}, err
+	}
+	defer f.Close()
+
+	r, err := decompress(f)
+	if err != nil {
+		return MRTConn{}, outputError(file, "", err)
+	}
+	m, err := decodeMRT(r)
+	if err != nil {
+		return MRTConn{}, outputError(file, "", err)
+	}
+
+	return m, nil
+}
+
+// decompress returns a reader for the uncompressed content of in.
+func decompress(in io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(in)
+	magic, err := br.Peek(3)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return bzip2.NewReader(br), nil
+	}
+	return br, nil
+}
+
+// decodeMRT reads every record of a TABLE_DUMP_V2 dump. Records of any other
+// type, and RIB records for anything other than unicast, are skipped.
+func decodeMRT(in io.Reader) (MRTConn, error) {
+	m := MRTConn{origins: make(map[string][]uint32)}
+	var peers []*mrt.Peer
+	// Paths received from each peer, IPv4 then IPv6.
+	received := make(map[uint16]*[2]uint32)
+
+	hdr := make([]byte, mrt.MRT_COMMON_HEADER_LEN)
+	for {
+		if _, err := io.ReadFull(in, hdr); err == io.EOF {
+			break
+		} else if err != nil {
+			return m, fmt.Errorf("unable to read MRT header: %w", err)
+		}
+		var h mrt.MRTHeader
+		if err := h.DecodeFromBytes(hdr); err != nil {
+			return m, err
+		}
+		if h.Len > maxMRTRecord {
+			return m, fmt.Errorf("MRT record of %d bytes is too large", h.Len)
+		}
+		data := make([]byte, h.Len)
+		if _, err := io.ReadFull(in, data); err != nil {
+			return m, fmt.Errorf("unable to read MRT record: %w", err)
+		}
+		if h.Type != mrt.TABLE_DUMPv2 {
+			continue
+		}
+		switch mrt.MRTSubTypeTableDumpv2(h.SubType) {
+		case mrt.PEER_INDEX_TABLE, mrt.RIB_IPV4_UNICAST, mrt.RIB_IPV6_UNICAST:
+		default:
+			continue
+		}
+		msg, err := mrt.ParseMRTBody(&h, data)
+		if err != nil {
+			return m, err
+		}
+
+		switch body := msg.Body.(type) {
+		case *mrt.PeerIndexTable:
+			peers = body.Peers
+		case *mrt.Rib:
+			if peers == nil {
+				return m, fmt.Errorf("RIB record seen before the peer index table")
+			}
+			r, err := bestMRTRoute(body, m.origins)
+			if err != nil {
+				return m, err
+			}
+			family := 0
+			if body.RouteFamily != bgp.RF_IPv4_UC {
+				family = 1
+			}
+			for _, e := range body.Entries {
+				if received[e.PeerIndex] == nil {
+					received[e.PeerIndex] = new([2]uint32)
+				}
+				received[e.PeerIndex][family]++
+			}
+			if family == 0 {
+				m.v4 = append(m.v4, r)
+				m.v4Rib += uint32(len(body.Entries))
+			} else {
+				m.v6 = append(m.v6, r)
+				m.v6Rib += uint32(len(body.Entries))
+			}
+		}
+	}
+
+	// A dump only lists peers, not their state, so a peer is counted as
+	// established if it contributed any path at all.
+	for i, p := range peers {
+		counts, seen := received[uint16(i)]
+		d := PeerDetail{Address: p.IpAddress, ASN: p.AS, State: StateIdle}
+		if seen {
+			d.State = StateEstablished
+			d.V4Received, d.V4Accepted = counts[0], counts[0]
+			d.V6Received, d.V6Accepted = counts[1], counts[1]
+		}
+		m.details = append(m.details, d)
+
+		if p.IpAddress.To4() != nil {
+			m.peers.V4c++
+			if seen {
+				m.peers.V4e++
+			}
+			continue
+		}
+		m.peers.V6c++
+		if seen {
+			m.peers.V6e++
+		}
+	}
+	sortPeers(m.details)
+
+	addRoutes(&m.routes, m.v4)
+	addRoutes(&m.routes, m.v6)
+
+	return m, nil
+}
+
+// bestMRTRoute returns the best path of a RIB record as a route. The origin
+// of every path is added to origins.
+func bestMRTRoute(rib *mrt.Rib, origins map[string][]uint32) (route, error) {
+	_, prefix, err := net.ParseCIDR(rib.Prefix.String())
+	if err != nil {
+		return route{}, fmt.Errorf("unable to parse prefix %q: %w", rib.Prefix, err)
+	}
+
+	best := route{prefix: prefix}
+	bestLen := -1
+	for _, e := range rib.Entries {
+		r := route{prefix: prefix}
+		for _, attr := range e.PathAttributes {
+			switch a := attr.(type) {
+			case *bgp.PathAttributeAsPath:
+				r.path = decodeASPathAttr(a)
+			default:
+				addCommunityAttr(&r, a)
+			}
+		}
+		addOrigin(origins, r)
+		if l := pathLen(r.path); bestLen == -1 || l < bestLen {
+			best, bestLen = r, l
+		}
+	}
+
+	return best, nil
+}
+
+// GetPeers returns ipv4 peer configured, established. ipv6 peers configured, established
+func (m MRTConn) GetPeers(context.Context) (Peers, error) {
+	return m.peers, nil
+}
+
+// GetPeerDetails returns the state of each peer, and the amount of
+// prefixes received from it for each address family.
+// A dump has no session state or uptime, and only holds the paths that were
+// accepted.
+func (m MRTConn) GetPeerDetails(context.Context) ([]PeerDetail, error) {
+	return slices.Clone(m.details), nil
+}
+
+// GetTransit returns how many prefixes an ASN transits, and the ASNs
+// seen directly upstream and downstream of it.
+func (m MRTConn) GetTransit(_ context.Context, asn uint32) (Transit, error) {
+	return transit(m.v4, m.v6, asn), nil
+}
+
+// GetTable returns the best path of every IPv4 and IPv6 route, with all of
+// their attributes.
+// The origin of every path in the dump is kept.
+func (m MRTConn) GetTable(context.Context) (*Table, error) {
+	table := newTable(m.v4, m.v6, m.origins)
+	table.totals.V4Rib, table.totals.V6Rib = m.v4Rib, m.v6Rib
+
+	return table, nil
+}
+
+// GetIPv4FromSource returns all the IPv4 networks sourced from a source ASN.
+func (m MRTConn) GetIPv4FromSource(_ context.Context, asn uint32) ([]*net.IPNet, error) {
+	return fromSource(m.v4, asn), nil
+}
+
+// GetIPv6FromSource returns all the IPv6 networks sourced from a source ASN.
+func (m MRTConn) GetIPv6FromSource(_ context.Context, asn uint32) ([]*net.IPNet, error) {
+	return fromSource(m.v6, asn), nil
+}
+
+// GetOriginFromIP will return the origin ASN from a source IP.
+func (m MRTConn) GetOriginFromIP(_ context.Context, ip net.IP) (uint32, bool, error) {
+	r, ok := m.lookup(ip)
+	if !ok {
+		return 0, false, nil
+	}
+	o, ok := r.origin()
+
+	return o, ok, nil
+}
+
+// GetASPathFromIP will return the matched prefix and its AS path, as well as as-set if any from a source IP.
+func (m MRTConn) GetASPathFromIP(_ context.Context, ip net.IP) (*net.IPNet, ASPath, bool, error) {
+	r, ok := m.lookup(ip)
+	if !ok {
+		return nil, ASPath{}, false, nil
+	}
+
+	return r.prefix, r.path, true, nil
+}
+
+// GetRoute will return the current FIB entry, if any, from a source IP.
+func (m MRTConn) GetRoute(_ context.Context, ip net.IP) (*net.IPNet, bool, error) {
+	r, ok := m.lookup(ip)
+	if !ok {
+		return nil, false, nil
+	}
+
+	return r.prefix, true, nil
+}
+
+// lookup returns the best path for the longest prefix covering ip.
+func (m MRTConn) lookup(ip net.IP) (route, bool) {
+	return longestMatch(&m.routes, ip)
+}
+
+// GetROA will return the ROA status from a prefix and ASN.
+// A dump has no VRPs, so the status is never known.
+func (m MRTConn) GetROA(context.Context, *net.IPNet, uint32) (int, bool, error) {
+	return RUnknown, false, nil
+}
+
+// GetVRPs will return all Validated ROA Payloads for an ASN.
+// A dump has no VRPs, so there are never any.
+func (m MRTConn) GetVRPs(context.Context, uint32) ([]VRP, error) {
+	return nil, nil
+}
+
+// GetInvalids returns a map of ASNs that are advertising RPKI invalid prefixes.
+// A dump carries no validation state, so there are never any.
+func (m MRTConn) GetInvalids(context.Context) (map[string][]string, error) {
+	return map[string][]string{}, nil
+}
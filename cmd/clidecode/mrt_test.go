@@ -0,0 +1,176 @@
+package clidecode
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMRTTable(t *testing.T) {
+	// A dump carries no validation state, its routes each have a single
+	// path, and the table only carries large communities.
+	want := withoutROAs(testTable())
+	want.origins = nil
+	want.v4[0].comms = communities{large: []string{"6939:1:0"}}
+	want.v4[1].comms = communities{}
+	want.v4[2].comms = communities{}
+	want.v4[3].comms = communities{large: []string{"6939:1:0", "6939:1:1"}}
+	want.v6[0].comms = communities{large: []string{"6939:1:0"}}
+	want.v6[1].comms = communities{}
+
+	// The same dump, uncompressed and compressed.
+	for _, file := range []string{"rib.mrt", "rib.mrt.gz", "rib.mrt.bz2"} {
+		t.Run(file, func(t *testing.T) {
+			m, err := NewMRTConn("testdata/mrt/" + file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := m.GetTable(t.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkTable(t, got, want)
+		})
+	}
+}
+
+func TestMRT(t *testing.T) {
+	// The same dump, uncompressed and compressed.
+	for _, file := range []string{"rib.mrt", "rib.mrt.gz", "rib.mrt.bz2"} {
+		m, err := NewMRTConn("testdata/mrt/" + file)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+
+		peers, _ := m.GetPeers(t.Context())
+		if want := (Peers{V4c: 3, V4e: 2, V6c: 1, V6e: 1}); peers != want {
+			t.Errorf("%s: Got %#v, Wanted %#v", file, peers, want)
+		}
+		// 192.0.2.2 is in the peer index, but sent nothing.
+		details, _ := m.GetPeerDetails(t.Context())
+		wantDetails := []PeerDetail{
+			{Address: net.ParseIP("192.0.2.1").To4(), ASN: 3356, State: StateEstablished, V4Received: 3, V4Accepted: 3},
+			{Address: net.ParseIP("192.0.2.2").To4(), ASN: 174, State: StateIdle},
+			{Address: net.ParseIP("192.0.2.3").To4(), ASN: 6939, State: StateEstablished, V4Received: 3, V4Accepted: 3},
+			{Address: net.ParseIP("2001:db8::1"), ASN: 6939, State: StateEstablished, V6Received: 2, V6Accepted: 2},
+		}
+		if !reflect.DeepEqual(details, wantDetails) {
+			t.Errorf("%s: Got %v, Wanted %v", file, details, wantDetails)
+		}
+		for asn, want := range tableTransits {
+			got, _ := m.GetTransit(t.Context(), asn)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: %d: Got %v, Wanted %v", file, asn, got, want)
+			}
+		}
+	}
+}
+
+func TestMRTLookups(t *testing.T) {
+	m, err := NewMRTConn("testdata/mrt/rib.mrt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip     string
+		route  string
+		origin uint32
+		path   ASPath
+	}{
+		{
+			// Both paths are the same length, so the first peer wins.
+			ip:     "1.1.1.1",
+			route:  "1.1.1.0/24",
+			origin: 13335,
+			path:   ASPath{Path: []uint32{3356, 13335}},
+		},
+		{
+			// The shorter path is listed second.
+			ip:     "8.8.8.8",
+			route:  "8.8.8.0/24",
+			origin: 15169,
+			path:   ASPath{Path: []uint32{3356, 15169}},
+		},
+		{
+			ip:     "8.8.4.4",
+			route:  "8.0.0.0/9",
+			origin: 3356,
+			path:   ASPath{Path: []uint32{3356}},
+		},
+		{
+			ip:     "9.9.9.9",
+			route:  "9.9.9.0/24",
+			origin: 19281,
+			path:   ASPath{Path: []uint32{6939, 19281}, Set: []uint32{1, 2}},
+		},
+		{
+			ip:     "2606:4700::1111",
+			route:  "2606:4700::/32",
+			origin: 13335,
+			path:   ASPath{Path: []uint32{6939, 13335}},
+		},
+	}
+	for _, tc := range tests {
+		ip := net.ParseIP(tc.ip)
+		route, ok, err := m.GetRoute(t.Context(), ip)
+		if err != nil || !ok || route.String() != tc.route {
+			t.Errorf("GetRoute(%s): got %v, %t, %v", tc.ip, route, ok, err)
+		}
+		origin, ok, err := m.GetOriginFromIP(t.Context(), ip)
+		if err != nil || !ok || origin != tc.origin {
+			t.Errorf("GetOriginFromIP(%s): got %d, %t, %v", tc.ip, origin, ok, err)
+		}
+		prefix, path, ok, err := m.GetASPathFromIP(t.Context(), ip)
+		if err != nil || !ok || prefix.String() != tc.route || !reflect.DeepEqual(path, tc.path) {
+			t.Errorf("GetASPathFromIP(%s): got %v, %v, %t, %v", tc.ip, prefix, path, ok, err)
+		}
+	}
+
+	if _, ok, err := m.GetRoute(t.Context(), net.ParseIP("192.0.2.1")); err != nil || ok {
+		t.Errorf("GetRoute for missing route: got %t, %v", ok, err)
+	}
+
+	v4, err := m.GetIPv4FromSource(t.Context(), 13335)
+	if err != nil || len(v4) != 1 || v4[0].String() != "1.1.1.0/24" {
+		t.Errorf("GetIPv4FromSource: got %v, %v", v4, err)
+	}
+	v6, err := m.GetIPv6FromSource(t.Context(), 15169)
+	if err != nil || len(v6) != 1 || v6[0].String() != "2001:4860::/32" {
+		t.Errorf("GetIPv6FromSource: got %v, %v", v6, err)
+	}
+}
+
+func TestMRTBadInput(t *testing.T) {
+	dump, err := os.ReadFile("testdata/mrt/rib.mrt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := decodeMRT(bytes.NewReader(dump[:len(dump)-10])); err == nil {
+		t.Error("expected error on truncated dump")
+	}
+	if _, err := NewMRTConn("testdata/mrt/missing.mrt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got %v, Wanted %v", err, ErrNotFound)
+	}
+	truncated := t.TempDir() + "/rib.mrt"
+	if err := os.WriteFile(truncated, dump[:len(dump)-10], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMRTConn(truncated); !errors.Is(err, ErrUnexpectedOutput) {
+		t.Errorf("Got %v, Wanted %v", err, ErrUnexpectedOutput)
+	}
+
+	// An empty dump is valid, it just has no routes.
+	m, err := decodeMRT(bytes.NewReader(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, _ := m.GetTable(t.Context())
+	if totals := table.Totals(); totals != (Totals{}) {
+		t.Errorf("Got %#v, Wanted %#v", totals, Totals{})
+	}
+}
@@ -0,0 +1,445 @@
+package clidecode
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	c "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
+)
+
+// rpkiClientROAs is where rpki-client writes the roa-set that bgpd includes.
+const rpkiClientROAs = "/var/db/rpki-client/openbgpd"
+
+// OpenBGPDConn is a connection to an OpenBGPD instance. All output is
+// requested from bgpctl as JSON. OpenBGPD validates routes itself, but
+// bgpctl has no way to list the VRPs, so those are read from the roa-set
+// written by rpki-client.
+type OpenBGPDConn struct {
+	run     Runner
+	roaFile string
+}
+
+// NewOpenBGPDConn returns an OpenBGPDConn that runs commands with run and
+// reads VRPs from roaFile. If run is nil, commands are passed to the local
+// bgpctl. If roaFile is empty, the rpki-client default is used.
+func NewOpenBGPDConn(run Runner, roaFile string) OpenBGPDConn {
+	if run == nil {
+		run = bgpctl
+	}
+	if roaFile == "" {
+		roaFile = rpkiClientROAs
+	}
+	return OpenBGPDConn{run: run, roaFile: roaFile}
+}
+
+// bgpctl runs a single command with the local bgpctl, requesting JSON.
+func bgpctl(ctx context.Context, cmd string) ([]byte, error) {
+	args := append([]string{"-j"}, strings.Fields(cmd)...)
+	return c.CommandOutput(ctx, "/usr/sbin/bgpctl", args...)
+}
+
+// obgpdNeighbors is the output of 'bgpctl -j show neighbor'
+type obgpdNeighbors struct {
+	Neighbors []struct {
+		RemoteAS      string `json:"remote_as"`
+		RemoteAddr    string `json:"remote_addr"`
+		State         string `json:"state"`
+		LastUpDownSec int64  `json:"last_updown_sec"`
+		Stats         struct {
+			Prefixes struct {
+				Received uint32 `json:"received"`
+			} `json:"prefixes"`
+		} `json:"stats"`
+	} `json:"neighbors"`
+}
+
+// obgpdRib is the output of 'bgpctl -j show rib', and all of its variants.
+type obgpdRib struct {
+	Rib []obgpdRibEntry `json:"rib"`
+}
+
+type obgpdRibEntry struct {
+	Prefix string `json:"prefix"`
+	ASPath string `json:"aspath"`
+	Best   bool   `json:"best"`
+	OVS    string `json:"ovs"`
+	// Communities are only shown in the detailed output. Well-known
+	// communities are shown by name, and extended ones as 'rt 65000:100'
+	Communities         []string `json:"communities"`
+	ExtendedCommunities []string `json:"extended_communities"`
+	LargeCommunities    []string `json:"large_communities"`
+}
+
+// command runs cmd and decodes the JSON output into v.
+func (o OpenBGPDConn) command(ctx context.Context, cmd string, v any) error {
+	out, err := o.run(ctx, cmd)
+	if err != nil {
+		return unreachable(cmd, err)
+	}
+	if err := json.Unmarshal(out, v); err != nil {
+		return outputError(cmd, string(out), err)
+	}
+	return nil
+}
+
+// rib runs a 'show rib' command. It returns the total amount of paths
+// seen, as well as the best path for each prefix as a route. The origin of
+// every path is added to origins, unless it's nil.
+func (o OpenBGPDConn) rib(ctx context.Context, cmd string, origins map[string][]uint32) (uint32, []route, error) {
+	var r obgpdRib
+	if err := o.command(ctx, cmd, &r); err != nil {
+		return 0, nil, err
+	}
+
+	var routes []route
+	for _, e := range r.Rib {
+		_, prefix, err := net.ParseCIDR(e.Prefix)
+		if err != nil {
+			return 0, nil, outputError(cmd, e.Prefix, err)
+		}
+		path, set, err := decodeASPaths(e.ASPath)
+		if err != nil {
+			return 0, nil, outputError(cmd, e.ASPath, err)
+		}
+		r := route{prefix: prefix, path: ASPath{Path: path, Set: set}}
+		if origins != nil {
+			addOrigin(origins, r)
+		}
+		if !e.Best {
+			continue
+		}
+		if r.comms, err = obgpdCommunities(e); err != nil {
+			return 0, nil, outputError(cmd, e.Prefix, err)
+		}
+		r.roa = obgpdROAState(e.OVS)
+		routes = append(routes, r)
+	}
+
+	return uint32(len(r.Rib)), routes, nil
+}
+
+// obgpdCommunities returns all the communities of a rib entry.
+func obgpdCommunities(e obgpdRibEntry) (communities, error) {
+	var comms communities
+	for _, comm := range e.Communities {
+		std, err := parseCommunity(comm)
+		if err != nil {
+			return comms, err
+		}
+		comms.standard = append(comms.standard, std)
+	}
+	for _, comm := range e.ExtendedCommunities {
+		kind, value, ok := strings.Cut(comm, " ")
+		if !ok {
+			return comms, fmt.Errorf("invalid extended community %q", comm)
+		}
+		comms.extended = append(comms.extended, extCommunity(kind, value))
+	}
+	for _, comm := range e.LargeCommunities {
+		large, err := parseLargeCommunity(comm)
+		if err != nil {
+			return comms, err
+		}
+		comms.large = append(comms.large, large)
+	}
+
+	return comms, nil
+}
+
+// obgpdROAState converts the OpenBGPD origin validation state.
+func obgpdROAState(ovs string) int {
+	switch ovs {
+	case "valid":
+		return RValid
+	case "invalid":
+		return RInvalid
+	}
+	return RUnknown
+}
+
+// GetPeers returns ipv4 peer configured, established. ipv6 peers configured, established
+// The address family of a peer is the family of the neighbor address.
+func (o OpenBGPDConn) GetPeers(ctx context.Context) (Peers, error) {
+	var p Peers
+	var n obgpdNeighbors
+	if err := o.command(ctx, "show neighbor", &n); err != nil {
+		return p, err
+	}
+
+	for _, peer := range n.Neighbors {
+		ip := net.ParseIP(peer.RemoteAddr)
+		if ip == nil {
+			return Peers{}, outputError("show neighbor", peer.RemoteAddr, errors.New("invalid neighbor address"))
+		}
+		up := peer.State == "Established"
+		switch {
+		case ip.To4() != nil:
+			p.V4c++
+			if up {
+				p.V4e++
+			}
+		default:
+			p.V6c++
+			if up {
+				p.V6e++
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// GetPeerDetails returns the state of each peer, and the amount of
+// prefixes received from it for each address family.
+// bgpctl doesn't split the prefixes by family, so they're all counted for
+// the family of the neighbor address. Rejected prefixes aren't kept.
+func (o OpenBGPDConn) GetPeerDetails(ctx context.Context) ([]PeerDetail, error) {
+	var n obgpdNeighbors
+	if err := o.command(ctx, "show neighbor", &n); err != nil {
+		return nil, err
+	}
+
+	var peers []PeerDetail
+	for _, peer := range n.Neighbors {
+		ip := net.ParseIP(peer.RemoteAddr)
+		if ip == nil {
+			return nil, outputError("show neighbor", peer.RemoteAddr, errors.New("invalid neighbor address"))
+		}
+		asn, err := c.ParseUint32(peer.RemoteAS)
+		if err != nil {
+			return nil, outputError("show neighbor", peer.RemoteAS, err)
+		}
+		d := PeerDetail{
+			Address: ip,
+			ASN:     asn,
+			State:   peerState(peer.State),
+		}
+		if d.State == StateEstablished {
+			d.Uptime = time.Duration(peer.LastUpDownSec) * time.Second
+		}
+		prefixes := peer.Stats.Prefixes.Received
+		if ip.To4() != nil {
+			d.V4Received, d.V4Accepted = prefixes, prefixes
+		} else {
+			d.V6Received, d.V6Accepted = prefixes, prefixes
+		}
+		peers = append(peers, d)
+	}
+	sortPeers(peers)
+
+	return peers, nil
+}
+
+// GetTransit returns how many prefixes an ASN transits, and the ASNs
+// seen directly upstream and downstream of it.
+func (o OpenBGPDConn) GetTransit(ctx context.Context, asn uint32) (Transit, error) {
+	_, v4, err := o.rib(ctx, "show rib inet", nil)
+	if err != nil {
+		return Transit{}, err
+	}
+	_, v6, err := o.rib(ctx, "show rib inet6", nil)
+	if err != nil {
+		return Transit{}, err
+	}
+
+	return transit(v4, v6, asn), nil
+}
+
+// GetTable returns the best path of every IPv4 and IPv6 route, with all of
+// their attributes. Communities are only shown in the detailed output. Every
+// rib entry is shown, so the origin of each is kept.
+func (o OpenBGPDConn) GetTable(ctx context.Context) (*Table, error) {
+	origins := make(map[string][]uint32)
+	rib4, v4, err := o.rib(ctx, "show rib detail inet", origins)
+	if err != nil {
+		return nil, err
+	}
+	rib6, v6, err := o.rib(ctx, "show rib detail inet6", origins)
+	if err != nil {
+		return nil, err
+	}
+
+	table := newTable(v4, v6, origins)
+	table.totals.V4Rib, table.totals.V6Rib = rib4, rib6
+
+	return table, nil
+}
+
+// GetIPv4FromSource returns all the IPv4 networks sourced from a source ASN.
+func (o OpenBGPDConn) GetIPv4FromSource(ctx context.Context, asn uint32) ([]*net.IPNet, error) {
+	_, routes, err := o.rib(ctx, fmt.Sprintf("show rib inet source-as %d", asn), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return fromSource(routes, asn), nil
+}
+
+// GetIPv6FromSource returns all the IPv6 networks sourced from a source ASN.
+func (o OpenBGPDConn) GetIPv6FromSource(ctx context.Context, asn uint32) ([]*net.IPNet, error) {
+	_, routes, err := o.rib(ctx, fmt.Sprintf("show rib inet6 source-as %d", asn), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return fromSource(routes, asn), nil
+}
+
+// GetOriginFromIP will return the origin ASN from a source IP.
+func (o OpenBGPDConn) GetOriginFromIP(ctx context.Context, ip net.IP) (uint32, bool, error) {
+	r, ok, err := o.lookup(ctx, ip)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	origin, ok := r.origin()
+
+	return origin, ok, nil
+}
+
+// GetASPathFromIP will return the matched prefix and its AS path, as well as as-set if any from a source IP.
+func (o OpenBGPDConn) GetASPathFromIP(ctx context.Context, ip net.IP) (*net.IPNet, ASPath, bool, error) {
+	r, ok, err := o.lookup(ctx, ip)
+	if err != nil || !ok {
+		return nil, ASPath{}, false, err
+	}
+
+	return r.prefix, r.path, true, nil
+}
+
+// GetRoute will return the current FIB entry, if any, from a source IP.
+func (o OpenBGPDConn) GetRoute(ctx context.Context, ip net.IP) (*net.IPNet, bool, error) {
+	r, ok, err := o.lookup(ctx, ip)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	return r.prefix, true, nil
+}
+
+// lookup returns the best path for the longest prefix covering ip.
+// bgpctl already does a longest match lookup when given an address.
+func (o OpenBGPDConn) lookup(ctx context.Context, ip net.IP) (route, bool, error) {
+	_, routes, err := o.rib(ctx, fmt.Sprintf("show rib %s", ip), nil)
+	if err != nil {
+		return route{}, false, err
+	}
+	var t c.Trie[route]
+	addRoutes(&t, routes)
+	r, ok := longestMatch(&t, ip)
+
+	return r, ok, nil
+}
+
+// GetROA will return the ROA status from a prefix and ASN.
+// This function does not check for the existence of the prefix in the table.
+func (o OpenBGPDConn) GetROA(ctx context.Context, prefix *net.IPNet, asn uint32) (int, bool, error) {
+	roas, err := o.roas()
+	if err != nil {
+		return RUnknown, false, err
+	}
+
+	var t c.Trie[[]roa]
+	addROAs(&t, roas)
+
+	return roaState(&t, prefix, asn), true, nil
+}
+
+// GetVRPs will return all Validated ROA Payloads for an ASN.
+func (o OpenBGPDConn) GetVRPs(ctx context.Context, asn uint32) ([]VRP, error) {
+	roas, err := o.roas()
+	if err != nil {
+		return nil, err
+	}
+
+	return vrpsFor(roas, asn), nil
+}
+
+// GetInvalids returns a map of ASNs that are advertising RPKI invalid prefixes.
+// It also includes all those prefixes being advertised.
+func (o OpenBGPDConn) GetInvalids(ctx context.Context) (map[string][]string, error) {
+	inv := make(map[string][]string)
+	for _, cmd := range []string{"show rib inet ovs invalid", "show rib inet6 ovs invalid"} {
+		_, routes, err := o.rib(ctx, cmd, nil)
+		if err != nil {
+			return inv, err
+		}
+		invalids(routes, inv)
+	}
+
+	return inv, nil
+}
+
+// roas reads the roa-set from the rpki-client output.
+func (o OpenBGPDConn) roas() ([]roa, error) {
+	f, err := os.Open(o.roaFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	roas, err := decodeROASet(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", o.roaFile, err)
+	}
+
+	return roas, nil
+}
+
+// decodeROASet decodes an OpenBGPD roa-set. Each entry is in the form of
+// 1.0.4.0/22 maxlen 24 source-as 38803 expires 1697600000
+// where both maxlen and expires are optional.
+func decodeROASet(in io.Reader) ([]roa, error) {
+	var roas []roa
+	var inSet bool
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch {
+		case len(fields) == 0 || strings.HasPrefix(fields[0], "#"):
+			continue
+		case fields[0] == "roa-set":
+			inSet = true
+			continue
+		case fields[0] == "}":
+			inSet = false
+			continue
+		case !inSet:
+			continue
+		}
+
+		_, prefix, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			return nil, outputError("roa-set", scanner.Text(), err)
+		}
+		r := roa{prefix: prefix}
+		r.max, _ = prefix.Mask.Size()
+		for i := 1; i+1 < len(fields); i += 2 {
+			val, err := strconv.ParseUint(fields[i+1], 10, 32)
+			if err != nil {
+				return nil, outputError("roa-set", scanner.Text(), err)
+			}
+			switch fields[i] {
+			case "maxlen":
+				r.max = int(val)
+			case "source-as":
+				r.asn = uint32(val)
+			}
+		}
+		roas = append(roas, r)
+	}
+
+	return roas, scanner.Err()
+}
@@ -0,0 +1,214 @@
+package clidecode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// obgpdFixtures maps each bgpctl command to captured output in testdata/openbgpd.
+var obgpdFixtures = map[string]string{
+	"show neighbor":                  "neighbor.json",
+	"show rib inet":                  "rib_inet.json",
+	"show rib inet6":                 "rib_inet6.json",
+	"show rib detail inet":           "rib_detail_inet.json",
+	"show rib detail inet6":          "rib_detail_inet6.json",
+	"show rib inet source-as 3356":   "rib_inet_source-as_3356.json",
+	"show rib inet6 source-as 13335": "rib_inet6_source-as_13335.json",
+	"show rib 8.8.8.8":               "rib_8.8.8.8.json",
+	"show rib 9.9.9.9":               "rib_9.9.9.9.json",
+	"show rib 192.0.2.1":             "rib_192.0.2.1.json",
+	"show rib inet ovs invalid":      "rib_inet_ovs_invalid.json",
+	"show rib inet6 ovs invalid":     "rib_inet6_ovs_invalid.json",
+}
+
+func obgpdFixture(_ context.Context, cmd string) ([]byte, error) {
+	f, ok := obgpdFixtures[cmd]
+	if !ok {
+		return nil, fmt.Errorf("no fixture for %q", cmd)
+	}
+	return os.ReadFile("testdata/openbgpd/" + f)
+}
+
+func TestOpenBGPDTable(t *testing.T) {
+	got, err := NewOpenBGPDConn(obgpdFixture, "testdata/openbgpd/openbgpd").GetTable(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTable(t, got, testTable())
+}
+
+func TestOpenBGPDPeers(t *testing.T) {
+	o := NewOpenBGPDConn(obgpdFixture, "testdata/openbgpd/openbgpd")
+
+	peers, err := o.GetPeers(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Peers{V4c: 3, V4e: 2, V6c: 1, V6e: 1}); peers != want {
+		t.Errorf("Got %#v, Wanted %#v", peers, want)
+	}
+
+	for asn, want := range tableTransits {
+		got, err := o.GetTransit(t.Context(), asn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d: Got %v, Wanted %v", asn, got, want)
+		}
+	}
+}
+
+func TestOpenBGPDPeerDetails(t *testing.T) {
+	o := NewOpenBGPDConn(obgpdFixture, "testdata/openbgpd/openbgpd")
+
+	got, err := o.GetPeerDetails(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	uptime := 26*time.Hour + 3*time.Minute
+	want := []PeerDetail{
+		{Address: net.ParseIP("192.0.2.1"), ASN: 3356, State: StateEstablished, Uptime: uptime, V4Received: 4, V4Accepted: 4},
+		{Address: net.ParseIP("192.0.2.2"), ASN: 174, State: StateActive},
+		{Address: net.ParseIP("192.0.2.3"), ASN: 6939, State: StateEstablished, Uptime: uptime, V4Received: 3, V4Accepted: 3},
+		{Address: net.ParseIP("2001:db8::1"), ASN: 6939, State: StateEstablished, Uptime: uptime, V6Received: 2, V6Accepted: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+}
+
+func TestOpenBGPDLookups(t *testing.T) {
+	o := NewOpenBGPDConn(obgpdFixture, "testdata/openbgpd/openbgpd")
+
+	route, ok, err := o.GetRoute(t.Context(), net.ParseIP("8.8.8.8"))
+	if err != nil || !ok || route.String() != "8.8.8.0/24" {
+		t.Errorf("GetRoute: got %v, %t, %v", route, ok, err)
+	}
+	origin, ok, err := o.GetOriginFromIP(t.Context(), net.ParseIP("8.8.8.8"))
+	if err != nil || !ok || origin != 15169 {
+		t.Errorf("GetOriginFromIP: got %d, %t, %v", origin, ok, err)
+	}
+	if _, ok, err := o.GetRoute(t.Context(), net.ParseIP("192.0.2.1")); err != nil || ok {
+		t.Errorf("GetRoute for missing route: got %t, %v", ok, err)
+	}
+
+	prefix, path, ok, err := o.GetASPathFromIP(t.Context(), net.ParseIP("9.9.9.9"))
+	wantPath := ASPath{Path: []uint32{6939, 19281}, Set: []uint32{1, 2}}
+	if err != nil || !ok || prefix.String() != "9.9.9.0/24" || !reflect.DeepEqual(path, wantPath) {
+		t.Errorf("GetASPathFromIP: got %v, %v, %t, %v", prefix, path, ok, err)
+	}
+
+	v4, err := o.GetIPv4FromSource(t.Context(), 3356)
+	if err != nil || len(v4) != 1 || v4[0].String() != "8.0.0.0/9" {
+		t.Errorf("GetIPv4FromSource: got %v, %v", v4, err)
+	}
+	v6, err := o.GetIPv6FromSource(t.Context(), 13335)
+	if err != nil || len(v6) != 1 || v6[0].String() != "2606:4700::/32" {
+		t.Errorf("GetIPv6FromSource: got %v, %v", v6, err)
+	}
+
+	inv, err := o.GetInvalids(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantInv := map[string][]string{"19281": {"9.9.9.0/24"}, "15169": {"2001:4860::/32"}}
+	if !reflect.DeepEqual(inv, wantInv) {
+		t.Errorf("GetInvalids: got %v, wanted %v", inv, wantInv)
+	}
+}
+
+func TestOpenBGPDROA(t *testing.T) {
+	o := NewOpenBGPDConn(obgpdFixture, "testdata/openbgpd/openbgpd")
+
+	_, prefix, _ := net.ParseCIDR("1.1.1.0/24")
+	if got, ok, err := o.GetROA(t.Context(), prefix, 3356); err != nil || !ok || got != RInvalid {
+		t.Errorf("GetROA: got %d, %t, %v", got, ok, err)
+	}
+
+	vrps, err := o.GetVRPs(t.Context(), 13335)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range vrps {
+		got = append(got, fmt.Sprintf("%s-%d", v.Prefix, v.Max))
+	}
+	sort.Strings(got)
+	if want := []string{"1.1.1.0/24-24", "2606:4700::/32-48"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetVRPs: got %v, wanted %v", got, want)
+	}
+
+	missing := NewOpenBGPDConn(obgpdFixture, "testdata/openbgpd/missing")
+	if _, ok, err := missing.GetROA(t.Context(), prefix, 13335); !errors.Is(err, ErrNotFound) || ok {
+		t.Errorf("GetROA with no roa-set: got %t, %v", ok, err)
+	}
+}
+
+func TestDecodeROASet(t *testing.T) {
+	tests := []struct {
+		desc    string
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{
+			desc: "maxlen and expires are optional",
+			in:   "roa-set {\n\t1.0.4.0/22 maxlen 24 source-as 38803\n\t1.1.1.0/24 source-as 13335 expires 1697600000\n}\n",
+			want: []string{"1.0.4.0/22-24-38803", "1.1.1.0/24-24-13335"},
+		},
+		{
+			desc: "entries outside the roa-set are ignored",
+			in:   "# comment\naspa-set {\n\tcustomer-as 64496 provider-as { 64497 }\n}\nroa-set {\n\t2001:db8::/32 maxlen 48 source-as 64496\n}\n",
+			want: []string{"2001:db8::/32-48-64496"},
+		},
+		{
+			desc:    "bad prefix",
+			in:      "roa-set {\n\t1.0.4.0/33 source-as 38803\n}\n",
+			wantErr: true,
+		},
+		{
+			desc:    "bad asn",
+			in:      "roa-set {\n\t1.0.4.0/22 source-as AS38803\n}\n",
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		roas, err := decodeROASet(strings.NewReader(tc.in))
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: got error %v, wanted error %t", tc.desc, err, tc.wantErr)
+			continue
+		}
+		var got []string
+		for _, r := range roas {
+			got = append(got, fmt.Sprintf("%s-%d-%d", r.prefix, r.max, r.asn))
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: Got %v, Wanted %v", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestOpenBGPDBadOutput(t *testing.T) {
+	o := NewOpenBGPDConn(func(context.Context, string) ([]byte, error) {
+		return []byte("bgpctl: connect: /var/run/bgpd.sock: No such file or directory"), nil
+	}, "")
+	if _, err := o.GetPeers(t.Context()); !errors.Is(err, ErrUnexpectedOutput) {
+		t.Errorf("Got %v, Wanted %v", err, ErrUnexpectedOutput)
+	}
+
+	o = NewOpenBGPDConn(func(context.Context, string) ([]byte, error) {
+		return nil, errors.New("exit status 1")
+	}, "")
+	if _, err := o.GetPeers(t.Context()); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Got %v, Wanted %v", err, ErrUnreachable)
+	}
+}
@@ -0,0 +1,41 @@
+package clidecode
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+)
+
+// Session states (RFC4271 8.2.2).
+const (
+	StateIdle        = "Idle"
+	StateConnect     = "Connect"
+	StateActive      = "Active"
+	StateOpenSent    = "OpenSent"
+	StateOpenConfirm = "OpenConfirm"
+	StateEstablished = "Established"
+)
+
+// peerState returns the session state shown by a router as named in
+// RFC4271. Routers differ in case and punctuation, i.e. OPEN_SENT or
+// opensent, and anything not recognised is returned as it is.
+func peerState(s string) string {
+	norm := strings.ToLower(strings.NewReplacer("_", "", "-", "", " ", "").Replace(s))
+	for _, state := range []string{
+		StateIdle, StateConnect, StateActive,
+		StateOpenSent, StateOpenConfirm, StateEstablished,
+	} {
+		if norm == strings.ToLower(state) {
+			return state
+		}
+	}
+	return s
+}
+
+// sortPeers orders peers by address. IPv4 addresses are mapped into IPv6,
+// so come first.
+func sortPeers(peers []PeerDetail) {
+	slices.SortFunc(peers, func(a, b PeerDetail) int {
+		return bytes.Compare(a.Address.To16(), b.Address.To16())
+	})
+}
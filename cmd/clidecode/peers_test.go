@@ -0,0 +1,40 @@
+package clidecode
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestPeerState(t *testing.T) {
+	tests := map[string]string{
+		"Established": StateEstablished,
+		"ESTABLISHED": StateEstablished,
+		"OPENSENT":    StateOpenSent,
+		"open_sent":   StateOpenSent,
+		"OpenConfirm": StateOpenConfirm,
+		"idle":        StateIdle,
+		"Clearing":    "Clearing",
+	}
+	for in, want := range tests {
+		if got := peerState(in); got != want {
+			t.Errorf("%s: Got %s, Wanted %s", in, got, want)
+		}
+	}
+}
+
+func TestSortPeers(t *testing.T) {
+	peers := []PeerDetail{
+		{Address: net.ParseIP("2001:db8::1")},
+		{Address: net.ParseIP("192.0.2.10")},
+		{Address: net.IPv4(192, 0, 2, 9).To4()},
+	}
+	sortPeers(peers)
+	var got []string
+	for _, p := range peers {
+		got = append(got, p.Address.String())
+	}
+	if want := []string{"192.0.2.9", "192.0.2.10", "2001:db8::1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+}
@@ -0,0 +1,393 @@
+package clidecode
+
+import (
+	"bytes"
+	"maps"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/aspa"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/bogon"
+	c "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+// route is the best path for a single prefix. It's used by the decoders
+// that receive the full table from the router and work out all the
+// statistics themselves, rather than asking the router for each one.
+type route struct {
+	prefix *net.IPNet
+	path   ASPath
+	comms  communities
+	roa    int
+}
+
+// origin returns the origin ASN of the route. Any AS-SET is ignored, as
+// bird does, so the origin is the last ASN of the AS sequence.
+func (r route) origin() (uint32, bool) {
+	if len(r.path.Path) == 0 {
+		return 0, false
+	}
+	return r.path.Path[len(r.path.Path)-1], true
+}
+
+// decodeASPathAttr returns the AS path and AS-SET from a decoded AS_PATH
+// attribute.
+func decodeASPathAttr(attr *bgp.PathAttributeAsPath) ASPath {
+	var p ASPath
+	for _, seg := range attr.Value {
+		switch seg.GetType() {
+		case bgp.BGP_ASPATH_ATTR_TYPE_SEQ:
+			p.Path = append(p.Path, seg.GetAS()...)
+		case bgp.BGP_ASPATH_ATTR_TYPE_SET:
+			p.Set = append(p.Set, seg.GetAS()...)
+		}
+	}
+	return p
+}
+
+// pathLen is the length of an AS path for best path selection. An AS-SET
+// counts as a single ASN no matter how many it holds (RFC4271 9.1.2.2).
+func pathLen(p ASPath) int {
+	if len(p.Set) > 0 {
+		return len(p.Path) + 1
+	}
+	return len(p.Path)
+}
+
+// unprepended returns the AS sequence with all prepends removed.
+func unprepended(path []uint32) []uint32 {
+	var u []uint32
+	for i, asn := range path {
+		if i > 0 && asn == path[i-1] {
+			continue
+		}
+		u = append(u, asn)
+	}
+	return u
+}
+
+// pathStats returns the AS path length distribution of routes.
+func pathStats(routes []route) PathStats {
+	s := PathStats{
+		Lengths: make(map[uint32]uint32),
+		Unique:  make(map[uint32]uint32),
+	}
+	for _, r := range routes {
+		unique := ASPath{Path: unprepended(r.path.Path), Set: r.path.Set}
+		s.Lengths[uint32(pathLen(r.path))]++
+		s.Unique[uint32(pathLen(unique))]++
+		if len(unique.Path) < len(r.path.Path) {
+			s.Prepended++
+		}
+		if len(r.path.Set) > 0 {
+			s.Sets++
+		}
+	}
+	return s
+}
+
+// sourceASNs returns the unique source ASN counts from IPv4 and IPv6 routes.
+func sourceASNs(v4, v6 []route) ASNs {
+	origins := func(routes []route) []string {
+		var asns []string
+		for _, r := range routes {
+			if o, ok := r.origin(); ok {
+				asns = append(asns, c.Uint32ToString(o))
+			}
+		}
+		return c.SetListOfStrings(asns)
+	}
+	as4Set := origins(v4)
+	as6Set := origins(v6)
+
+	var as10 []string
+	as10 = append(as10, as4Set...)
+	as10 = append(as10, as6Set...)
+
+	return ASNs{
+		As4:     uint32(len(as4Set)),
+		As6:     uint32(len(as6Set)),
+		As10:    uint32(len(c.SetListOfStrings(as10))),
+		As4Only: uint32(len(c.InFirstButNotSecond(as4Set, as6Set))),
+		As6Only: uint32(len(c.InFirstButNotSecond(as6Set, as4Set))),
+		AsBoth:  uint32(len(c.Intersection(as4Set, as6Set))),
+	}
+}
+
+// maskCounts returns the total count of each mask value.
+func maskCounts(routes []route) map[string]uint32 {
+	masks := make(map[string]uint32)
+	for _, r := range routes {
+		ones, _ := r.prefix.Mask.Size()
+		masks[strconv.Itoa(ones)]++
+	}
+	return masks
+}
+
+// roaCounts returns the valid, invalid and unknown route counts.
+func roaCounts(routes []route) (v, i, u uint32) {
+	for _, r := range routes {
+		switch r.roa {
+		case RValid:
+			v++
+		case RInvalid:
+			i++
+		default:
+			u++
+		}
+	}
+	return v, i, u
+}
+
+// largeCount returns the amount of routes with large communities attached.
+func largeCount(routes []route) uint32 {
+	var l uint32
+	for _, r := range routes {
+		if len(r.comms.large) > 0 {
+			l++
+		}
+	}
+	return l
+}
+
+// fromSource returns all the networks originated by asn.
+func fromSource(routes []route, asn uint32) []*net.IPNet {
+	var ips []*net.IPNet
+	for _, r := range routes {
+		if o, ok := r.origin(); ok && o == asn {
+			ips = append(ips, r.prefix)
+		}
+	}
+	return ips
+}
+
+// transit returns the prefixes transited by asn, and its neighbours, over
+// the IPv4 and IPv6 routes.
+func transit(v4, v6 []route, asn uint32) Transit {
+	up := make(map[uint32]bool)
+	down := make(map[uint32]bool)
+	t := Transit{
+		V4: transitCount(v4, asn, up, down),
+		V6: transitCount(v6, asn, up, down),
+	}
+	t.Upstreams = slices.Sorted(maps.Keys(up))
+	t.Downstreams = slices.Sorted(maps.Keys(down))
+
+	return t
+}
+
+// transitCount returns the amount of routes transited by asn. The ASNs on
+// either side of asn in every path are added to up and down.
+func transitCount(routes []route, asn uint32, up, down map[uint32]bool) uint32 {
+	var count uint32
+	for _, r := range routes {
+		path := unprepended(r.path.Path)
+		var seen bool
+		for i, a := range path {
+			if a != asn {
+				continue
+			}
+			seen = true
+			if i > 0 {
+				up[path[i-1]] = true
+			}
+			if i < len(path)-1 {
+				down[path[i+1]] = true
+			}
+		}
+		if o, _ := r.origin(); seen && o != asn {
+			count++
+		}
+	}
+	return count
+}
+
+// origins returns the origin of every route, keyed by prefix. Locally
+// originated routes have no origin, so are left out.
+func origins(tables ...[]route) map[string][]uint32 {
+	o := make(map[string][]uint32)
+	for _, routes := range tables {
+		for _, r := range routes {
+			addOrigin(o, r)
+		}
+	}
+	return o
+}
+
+// addOrigin adds the origin of r to o, if it isn't there already.
+func addOrigin(o map[string][]uint32, r route) {
+	asn, ok := r.origin()
+	if !ok {
+		return
+	}
+	p := r.prefix.String()
+	if !slices.Contains(o[p], asn) {
+		o[p] = append(o[p], asn)
+	}
+}
+
+// bogons classifies the IPv4 and IPv6 routes with e.
+func bogons(v4, v6 []route, e *bogon.Engine) Bogons {
+	var b Bogons
+	b.V4 = bogonCount(v4, e, &b.Routes)
+	b.V6 = bogonCount(v6, e, &b.Routes)
+	slices.SortFunc(b.Routes, func(x, y Bogon) int {
+		if c := bytes.Compare(x.Prefix.IP.To16(), y.Prefix.IP.To16()); c != 0 {
+			return c
+		}
+		return bytes.Compare(x.Prefix.Mask, y.Prefix.Mask)
+	})
+
+	return b
+}
+
+// aspas returns the amount of routes in each ASPA state.
+func aspas(v4, v6 []route, e *aspa.Engine) ASPAs {
+	var a ASPAs
+	a.V4v, a.V4i, a.V4u = aspaCount(v4, e)
+	a.V6v, a.V6i, a.V6u = aspaCount(v6, e)
+	return a
+}
+
+// aspaCount returns the amount of valid, invalid and unknown paths in routes.
+func aspaCount(routes []route, e *aspa.Engine) (valid, invalid, unknown uint32) {
+	for _, r := range routes {
+		switch e.Verify(r.path.Path, r.path.Set) {
+		case aspa.Valid:
+			valid++
+		case aspa.Invalid:
+			invalid++
+		default:
+			unknown++
+		}
+	}
+	return valid, invalid, unknown
+}
+
+// toPrefix returns n as a netip.Prefix, with IPv4 addresses unmapped.
+func toPrefix(n *net.IPNet) (netip.Prefix, bool) {
+	addr, ok := netip.AddrFromSlice(n.IP)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	ones, _ := n.Mask.Size()
+	return netip.PrefixFrom(addr.Unmap(), ones), true
+}
+
+// bogonCount returns the amount of each kind of bogon in routes, adding
+// every bogon to list.
+func bogonCount(routes []route, e *bogon.Engine, list *[]Bogon) BogonCount {
+	var count BogonCount
+	for _, r := range routes {
+		p, ok := toPrefix(r.prefix)
+		if !ok {
+			continue
+		}
+		kind := e.Classify(p, r.path.Path)
+		switch kind {
+		case bogon.None:
+			continue
+		case bogon.Martian:
+			count.Martian++
+		case bogon.Unallocated:
+			count.Unallocated++
+		case bogon.ReservedASN:
+			count.ReservedASN++
+		}
+		origin, _ := r.origin()
+		*list = append(*list, Bogon{Prefix: r.prefix, Origin: origin, Kind: kind})
+	}
+	return count
+}
+
+// invalids adds all RPKI invalid routes to inv, keyed by origin ASN.
+// Invalids with no source ASN are ignored, the same as bird.
+func invalids(routes []route, inv map[string][]string) {
+	for _, r := range routes {
+		o, ok := r.origin()
+		if r.roa != RInvalid || !ok {
+			continue
+		}
+		asn := c.Uint32ToString(o)
+		inv[asn] = append(inv[asn], r.prefix.String())
+	}
+}
+
+// addRoutes adds routes to t keyed by prefix, for longest prefix match.
+// The first route for a prefix is kept.
+func addRoutes(t *c.Trie[route], routes []route) {
+	for _, r := range routes {
+		p, ok := toPrefix(r.prefix)
+		if !ok {
+			continue
+		}
+		if _, ok := t.Get(p); !ok {
+			t.Insert(p, r)
+		}
+	}
+}
+
+// longestMatch returns the most specific route in t covering ip.
+func longestMatch(t *c.Trie[route], ip net.IP) (route, bool) {
+	a, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return route{}, false
+	}
+	_, r, ok := t.Lookup(a.Unmap())
+	return r, ok
+}
+
+// roa is a single Validated ROA Payload.
+type roa struct {
+	prefix *net.IPNet
+	max    int
+	asn    uint32
+}
+
+// addROAs adds VRPs to t keyed by prefix, so the VRPs covering a prefix
+// can be found without checking every one.
+func addROAs(t *c.Trie[[]roa], roas []roa) {
+	for _, r := range roas {
+		p, ok := toPrefix(r.prefix)
+		if !ok {
+			continue
+		}
+		v, _ := t.Get(p)
+		t.Insert(p, append(v, r))
+	}
+}
+
+// roaState performs route origin validation (RFC6811) of a prefix and
+// origin ASN against the VRPs in t.
+func roaState(t *c.Trie[[]roa], prefix *net.IPNet, asn uint32) int {
+	p, ok := toPrefix(prefix)
+	if !ok {
+		return RUnknown
+	}
+	state := RUnknown
+	// A VRP covers the prefix if it's the same or less specific.
+	for _, roas := range t.Covering(p) {
+		for _, r := range roas {
+			if r.asn != 0 && r.asn == asn && p.Bits() <= r.max {
+				return RValid
+			}
+			state = RInvalid
+		}
+	}
+
+	return state
+}
+
+// vrpsFor returns the VRPs for an ASN.
+func vrpsFor(roas []roa, asn uint32) []VRP {
+	var VRPs []VRP
+	for _, r := range roas {
+		if r.asn == asn {
+			VRPs = append(VRPs, VRP{Prefix: r.prefix, Max: r.max})
+		}
+	}
+	return VRPs
+}
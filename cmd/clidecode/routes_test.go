@@ -0,0 +1,276 @@
+package clidecode
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/aspa"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/bogon"
+)
+
+// tablePathStats are the AS path stats of the table every decoder is
+// tested with. 9.9.9.0/24 ends in an AS-SET, which counts as one ASN.
+var tablePathStats = ASPathStats{
+	V4: PathStats{
+		Lengths: map[uint32]uint32{1: 1, 2: 2, 3: 1},
+		Unique:  map[uint32]uint32{1: 1, 2: 2, 3: 1},
+		Sets:    1,
+	},
+	V6: PathStats{
+		Lengths: map[uint32]uint32{2: 2},
+		Unique:  map[uint32]uint32{2: 2},
+	},
+}
+
+// tableCommunities are the communities of the table every decoder is
+// tested with. 8.0.0.0/9 is NO_EXPORT and 9.9.9.0/24 is blackholed.
+var tableCommunities = Communities{
+	V4: CommunityUse{
+		Standard: 3,
+		Extended: 1,
+		Large:    2,
+		Top: []CommunityCount{
+			{"3356:100", 2},
+			{"13335:1:100", 1},
+			{"3356:2001", 1},
+			{"65535:65281", 1},
+			{"65535:666", 1},
+			{"6939:1:1", 1},
+			{"6939:1:2", 1},
+			{"rt:65000:100", 1},
+		},
+		WellKnown: WellKnown{NoExport: 1, Blackhole: 1},
+	},
+	V6: CommunityUse{
+		Standard: 1,
+		Extended: 1,
+		Large:    1,
+		Top: []CommunityCount{
+			{"6939:1:1", 1},
+			{"6939:666", 1},
+			{"soo:65000:1", 1},
+		},
+	},
+}
+
+// tableTransits are the transits of some ASNs in the table every decoder is
+// tested with. 13335 only ever originates, but is seen behind 3356 and 6939.
+var tableTransits = map[uint32]Transit{
+	6939:  {V4: 1, V6: 2, Downstreams: []uint32{13335, 15169, 19281}},
+	13335: {Upstreams: []uint32{3356, 6939}},
+}
+
+// newBogonEngine returns a bogon engine loaded with the bogon package's test
+// registries. Only 1.1.1.0/24, 8.0.0.0/8 and 2001:4860::/32 of the table
+// every decoder is tested with are allocated.
+func newBogonEngine(t *testing.T) *bogon.Engine {
+	t.Helper()
+	dir := "../../pkg/bogon/testdata/"
+	e, err := bogon.Load(
+		[]string{
+			dir + "iana-ipv4-special-registry-1.csv",
+			dir + "iana-ipv6-special-registry-1.csv",
+			dir + "special-purpose-as-numbers.csv",
+		},
+		[]string{dir + "delegated-test-extended-latest"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// newASPAEngine returns an ASPA engine loaded with the aspa package's test
+// export.
+func newASPAEngine(t *testing.T) *aspa.Engine {
+	t.Helper()
+	e, err := aspa.Load("../../pkg/aspa/testdata/rpki-client.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// tableASPAs are the ASPA states of the table every decoder is tested with.
+// Every path is short enough to be valid, apart from the one with an AS-SET.
+var tableASPAs = ASPAs{V4v: 3, V4i: 1, V6v: 2}
+
+// tableBogons are the bogons of the table every decoder is tested with.
+var tableBogons = Bogons{
+	V4: BogonCount{Unallocated: 1},
+	V6: BogonCount{Unallocated: 1},
+	Routes: []Bogon{
+		{Prefix: mustCIDR("9.9.9.0/24"), Origin: 19281, Kind: bogon.Unallocated},
+		{Prefix: mustCIDR("2606:4700::/32"), Origin: 13335, Kind: bogon.Unallocated},
+	},
+}
+
+// tableOrigins are the origins of the table every decoder is tested with.
+var tableOrigins = map[string][]uint32{
+	"1.1.1.0/24":     {13335},
+	"8.0.0.0/9":      {3356},
+	"8.8.8.0/24":     {15169},
+	"9.9.9.0/24":     {19281},
+	"2001:4860::/32": {15169},
+	"2606:4700::/32": {13335},
+}
+
+// tableMOASOrigins are the origins of every path in the table, for decoders
+// tested with more than the best path. 1.1.1.0/24 is also announced by 64496
+// on a path that isn't the best.
+var tableMOASOrigins = map[string][]uint32{
+	"1.1.1.0/24":     {13335, 64496},
+	"8.0.0.0/9":      {3356},
+	"8.8.8.0/24":     {15169},
+	"9.9.9.0/24":     {19281},
+	"2001:4860::/32": {15169},
+	"2606:4700::/32": {13335},
+}
+
+// mustCIDR returns the network of a CIDR, or panics.
+func mustCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func TestPathStats(t *testing.T) {
+	_, prefix, _ := net.ParseCIDR("192.0.2.0/24")
+	routes := []route{
+		{prefix: prefix, path: ASPath{Path: []uint32{3356, 3356, 3356, 13335}}},
+		{prefix: prefix, path: ASPath{Path: []uint32{6939, 13335, 13335}, Set: []uint32{1, 2}}},
+		{prefix: prefix, path: ASPath{Path: []uint32{6939, 3356, 6939}}},
+		// Locally originated routes have an empty path.
+		{prefix: prefix},
+	}
+
+	got := pathStats(routes)
+	want := PathStats{
+		Lengths:   map[uint32]uint32{0: 1, 3: 1, 4: 2},
+		Unique:    map[uint32]uint32{0: 1, 2: 1, 3: 2},
+		Prepended: 2,
+		Sets:      1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+}
+
+func TestTransit(t *testing.T) {
+	_, prefix, _ := net.ParseCIDR("192.0.2.0/24")
+	v4 := []route{
+		{prefix: prefix, path: ASPath{Path: []uint32{3356, 3356, 3356, 13335}}},
+		{prefix: prefix, path: ASPath{Path: []uint32{6939, 3356, 174}, Set: []uint32{1, 2}}},
+		{prefix: prefix, path: ASPath{Path: []uint32{6939, 3356}}},
+		// Locally originated routes have an empty path.
+		{prefix: prefix},
+	}
+	v6 := []route{
+		{prefix: prefix, path: ASPath{Path: []uint32{3356, 3356, 2914, 13335}}},
+	}
+
+	tests := []struct {
+		asn  uint32
+		want Transit
+	}{
+		{
+			asn: 3356,
+			want: Transit{
+				V4:          2,
+				V6:          1,
+				Upstreams:   []uint32{6939},
+				Downstreams: []uint32{174, 2914, 13335},
+			},
+		},
+		{
+			// The AS-SET isn't downstream of 174, which is the origin.
+			asn:  174,
+			want: Transit{Upstreams: []uint32{3356}},
+		},
+		{
+			asn: 64496,
+		},
+	}
+	for _, tc := range tests {
+		got := transit(v4, v6, tc.asn)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%d: Got %v, Wanted %v", tc.asn, got, tc.want)
+		}
+	}
+}
+
+func TestBogons(t *testing.T) {
+	e := newBogonEngine(t)
+	v4 := []route{
+		{prefix: mustCIDR("8.8.8.0/24"), path: ASPath{Path: []uint32{3356, 15169}}},
+		{prefix: mustCIDR("192.168.0.0/16"), path: ASPath{Path: []uint32{3356, 64512}}},
+		{prefix: mustCIDR("10.0.0.0/8")},
+		{prefix: mustCIDR("8.0.0.0/9"), path: ASPath{Path: []uint32{3356, 64512}}},
+		{prefix: mustCIDR("9.9.9.0/24"), path: ASPath{Path: []uint32{6939, 19281}, Set: []uint32{1, 2}}},
+	}
+	v6 := []route{
+		{prefix: mustCIDR("2001:db8::/32"), path: ASPath{Path: []uint32{6939}}},
+		{prefix: mustCIDR("2001:4860::/32"), path: ASPath{Path: []uint32{6939, 4200000000}}},
+	}
+
+	got := bogons(v4, v6, e)
+	want := Bogons{
+		V4: BogonCount{Martian: 2, Unallocated: 1, ReservedASN: 1},
+		V6: BogonCount{Martian: 1, ReservedASN: 1},
+		Routes: []Bogon{
+			{Prefix: mustCIDR("8.0.0.0/9"), Origin: 64512, Kind: bogon.ReservedASN},
+			{Prefix: mustCIDR("9.9.9.0/24"), Origin: 19281, Kind: bogon.Unallocated},
+			{Prefix: mustCIDR("10.0.0.0/8"), Kind: bogon.Martian},
+			{Prefix: mustCIDR("192.168.0.0/16"), Origin: 64512, Kind: bogon.Martian},
+			{Prefix: mustCIDR("2001:db8::/32"), Origin: 6939, Kind: bogon.Martian},
+			{Prefix: mustCIDR("2001:4860::/32"), Origin: 4200000000, Kind: bogon.ReservedASN},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+}
+
+func TestOrigins(t *testing.T) {
+	routes := []route{
+		{prefix: mustCIDR("1.1.1.0/24"), path: ASPath{Path: []uint32{3356, 13335}}},
+		{prefix: mustCIDR("1.1.1.0/24"), path: ASPath{Path: []uint32{6939, 13335, 13335}}},
+		{prefix: mustCIDR("1.1.1.0/24"), path: ASPath{Path: []uint32{174, 666}}},
+		// Locally originated routes have no origin.
+		{prefix: mustCIDR("10.0.0.0/8")},
+	}
+	got := origins(routes, []route{
+		{prefix: mustCIDR("2606:4700::/32"), path: ASPath{Path: []uint32{6939, 13335}}},
+	})
+	want := map[string][]uint32{
+		"1.1.1.0/24":     {13335, 666},
+		"2606:4700::/32": {13335},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+}
+
+func TestASPAs(t *testing.T) {
+	e := newASPAEngine(t)
+	v4 := []route{
+		{prefix: mustCIDR("1.1.1.0/24"), path: ASPath{Path: []uint32{174, 3356, 13335}}},
+		{prefix: mustCIDR("1.1.1.0/24"), path: ASPath{Path: []uint32{174, 6939, 3356, 13335}}},
+		{prefix: mustCIDR("9.9.9.0/24"), path: ASPath{Path: []uint32{6939, 19281}, Set: []uint32{1, 2}}},
+		{prefix: mustCIDR("192.0.2.0/24"), path: ASPath{Path: []uint32{64496, 64497, 64498}}},
+		// Locally originated routes have an empty path.
+		{prefix: mustCIDR("10.0.0.0/8")},
+	}
+	v6 := []route{
+		{prefix: mustCIDR("2606:4700::/32"), path: ASPath{Path: []uint32{174, 13335, 6939, 15169}}},
+	}
+
+	got := aspas(v4, v6, e)
+	want := ASPAs{V4v: 2, V4i: 2, V4u: 1, V6i: 1}
+	if got != want {
+		t.Errorf("Got %#v, Wanted %#v", got, want)
+	}
+}
@@ -0,0 +1,125 @@
+package clidecode
+
+import (
+	"context"
+	"net"
+	"slices"
+
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/rov"
+)
+
+// VRPSource supplies the VRPs to validate routes with, i.e. an rtr.Client,
+// or a rov.Table loaded from a validator's export. Table returns nil until
+// it has any.
+type VRPSource interface {
+	Table() *rov.Table
+}
+
+// ROVConn wraps a Decoder, validating route origins against the VRPs of a
+// VRPSource rather than relying on RPKI being set up on the router. Until
+// the source has VRPs, the router's own ROA state is used.
+type ROVConn struct {
+	Decoder
+	vrps VRPSource
+}
+
+// NewROVConn returns d with its ROA state taken from vrps.
+func NewROVConn(d Decoder, vrps VRPSource) ROVConn {
+	return ROVConn{Decoder: d, vrps: vrps}
+}
+
+// tables returns the best routes of the router with their ROA state set
+// from t. The router's own routes are left untouched.
+func (r ROVConn) tables(ctx context.Context, t *rov.Table) ([]route, []route, error) {
+	table, err := r.Decoder.GetTable(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return validate(table.v4, t), validate(table.v6, t), nil
+}
+
+// GetTable returns the best path of every IPv4 and IPv6 route, with all of
+// their attributes. The ROA state of each is set from the VRPs, rather than
+// any the router counted itself.
+func (r ROVConn) GetTable(ctx context.Context) (*Table, error) {
+	table, err := r.Decoder.GetTable(ctx)
+	t := r.vrps.Table()
+	if err != nil || t == nil {
+		return table, err
+	}
+
+	validated := *table
+	validated.v4, validated.v6 = validate(table.v4, t), validate(table.v6, t)
+	validated.roas = nil
+
+	return &validated, nil
+}
+
+// validate returns a copy of routes with the ROA state of each set from t.
+// Locally originated routes have no origin, so can't be valid.
+func validate(routes []route, t *rov.Table) []route {
+	routes = slices.Clone(routes)
+	for i, r := range routes {
+		p, ok := toPrefix(r.prefix)
+		if !ok {
+			continue
+		}
+		origin, _ := r.origin()
+		routes[i].roa = int(t.Validate(p, origin))
+	}
+	return routes
+}
+
+// GetROA will return the ROA status from a prefix and ASN.
+// This function does not check for the existence of the prefix in the table.
+func (r ROVConn) GetROA(ctx context.Context, prefix *net.IPNet, asn uint32) (int, bool, error) {
+	t := r.vrps.Table()
+	if t == nil {
+		return r.Decoder.GetROA(ctx, prefix, asn)
+	}
+	p, ok := toPrefix(prefix)
+	if !ok {
+		return RUnknown, false, nil
+	}
+
+	return int(t.Validate(p, asn)), true, nil
+}
+
+// GetVRPs will return all Validated ROA Payloads for an ASN.
+func (r ROVConn) GetVRPs(ctx context.Context, asn uint32) ([]VRP, error) {
+	t := r.vrps.Table()
+	if t == nil {
+		return r.Decoder.GetVRPs(ctx, asn)
+	}
+
+	var VRPs []VRP
+	for _, v := range t.VRPs(asn) {
+		a := v.Prefix.Addr()
+		VRPs = append(VRPs, VRP{
+			Prefix: &net.IPNet{IP: net.IP(a.AsSlice()), Mask: net.CIDRMask(v.Prefix.Bits(), a.BitLen())},
+			Max:    int(v.MaxLen),
+		})
+	}
+
+	return VRPs, nil
+}
+
+// GetInvalids returns a map of ASNs that are advertising RPKI invalid prefixes.
+// It also includes all those prefixes being advertised.
+func (r ROVConn) GetInvalids(ctx context.Context) (map[string][]string, error) {
+	t := r.vrps.Table()
+	if t == nil {
+		return r.Decoder.GetInvalids(ctx)
+	}
+	v4, v6, err := r.tables(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := make(map[string][]string)
+	invalids(v4, inv)
+	invalids(v6, inv)
+
+	return inv, nil
+}
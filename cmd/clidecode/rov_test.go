@@ -0,0 +1,127 @@
+package clidecode
+
+import (
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/rov"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/rtr"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/rtr/rtrtest"
+)
+
+// noVRPs is a VRPSource that hasn't synced yet.
+type noVRPs struct{}
+
+func (noVRPs) Table() *rov.Table { return nil }
+
+func TestROVConn(t *testing.T) {
+	f, err := LoadFakeConn("testdata/fake/table.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := rtrtest.NewServer(rtr.Version1, []rov.VRP{
+		{Prefix: netip.MustParsePrefix("1.1.1.0/24"), MaxLen: 24, ASN: 13335},
+		{Prefix: netip.MustParsePrefix("8.8.8.0/24"), MaxLen: 24, ASN: 15169},
+		{Prefix: netip.MustParsePrefix("9.9.0.0/16"), MaxLen: 24, ASN: 42},
+		{Prefix: netip.MustParsePrefix("2001:4860::/32"), MaxLen: 48, ASN: 15169},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := rtr.NewClient(s.Addr)
+	go client.Run(t.Context())
+	<-client.Synced()
+	r := NewROVConn(f, client)
+
+	table, err := r.GetTable(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	roas := table.ROAs()
+	if want := (Roas{V4v: 2, V4i: 1, V4u: 1, V6v: 1, V6u: 1}); roas != want {
+		t.Errorf("Got %#v, Wanted %#v", roas, want)
+	}
+
+	inv, err := r.GetInvalids(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string][]string{"19281": {"9.9.9.0/24"}}; !reflect.DeepEqual(inv, want) {
+		t.Errorf("Got %v, Wanted %v", inv, want)
+	}
+
+	for _, tc := range []struct {
+		prefix string
+		asn    uint32
+		want   int
+	}{
+		{prefix: "1.1.1.0/24", asn: 13335, want: RValid},
+		{prefix: "1.1.1.0/24", asn: 666, want: RInvalid},
+		{prefix: "2606:4700::/32", asn: 13335, want: RUnknown},
+	} {
+		got, ok, err := r.GetROA(t.Context(), mustCIDR(tc.prefix), tc.asn)
+		if err != nil || !ok || got != tc.want {
+			t.Errorf("%s AS%d: Got %d, %t, %v, Wanted %d", tc.prefix, tc.asn, got, ok, err, tc.want)
+		}
+	}
+
+	vrps, err := r.GetVRPs(t.Context(), 15169)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []VRP{
+		{Prefix: &net.IPNet{IP: net.IP{8, 8, 8, 0}, Mask: net.CIDRMask(24, 32)}, Max: 24},
+		{Prefix: mustCIDR("2001:4860::/32"), Max: 48},
+	}
+	if !reflect.DeepEqual(vrps, want) {
+		t.Errorf("Got %v, Wanted %v", vrps, want)
+	}
+
+	// The router's own routes keep their state.
+	own, _ := f.GetTable(t.Context())
+	if own.ROAs() == roas {
+		t.Errorf("Got the router's own state %#v", own)
+	}
+}
+
+func TestROVConnUnsynced(t *testing.T) {
+	f, err := LoadFakeConn("testdata/fake/table.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewROVConn(f, noVRPs{})
+
+	table, err := r.GetTable(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := table.ROAs()
+	want, _ := f.GetTable(t.Context())
+	if got != want.ROAs() {
+		t.Errorf("Got %#v, Wanted %#v", got, want.ROAs())
+	}
+}
+
+func TestROVConnExport(t *testing.T) {
+	f, err := LoadFakeConn("testdata/fake/table.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vrps, err := rov.Load("../../pkg/rov/testdata/routinator.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewROVConn(f, vrps)
+
+	table, err := r.GetTable(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	roas := table.ROAs()
+	if want := (Roas{V4v: 2, V4i: 1, V4u: 1, V6v: 1, V6i: 1}); roas != want {
+		t.Errorf("Got %#v, Wanted %#v", roas, want)
+	}
+}
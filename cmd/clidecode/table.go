@@ -0,0 +1,113 @@
+package clidecode
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/aspa"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/bogon"
+)
+
+// Table is a copy of the best path of every route the router has, with all
+// of their attributes. Fetching the whole table is by far the slowest thing
+// asked of a router, so it's fetched once with GetTable, and every statistic
+// of the table is worked out from the same copy.
+type Table struct {
+	v4, v6 []route
+	// origins holds the origin of every path to each prefix, for routers
+	// that show more than the best path. Otherwise it's nil, and the best
+	// paths are used.
+	origins map[string][]uint32
+	// totals holds the amount of paths and prefixes. Routers that only show
+	// their best path have as many paths as prefixes.
+	totals Totals
+	// roas holds the ROA state of the best paths, for routers that count
+	// them rather than showing the state of each route. Otherwise it's nil,
+	// and the state of each route is counted.
+	roas *Roas
+}
+
+// newTable returns a table of the best IPv4 and IPv6 routes, and the origins
+// of every path if known.
+func newTable(v4, v6 []route, origins map[string][]uint32) *Table {
+	return &Table{
+		v4:      v4,
+		v6:      v6,
+		origins: origins,
+		totals: Totals{
+			V4Rib: uint32(len(v4)),
+			V4Fib: uint32(len(v4)),
+			V6Rib: uint32(len(v6)),
+			V6Fib: uint32(len(v6)),
+		},
+	}
+}
+
+// Totals returns rib, fib ipv4. rib, fib ipv6
+func (t *Table) Totals() Totals {
+	return t.totals
+}
+
+// ROAs returns total amount of all ROA states
+func (t *Table) ROAs() Roas {
+	if t.roas != nil {
+		return *t.roas
+	}
+	var r Roas
+	r.V4v, r.V4i, r.V4u = roaCounts(t.v4)
+	r.V6v, r.V6i, r.V6u = roaCounts(t.v6)
+
+	return r
+}
+
+// SourceASNs returns the amount of unique ASNs originating routes.
+func (t *Table) SourceASNs() ASNs {
+	return sourceASNs(t.v4, t.v6)
+}
+
+// Masks returns the total count of each mask value
+// First item is IPv4, second item is IPv6
+func (t *Table) Masks() []map[string]uint32 {
+	return []map[string]uint32{maskCounts(t.v4), maskCounts(t.v6)}
+}
+
+// LargeCommunities returns the amount of prefixes that have large communities attached (RFC8092)
+func (t *Table) LargeCommunities() Large {
+	return Large{V4: largeCount(t.v4), V6: largeCount(t.v6)}
+}
+
+// ASPathStats returns the distribution of AS path lengths, and how many
+// prefixes are prepended or carry an AS-SET.
+func (t *Table) ASPathStats() ASPathStats {
+	return ASPathStats{V4: pathStats(t.v4), V6: pathStats(t.v6)}
+}
+
+// Communities returns how many prefixes carry each type of community,
+// the most used communities, and how many carry each well-known community.
+func (t *Table) Communities() Communities {
+	return Communities{V4: communityUse(t.v4), V6: communityUse(t.v6)}
+}
+
+// Origins returns the origin ASNs announcing every prefix, keyed by prefix.
+func (t *Table) Origins() map[string][]uint32 {
+	if t.origins == nil {
+		return origins(t.v4, t.v6)
+	}
+	o := maps.Clone(t.origins)
+	for p, asns := range o {
+		o[p] = slices.Clone(asns)
+	}
+	return o
+}
+
+// Bogons classifies every route in the table with the bogon engine,
+// returning the amount of each kind and every route that is a bogon.
+func (t *Table) Bogons(e *bogon.Engine) Bogons {
+	return bogons(t.v4, t.v6, e)
+}
+
+// ASPAs verifies the AS path of every route in the table with the ASPA
+// engine, returning the amount in each state.
+func (t *Table) ASPAs(e *aspa.Engine) ASPAs {
+	return aspas(t.v4, t.v6, e)
+}
@@ -0,0 +1,182 @@
+package clidecode
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// testTable returns the table every decoder is tested with, as the text
+// decoders show it, with the origin of every path. Each decoder's test
+// changes what its router shows differently.
+func testTable() *Table {
+	table := newTable(
+		[]route{
+			{
+				prefix: mustCIDR("1.1.1.0/24"),
+				path:   ASPath{Path: []uint32{3356, 13335}},
+				comms:  communities{standard: []uint32{3356<<16 | 100, 3356<<16 | 2001}, large: []string{"13335:1:100"}},
+				roa:    RValid,
+			},
+			{
+				prefix: mustCIDR("8.0.0.0/9"),
+				path:   ASPath{Path: []uint32{3356}},
+				comms:  communities{standard: []uint32{3356<<16 | 100, commNoExport}},
+			},
+			{
+				prefix: mustCIDR("8.8.8.0/24"),
+				path:   ASPath{Path: []uint32{3356, 15169}},
+				comms:  communities{extended: []string{"rt:65000:100"}},
+				roa:    RValid,
+			},
+			{
+				prefix: mustCIDR("9.9.9.0/24"),
+				path:   ASPath{Path: []uint32{6939, 19281}, Set: []uint32{1, 2}},
+				comms:  communities{standard: []uint32{commBlackhole}, large: []string{"6939:1:1", "6939:1:2"}},
+				roa:    RInvalid,
+			},
+		},
+		[]route{
+			{
+				prefix: mustCIDR("2001:4860::/32"),
+				path:   ASPath{Path: []uint32{6939, 15169}},
+				comms:  communities{large: []string{"6939:1:1"}},
+				roa:    RInvalid,
+			},
+			{
+				prefix: mustCIDR("2606:4700::/32"),
+				path:   ASPath{Path: []uint32{6939, 13335}},
+				comms:  communities{standard: []uint32{6939<<16 | 666}, extended: []string{"soo:65000:1"}},
+				roa:    RValid,
+			},
+		},
+		tableMOASOrigins,
+	)
+	table.totals.V4Rib, table.totals.V6Rib = 6, 2
+
+	return table
+}
+
+// withoutROAs returns t with the ROA state of every route unknown, as shown
+// by routers that don't validate routes.
+func withoutROAs(t *Table) *Table {
+	for _, routes := range [][]route{t.v4, t.v6} {
+		for i := range routes {
+			routes[i].roa = RUnknown
+		}
+	}
+	return t
+}
+
+// routeStrings returns each route as a string, ordered by prefix, so the
+// routes of two tables can be compared whatever order they were shown in.
+func routeStrings(routes []route) []string {
+	var s []string
+	for _, r := range routes {
+		s = append(s, fmt.Sprintf("%s %v %v %v %v %d", r.prefix, r.path, r.comms.standard, r.comms.extended, r.comms.large, r.roa))
+	}
+	slices.Sort(s)
+	return s
+}
+
+// checkTable compares the table a decoder returned with want.
+func checkTable(t *testing.T, got, want *Table) {
+	t.Helper()
+	if g, w := routeStrings(got.v4), routeStrings(want.v4); !slices.Equal(g, w) {
+		t.Errorf("IPv4: Got %q, Wanted %q", g, w)
+	}
+	if g, w := routeStrings(got.v6), routeStrings(want.v6); !slices.Equal(g, w) {
+		t.Errorf("IPv6: Got %q, Wanted %q", g, w)
+	}
+	if g, w := got.Totals(), want.Totals(); g != w {
+		t.Errorf("Got %#v, Wanted %#v", g, w)
+	}
+	if g, w := got.ROAs(), want.ROAs(); g != w {
+		t.Errorf("Got %#v, Wanted %#v", g, w)
+	}
+	if g, w := got.Origins(), want.Origins(); !reflect.DeepEqual(g, w) {
+		t.Errorf("Got %v, Wanted %v", g, w)
+	}
+}
+
+func TestTable(t *testing.T) {
+	table := testTable()
+	counted := testTable()
+	counted.roas = &Roas{V4v: 1, V4u: 3, V6u: 2}
+	best := testTable()
+	best.origins = nil
+
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{
+			name: "totals",
+			got:  table.Totals(),
+			want: Totals{V4Rib: 6, V4Fib: 4, V6Rib: 2, V6Fib: 2},
+		},
+		{
+			name: "asns",
+			got:  table.SourceASNs(),
+			want: ASNs{As4: 4, As6: 2, As10: 4, As4Only: 2, AsBoth: 2},
+		},
+		{
+			name: "masks",
+			got:  table.Masks(),
+			want: []map[string]uint32{{"9": 1, "24": 3}, {"32": 2}},
+		},
+		{
+			name: "roas",
+			got:  table.ROAs(),
+			want: Roas{V4v: 2, V4i: 1, V4u: 1, V6v: 1, V6i: 1},
+		},
+		{
+			// Routers that count the states themselves are believed.
+			name: "counted roas",
+			got:  counted.ROAs(),
+			want: Roas{V4v: 1, V4u: 3, V6u: 2},
+		},
+		{
+			name: "large communities",
+			got:  table.LargeCommunities(),
+			want: Large{V4: 2, V6: 1},
+		},
+		{
+			name: "as paths",
+			got:  table.ASPathStats(),
+			want: tablePathStats,
+		},
+		{
+			name: "communities",
+			got:  table.Communities(),
+			want: tableCommunities,
+		},
+		{
+			name: "bogons",
+			got:  table.Bogons(newBogonEngine(t)),
+			want: tableBogons,
+		},
+		{
+			name: "aspas",
+			got:  table.ASPAs(newASPAEngine(t)),
+			want: tableASPAs,
+		},
+		{
+			name: "origins",
+			got:  table.Origins(),
+			want: tableMOASOrigins,
+		},
+		{
+			// Without every path, the origins of the best paths are used.
+			name: "best path origins",
+			got:  best.Origins(),
+			want: tableOrigins,
+		},
+	}
+	for _, tc := range tests {
+		if !reflect.DeepEqual(tc.got, tc.want) {
+			t.Errorf("%s: Got %v, Wanted %v", tc.name, tc.got, tc.want)
+		}
+	}
+}
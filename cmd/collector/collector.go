@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mellowdrifter/bgp_infrastructure/cmd/clidecode"
+	pb "github.com/mellowdrifter/bgp_infrastructure/internal/bgpsql"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/aspa"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/bird"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/bogon"
+	com "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/hijack"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/rtr"
+	"github.com/osrg/gobgp/v3/pkg/packet/bmp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	ini "gopkg.in/ini.v1"
+)
+
+var (
+	decoder  = flag.String("decoder", "bird2", "router to interrogate. One of bird2, gobgp, frr, openbgpd, mrt, bmp or fake")
+	birdSock = flag.String("bird", bird.DefaultSocket, "path to the bird control socket")
+	gobgpd   = flag.String("gobgp", "127.0.0.1:50051", "address of the gobgpd gRPC API")
+	mrtFile  = flag.String("mrt", "", "MRT RIB dump to read when using the mrt decoder")
+	fakeFile = flag.String("fake", "", "JSON fixture of routes and peers to answer from when using the fake decoder")
+	bmpAddr  = flag.String("bmp", fmt.Sprintf(":%d", bmp.BMP_DEFAULT_PORT), "address to accept BMP sessions on when using the bmp decoder")
+	interval = flag.Duration("interval", 5*time.Minute, "how often to collect and send an update")
+	timeout  = flag.Duration("timeout", 2*time.Minute, "how long to wait on the router before abandoning a collection")
+	once     = flag.Bool("once", false, "collect and send a single update, then exit")
+)
+
+type config struct {
+	logfile    string
+	servers    []string
+	timeout    time.Duration
+	registries []string
+	delegated  []string
+	aspa       string
+	rtr        string
+}
+
+// readConfig reads all the config.ini options.
+func readConfig() config {
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	path := fmt.Sprintf("%s/config.ini", path.Dir(exe))
+	cf, err := ini.ShadowLoad(path)
+	if err != nil {
+		log.Fatalf("failed to read config file: %v\n", err)
+	}
+
+	var cfg config
+	cfg.logfile = cf.Section("log").Key("file").String()
+	cfg.servers = cf.Section("bgpinfo").Key("server").ValueWithShadows()
+	cfg.timeout = cf.Section("grpc").Key("timeout").MustDuration(30 * time.Second)
+	cfg.registries = cf.Section("bogon").Key("registry").ValueWithShadows()
+	cfg.delegated = cf.Section("bogon").Key("delegated").ValueWithShadows()
+	cfg.aspa = cf.Section("aspa").Key("file").String()
+	cfg.rtr = cf.Section("rtr").Key("server").String()
+
+	return cfg
+}
+
+func main() {
+	flag.Parse()
+	cfg := readConfig()
+
+	// Set up log file
+	f, err := os.OpenFile(cfg.logfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Fatalf("failed to open logfile: %v\n", err)
+	}
+	defer f.Close()
+	log.SetOutput(f)
+
+	router, err := clidecode.NewDecoder(*decoder, clidecode.Config{
+		Bird:  *birdSock,
+		GoBGP: *gobgpd,
+		MRT:   *mrtFile,
+		BMP:   *bmpAddr,
+		Fake:  *fakeFile,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(cfg.servers) == 0 {
+		log.Fatal("no bgpinfo servers configured")
+	}
+
+	// With an RTR cache, routes are validated here rather than relying on
+	// RPKI being set up on the router.
+	var cache *rtr.Client
+	if cfg.rtr != "" {
+		cache = rtr.NewClient(cfg.rtr)
+		go func() {
+			log.Printf("RTR client stopped: %v", cache.Run(context.Background()))
+		}()
+		select {
+		case <-cache.Synced():
+		case <-time.After(*timeout):
+			log.Printf("no VRPs from %s yet, using the router's ROA state", cfg.rtr)
+		}
+		router = clidecode.NewROVConn(router, cache)
+	}
+
+	// The detector compares each run with the last, so lives across runs.
+	detector := hijack.NewDetector()
+	for {
+		if err := run(router, cfg, detector, cache); err != nil {
+			log.Printf("unable to complete collection: %v", err)
+		}
+		if *once {
+			return
+		}
+		// Align each run with the interval so that snapshots line up
+		// across collectors, i.e. every 5 minutes on the 5 minute mark.
+		time.Sleep(time.Until(time.Now().Truncate(*interval).Add(*interval)))
+	}
+}
+
+// run gathers a single snapshot and ships it to all bgpinfo servers. ASPAs
+// come from the RTR cache when no export is configured.
+func run(router clidecode.Decoder, cfg config, detector *hijack.Detector, cache *rtr.Client) error {
+	defer com.TimeFunction(time.Now(), "run")
+
+	bogons, err := loadBogons(cfg)
+	if err != nil {
+		return err
+	}
+	aspas, err := loadASPAs(cfg)
+	if err != nil {
+		return err
+	}
+	if aspas == nil && cache != nil {
+		aspas = cache.ASPAs()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	update, table, err := gather(ctx, router, bogons, aspas)
+	if err != nil {
+		return err
+	}
+	update.Time = uint64(time.Now().Unix())
+
+	events, err := originEvents(table.Origins(), detector, time.Unix(int64(update.Time), 0))
+	if err != nil {
+		return err
+	}
+	update.OriginEvents = events
+
+	if err := send(com.StructToProto(update), cfg); err != nil {
+		return err
+	}
+	// Only once every server has the events can the detector forget them.
+	detector.Commit()
+
+	return nil
+}
+
+// loadBogons loads the bogon registries on every run, so that refreshed
+// local copies are picked up without a restart. nil is returned when none
+// are configured.
+func loadBogons(cfg config) (*bogon.Engine, error) {
+	if len(cfg.registries) == 0 && len(cfg.delegated) == 0 {
+		return nil, nil
+	}
+	e, err := bogon.Load(cfg.registries, cfg.delegated)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load bogon registries: %w", err)
+	}
+	return e, nil
+}
+
+// loadASPAs loads the rpki-client export on every run, as it's rewritten
+// each time rpki-client runs. nil is returned when none is configured.
+func loadASPAs(cfg config) (*aspa.Engine, error) {
+	if cfg.aspa == "" {
+		return nil, nil
+	}
+	e, err := aspa.Load(cfg.aspa)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load ASPAs: %w", err)
+	}
+	return e, nil
+}
+
+// originEvents passes the origins currently seen by the router to the
+// detector, returning the MOAS, sub-prefix and origin change events found.
+// Events are returned again until the detector is committed.
+func originEvents(origins map[string][]uint32, detector *hijack.Detector, now time.Time) ([]com.OriginEvent, error) {
+	snapshot, err := hijack.ParseSnapshot(origins)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []com.OriginEvent
+	for _, e := range detector.Update(snapshot, now) {
+		events = append(events, com.OriginEvent{
+			Kind:      e.Kind.String(),
+			Prefix:    e.Prefix.String(),
+			OldOrigin: e.OldOrigin,
+			NewOrigin: e.NewOrigin,
+			FirstSeen: uint64(e.FirstSeen.Unix()),
+			LastSeen:  uint64(e.LastSeen.Unix()),
+		})
+	}
+
+	return events, nil
+}
+
+// gather interrogates the router for every statistic at the same time.
+// If any single statistic fails, the whole update is discarded rather than
+// sending a partial snapshot, and the rest are cancelled. The full table is
+// only fetched once, and every statistic of it is worked out from that copy,
+// which is returned for the origins. Bogons and ASPA states are only
+// gathered with an engine to check them.
+func gather(ctx context.Context, router clidecode.Decoder, bogons *bogon.Engine, aspas *aspa.Engine) (*com.BgpUpdate, *clidecode.Table, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		update com.BgpUpdate
+		table  *clidecode.Table
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		errs   []error
+	)
+
+	// Each task writes to its own fields of update, so only the
+	// error slice needs protecting.
+	tasks := map[string]func() error{
+		"peers": func() error {
+			p, err := router.GetPeers(ctx)
+			update.PeersConfigured, update.PeersUp = p.V4c, p.V4e
+			update.Peers6Configured, update.Peers6Up = p.V6c, p.V6e
+			return err
+		},
+		"peer details": func() error {
+			peers, err := router.GetPeerDetails(ctx)
+			for _, p := range peers {
+				update.PeerDetails = append(update.PeerDetails, com.PeerDetail{
+					Address:    p.Address.String(),
+					ASN:        p.ASN,
+					State:      p.State,
+					Uptime:     p.Uptime,
+					V4Received: p.V4Received,
+					V4Accepted: p.V4Accepted,
+					V6Received: p.V6Received,
+					V6Accepted: p.V6Accepted,
+				})
+			}
+			return err
+		},
+		"table": func() error {
+			var err error
+			table, err = router.GetTable(ctx)
+			if err != nil {
+				return err
+			}
+			t := table.Totals()
+			update.V4Total, update.V4Count = t.V4Rib, t.V4Fib
+			update.V6Total, update.V6Count = t.V6Rib, t.V6Fib
+			r := table.ROAs()
+			update.Roavalid4, update.Roainvalid4, update.Roaunknown4 = r.V4v, r.V4i, r.V4u
+			update.Roavalid6, update.Roainvalid6, update.Roaunknown6 = r.V6v, r.V6i, r.V6u
+			a := table.SourceASNs()
+			update.As4, update.As6, update.As10 = a.As4, a.As6, a.As10
+			update.As4Only, update.As6Only, update.AsBoth = a.As4Only, a.As6Only, a.AsBoth
+			l := table.LargeCommunities()
+			update.LargeC4, update.LargeC6 = l.V4, l.V6
+			p := table.ASPathStats()
+			update.Paths4 = com.PathStats(p.V4)
+			update.Paths6 = com.PathStats(p.V6)
+			c := table.Communities()
+			update.Communities4 = communityUse(c.V4)
+			update.Communities6 = communityUse(c.V6)
+			if bogons != nil {
+				b := table.Bogons(bogons)
+				update.Bogons4 = com.BogonCount(b.V4)
+				update.Bogons6 = com.BogonCount(b.V6)
+				for _, r := range b.Routes {
+					update.Bogons = append(update.Bogons, com.Bogon{
+						Prefix: r.Prefix.String(),
+						Origin: r.Origin,
+						Kind:   r.Kind.String(),
+					})
+				}
+			}
+			if aspas != nil {
+				a := table.ASPAs(aspas)
+				update.Aspavalid4, update.Aspainvalid4, update.Aspaunknown4 = a.V4v, a.V4i, a.V4u
+				update.Aspavalid6, update.Aspainvalid6, update.Aspaunknown6 = a.V6v, a.V6i, a.V6u
+			}
+			return setMasks(&update, table.Masks())
+		},
+	}
+
+	for name, task := range tasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := task(); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("unable to get %s: %w", name, err))
+				mu.Unlock()
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return nil, nil, errs[0]
+	}
+
+	return &update, table, nil
+}
+
+// communityUse copies the community usage of one address family returned
+// from the router into the form the update carries.
+func communityUse(u clidecode.CommunityUse) com.CommunityUse {
+	c := com.CommunityUse{
+		Standard:  u.Standard,
+		Extended:  u.Extended,
+		Large:     u.Large,
+		WellKnown: com.WellKnown(u.WellKnown),
+	}
+	for _, t := range u.Top {
+		c.Top = append(c.Top, com.CommunityCount(t))
+	}
+
+	return c
+}
+
+// setMasks copies the mask counts returned from the router into the update,
+// keyed by prefix length.
+func setMasks(update *com.BgpUpdate, masks []map[string]uint32) error {
+	if len(masks) != 2 {
+		return fmt.Errorf("expected IPv4 and IPv6 masks, got %d families", len(masks))
+	}
+
+	families := []*map[uint32]uint32{&update.Masks4, &update.Masks6}
+	for i, bits := range []int{32, 128} {
+		counts := make(map[uint32]uint32, len(masks[i]))
+		for mask, count := range masks[i] {
+			m, err := strconv.Atoi(mask)
+			if err != nil || m < 0 || m > bits {
+				return fmt.Errorf("invalid mask %q", mask)
+			}
+			counts[uint32(m)] = count
+		}
+		*families[i] = counts
+	}
+
+	return nil
+}
+
+// send will push the update to every configured bgpinfo server. An error is
+// returned if any of them fail, but every server is always attempted.
+func send(v *pb.Values, cfg config) error {
+	var failed int
+	for _, srv := range cfg.servers {
+		if err := sendOne(v, srv, cfg.timeout); err != nil {
+			log.Printf("unable to update %s: %v", srv, err)
+			failed++
+			continue
+		}
+		log.Printf("updated %s", srv)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to update %d of %d servers", failed, len(cfg.servers))
+	}
+
+	return nil
+}
+
+func sendOne(v *pb.Values, srv string, timeout time.Duration) error {
+	conn, err := grpc.NewClient(srv, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return fmt.Errorf("unable to dial gRPC server: %w", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	resp, err := pb.NewBgpInfoClient(conn).AddLatest(ctx, v)
+	if err != nil {
+		return err
+	}
+	if !resp.GetSuccess() {
+		return fmt.Errorf("server returned unsuccessful result: %s", resp.GetResult())
+	}
+
+	return nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mellowdrifter/bgp_infrastructure/cmd/clidecode"
+	com "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/hijack"
+)
+
+// testConn returns fixed values for the statistics the collector gathers
+// from the router, with the table taken from the fake router's fixture. The
+// amount of times the table is fetched is counted.
+type testConn struct {
+	clidecode.FakeConn
+	peerErr error
+	tables  *atomic.Int32
+}
+
+// newTestConn returns a testConn with the fake router's fixture loaded.
+func newTestConn(t *testing.T) testConn {
+	t.Helper()
+	f, err := clidecode.LoadFakeConn("../clidecode/testdata/fake/table.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testConn{FakeConn: f, tables: new(atomic.Int32)}
+}
+
+func (t testConn) GetPeers(context.Context) (clidecode.Peers, error) {
+	return clidecode.Peers{V4c: 4, V4e: 3, V6c: 2, V6e: 1}, t.peerErr
+}
+
+func (t testConn) GetTable(ctx context.Context) (*clidecode.Table, error) {
+	t.tables.Add(1)
+	return t.FakeConn.GetTable(ctx)
+}
+
+func (t testConn) GetPeerDetails(context.Context) ([]clidecode.PeerDetail, error) {
+	return []clidecode.PeerDetail{{
+		Address:    net.ParseIP("192.0.2.1").To4(),
+		ASN:        3356,
+		State:      clidecode.StateEstablished,
+		Uptime:     time.Hour,
+		V4Received: 950000,
+		V4Accepted: 949000,
+	}}, nil
+}
+
+func TestGather(t *testing.T) {
+	router := newTestConn(t)
+	got, _, err := gather(t.Context(), router, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := router.tables.Load(); n != 1 {
+		t.Errorf("Got %d table fetches, Wanted 1", n)
+	}
+
+	want := com.BgpUpdate{
+		V4Total: 6, V4Count: 4,
+		V6Total: 2, V6Count: 2,
+		PeersConfigured: 4, PeersUp: 3,
+		Peers6Configured: 2, Peers6Up: 1,
+		Roavalid4: 2, Roainvalid4: 1, Roaunknown4: 1,
+		Roavalid6: 1, Roainvalid6: 1,
+		As4: 4, As6: 2, As10: 4, As4Only: 2, AsBoth: 2,
+		LargeC4: 2, LargeC6: 1,
+		Masks4: map[uint32]uint32{9: 1, 24: 3},
+		Masks6: map[uint32]uint32{32: 2},
+		Paths4: com.PathStats{
+			Lengths:   map[uint32]uint32{1: 1, 2: 1, 3: 2},
+			Unique:    map[uint32]uint32{1: 1, 2: 2, 3: 1},
+			Prepended: 1,
+			Sets:      1,
+		},
+		Paths6: com.PathStats{
+			Lengths: map[uint32]uint32{2: 2},
+			Unique:  map[uint32]uint32{2: 2},
+		},
+		Communities4: com.CommunityUse{
+			Standard: 3,
+			Extended: 1,
+			Large:    2,
+			Top: []com.CommunityCount{
+				{Community: "3356:100", Prefixes: 2},
+				{Community: "13335:1:100", Prefixes: 1},
+				{Community: "3356:2001", Prefixes: 1},
+				{Community: "65535:65281", Prefixes: 1},
+				{Community: "65535:666", Prefixes: 1},
+				{Community: "6939:1:1", Prefixes: 1},
+				{Community: "6939:1:2", Prefixes: 1},
+				{Community: "rt:65000:100", Prefixes: 1},
+			},
+			WellKnown: com.WellKnown{NoExport: 1, Blackhole: 1},
+		},
+		Communities6: com.CommunityUse{
+			Standard: 1,
+			Extended: 1,
+			Large:    1,
+			Top: []com.CommunityCount{
+				{Community: "6939:1:1", Prefixes: 1},
+				{Community: "6939:666", Prefixes: 1},
+				{Community: "soo:65000:1", Prefixes: 1},
+			},
+		},
+		PeerDetails: []com.PeerDetail{{
+			Address:    "192.0.2.1",
+			ASN:        3356,
+			State:      "Established",
+			Uptime:     time.Hour,
+			V4Received: 950000,
+			V4Accepted: 949000,
+		}},
+	}
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("Got %#v, Wanted %#v", *got, want)
+	}
+}
+
+func TestGatherError(t *testing.T) {
+	boom := errors.New("birdc went away")
+	router := newTestConn(t)
+	router.peerErr = boom
+	if _, _, err := gather(t.Context(), router, nil, nil); !errors.Is(err, boom) {
+		t.Errorf("Got %v, Wanted %v", err, boom)
+	}
+}
+
+// hungConn never answers GetTable until it's cancelled.
+type hungConn struct {
+	testConn
+}
+
+func (h hungConn) GetTable(ctx context.Context) (*clidecode.Table, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestGatherCancel(t *testing.T) {
+	// A failure cancels the statistics still being gathered.
+	boom := errors.New("birdc went away")
+	router := newTestConn(t)
+	router.peerErr = boom
+	if _, _, err := gather(t.Context(), hungConn{router}, nil, nil); !errors.Is(err, boom) {
+		t.Errorf("Got %v, Wanted %v", err, boom)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := gather(ctx, hungConn{newTestConn(t)}, nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Got %v, Wanted %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestGatherFake(t *testing.T) {
+	if _, _, err := gather(t.Context(), clidecode.FakeConn{}, nil, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	router, err := clidecode.LoadFakeConn("../clidecode/testdata/fake/table.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	update, _, err := gather(t.Context(), router, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if update.V4Count != 4 || update.V6Count != 2 || update.Roavalid4 != 2 || update.Roainvalid6 != 1 {
+		t.Errorf("Got %+v", update)
+	}
+	if update.Bogons != nil {
+		t.Errorf("Got bogons %v without an engine", update.Bogons)
+	}
+
+	dir := "../../pkg/bogon/testdata/"
+	bogons, err := loadBogons(config{
+		registries: []string{dir + "iana-ipv4-special-registry-1.csv", dir + "special-purpose-as-numbers.csv"},
+		delegated:  []string{dir + "delegated-test-extended-latest"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	update, _, err = gather(t.Context(), router, bogons, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantBogons := []com.Bogon{
+		{Prefix: "9.9.9.0/24", Origin: 19281, Kind: "unallocated"},
+		{Prefix: "2606:4700::/32", Origin: 13335, Kind: "unallocated"},
+	}
+	if !reflect.DeepEqual(update.Bogons, wantBogons) || update.Bogons4.Unallocated != 1 || update.Bogons6.Unallocated != 1 {
+		t.Errorf("Got %v %v %v, Wanted %v", update.Bogons4, update.Bogons6, update.Bogons, wantBogons)
+	}
+
+	aspas, err := loadASPAs(config{aspa: "../../pkg/aspa/testdata/rpki-client.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	update, _, err = gather(t.Context(), router, nil, aspas)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if update.Aspavalid4 != 3 || update.Aspainvalid4 != 1 || update.Aspaunknown4 != 0 || update.Aspavalid6 != 2 {
+		t.Errorf("Got %+v", update)
+	}
+}
+
+func TestOriginEvents(t *testing.T) {
+	origins := []map[string][]uint32{
+		{"1.1.1.0/24": {13335}, "8.0.0.0/9": {3356}},
+		{"1.1.1.0/24": {13335, 666}, "8.0.0.0/9": {174}},
+		{"1.1.1.0/24": {13335, 666}, "8.0.0.0/9": {174}},
+		{"1.1.1.0/24": {13335}, "8.0.0.0/9": {174}},
+	}
+	moas := func(last uint64) com.OriginEvent {
+		return com.OriginEvent{Kind: "moas", Prefix: "1.1.1.0/24", OldOrigin: 13335, NewOrigin: 666, FirstSeen: 300, LastSeen: last}
+	}
+	want := [][]com.OriginEvent{
+		nil,
+		{moas(300), {Kind: "origin_change", Prefix: "8.0.0.0/9", OldOrigin: 3356, NewOrigin: 174, FirstSeen: 300, LastSeen: 300}},
+		{moas(600)},
+		nil,
+	}
+
+	detector := hijack.NewDetector()
+	for i := range want {
+		got, err := originEvents(origins[i], detector, time.Unix(int64(i)*300, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("%d: Got %v, Wanted %v", i, got, want[i])
+		}
+		detector.Commit()
+	}
+}
+
+func TestRunUnsent(t *testing.T) {
+	router := newTestConn(t)
+	table, err := router.GetTable(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The baseline has 1.1.1.0/24 from another origin, so every run finds
+	// it changed.
+	origins := table.Origins()
+	origins["1.1.1.0/24"] = []uint32{64500}
+	detector := hijack.NewDetector()
+	if _, err := originEvents(origins, detector, time.Unix(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing listens on the server, so the events must be kept for the
+	// next run.
+	cfg := config{servers: []string{"127.0.0.1:1"}, timeout: time.Second}
+	if err := run(router, cfg, detector, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	events, err := originEvents(table.Origins(), detector, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Prefix != "1.1.1.0/24" || events[0].NewOrigin != 13335 {
+		t.Errorf("Got %v, Wanted the origin change of 1.1.1.0/24", events)
+	}
+
+	// Once sent, they're gone.
+	if err := run(router, config{}, detector, nil); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := originEvents(table.Origins(), detector, time.Now()); events != nil {
+		t.Errorf("Got %v, Wanted no events", events)
+	}
+}
+
+func TestSetMasks(t *testing.T) {
+	tests := []struct {
+		name    string
+		masks   []map[string]uint32
+		want    com.BgpUpdate
+		wantErr bool
+	}{
+		{
+			name:  "Both families",
+			masks: []map[string]uint32{{"9": 1, "23": 2}, {"8": 3, "47": 4}},
+			want: com.BgpUpdate{
+				Masks4: map[uint32]uint32{9: 1, 23: 2},
+				Masks6: map[uint32]uint32{8: 3, 47: 4},
+			},
+		},
+		{
+			name:  "Every length kept",
+			masks: []map[string]uint32{{"0": 1, "7": 1, "25": 2, "32": 3}, {"49": 3, "128": 4}},
+			want: com.BgpUpdate{
+				Masks4: map[uint32]uint32{0: 1, 7: 1, 25: 2, 32: 3},
+				Masks6: map[uint32]uint32{49: 3, 128: 4},
+			},
+		},
+		{
+			name:    "Missing family",
+			masks:   []map[string]uint32{{"24": 1}},
+			wantErr: true,
+		},
+		{
+			name:    "Bad mask",
+			masks:   []map[string]uint32{{"abc": 1}, {}},
+			wantErr: true,
+		},
+		{
+			name:    "Too long",
+			masks:   []map[string]uint32{{"33": 1}, {}},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		var got com.BgpUpdate
+		err := setMasks(&got, tc.masks)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: got error %v, wanted error %t", tc.name, err, tc.wantErr)
+			continue
+		}
+		if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: Got %#v, Wanted %#v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+
+	"github.com/mellowdrifter/bgp_infrastructure/cmd/clidecode"
+	pb "github.com/mellowdrifter/bgp_infrastructure/internal/glass"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/aspa"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/bird"
+	com "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/rtr"
+	"github.com/osrg/gobgp/v3/pkg/packet/bmp"
+	"google.golang.org/grpc"
+	ini "gopkg.in/ini.v1"
+)
+
+var (
+	decoder  = flag.String("decoder", "bird2", "router to interrogate. One of bird2, gobgp, frr, openbgpd, mrt, bmp or fake")
+	birdSock = flag.String("bird", bird.DefaultSocket, "path to the bird control socket")
+	gobgpd   = flag.String("gobgp", "127.0.0.1:50051", "address of the gobgpd gRPC API")
+	mrtFile  = flag.String("mrt", "", "MRT RIB dump to read when using the mrt decoder")
+	fakeFile = flag.String("fake", "", "JSON fixture of routes and peers to answer from when using the fake decoder")
+	bmpAddr  = flag.String("bmp", fmt.Sprintf(":%d", bmp.BMP_DEFAULT_PORT), "address to accept BMP sessions on when using the bmp decoder")
+	timeout  = flag.Duration("timeout", time.Minute, "how long to wait on the router before abandoning a request")
+)
+
+type config struct {
+	port        string
+	logfile     string
+	aspa        string
+	aspaRefresh time.Duration
+	rtr         string
+}
+
+// server answers looking glass requests from the router's current table.
+// Anything not yet backed by a decoder is left unimplemented.
+type server struct {
+	pb.UnimplementedLookingGlassServer
+	router clidecode.Decoder
+
+	// aspas is replaced as the rpki-client export is reloaded.
+	aspas atomic.Pointer[aspa.Engine]
+	// cache supplies ASPAs when there's no export.
+	cache *rtr.Client
+}
+
+// readConfig reads all the config.ini options.
+func readConfig() config {
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	path := fmt.Sprintf("%s/config.ini", path.Dir(exe))
+	cf, err := ini.Load(path)
+	if err != nil {
+		log.Fatalf("failed to read config file: %v\n", err)
+	}
+
+	var cfg config
+	cfg.port = fmt.Sprintf(":%s", cf.Section("grpc").Key("port").String())
+	cfg.logfile = cf.Section("log").Key("file").String()
+	cfg.aspa = cf.Section("aspa").Key("file").String()
+	cfg.aspaRefresh = cf.Section("aspa").Key("refresh").MustDuration(time.Hour)
+	cfg.rtr = cf.Section("rtr").Key("server").String()
+
+	return cfg
+}
+
+func main() {
+	flag.Parse()
+	cfg := readConfig()
+
+	// Set up log file
+	f, err := os.OpenFile(cfg.logfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Fatalf("failed to open logfile: %v\n", err)
+	}
+	defer f.Close()
+	log.SetOutput(f)
+
+	router, err := clidecode.NewDecoder(*decoder, clidecode.Config{
+		Bird:  *birdSock,
+		GoBGP: *gobgpd,
+		MRT:   *mrtFile,
+		BMP:   *bmpAddr,
+		Fake:  *fakeFile,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// set up gRPC server
+	log.Printf("Listening on port %s\n", cfg.port)
+	lis, err := net.Listen("tcp", cfg.port)
+	if err != nil {
+		log.Fatalf("Failed to bind: %v", err)
+	}
+	srv := &server{router: router}
+	if cfg.rtr != "" {
+		srv.cache = rtr.NewClient(cfg.rtr)
+		go func() {
+			log.Printf("RTR client stopped: %v", srv.cache.Run(context.Background()))
+		}()
+		srv.router = clidecode.NewROVConn(router, srv.cache)
+	}
+	if cfg.aspa != "" {
+		if err := srv.loadASPAs(cfg.aspa); err != nil {
+			log.Fatal(err)
+		}
+		go srv.refreshASPAs(cfg.aspa, cfg.aspaRefresh)
+	}
+	grpcServer := grpc.NewServer()
+	pb.RegisterLookingGlassServer(grpcServer, srv)
+
+	grpcServer.Serve(lis)
+}
+
+// loadASPAs replaces the ASPAs used to verify paths with those in the
+// rpki-client export at name.
+func (s *server) loadASPAs(name string) error {
+	e, err := aspa.Load(name)
+	if err != nil {
+		return fmt.Errorf("unable to load ASPAs: %w", err)
+	}
+	s.aspas.Store(e)
+	log.Printf("Loaded ASPAs for %d customers\n", e.Len())
+	return nil
+}
+
+// refreshASPAs reloads the rpki-client export every interval. A failed
+// reload keeps the ASPAs already loaded.
+func (s *server) refreshASPAs(name string, interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := s.loadASPAs(name); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func (s *server) Aspa(ctx context.Context, r *pb.AspaRequest) (*pb.AspaResponse, error) {
+	// Verify the path of the active route for an address against ASPAs.
+	log.Println("Running Aspa")
+
+	e := s.aspas.Load()
+	if e == nil && s.cache != nil {
+		e = s.cache.ASPAs()
+	}
+	if e == nil {
+		return nil, fmt.Errorf("no ASPAs loaded")
+	}
+	ip := net.ParseIP(r.GetIpAddress().GetAddress())
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %q", r.GetIpAddress().GetAddress())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	prefix, p, ok, err := s.router.GetASPathFromIP(ctx, ip)
+	if err != nil {
+		log.Printf("Got error in Aspa: %s\n", err)
+		return nil, err
+	}
+	if !ok {
+		return &pb.AspaResponse{CacheTime: uint64(time.Now().Unix())}, nil
+	}
+
+	mask, _ := prefix.Mask.Size()
+	return &pb.AspaResponse{
+		IpAddress: &pb.IpAddress{Address: prefix.IP.String(), Mask: uint32(mask)},
+		Status:    pb.AspaResponse_ASPAStatus(e.Verify(p.Path, p.Set)),
+		Asn:       asns(p.Path),
+		Set:       asns(p.Set),
+		Exists:    true,
+		CacheTime: uint64(time.Now().Unix()),
+	}, nil
+}
+
+// asns returns each AS number in both asplain and asdot.
+func asns(path []uint32) []*pb.Asn {
+	var a []*pb.Asn
+	for _, asn := range path {
+		a = append(a, &pb.Asn{Asplain: asn, Asdot: com.ASPlainToASDot(asn)})
+	}
+	return a
+}
+
+func (s *server) TotalTransit(ctx context.Context, r *pb.TotalTransitRequest) (*pb.TotalTransitResponse, error) {
+	// Count the prefixes an ASN transits, and who it sits between.
+	log.Println("Running TotalTransit")
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	t, err := s.router.GetTransit(ctx, r.GetAsNumber())
+	if err != nil {
+		log.Printf("Got error in TotalTransit: %s\n", err)
+		return nil, err
+	}
+
+	return &pb.TotalTransitResponse{
+		Total:       t.V4 + t.V6,
+		V4Count:     t.V4,
+		V6Count:     t.V6,
+		Upstreams:   t.Upstreams,
+		Downstreams: t.Downstreams,
+		CacheTime:   uint64(time.Now().Unix()),
+	}, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mellowdrifter/bgp_infrastructure/cmd/clidecode"
+	pb "github.com/mellowdrifter/bgp_infrastructure/internal/glass"
+	"google.golang.org/protobuf/proto"
+)
+
+// newTestServer returns a server answering from the fake decoder's table.
+func newTestServer(t *testing.T) *server {
+	t.Helper()
+	router, err := clidecode.LoadFakeConn("../clidecode/testdata/fake/table.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &server{router: router}
+}
+
+func TestTotalTransit(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		asn  uint32
+		want *pb.TotalTransitResponse
+	}{
+		{
+			asn: 3356,
+			want: &pb.TotalTransitResponse{
+				Total:       2,
+				V4Count:     2,
+				Downstreams: []uint32{13335, 15169},
+			},
+		},
+		{
+			asn: 6939,
+			want: &pb.TotalTransitResponse{
+				Total:       3,
+				V4Count:     1,
+				V6Count:     2,
+				Downstreams: []uint32{13335, 15169, 19281},
+			},
+		},
+		{
+			asn: 15169,
+			want: &pb.TotalTransitResponse{
+				Upstreams: []uint32{3356, 6939},
+			},
+		},
+	}
+	for _, tc := range tests {
+		got, err := s.TotalTransit(t.Context(), &pb.TotalTransitRequest{AsNumber: tc.asn})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.GetCacheTime() == 0 {
+			t.Errorf("%d: cache time not set", tc.asn)
+		}
+		got.CacheTime = 0
+		if !proto.Equal(got, tc.want) {
+			t.Errorf("%d: Got %v, Wanted %v", tc.asn, got, tc.want)
+		}
+	}
+}
+
+func TestAspa(t *testing.T) {
+	s := newTestServer(t)
+	req := &pb.AspaRequest{IpAddress: &pb.IpAddress{Address: "9.9.9.9"}}
+	if _, err := s.Aspa(t.Context(), req); err == nil {
+		t.Error("Got no error without ASPAs loaded")
+	}
+	if err := s.loadASPAs("../../pkg/aspa/testdata/rpki-client.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	asn := func(asplain uint32, asdot string) *pb.Asn { return &pb.Asn{Asplain: asplain, Asdot: asdot} }
+	tests := []struct {
+		address string
+		want    *pb.AspaResponse
+	}{
+		{
+			address: "2606:4700::1111",
+			want: &pb.AspaResponse{
+				IpAddress: &pb.IpAddress{Address: "2606:4700::", Mask: 32},
+				Status:    pb.AspaResponse_VALID,
+				Asn:       []*pb.Asn{asn(6939, "6939"), asn(13335, "13335")},
+				Exists:    true,
+			},
+		},
+		{
+			address: "9.9.9.9",
+			want: &pb.AspaResponse{
+				IpAddress: &pb.IpAddress{Address: "9.9.9.0", Mask: 24},
+				Status:    pb.AspaResponse_INVALID,
+				Asn:       []*pb.Asn{asn(6939, "6939"), asn(19281, "19281")},
+				Set:       []*pb.Asn{asn(1, "1"), asn(2, "2")},
+				Exists:    true,
+			},
+		},
+		{
+			address: "192.0.2.1",
+			want:    &pb.AspaResponse{},
+		},
+	}
+	for _, tc := range tests {
+		got, err := s.Aspa(t.Context(), &pb.AspaRequest{IpAddress: &pb.IpAddress{Address: tc.address}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.GetCacheTime() == 0 {
+			t.Errorf("%s: cache time not set", tc.address)
+		}
+		got.CacheTime = 0
+		if !proto.Equal(got, tc.want) {
+			t.Errorf("%s: Got %v, Wanted %v", tc.address, got, tc.want)
+		}
+	}
+
+	if _, err := s.Aspa(t.Context(), &pb.AspaRequest{IpAddress: &pb.IpAddress{Address: "bogus"}}); err == nil {
+		t.Error("Got no error for an invalid address")
+	}
+}
@@ -0,0 +1,134 @@
+// rovstat validates a router's table against a VRP export and prints how
+// many routes each origin ASN has valid, invalid and unknown.
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mellowdrifter/bgp_infrastructure/cmd/clidecode"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/bird"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/rov"
+	"github.com/osrg/gobgp/v3/pkg/packet/bmp"
+)
+
+var (
+	decoder  = flag.String("decoder", "mrt", "router to interrogate. One of bird2, gobgp, frr, openbgpd, mrt, bmp or fake")
+	birdSock = flag.String("bird", bird.DefaultSocket, "path to the bird control socket")
+	gobgpd   = flag.String("gobgp", "127.0.0.1:50051", "address of the gobgpd gRPC API")
+	mrtFile  = flag.String("mrt", "", "MRT RIB dump to read when using the mrt decoder")
+	fakeFile = flag.String("fake", "", "JSON fixture of routes and peers to answer from when using the fake decoder")
+	bmpAddr  = flag.String("bmp", fmt.Sprintf(":%d", bmp.BMP_DEFAULT_PORT), "address to accept BMP sessions on when using the bmp decoder")
+	vrpFile  = flag.String("vrps", "", "rpki-client or Routinator JSON or CSV export to validate against")
+	asn      = flag.Uint("asn", 0, "only print this origin ASN")
+	timeout  = flag.Duration("timeout", 2*time.Minute, "how long to wait on the router")
+)
+
+// stat is the amount of routes an ASN originates in each state.
+type stat struct {
+	asn                     uint32
+	valid, invalid, unknown int
+}
+
+func main() {
+	flag.Parse()
+	if *vrpFile == "" {
+		log.Fatal("no VRP export given with -vrps")
+	}
+
+	vrps, err := rov.Load(*vrpFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	router, err := clidecode.NewDecoder(*decoder, clidecode.Config{
+		Bird:  *birdSock,
+		GoBGP: *gobgpd,
+		MRT:   *mrtFile,
+		BMP:   *bmpAddr,
+		Fake:  *fakeFile,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	stats, err := validate(ctx, router, vrps)
+	if err != nil {
+		log.Fatalf("unable to validate routes: %v", err)
+	}
+	if *asn != 0 {
+		stats = slices.DeleteFunc(stats, func(s stat) bool {
+			return s.asn != uint32(*asn)
+		})
+	}
+	if err := writeStats(os.Stdout, stats); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// validate returns the state of every route the router has, counted per
+// origin ASN and sorted by ASN. A prefix announced by more than one origin
+// counts once for each.
+func validate(ctx context.Context, router clidecode.Decoder, vrps *rov.Table) ([]stat, error) {
+	table, err := router.GetTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byASN := make(map[uint32]*stat)
+	for p, asns := range table.Origins() {
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix %q: %w", p, err)
+		}
+		for _, a := range asns {
+			s, ok := byASN[a]
+			if !ok {
+				s = &stat{asn: a}
+				byASN[a] = s
+			}
+			switch vrps.Validate(prefix, a) {
+			case rov.Valid:
+				s.valid++
+			case rov.Invalid:
+				s.invalid++
+			default:
+				s.unknown++
+			}
+		}
+	}
+
+	stats := make([]stat, 0, len(byASN))
+	for _, s := range byASN {
+		stats = append(stats, *s)
+	}
+	slices.SortFunc(stats, func(a, b stat) int {
+		return cmp.Compare(a.asn, b.asn)
+	})
+	return stats, nil
+}
+
+// writeStats writes stats as a table, followed by their totals.
+func writeStats(w io.Writer, stats []stat) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "ASN\tVALID\tINVALID\tUNKNOWN\t")
+	var total stat
+	for _, s := range stats {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t\n", s.asn, s.valid, s.invalid, s.unknown)
+		total.valid += s.valid
+		total.invalid += s.invalid
+		total.unknown += s.unknown
+	}
+	fmt.Fprintf(tw, "total\t%d\t%d\t%d\t\n", total.valid, total.invalid, total.unknown)
+	return tw.Flush()
+}
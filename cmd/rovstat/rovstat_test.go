@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/mellowdrifter/bgp_infrastructure/cmd/clidecode"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/rov"
+)
+
+func TestValidate(t *testing.T) {
+	router, err := clidecode.LoadFakeConn("../clidecode/testdata/fake/table.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vrps, err := rov.Load("../../pkg/rov/testdata/routinator.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := validate(context.Background(), router, vrps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []stat{
+		{asn: 3356, invalid: 1},
+		{asn: 13335, valid: 1, invalid: 1},
+		{asn: 15169, valid: 2},
+		{asn: 19281, unknown: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+
+	var b bytes.Buffer
+	if err := writeStats(&b, got); err != nil {
+		t.Fatal(err)
+	}
+	wantOut := "    ASN  VALID  INVALID  UNKNOWN\n" +
+		"   3356      0        1        0\n" +
+		"  13335      1        1        0\n" +
+		"  15169      2        0        0\n" +
+		"  19281      0        0        1\n" +
+		"  total      3        2        1\n"
+	if b.String() != wantOut {
+		t.Errorf("Got\n%s, Wanted\n%s", b.String(), wantOut)
+	}
+}
@@ -0,0 +1,194 @@
+// Package aspa verifies AS paths against AS Provider Authorizations.
+//
+// ASPA objects are read from the JSON export written by rpki-client, as
+// described in https://man.openbsd.org/rpki-client. Paths are verified with
+// the downstream procedure from draft-ietf-sidrops-aspa-verification, as a
+// collector's table is mostly learnt from its providers. The downstream
+// procedure still finds a route leaked through more than one lateral peer.
+package aspa
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+// State is the result of verifying an AS path.
+type State int
+
+const (
+	// Unknown is a path that can't be proven valid or invalid, as not
+	// every ASN in it has an ASPA.
+	Unknown State = iota
+	// Valid is a path where every hop is attested.
+	Valid
+	// Invalid is a path with a hop that can't be a valley free path, or
+	// that carries an AS-SET.
+	Invalid
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case Unknown:
+		return "unknown"
+	case Valid:
+		return "valid"
+	case Invalid:
+		return "invalid"
+	}
+	return fmt.Sprintf("state(%d)", int(s))
+}
+
+// hop is the relationship attested for one ASN towards the next.
+type hop int
+
+const (
+	noAttestation hop = iota
+	provider
+	notProvider
+)
+
+// Engine verifies AS paths. The zero value has no ASPAs, so finds nothing
+// valid or invalid beyond the shortest paths. Load it with an export, then
+// don't modify it while it's being used.
+type Engine struct {
+	// The sorted providers of each customer ASN.
+	providers map[uint32][]uint32
+}
+
+// export is the part of the rpki-client JSON export holding ASPAs.
+type export struct {
+	ASPAs []struct {
+		Customer  *uint32  `json:"customer_asid"`
+		Providers []uint32 `json:"providers"`
+	} `json:"aspas"`
+}
+
+// New returns an Engine holding the providers of each customer ASN, as
+// synced over RTR rather than loaded from an export.
+func New(providers map[uint32][]uint32) *Engine {
+	e := &Engine{providers: make(map[uint32][]uint32, len(providers))}
+	for customer, p := range providers {
+		p = slices.Clone(p)
+		slices.Sort(p)
+		e.providers[customer] = slices.Compact(p)
+	}
+	return e
+}
+
+// Load returns an Engine loaded from the rpki-client JSON export at name.
+func Load(name string) (*Engine, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var e Engine
+	if err := e.LoadJSON(f); err != nil {
+		return nil, fmt.Errorf("unable to load %s: %w", name, err)
+	}
+	return &e, nil
+}
+
+// LoadJSON adds the ASPAs of an rpki-client JSON export. Anything else in
+// the export is ignored. ASPAs for the same customer are merged.
+func (e *Engine) LoadJSON(r io.Reader) error {
+	var ex export
+	if err := json.NewDecoder(r).Decode(&ex); err != nil {
+		return err
+	}
+
+	if e.providers == nil {
+		e.providers = make(map[uint32][]uint32, len(ex.ASPAs))
+	}
+	for _, a := range ex.ASPAs {
+		if a.Customer == nil {
+			return fmt.Errorf("ASPA without a customer ASN")
+		}
+		p := append(e.providers[*a.Customer], a.Providers...)
+		slices.Sort(p)
+		e.providers[*a.Customer] = slices.Compact(p)
+	}
+	return nil
+}
+
+// Len returns the amount of customer ASNs with an ASPA.
+func (e *Engine) Len() int {
+	return len(e.providers)
+}
+
+// Providers returns the providers attested by customer, and whether it
+// has an ASPA at all. An ASPA listing only AS0 attests there are none.
+func (e *Engine) Providers(customer uint32) ([]uint32, bool) {
+	p, ok := e.providers[customer]
+	return slices.Clone(p), ok
+}
+
+// hop returns whether p is an attested provider of customer.
+func (e *Engine) hop(customer, p uint32) hop {
+	providers, ok := e.providers[customer]
+	if !ok {
+		return noAttestation
+	}
+	if _, found := slices.BinarySearch(providers, p); found {
+		return provider
+	}
+	return notProvider
+}
+
+// Verify returns the state of an AS path as received, with the neighbour
+// first and the origin last. Any AS-SET makes the path invalid. Prepends
+// are ignored, so a path through two ASNs or fewer is always valid.
+func (e *Engine) Verify(path, set []uint32) State {
+	if len(set) > 0 {
+		return Invalid
+	}
+
+	// as[i] is AS(i+1) in the draft, so the origin comes first.
+	as := slices.Clone(path)
+	slices.Reverse(as)
+	as = slices.Compact(as)
+	n := len(as)
+	if n <= 2 {
+		return Valid
+	}
+
+	// The lowest point the path can no longer be going up, and the highest
+	// it must still be going down. Crossing means a valley.
+	uMin := n + 1
+	for u := 2; u <= n; u++ {
+		if e.hop(as[u-2], as[u-1]) == notProvider {
+			uMin = u
+			break
+		}
+	}
+	vMax := 0
+	for v := n - 1; v >= 1; v-- {
+		if e.hop(as[v], as[v-1]) == notProvider {
+			vMax = v
+			break
+		}
+	}
+	if uMin <= vMax {
+		return Invalid
+	}
+
+	// The longest attested up ramp from the origin, and down ramp to the
+	// neighbour. At most one hop between them means the path is proven.
+	k := 1
+	for k < n && e.hop(as[k-1], as[k]) == provider {
+		k++
+	}
+	l := n
+	for l > 1 && e.hop(as[l-1], as[l-2]) == provider {
+		l--
+	}
+	if l-k <= 1 {
+		return Valid
+	}
+	return Unknown
+}
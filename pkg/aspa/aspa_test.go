@@ -0,0 +1,112 @@
+package aspa
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func loadTest(t *testing.T) *Engine {
+	t.Helper()
+	e, err := Load("testdata/rpki-client.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestLoad(t *testing.T) {
+	e := loadTest(t)
+	if got := e.Len(); got != 6 {
+		t.Errorf("Got %d, Wanted %d", got, 6)
+	}
+	got, ok := e.Providers(13335)
+	if want := []uint32{3356, 6939}; !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, %t, Wanted %v", got, ok, want)
+	}
+	if _, ok := e.Providers(19281); ok {
+		t.Error("Got an ASPA for 19281")
+	}
+
+	// A second export for the same customer is merged.
+	if err := e.LoadJSON(strings.NewReader(`{"aspas": [{"customer_asid": 13335, "providers": [174, 3356]}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = e.Providers(13335)
+	if want := []uint32{174, 3356, 6939}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, in := range []string{
+		`{"aspas": [{"providers": [174]}]}`,
+		`{"aspas": [{"customer_asid": "AS13335", "providers": [174]}]}`,
+		`not json`,
+	} {
+		var e Engine
+		if err := e.LoadJSON(strings.NewReader(in)); err == nil {
+			t.Errorf("%s: expected an error", in)
+		}
+	}
+	if _, err := Load("testdata/missing.json"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	e := loadTest(t)
+
+	tests := []struct {
+		name string
+		path []uint32
+		set  []uint32
+		want State
+	}{
+		{name: "Local", want: Valid},
+		{name: "Neighbour", path: []uint32{3356}, want: Valid},
+		{name: "Two ASNs", path: []uint32{64496, 64497}, want: Valid},
+		{name: "Up then down", path: []uint32{174, 3356, 13335}, want: Valid},
+		{name: "Prepended", path: []uint32{174, 174, 3356, 13335, 13335, 13335}, want: Valid},
+		{name: "Up, down through a provider", path: []uint32{13335, 3356, 15169}, want: Valid},
+		{name: "Leaked between peers", path: []uint32{174, 6939, 3356, 13335}, want: Invalid},
+		{name: "Leaked by a customer", path: []uint32{174, 13335, 6939, 15169}, want: Invalid},
+		{name: "AS-SET", path: []uint32{6939, 19281}, set: []uint32{1, 2}, want: Invalid},
+		{name: "Not attested", path: []uint32{64511, 64500, 64502}, want: Unknown},
+		{name: "No ASPAs", path: []uint32{64496, 64497, 64498}, want: Unknown},
+	}
+	for _, tc := range tests {
+		if got := e.Verify(tc.path, tc.set); got != tc.want {
+			t.Errorf("%s: Got %v, Wanted %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestVerifyEmpty(t *testing.T) {
+	// Without any ASPAs, only the shortest paths are proven.
+	var e Engine
+	for path, want := range map[int]State{1: Valid, 2: Valid, 3: Unknown} {
+		if got := e.Verify([]uint32{3356, 6939, 13335}[:path], nil); got != want {
+			t.Errorf("%d: Got %v, Wanted %v", path, got, want)
+		}
+	}
+}
+
+func TestStateString(t *testing.T) {
+	for s, want := range map[State]string{Unknown: "unknown", Valid: "valid", Invalid: "invalid", 3: "state(3)"} {
+		if got := s.String(); got != want {
+			t.Errorf("Got %q, Wanted %q", got, want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	e := New(map[uint32][]uint32{13335: {6939, 3356, 6939}, 3356: {0}})
+	got, _ := e.Providers(13335)
+	if want := []uint32{3356, 6939}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+	if got := e.Verify([]uint32{174, 3356, 13335}, nil); got != Valid {
+		t.Errorf("Got %v, Wanted %v", got, Valid)
+	}
+}
@@ -0,0 +1,227 @@
+// Package bird is a client for the BIRD control socket. It speaks the same
+// protocol as birdc, so no birdc binary or shell is needed to query BIRD.
+//
+// Every reply line starts with a four digit code followed by a '-' if more
+// lines follow, or a space if it's the last line of the reply. Following
+// lines with the same code start with a space instead of repeating the code.
+// Codes starting with 8 are runtime errors and codes starting with 9 are
+// syntax errors.
+package bird
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSocket is where BIRD creates its control socket by default.
+const DefaultSocket = "/run/bird/bird.ctl"
+
+// Reply codes used by this package. See doc/reply_codes in the BIRD source
+// for the full list.
+const (
+	CodeOK              = 0
+	CodeWelcome         = 1
+	CodeProtocol        = 1002
+	CodeProtocolDetails = 1006
+	CodeNetworkNotFound = 8001
+)
+
+// Line is a single line of a reply.
+type Line struct {
+	Code int
+	Text string
+}
+
+// Error is an error returned by BIRD, for example when a command has a
+// syntax error or a network is not found.
+type Error struct {
+	Code int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("bird: %04d %s", e.Code, e.Msg)
+}
+
+// IsError returns true if the code is a runtime or syntax error.
+func IsError(code int) bool {
+	return code >= 8000 && code < 10000
+}
+
+// Client is a connection to the BIRD control socket. Commands are run one
+// at a time, so a Client is safe to use from multiple goroutines.
+type Client struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	r       *bufio.Reader
+	version string
+}
+
+// Dial connects to the BIRD control socket at path.
+func Dial(path string) (*Client, error) {
+	return DialContext(context.Background(), path)
+}
+
+// DialContext connects to the BIRD control socket at path, giving up once
+// ctx is done. ctx only applies to connecting and reading the welcome.
+func DialContext(ctx context.Context, path string) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	stop := interrupt(ctx, conn)
+	c, err := NewClient(conn)
+	if !stop() && err != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// interrupt unblocks any read or write on conn once ctx is done. The
+// returned function stops that, and returns false if it already happened.
+func interrupt(ctx context.Context, conn net.Conn) func() bool {
+	return context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+}
+
+// NewClient returns a Client on an existing connection. BIRD sends a welcome
+// message as soon as a client connects, which is read before returning.
+func NewClient(conn net.Conn) (*Client, error) {
+	c := &Client{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+	}
+	lines, err := c.read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read welcome: %w", err)
+	}
+	if len(lines) != 1 || lines[0].Code != CodeWelcome {
+		return nil, fmt.Errorf("unexpected welcome: %v", lines)
+	}
+	c.version = strings.TrimSuffix(lines[0].Text, " ready.")
+
+	return c, nil
+}
+
+// Version returns the version BIRD sent when connecting, i.e. "BIRD 2.0.12"
+func (c *Client) Version() string {
+	return c.version
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Command runs a single command and returns every line of the reply. If
+// BIRD returns an error, it's returned as an *Error.
+func (c *Client) Command(cmd string) ([]Line, error) {
+	return c.CommandContext(context.Background(), cmd)
+}
+
+// CommandContext is Command, but gives up once ctx is done. The rest of the
+// reply can't be told apart from the next one, so the connection is closed
+// when that happens.
+func (c *Client) CommandContext(ctx context.Context, cmd string) ([]Line, error) {
+	if strings.ContainsAny(cmd, "\r\n") {
+		return nil, fmt.Errorf("command must be a single line: %q", cmd)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	stop := interrupt(ctx, c.conn)
+	lines, err := c.command(cmd)
+	if !stop() {
+		c.conn.Close()
+		if err != nil {
+			return nil, fmt.Errorf("command %q interrupted: %w", cmd, ctx.Err())
+		}
+	}
+
+	return lines, err
+}
+
+func (c *Client) command(cmd string) ([]Line, error) {
+	if _, err := fmt.Fprintf(c.conn, "%s\n", cmd); err != nil {
+		return nil, fmt.Errorf("unable to send command: %w", err)
+	}
+
+	return c.read()
+}
+
+// read reads a full reply. Empty lines with the OK code carry no information
+// so are not returned.
+func (c *Client) read() ([]Line, error) {
+	var lines []Line
+	var birdErr *Error
+	code := -1
+	for {
+		raw, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("unable to read reply: %w", err)
+		}
+		raw = strings.TrimSuffix(raw, "\n")
+
+		var last bool
+		text := raw
+		switch {
+		case strings.HasPrefix(raw, " ") && code != -1:
+			text = raw[1:]
+		case len(raw) >= 5 && (raw[4] == ' ' || raw[4] == '-'):
+			n, err := strconv.Atoi(raw[:4])
+			if err != nil {
+				return nil, fmt.Errorf("invalid reply code in %q", raw)
+			}
+			code = n
+			last = raw[4] == ' '
+			text = raw[5:]
+		case len(raw) == 4:
+			// The final OK line can come without any trailing space.
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid reply code in %q", raw)
+			}
+			code = n
+			last = true
+			text = ""
+		default:
+			return nil, fmt.Errorf("invalid reply line %q", raw)
+		}
+
+		// The rest of the reply is still read after an error, otherwise
+		// it would be returned as the reply to the next command.
+		switch {
+		case IsError(code):
+			if birdErr == nil {
+				birdErr = &Error{Code: code, Msg: text}
+			}
+		case code != CodeOK || text != "":
+			lines = append(lines, Line{Code: code, Text: text})
+		}
+		if last {
+			break
+		}
+	}
+	if birdErr != nil {
+		return nil, birdErr
+	}
+
+	return lines, nil
+}
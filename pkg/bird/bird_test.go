@@ -0,0 +1,191 @@
+package bird
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/bird/birdtest"
+)
+
+func TestCommand(t *testing.T) {
+	srv, err := birdtest.NewServer(map[string]string{
+		"show status": "1000-BIRD 2.0.12\n" +
+			"1011-Router ID is 192.0.2.254\n" +
+			" Hostname is rtr1\n" +
+			"0013 Daemon is up and running\n",
+		"show route count": "1007-6 of 6 routes for 4 networks in table master4\n" +
+			" 2 of 2 routes for 2 networks in table master6\n" +
+			"0014 Total: 8 of 8 routes for 6 networks in 2 tables\n",
+		"show route for 192.0.2.1": "8001 Network not found\n",
+		"show route for 198.51.100.1": "1007-Table master4:\n" +
+			"8003-No protocols match\n" +
+			"0000 \n",
+		"configure check": "0020 Configuration OK\n",
+		"show memory": "1018-BIRD memory usage\n" +
+			"0000\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	c, err := Dial(srv.Socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if got, want := c.Version(), "BIRD 2.0.12"; got != want {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+
+	tests := []struct {
+		desc    string
+		cmd     string
+		want    []Line
+		wantErr int
+	}{
+		{
+			desc: "continuation lines keep the previous code",
+			cmd:  "show status",
+			want: []Line{
+				{Code: 1000, Text: "BIRD 2.0.12"},
+				{Code: 1011, Text: "Router ID is 192.0.2.254"},
+				{Code: 1011, Text: "Hostname is rtr1"},
+				{Code: 13, Text: "Daemon is up and running"},
+			},
+		},
+		{
+			desc: "continuation lines that look like a code",
+			cmd:  "show route count",
+			want: []Line{
+				{Code: 1007, Text: "6 of 6 routes for 4 networks in table master4"},
+				{Code: 1007, Text: "2 of 2 routes for 2 networks in table master6"},
+				{Code: 14, Text: "Total: 8 of 8 routes for 6 networks in 2 tables"},
+			},
+		},
+		{
+			desc: "single line reply",
+			cmd:  "configure check",
+			want: []Line{{Code: 20, Text: "Configuration OK"}},
+		},
+		{
+			desc: "final line without a trailing space",
+			cmd:  "show memory",
+			want: []Line{{Code: 1018, Text: "BIRD memory usage"}},
+		},
+		{
+			desc:    "runtime error",
+			cmd:     "show route for 192.0.2.1",
+			wantErr: CodeNetworkNotFound,
+		},
+		{
+			desc:    "runtime error in the middle of a reply",
+			cmd:     "show route for 198.51.100.1",
+			wantErr: 8003,
+		},
+		{
+			desc:    "syntax error",
+			cmd:     "show rout",
+			wantErr: 9001,
+		},
+	}
+
+	// All commands share one connection, so this also checks that every
+	// reply is read in full.
+	for _, tc := range tests {
+		got, err := c.Command(tc.cmd)
+		if tc.wantErr != 0 {
+			var birdErr *Error
+			if !errors.As(err, &birdErr) || birdErr.Code != tc.wantErr {
+				t.Errorf("%s: got error %v, wanted code %d", tc.desc, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.desc, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: Got %v, Wanted %v", tc.desc, got, tc.want)
+		}
+	}
+
+	if _, err := c.Command("show status\nshow route"); err == nil {
+		t.Error("expected error on a multi line command")
+	}
+}
+
+func TestBadReplies(t *testing.T) {
+	tests := []struct {
+		desc  string
+		reply string
+	}{
+		{
+			desc:  "no reply code",
+			reply: "BIRD 2.0.12 ready.\n",
+		},
+		{
+			desc:  "continuation line first",
+			reply: " BIRD 2.0.12 ready.\n",
+		},
+		{
+			desc:  "wrong welcome",
+			reply: "0013 Daemon is up and running\n",
+		},
+		{
+			desc:  "connection closed mid reply",
+			reply: "0001-BIRD 2.0.12 ready.\n",
+		},
+	}
+
+	for _, tc := range tests {
+		server, client := net.Pipe()
+		go func() {
+			server.Write([]byte(tc.reply))
+			server.Close()
+		}()
+		if _, err := NewClient(client); err == nil {
+			t.Errorf("%s: expected error", tc.desc)
+		}
+		client.Close()
+	}
+}
+
+func TestCommandContext(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	go func() {
+		// Welcome the client, then never reply to its command.
+		server.Write([]byte("0001 BIRD 2.0.12 ready.\n"))
+		bufio.NewReader(server).ReadString('\n')
+	}()
+
+	c, err := NewClient(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.CommandContext(ctx, "show status"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Got %v, Wanted %v", err, context.Canceled)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := c.CommandContext(ctx, "show status"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Got %v, Wanted %v", err, context.DeadlineExceeded)
+	}
+
+	// The reply may still arrive, so the connection can't be used again.
+	if _, err := c.Command("show status"); err == nil {
+		t.Error("expected error on an interrupted connection")
+	}
+}
@@ -0,0 +1,124 @@
+// Package birdtest provides a fake BIRD control socket for tests.
+package birdtest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Welcome is the message sent to every new connection.
+const Welcome = "0001 BIRD 2.0.12 ready.\n"
+
+// Server is a fake BIRD listening on a Unix socket. Each command received
+// is answered with the matching raw reply, including reply codes. Unknown
+// commands are answered with a syntax error, the same as BIRD.
+type Server struct {
+	// Socket is the path to connect to.
+	Socket string
+
+	dir      string
+	listener net.Listener
+	replies  map[string]string
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	commands []string
+	conns    map[net.Conn]bool
+}
+
+// NewServer starts a Server answering with replies, keyed by command.
+func NewServer(replies map[string]string) (*Server, error) {
+	dir, err := os.MkdirTemp("", "birdtest")
+	if err != nil {
+		return nil, err
+	}
+	socket := filepath.Join(dir, "bird.ctl")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	s := &Server{
+		Socket:   socket,
+		dir:      dir,
+		listener: l,
+		replies:  replies,
+		conns:    make(map[net.Conn]bool),
+	}
+	s.wg.Add(1)
+	go s.serve()
+
+	return s, nil
+}
+
+// Commands returns every command received so far, in order.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Close stops the server, closing any open connections, and removes the
+// socket.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	os.RemoveAll(s.dir)
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	if _, err := fmt.Fprint(conn, Welcome); err != nil {
+		return
+	}
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		cmd := strings.TrimSpace(scanner.Text())
+		s.mu.Lock()
+		s.commands = append(s.commands, cmd)
+		s.mu.Unlock()
+
+		reply, ok := s.replies[cmd]
+		if !ok {
+			reply = "9001 syntax error, unexpected CF_SYM_UNDEFINED\n"
+		}
+		if _, err := fmt.Fprint(conn, reply); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,444 @@
+// Package bogon classifies routes that shouldn't be in the global table.
+//
+// Address space is checked against local copies of the IANA special-purpose
+// registries and the RIR delegated stats files. Origin ASNs are checked
+// against the IANA special-purpose AS numbers registry.
+//
+// The IANA registries are the CSV files published at
+// https://www.iana.org/assignments/iana-ipv4-special-registry,
+// https://www.iana.org/assignments/iana-ipv6-special-registry and
+// https://www.iana.org/assignments/iana-as-numbers-special-registry.
+// The RIR files are the delegated-<rir>-extended-latest files published by
+// each RIR, as described in
+// https://www.apnic.net/about-apnic/corporate-documents/documents/resource-guidelines/rir-statistics-exchange-format/
+package bogon
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Kind is the reason a route is a bogon.
+type Kind int
+
+const (
+	// None is a route that isn't a bogon.
+	None Kind = iota
+	// Martian is a route covering special-purpose space that isn't
+	// globally reachable, i.e. RFC1918 or documentation prefixes.
+	Martian
+	// Unallocated is a route covering space that no RIR has allocated
+	// or assigned.
+	Unallocated
+	// ReservedASN is a route originated by a special-purpose ASN, i.e. a
+	// private or documentation ASN.
+	ReservedASN
+)
+
+// String returns the name of the kind as stored in the database.
+func (k Kind) String() string {
+	switch k {
+	case None:
+		return "none"
+	case Martian:
+		return "martian"
+	case Unallocated:
+		return "unallocated"
+	case ReservedASN:
+		return "reserved_asn"
+	}
+	return fmt.Sprintf("kind(%d)", int(k))
+}
+
+// ParseKind returns the Kind named by s, as returned by Kind.String.
+func ParseKind(s string) (Kind, error) {
+	for k := None; k <= ReservedASN; k++ {
+		if k.String() == s {
+			return k, nil
+		}
+	}
+	return None, fmt.Errorf("unknown bogon kind: %q", s)
+}
+
+// special is a block from the IANA special-purpose address registries.
+type special struct {
+	prefix    netip.Prefix
+	reachable bool
+}
+
+// addrRange is an inclusive range of addresses.
+type addrRange struct {
+	from, to netip.Addr
+}
+
+// asRange is an inclusive range of AS numbers.
+type asRange struct {
+	from, to uint32
+}
+
+// Engine classifies routes. The zero value knows nothing, so classifies
+// nothing as a bogon. Load it with the registries, then don't modify it
+// while it's being used.
+type Engine struct {
+	special  []special
+	reserved []asRange
+
+	// Allocated space for each family, sorted and merged. A family with
+	// no delegated stats loaded is never classified as unallocated.
+	allocated4, allocated6 []addrRange
+}
+
+// Load returns an Engine loaded from the IANA registry and RIR delegated
+// stats files at the given paths.
+func Load(registries, delegated []string) (*Engine, error) {
+	var e Engine
+	for _, name := range registries {
+		if err := loadFile(name, e.LoadRegistry); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range delegated {
+		if err := loadFile(name, e.LoadDelegated); err != nil {
+			return nil, err
+		}
+	}
+
+	return &e, nil
+}
+
+// loadFile opens name and passes it to load.
+func loadFile(name string, load func(io.Reader) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := load(f); err != nil {
+		return fmt.Errorf("unable to load %s: %w", name, err)
+	}
+	return nil
+}
+
+// LoadRegistry adds an IANA special-purpose registry in CSV form. The
+// registry is recognised from its header, so the IPv4, IPv6 and AS number
+// registries can all be loaded through here.
+func (e *Engine) LoadRegistry(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("unable to read registry header: %w", err)
+	}
+	cols := make(map[string]int)
+	for i, h := range header {
+		cols[strings.TrimSpace(h)] = i
+	}
+
+	var add func([]string) error
+	switch {
+	case hasColumns(cols, "Address Block", "Globally Reachable"):
+		add = func(rec []string) error {
+			return e.addSpecial(rec[cols["Address Block"]], rec[cols["Globally Reachable"]])
+		}
+	case hasColumns(cols, "AS Number"):
+		add = func(rec []string) error {
+			return e.addReserved(rec[cols["AS Number"]])
+		}
+	default:
+		return fmt.Errorf("unknown registry with header %q", header)
+	}
+
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(rec) != len(header) {
+			return fmt.Errorf("registry record %q doesn't match header", rec)
+		}
+		if err := add(rec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasColumns reports whether all names are in cols.
+func hasColumns(cols map[string]int, names ...string) bool {
+	for _, n := range names {
+		if _, ok := cols[n]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// stripFootnote removes the trailing footnote references IANA adds to some
+// fields, i.e. "192.0.0.0/24 [2]" or "False [1]".
+func stripFootnote(s string) string {
+	if i := strings.Index(s, "["); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// addSpecial adds the comma separated blocks of a single registry entry.
+// Only entries marked globally reachable are allowed in the table. N/A is
+// used for deprecated entries, which are treated as reachable.
+func (e *Engine) addSpecial(blocks, reachable string) error {
+	r := !strings.EqualFold(stripFootnote(reachable), "false")
+	for _, b := range strings.Split(blocks, ",") {
+		p, err := netip.ParsePrefix(stripFootnote(b))
+		if err != nil {
+			return fmt.Errorf("invalid address block %q: %w", b, err)
+		}
+		e.special = append(e.special, special{prefix: p.Masked(), reachable: r})
+	}
+	return nil
+}
+
+// as112 is in the special-purpose registry, but is announced in the global
+// table to sink misdirected DNS queries. See RFC7534.
+const as112 = 112
+
+// addReserved adds a single AS number, or a range such as 64512-65534.
+// AS112 is skipped.
+func (e *Engine) addReserved(asns string) error {
+	from, to, isRange := strings.Cut(stripFootnote(asns), "-")
+	if !isRange {
+		to = from
+	}
+	f, err := strconv.ParseUint(from, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid AS number %q: %w", asns, err)
+	}
+	t, err := strconv.ParseUint(to, 10, 32)
+	if err != nil || t < f {
+		return fmt.Errorf("invalid AS number range %q", asns)
+	}
+	if f == as112 && t == as112 {
+		return nil
+	}
+	e.reserved = append(e.reserved, asRange{uint32(f), uint32(t)})
+	return nil
+}
+
+// LoadDelegated adds the allocated and assigned space of an RIR delegated
+// stats file. Records are registry|cc|type|start|value|date|status, where
+// value is the amount of addresses for IPv4 and the prefix length for IPv6.
+// The version line, summary lines and ASN records are skipped.
+func (e *Engine) LoadDelegated(r io.Reader) error {
+	var v4, v6 []addrRange
+	scanner := bufio.NewScanner(r)
+	var n int
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "|")
+		// The version line starts with the format version, i.e. 2.3
+		if _, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			continue
+		}
+		if len(fields) == 6 && fields[5] == "summary" {
+			continue
+		}
+		if len(fields) < 7 {
+			return fmt.Errorf("line %d: expected at least 7 fields, got %d", n, len(fields))
+		}
+		if status := fields[6]; status != "allocated" && status != "assigned" {
+			continue
+		}
+
+		switch fields[2] {
+		case "ipv4":
+			rng, err := delegated4(fields[3], fields[4])
+			if err != nil {
+				return fmt.Errorf("line %d: %w", n, err)
+			}
+			v4 = append(v4, rng)
+		case "ipv6":
+			rng, err := delegated6(fields[3], fields[4])
+			if err != nil {
+				return fmt.Errorf("line %d: %w", n, err)
+			}
+			v6 = append(v6, rng)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	e.allocated4 = merge(append(e.allocated4, v4...))
+	e.allocated6 = merge(append(e.allocated6, v6...))
+	return nil
+}
+
+// delegated4 returns the range of an IPv4 record, which isn't always a
+// power of two.
+func delegated4(start, value string) (addrRange, error) {
+	from, err := netip.ParseAddr(start)
+	if err != nil || !from.Is4() {
+		return addrRange{}, fmt.Errorf("invalid IPv4 start %q", start)
+	}
+	count, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || count == 0 {
+		return addrRange{}, fmt.Errorf("invalid IPv4 count %q", value)
+	}
+	b := from.As4()
+	first := uint64(b[0])<<24 | uint64(b[1])<<16 | uint64(b[2])<<8 | uint64(b[3])
+	last := first + count - 1
+	if last > 0xffffffff {
+		return addrRange{}, fmt.Errorf("IPv4 range %s+%d overflows", start, count)
+	}
+	to := netip.AddrFrom4([4]byte{byte(last >> 24), byte(last >> 16), byte(last >> 8), byte(last)})
+	return addrRange{from, to}, nil
+}
+
+// delegated6 returns the range of an IPv6 record.
+func delegated6(start, value string) (addrRange, error) {
+	p, err := netip.ParsePrefix(start + "/" + value)
+	if err != nil || !p.Addr().Is6() {
+		return addrRange{}, fmt.Errorf("invalid IPv6 prefix %s/%s", start, value)
+	}
+	return prefixRange(p.Masked()), nil
+}
+
+// prefixRange returns the first and last address of p.
+func prefixRange(p netip.Prefix) addrRange {
+	from := p.Masked().Addr()
+	b := from.As16()
+	host := from.BitLen() - p.Bits()
+	// IPv4 addresses are the last four bytes of As16.
+	for i := 15; host > 0; i-- {
+		n := min(host, 8)
+		b[i] |= byte(1<<n - 1)
+		host -= n
+	}
+	to := netip.AddrFrom16(b)
+	if from.Is4() {
+		to = to.Unmap()
+	}
+	return addrRange{from, to}
+}
+
+// merge sorts ranges and joins those that overlap or are adjacent.
+func merge(ranges []addrRange) []addrRange {
+	slices.SortFunc(ranges, func(a, b addrRange) int {
+		return a.from.Compare(b.from)
+	})
+	var merged []addrRange
+	for _, r := range ranges {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			next := last.to.Next()
+			if r.from.Compare(last.to) <= 0 || (next.IsValid() && r.from == next) {
+				if r.to.Compare(last.to) > 0 {
+					last.to = r.to
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// covered reports whether all of r is inside a single range of ranges,
+// which must be sorted and merged.
+func covered(ranges []addrRange, r addrRange) bool {
+	// Find the last range starting at or before r.
+	i, found := slices.BinarySearchFunc(ranges, r.from, func(a addrRange, t netip.Addr) int {
+		return a.from.Compare(t)
+	})
+	if !found {
+		i--
+	}
+	if i < 0 {
+		return false
+	}
+	return ranges[i].to.Compare(r.to) >= 0
+}
+
+// Classify returns why a route for prefix with the given AS path is a bogon,
+// or None. Martians are checked first, then unallocated space, then the
+// origin ASN. A prefix is a martian if its most specific special-purpose
+// block isn't globally reachable, or if it covers any block that isn't.
+// Globally reachable special-purpose space is assigned by IANA rather than
+// an RIR, so is never unallocated. An empty path, i.e. a locally
+// originated route, has no origin to check.
+func (e *Engine) Classify(prefix netip.Prefix, path []uint32) Kind {
+	prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()).Masked()
+	if e.leaks(prefix) {
+		return Martian
+	}
+	s, isSpecial := e.specialBlock(prefix)
+	if isSpecial && !s.reachable {
+		return Martian
+	}
+
+	allocated := e.allocated4
+	if prefix.Addr().Is6() {
+		allocated = e.allocated6
+	}
+	if !isSpecial && len(allocated) > 0 && !covered(allocated, prefixRange(prefix)) {
+		return Unallocated
+	}
+
+	if len(path) > 0 && e.Reserved(path[len(path)-1]) {
+		return ReservedASN
+	}
+
+	return None
+}
+
+// specialBlock returns the most specific special-purpose block that
+// contains prefix.
+func (e *Engine) specialBlock(prefix netip.Prefix) (special, bool) {
+	var best special
+	var found bool
+	for _, s := range e.special {
+		if s.prefix.Bits() > prefix.Bits() || !s.prefix.Contains(prefix.Addr()) {
+			continue
+		}
+		if !found || s.prefix.Bits() > best.prefix.Bits() {
+			best, found = s, true
+		}
+	}
+	return best, found
+}
+
+// leaks reports whether prefix covers a special-purpose block that isn't
+// globally reachable, i.e. 0.0.0.0/0 or 192.0.0.0/8.
+func (e *Engine) leaks(prefix netip.Prefix) bool {
+	for _, s := range e.special {
+		if !s.reachable && prefix.Bits() < s.prefix.Bits() && prefix.Contains(s.prefix.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reserved reports whether asn is a special-purpose AS number.
+func (e *Engine) Reserved(asn uint32) bool {
+	for _, r := range e.reserved {
+		if asn >= r.from && asn <= r.to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package bogon
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func loadTest(t *testing.T) *Engine {
+	t.Helper()
+	e, err := Load(
+		[]string{
+			"testdata/iana-ipv4-special-registry-1.csv",
+			"testdata/iana-ipv6-special-registry-1.csv",
+			"testdata/special-purpose-as-numbers.csv",
+		},
+		[]string{"testdata/delegated-test-extended-latest"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestClassify(t *testing.T) {
+	e := loadTest(t)
+
+	tests := []struct {
+		prefix string
+		path   []uint32
+		want   Kind
+	}{
+		{prefix: "1.1.1.0/24", path: []uint32{3356, 13335}, want: None},
+		// Adjacent delegations are merged.
+		{prefix: "8.0.0.0/8", path: []uint32{3356}, want: None},
+		{prefix: "8.8.8.0/24", path: []uint32{3356, 15169}, want: None},
+		{prefix: "10.0.0.0/8", path: []uint32{64512}, want: Martian},
+		{prefix: "10.1.0.0/16", want: Martian},
+		{prefix: "0.0.0.0/0", want: Martian},
+		{prefix: "192.0.0.0/8", want: Martian},
+		{prefix: "192.0.0.0/24", want: Martian},
+		{prefix: "192.0.0.170/32", want: Martian},
+		{prefix: "255.255.255.255/32", want: Martian},
+		// A globally reachable block inside one that isn't.
+		{prefix: "192.0.0.9/32", want: None},
+		// IANA assigns AS112 space, not an RIR.
+		{prefix: "192.31.196.0/24", path: []uint32{112}, want: None},
+		// Deprecated entries are N/A.
+		{prefix: "192.88.99.0/24", want: None},
+		// 9.0.0.0/8 is only available.
+		{prefix: "9.9.9.0/24", path: []uint32{19281}, want: Unallocated},
+		// Only 185.0.0.0 - 185.0.2.255 is allocated.
+		{prefix: "185.0.2.0/24", want: None},
+		{prefix: "185.0.2.0/23", want: Unallocated},
+		{prefix: "1.1.1.0/24", path: []uint32{3356, 64512}, want: ReservedASN},
+		{prefix: "1.1.1.0/24", path: []uint32{4200000000}, want: ReservedASN},
+		{prefix: "1.1.1.0/24", path: []uint32{23456}, want: ReservedASN},
+		// Only the origin is checked.
+		{prefix: "1.1.1.0/24", path: []uint32{64512, 13335}, want: None},
+		{prefix: "2001:4860::/32", path: []uint32{6939, 15169}, want: None},
+		{prefix: "2001:4860:4860::/48", want: None},
+		{prefix: "2001:db8::/32", path: []uint32{6939, 64496}, want: Martian},
+		// Teredo is inside IETF Protocol Assignments.
+		{prefix: "2001::/32", want: Martian},
+		{prefix: "fc00::/7", want: Martian},
+		{prefix: "::/0", want: Martian},
+		{prefix: "2002::/16", want: None},
+		{prefix: "2606:4700::/32", path: []uint32{6939, 13335}, want: Unallocated},
+		{prefix: "2a00::/12", want: Unallocated},
+	}
+	for _, tc := range tests {
+		got := e.Classify(netip.MustParsePrefix(tc.prefix), tc.path)
+		if got != tc.want {
+			t.Errorf("%s %v: Got %v, Wanted %v", tc.prefix, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestClassifyEmpty(t *testing.T) {
+	// Nothing is a bogon until the registries are loaded.
+	var e Engine
+	for _, p := range []string{"10.0.0.0/8", "9.9.9.0/24", "2001:db8::/32"} {
+		if got := e.Classify(netip.MustParsePrefix(p), []uint32{64512}); got != None {
+			t.Errorf("%s: Got %v, Wanted %v", p, got, None)
+		}
+	}
+}
+
+func TestClassifyMapped(t *testing.T) {
+	e := loadTest(t)
+	p := netip.PrefixFrom(netip.MustParseAddr("::ffff:10.0.0.0"), 8)
+	if got := e.Classify(p, nil); got != Martian {
+		t.Errorf("Got %v, Wanted %v", got, Martian)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		registry  string
+		delegated string
+	}{
+		{name: "Unknown registry", registry: "Name,Value\nfoo,bar\n"},
+		{name: "Bad block", registry: "Address Block,Globally Reachable\n10.0.0.0/33,False\n"},
+		{name: "Bad ASN range", registry: "AS Number,Reason for Reservation\n65535-64512,Backwards\n"},
+		{name: "Short record", delegated: "2.3|test|20261016|9|19700101|20261016|+0000\ntest|AU|ipv4\n"},
+		{name: "Bad IPv4 count", delegated: "test|AU|ipv4|1.1.1.0|0|20110811|assigned\n"},
+		{name: "IPv4 overflow", delegated: "test|AU|ipv4|255.255.255.0|512|20110811|assigned\n"},
+		{name: "Bad IPv6 prefix", delegated: "test|AU|ipv6|1.1.1.0|32|20110811|assigned\n"},
+	}
+	for _, tc := range tests {
+		var e Engine
+		var err error
+		if tc.registry != "" {
+			err = e.LoadRegistry(strings.NewReader(tc.registry))
+		} else {
+			err = e.LoadDelegated(strings.NewReader(tc.delegated))
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+
+	if _, err := Load([]string{"testdata/missing.csv"}, nil); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestParseKind(t *testing.T) {
+	for _, k := range []Kind{None, Martian, Unallocated, ReservedASN} {
+		got, err := ParseKind(k.String())
+		if err != nil || got != k {
+			t.Errorf("Got %v, %v, Wanted %v", got, err, k)
+		}
+	}
+	if _, err := ParseKind("cheese"); err == nil {
+		t.Error("expected an error")
+	}
+}
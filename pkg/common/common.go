@@ -1,6 +1,8 @@
 package common
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -42,24 +44,136 @@ type BgpUpdate struct {
 	MemProto6, MemAttr6                 string
 	Roavalid4, Roainvalid4, Roaunknown4 uint32
 	Roavalid6, Roainvalid6, Roaunknown6 uint32
-	V4_23, V4_22, V4_21, V4_20, V4_19   uint32
-	V4_18, V4_17, V4_16, V4_15, V4_14   uint32
-	V4_13, V4_12, V4_11, V4_10, V4_09   uint32
-	V4_08, V6_48, V6_47, V6_46, V6_45   uint32
-	V6_44, V6_43, V6_42, V6_41, V6_40   uint32
-	V6_39, V6_38, V6_37, V6_36, V6_35   uint32
-	V6_34, V6_33, V6_32, V6_31, V6_30   uint32
-	V6_29, V6_28, V6_27, V6_26, V6_25   uint32
-	V6_24, V6_23, V6_22, V6_21, V6_20   uint32
-	V6_19, V6_18, V6_17, V6_16, V6_15   uint32
-	V6_14, V6_13, V6_12, V6_11, V6_10   uint32
-	V6_09, V6_08, V4_24                 uint32
+	Aspavalid4, Aspavalid6              uint32
+	Aspainvalid4, Aspainvalid6          uint32
+	Aspaunknown4, Aspaunknown6          uint32
+	Masks4, Masks6                      map[uint32]uint32
+	Paths4, Paths6                      PathStats
+	Communities4, Communities6          CommunityUse
+	PeerDetails                         []PeerDetail
+	Bogons4, Bogons6                    BogonCount
+	Bogons                              []Bogon
+	OriginEvents                        []OriginEvent
+}
+
+// BogonCount holds the amount of routes of each bogon kind in one address family.
+type BogonCount struct {
+	Martian, Unallocated, ReservedASN uint32
+}
+
+// Bogon is a route that shouldn't be in the table. Kind is martian,
+// unallocated or reserved_asn.
+type Bogon struct {
+	Prefix string
+	Origin uint32
+	Kind   string
+}
+
+// OriginEvent is a possible hijack seen between two updates. Kind is moas,
+// sub_prefix or origin_change. Times are unix times.
+type OriginEvent struct {
+	Kind, Prefix         string
+	OldOrigin, NewOrigin uint32
+	FirstSeen, LastSeen  uint64
+}
+
+// PeerDetail holds the state of a single peer. Received and Accepted are
+// prefixes before and after import policy.
+type PeerDetail struct {
+	Address                string
+	ASN                    uint32
+	State                  string
+	Uptime                 time.Duration
+	V4Received, V4Accepted uint32
+	V6Received, V6Accepted uint32
+}
+
+// PathStats holds the AS path length distribution of one address family.
+// Lengths counts prepends, Unique doesn't.
+type PathStats struct {
+	Lengths, Unique map[uint32]uint32
+	Prepended, Sets uint32
+}
+
+// CommunityUse holds the community usage of one address family. Top is the
+// most used communities, most used first.
+type CommunityUse struct {
+	Standard, Extended, Large uint32
+	Top                       []CommunityCount
+	WellKnown                 WellKnown
+}
+
+// CommunityCount is the amount of prefixes carrying a community.
+type CommunityCount struct {
+	Community string
+	Prefixes  uint32
+}
+
+// WellKnown holds the amount of prefixes carrying each well-known community.
+type WellKnown struct {
+	NoExport, NoAdvertise, NoExportSubconfed uint32
+	Blackhole, GracefulShutdown              uint32
+}
+
+// TimeoutError is returned when an operation is abandoned because its
+// context deadline has passed.
+type TimeoutError struct {
+	// Op is what timed out, i.e. the command being run.
+	Op  string
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s: timed out: %v", e.Op, e.Err)
+}
+
+// Unwrap returns the context error, so errors.Is(err, context.DeadlineExceeded) works.
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout is always true. It matches the net.Error interface.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// ContextError returns the error for op being interrupted by a context that
+// returned err. A passed deadline is returned as a *TimeoutError.
+func ContextError(op string, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &TimeoutError{Op: op, Err: err}
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// waitDelay is how long a killed command's output is waited on. Children of
+// the command can keep its output open after it's killed.
+const waitDelay = time.Second
+
+// CommandOutput runs a command and returns its standard output. The command,
+// and any children it started, are killed once ctx is done.
+func CommandOutput(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	killGroup(cmd)
+	cmd.WaitDelay = waitDelay
+
+	out, err := cmd.Output()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return out, ContextError(cmd.String(), ctxErr)
+	}
+
+	return out, err
 }
 
 // GetOutput is a helper function to run commands and return outputs to other functions.
 func GetOutput(cmd string) (string, error) {
+	return GetOutputContext(context.Background(), cmd)
+}
+
+// GetOutputContext is GetOutput, but kills the command once ctx is done.
+func GetOutputContext(ctx context.Context, cmd string) (string, error) {
 	log.Printf("Running getOutput with cmd %s\n", cmd)
-	cmdOut, err := exec.Command("bash", "-c", cmd).Output()
+	cmdOut, err := CommandOutput(ctx, "bash", "-c", cmd)
 	if err != nil {
 		return string(cmdOut), err
 	}
@@ -67,8 +181,19 @@ func GetOutput(cmd string) (string, error) {
 	return strings.TrimSuffix(string(cmdOut), "\n"), err
 }
 
+// ParseUint32 converts a decimal string to a uint32. Unlike StringToUint32,
+// anything other than a plain number is an error rather than 0.
+func ParseUint32(s string) (uint32, error) {
+	val, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid uint32 %q: %w", s, err)
+	}
+	return uint32(val), nil
+}
+
 // StringToUint32 is a helper function as many times I need to do this conversion.
-// TODO: I really should be returning an error here...
+// Non-digits are stripped and anything invalid is 0. Use ParseUint32 when
+// bad input needs to be an error.
 func StringToUint32(s string) uint32 {
 	reg := regexp.MustCompile("[^0-9]+")
 	c := reg.ReplaceAllString(s, "")
@@ -303,7 +428,7 @@ func ProtoToStruct(v *pb.Values) *BgpUpdate {
 	// format needs to be adjusted a bit to insert into the
 	// database later.
 	as := v.GetAsCount()
-	mask := v.GetMasks()
+	masks4, masks6 := ProtoToMasks(v.GetMasks())
 	p := v.GetPrefixCount()
 	roa := v.GetRoas()
 	update := &BgpUpdate{
@@ -330,72 +455,175 @@ func ProtoToStruct(v *pb.Values) *BgpUpdate {
 		Roavalid6:        roa.GetV6Valid(),
 		Roainvalid6:      roa.GetV6Invalid(),
 		Roaunknown6:      roa.GetV6Unknown(),
-		V4_08:            mask.GetV4_08(),
-		V4_09:            mask.GetV4_09(),
-		V4_10:            mask.GetV4_10(),
-		V4_11:            mask.GetV4_11(),
-		V4_12:            mask.GetV4_12(),
-		V4_13:            mask.GetV4_13(),
-		V4_14:            mask.GetV4_14(),
-		V4_15:            mask.GetV4_15(),
-		V4_16:            mask.GetV4_16(),
-		V4_17:            mask.GetV4_17(),
-		V4_18:            mask.GetV4_18(),
-		V4_19:            mask.GetV4_19(),
-		V4_20:            mask.GetV4_20(),
-		V4_21:            mask.GetV4_21(),
-		V4_22:            mask.GetV4_22(),
-		V4_23:            mask.GetV4_23(),
-		V4_24:            mask.GetV4_24(),
-		V6_08:            mask.GetV6_08(),
-		V6_09:            mask.GetV6_09(),
-		V6_10:            mask.GetV6_10(),
-		V6_11:            mask.GetV6_11(),
-		V6_12:            mask.GetV6_12(),
-		V6_13:            mask.GetV6_13(),
-		V6_14:            mask.GetV6_14(),
-		V6_15:            mask.GetV6_15(),
-		V6_16:            mask.GetV6_16(),
-		V6_17:            mask.GetV6_17(),
-		V6_18:            mask.GetV6_18(),
-		V6_19:            mask.GetV6_19(),
-		V6_20:            mask.GetV6_20(),
-		V6_21:            mask.GetV6_21(),
-		V6_22:            mask.GetV6_22(),
-		V6_23:            mask.GetV6_23(),
-		V6_24:            mask.GetV6_24(),
-		V6_25:            mask.GetV6_25(),
-		V6_26:            mask.GetV6_26(),
-		V6_27:            mask.GetV6_27(),
-		V6_28:            mask.GetV6_28(),
-		V6_29:            mask.GetV6_29(),
-		V6_30:            mask.GetV6_30(),
-		V6_31:            mask.GetV6_31(),
-		V6_32:            mask.GetV6_32(),
-		V6_33:            mask.GetV6_33(),
-		V6_34:            mask.GetV6_34(),
-		V6_35:            mask.GetV6_35(),
-		V6_36:            mask.GetV6_36(),
-		V6_37:            mask.GetV6_37(),
-		V6_38:            mask.GetV6_38(),
-		V6_39:            mask.GetV6_39(),
-		V6_40:            mask.GetV6_40(),
-		V6_41:            mask.GetV6_41(),
-		V6_42:            mask.GetV6_42(),
-		V6_43:            mask.GetV6_43(),
-		V6_44:            mask.GetV6_44(),
-		V6_45:            mask.GetV6_45(),
-		V6_46:            mask.GetV6_46(),
-		V6_47:            mask.GetV6_47(),
-		V6_48:            mask.GetV6_48(),
+		Aspavalid4:       v.GetAspas().GetV4Valid(),
+		Aspainvalid4:     v.GetAspas().GetV4Invalid(),
+		Aspaunknown4:     v.GetAspas().GetV4Unknown(),
+		Aspavalid6:       v.GetAspas().GetV6Valid(),
+		Aspainvalid6:     v.GetAspas().GetV6Invalid(),
+		Aspaunknown6:     v.GetAspas().GetV6Unknown(),
+		Masks4:           masks4,
+		Masks6:           masks6,
+		Paths4:           protoToPathStats(v.GetAsPaths().GetV4()),
+		Paths6:           protoToPathStats(v.GetAsPaths().GetV6()),
+		Communities4:     protoToCommunityUse(v.GetCommunities().GetV4()),
+		Communities6:     protoToCommunityUse(v.GetCommunities().GetV6()),
+	}
+	for _, p := range v.GetPeerDetails() {
+		update.PeerDetails = append(update.PeerDetails, ProtoToPeerDetail(p))
+	}
+	update.Bogons4 = protoToBogonCount(v.GetBogons().GetV4())
+	update.Bogons6 = protoToBogonCount(v.GetBogons().GetV6())
+	for _, b := range v.GetBogons().GetRoutes() {
+		update.Bogons = append(update.Bogons, Bogon{Prefix: b.GetPrefix(), Origin: b.GetOrigin(), Kind: b.GetKind()})
+	}
+	for _, e := range v.GetOriginEvents() {
+		update.OriginEvents = append(update.OriginEvents, ProtoToOriginEvent(e))
 	}
 
 	return update
 }
 
+// protoToPathStats converts a bgpinfo.AsPathStats proto to a PathStats struct.
+func protoToPathStats(p *pb.AsPathStats) PathStats {
+	return PathStats{
+		Lengths:   p.GetLengths(),
+		Unique:    p.GetUniqueLengths(),
+		Prepended: p.GetPrepended(),
+		Sets:      p.GetAsSets(),
+	}
+}
+
+// PathStatsToProto converts a PathStats struct to a bgpinfo.AsPathStats proto.
+func PathStatsToProto(p PathStats) *pb.AsPathStats {
+	return &pb.AsPathStats{
+		Lengths:       p.Lengths,
+		UniqueLengths: p.Unique,
+		Prepended:     p.Prepended,
+		AsSets:        p.Sets,
+	}
+}
+
+// protoToCommunityUse converts a bgpinfo.CommunityUse proto to a CommunityUse struct.
+func protoToCommunityUse(c *pb.CommunityUse) CommunityUse {
+	u := CommunityUse{
+		Standard: c.GetStandard(),
+		Extended: c.GetExtended(),
+		Large:    c.GetLarge(),
+		WellKnown: WellKnown{
+			NoExport:          c.GetWellKnown().GetNoExport(),
+			NoAdvertise:       c.GetWellKnown().GetNoAdvertise(),
+			NoExportSubconfed: c.GetWellKnown().GetNoExportSubconfed(),
+			Blackhole:         c.GetWellKnown().GetBlackhole(),
+			GracefulShutdown:  c.GetWellKnown().GetGracefulShutdown(),
+		},
+	}
+	for _, t := range c.GetTop() {
+		u.Top = append(u.Top, CommunityCount{Community: t.GetCommunity(), Prefixes: t.GetPrefixes()})
+	}
+
+	return u
+}
+
+// CommunityUseToProto converts a CommunityUse struct to a bgpinfo.CommunityUse proto.
+func CommunityUseToProto(u CommunityUse) *pb.CommunityUse {
+	c := &pb.CommunityUse{
+		Standard: u.Standard,
+		Extended: u.Extended,
+		Large:    u.Large,
+		WellKnown: &pb.WellKnownCommunities{
+			NoExport:          u.WellKnown.NoExport,
+			NoAdvertise:       u.WellKnown.NoAdvertise,
+			NoExportSubconfed: u.WellKnown.NoExportSubconfed,
+			Blackhole:         u.WellKnown.Blackhole,
+			GracefulShutdown:  u.WellKnown.GracefulShutdown,
+		},
+	}
+	for _, t := range u.Top {
+		c.Top = append(c.Top, &pb.CommunityCount{Community: t.Community, Prefixes: t.Prefixes})
+	}
+
+	return c
+}
+
+// ProtoToPeerDetail converts a bgpinfo.PeerDetail proto to a PeerDetail struct.
+func ProtoToPeerDetail(p *pb.PeerDetail) PeerDetail {
+	return PeerDetail{
+		Address:    p.GetAddress(),
+		ASN:        p.GetAsn(),
+		State:      p.GetState(),
+		Uptime:     time.Duration(p.GetUptime()) * time.Second,
+		V4Received: p.GetV4Received(),
+		V4Accepted: p.GetV4Accepted(),
+		V6Received: p.GetV6Received(),
+		V6Accepted: p.GetV6Accepted(),
+	}
+}
+
+// PeerDetailToProto converts a PeerDetail struct to a bgpinfo.PeerDetail proto.
+// The uptime is rounded down to the second.
+func PeerDetailToProto(p PeerDetail) *pb.PeerDetail {
+	return &pb.PeerDetail{
+		Address:    p.Address,
+		Asn:        p.ASN,
+		State:      p.State,
+		Uptime:     uint64(p.Uptime / time.Second),
+		V4Received: p.V4Received,
+		V4Accepted: p.V4Accepted,
+		V6Received: p.V6Received,
+		V6Accepted: p.V6Accepted,
+	}
+}
+
+// protoToBogonCount converts a bgpinfo.BogonCount proto to a BogonCount struct.
+func protoToBogonCount(c *pb.BogonCount) BogonCount {
+	return BogonCount{
+		Martian:     c.GetMartian(),
+		Unallocated: c.GetUnallocated(),
+		ReservedASN: c.GetReservedAsn(),
+	}
+}
+
+// BogonsToProto converts the bogon counts and routes of a BgpUpdate to a
+// bgpinfo.Bogons proto.
+func BogonsToProto(v4, v6 BogonCount, routes []Bogon) *pb.Bogons {
+	b := &pb.Bogons{
+		V4: &pb.BogonCount{Martian: v4.Martian, Unallocated: v4.Unallocated, ReservedAsn: v4.ReservedASN},
+		V6: &pb.BogonCount{Martian: v6.Martian, Unallocated: v6.Unallocated, ReservedAsn: v6.ReservedASN},
+	}
+	for _, r := range routes {
+		b.Routes = append(b.Routes, &pb.Bogon{Prefix: r.Prefix, Origin: r.Origin, Kind: r.Kind})
+	}
+
+	return b
+}
+
+// ProtoToOriginEvent converts a bgpinfo.OriginEvent proto to an OriginEvent struct.
+func ProtoToOriginEvent(e *pb.OriginEvent) OriginEvent {
+	return OriginEvent{
+		Kind:      e.GetKind(),
+		Prefix:    e.GetPrefix(),
+		OldOrigin: e.GetOldOrigin(),
+		NewOrigin: e.GetNewOrigin(),
+		FirstSeen: e.GetFirstSeen(),
+		LastSeen:  e.GetLastSeen(),
+	}
+}
+
+// OriginEventToProto converts an OriginEvent struct to a bgpinfo.OriginEvent proto.
+func OriginEventToProto(e OriginEvent) *pb.OriginEvent {
+	return &pb.OriginEvent{
+		Kind:      e.Kind,
+		Prefix:    e.Prefix,
+		OldOrigin: e.OldOrigin,
+		NewOrigin: e.NewOrigin,
+		FirstSeen: e.FirstSeen,
+		LastSeen:  e.LastSeen,
+	}
+}
+
 // StructToProto converts a BgpUpdate to a bgpinfo.Values proto.
 func StructToProto(b *BgpUpdate) *pb.Values {
-	return &pb.Values{
+	v := &pb.Values{
 		Time: b.Time,
 		PrefixCount: &pb.PrefixCount{
 			Active_4: b.V4Count,
@@ -417,66 +645,7 @@ func StructToProto(b *BgpUpdate) *pb.Values {
 			As6Only: b.As6Only,
 			AsBoth:  b.AsBoth,
 		},
-		Masks: &pb.Masks{
-			V4_08: b.V4_08,
-			V4_09: b.V4_09,
-			V4_10: b.V4_10,
-			V4_11: b.V4_11,
-			V4_12: b.V4_12,
-			V4_13: b.V4_13,
-			V4_14: b.V4_14,
-			V4_15: b.V4_15,
-			V4_16: b.V4_16,
-			V4_17: b.V4_17,
-			V4_18: b.V4_18,
-			V4_19: b.V4_19,
-			V4_20: b.V4_20,
-			V4_21: b.V4_21,
-			V4_22: b.V4_22,
-			V4_23: b.V4_23,
-			V4_24: b.V4_24,
-			V6_08: b.V6_08,
-			V6_09: b.V6_09,
-			V6_10: b.V6_10,
-			V6_11: b.V6_11,
-			V6_12: b.V6_12,
-			V6_13: b.V6_13,
-			V6_14: b.V6_14,
-			V6_15: b.V6_15,
-			V6_16: b.V6_16,
-			V6_17: b.V6_17,
-			V6_18: b.V6_18,
-			V6_19: b.V6_19,
-			V6_20: b.V6_20,
-			V6_21: b.V6_21,
-			V6_22: b.V6_22,
-			V6_23: b.V6_23,
-			V6_24: b.V6_24,
-			V6_25: b.V6_25,
-			V6_26: b.V6_26,
-			V6_27: b.V6_27,
-			V6_28: b.V6_28,
-			V6_29: b.V6_29,
-			V6_30: b.V6_30,
-			V6_31: b.V6_31,
-			V6_32: b.V6_32,
-			V6_33: b.V6_33,
-			V6_34: b.V6_34,
-			V6_35: b.V6_35,
-			V6_36: b.V6_36,
-			V6_37: b.V6_37,
-			V6_38: b.V6_38,
-			V6_39: b.V6_39,
-			V6_40: b.V6_40,
-			V6_41: b.V6_41,
-			V6_42: b.V6_42,
-			V6_43: b.V6_43,
-			V6_44: b.V6_44,
-			V6_45: b.V6_45,
-			V6_46: b.V6_46,
-			V6_47: b.V6_47,
-			V6_48: b.V6_48,
-		},
+		Masks: MasksToProto(b.Masks4, b.Masks6),
 		LargeCommunity: &pb.LargeCommunity{
 			C4: b.LargeC4,
 			C6: b.LargeC6,
@@ -489,5 +658,30 @@ func StructToProto(b *BgpUpdate) *pb.Values {
 			V6Invalid: b.Roainvalid6,
 			V6Unknown: b.Roaunknown6,
 		},
+		Aspas: &pb.Aspas{
+			V4Valid:   b.Aspavalid4,
+			V4Invalid: b.Aspainvalid4,
+			V4Unknown: b.Aspaunknown4,
+			V6Valid:   b.Aspavalid6,
+			V6Invalid: b.Aspainvalid6,
+			V6Unknown: b.Aspaunknown6,
+		},
+		AsPaths: &pb.AsPaths{
+			V4: PathStatsToProto(b.Paths4),
+			V6: PathStatsToProto(b.Paths6),
+		},
+		Communities: &pb.Communities{
+			V4: CommunityUseToProto(b.Communities4),
+			V6: CommunityUseToProto(b.Communities6),
+		},
+		Bogons: BogonsToProto(b.Bogons4, b.Bogons6, b.Bogons),
+	}
+	for _, p := range b.PeerDetails {
+		v.PeerDetails = append(v.PeerDetails, PeerDetailToProto(p))
 	}
+	for _, e := range b.OriginEvents {
+		v.OriginEvents = append(v.OriginEvents, OriginEventToProto(e))
+	}
+
+	return v
 }
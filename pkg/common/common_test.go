@@ -1,9 +1,12 @@
 package common
 
 import (
+	"context"
+	"errors"
 	"net"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestStringToUint32(t *testing.T) {
@@ -36,6 +39,56 @@ func TestStringToUint32(t *testing.T) {
 	}
 }
 
+func TestParseUint32(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		out     uint32
+		wantErr bool
+	}{
+		{
+			name: "Regular number to uint32",
+			in:   "1",
+			out:  uint32(1),
+		},
+		{
+			name: "Largest uint32",
+			in:   "4294967295",
+			out:  uint32(4294967295),
+		},
+		{
+			name:    "One larger",
+			in:      "4294967296",
+			wantErr: true,
+		},
+		{
+			name:    "Not just digits",
+			in:      "AS3356",
+			wantErr: true,
+		},
+		{
+			name:    "Negative",
+			in:      "-1",
+			wantErr: true,
+		},
+		{
+			name:    "Empty",
+			in:      "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		actual, err := ParseUint32(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Error on %s. Expected error %t, got %v", tt.name, tt.wantErr, err)
+		}
+		if actual != tt.out {
+			t.Errorf("Error on %s. Expected %d, got %d", tt.name, tt.out, actual)
+		}
+	}
+}
+
 func TestUint32ToString(t *testing.T) {
 	tests := []struct {
 		name string
@@ -311,3 +364,31 @@ func TestASDotToASPlain(t *testing.T) {
 		}
 	}
 }
+
+func TestGetOutputContext(t *testing.T) {
+	out, err := GetOutputContext(context.Background(), "echo hello")
+	if err != nil || out != "hello" {
+		t.Errorf("Expected hello, got %q, %v", out, err)
+	}
+
+	// The sleep is a child of bash, so is only killed along with its
+	// process group. Output would otherwise wait for it to finish.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = GetOutputContext(ctx, "sleep 10 | cat")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the command to be killed, took %v", elapsed)
+	}
+	var timeout *TimeoutError
+	if !errors.As(err, &timeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a TimeoutError, got %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = GetOutputContext(ctx, "sleep 10")
+	if errors.As(err, &timeout) || !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a cancellation error, got %v", err)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package common
+
+import "os/exec"
+
+// killGroup does nothing without process groups, so only cmd itself is
+// killed on cancellation.
+func killGroup(*exec.Cmd) {}
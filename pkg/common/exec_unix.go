@@ -0,0 +1,18 @@
+//go:build unix
+
+package common
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killGroup starts cmd in its own process group, and kills the whole group
+// on cancellation. Otherwise anything started by cmd, i.e. the birdc under
+// a bash -c, would keep running.
+func killGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
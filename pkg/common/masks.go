@@ -0,0 +1,69 @@
+package common
+
+import (
+	"fmt"
+	"maps"
+
+	pb "github.com/mellowdrifter/bgp_infrastructure/internal/bgpsql"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// The prefix lengths older clients of bgpsql have a masks field for.
+const (
+	legacyMaskMin   = 8
+	legacyV4MaskMax = 24
+	legacyV6MaskMax = 48
+)
+
+// legacyMaskField returns the fixed masks field for a prefix length, or nil
+// for lengths older clients don't know about.
+func legacyMaskField(family string, length uint32) protoreflect.FieldDescriptor {
+	fields := (&pb.Masks{}).ProtoReflect().Descriptor().Fields()
+	return fields.ByName(protoreflect.Name(fmt.Sprintf("%s_%02d", family, length)))
+}
+
+// MasksToProto converts the route count of every IPv4 and IPv6 prefix
+// length to a masks proto. The fixed fields are filled in as well, so
+// clients that predate the maps keep working.
+func MasksToProto(v4, v6 map[uint32]uint32) *pb.Masks {
+	m := &pb.Masks{
+		V4: maps.Clone(v4),
+		V6: maps.Clone(v6),
+	}
+	r := m.ProtoReflect()
+	for family, counts := range map[string]map[uint32]uint32{"v4": v4, "v6": v6} {
+		for length, count := range counts {
+			if f := legacyMaskField(family, length); f != nil {
+				r.Set(f, protoreflect.ValueOfUint32(count))
+			}
+		}
+	}
+	return m
+}
+
+// ProtoToMasks returns the route count of every IPv4 and IPv6 prefix length
+// in a masks proto. Senders that predate the maps only fill the fixed
+// fields, so those are read when a family has no map.
+func ProtoToMasks(m *pb.Masks) (v4, v6 map[uint32]uint32) {
+	return protoToFamilyMasks(m, "v4", m.GetV4(), legacyV4MaskMax),
+		protoToFamilyMasks(m, "v6", m.GetV6(), legacyV6MaskMax)
+}
+
+// protoToFamilyMasks returns the counts of one family, from its map when
+// set, or otherwise its fixed fields.
+func protoToFamilyMasks(m *pb.Masks, family string, counts map[uint32]uint32, last uint32) map[uint32]uint32 {
+	if len(counts) > 0 {
+		return maps.Clone(counts)
+	}
+	counts = make(map[uint32]uint32)
+	if m == nil {
+		return counts
+	}
+	r := m.ProtoReflect()
+	for length := uint32(legacyMaskMin); length <= last; length++ {
+		if c := r.Get(legacyMaskField(family, length)).Uint(); c > 0 {
+			counts[length] = uint32(c)
+		}
+	}
+	return counts
+}
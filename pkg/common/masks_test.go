@@ -0,0 +1,62 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+
+	pb "github.com/mellowdrifter/bgp_infrastructure/internal/bgpsql"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMasksToProto(t *testing.T) {
+	v4 := map[uint32]uint32{8: 16, 24: 500000, 25: 12, 32: 3}
+	v6 := map[uint32]uint32{32: 20000, 48: 100000, 64: 7}
+
+	got := MasksToProto(v4, v6)
+	want := &pb.Masks{
+		V4_08: 16, V4_24: 500000,
+		V6_32: 20000, V6_48: 100000,
+		V4: v4,
+		V6: v6,
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+
+	// And back again, with nothing lost beyond /24 and /48.
+	got4, got6 := ProtoToMasks(got)
+	if !reflect.DeepEqual(got4, v4) || !reflect.DeepEqual(got6, v6) {
+		t.Errorf("Got %v %v, Wanted %v %v", got4, got6, v4, v6)
+	}
+}
+
+func TestProtoToMasksLegacy(t *testing.T) {
+	tests := []struct {
+		masks  *pb.Masks
+		v4, v6 map[uint32]uint32
+	}{
+		{
+			masks: nil,
+			v4:    map[uint32]uint32{},
+			v6:    map[uint32]uint32{},
+		},
+		{
+			// A client that only knows the fixed fields.
+			masks: &pb.Masks{V4_08: 1, V4_24: 2, V6_08: 3, V6_48: 4},
+			v4:    map[uint32]uint32{8: 1, 24: 2},
+			v6:    map[uint32]uint32{8: 3, 48: 4},
+		},
+		{
+			// The maps win over the fixed fields of the same family.
+			masks: &pb.Masks{V4_24: 2, V6_48: 4, V4: map[uint32]uint32{24: 5, 28: 6}},
+			v4:    map[uint32]uint32{24: 5, 28: 6},
+			v6:    map[uint32]uint32{48: 4},
+		},
+	}
+	for _, tc := range tests {
+		v4, v6 := ProtoToMasks(tc.masks)
+		if !reflect.DeepEqual(v4, tc.v4) || !reflect.DeepEqual(v6, tc.v6) {
+			t.Errorf("%v: Got %v %v, Wanted %v %v", tc.masks, v4, v6, tc.v4, tc.v6)
+		}
+	}
+}
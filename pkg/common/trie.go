@@ -0,0 +1,334 @@
+package common
+
+import (
+	"encoding/binary"
+	"iter"
+	"math/bits"
+	"net/netip"
+)
+
+// Trie is a path compressed binary radix (patricia) trie mapping prefixes to
+// values, for longest prefix match and coverage queries over a full table.
+// IPv4 and IPv6 prefixes are held apart, and IPv4-mapped IPv6 prefixes are
+// treated as IPv4. The zero value is an empty trie. A Trie isn't safe for
+// concurrent use while it's being modified.
+type Trie[V any] struct {
+	v4, v6 *trieNode[V]
+	len    int
+}
+
+// trieNode is a prefix in the trie. Nodes without a value only join two
+// longer prefixes that differ in the bit following the node's own.
+type trieNode[V any] struct {
+	key   trieKey
+	bits  uint8
+	is4   bool
+	set   bool
+	value V
+	child [2]*trieNode[V]
+}
+
+// trieKey is an address as a 128 bit number, so bits are cheap to compare.
+// IPv4 addresses are held in the top 32 bits.
+type trieKey struct {
+	hi, lo uint64
+}
+
+// keyOf returns the key of a.
+func keyOf(a netip.Addr) trieKey {
+	if a.Is4() {
+		b := a.As4()
+		return trieKey{hi: uint64(binary.BigEndian.Uint32(b[:])) << 32}
+	}
+	b := a.As16()
+	return trieKey{hi: binary.BigEndian.Uint64(b[:8]), lo: binary.BigEndian.Uint64(b[8:])}
+}
+
+// newTrieNode returns a node for the masked prefix p.
+func newTrieNode[V any](p netip.Prefix) *trieNode[V] {
+	return &trieNode[V]{key: keyOf(p.Addr()), bits: uint8(p.Bits()), is4: p.Addr().Is4()}
+}
+
+// prefix returns the prefix n is for.
+func (n *trieNode[V]) prefix() netip.Prefix {
+	if n.is4 {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(n.key.hi>>32))
+		return netip.PrefixFrom(netip.AddrFrom4(b), int(n.bits))
+	}
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], n.key.hi)
+	binary.BigEndian.PutUint64(b[8:], n.key.lo)
+	return netip.PrefixFrom(netip.AddrFrom16(b), int(n.bits))
+}
+
+// bit returns bit i of k, counting from the most significant.
+func (k trieKey) bit(i int) int {
+	if i < 64 {
+		return int(k.hi>>(63-i)) & 1
+	}
+	return int(k.lo>>(127-i)) & 1
+}
+
+// common returns how many leading bits k and o share, up to limit.
+func (k trieKey) common(o trieKey, limit int) int {
+	n := bits.LeadingZeros64(k.hi ^ o.hi)
+	if n == 64 {
+		n += bits.LeadingZeros64(k.lo ^ o.lo)
+	}
+	return min(n, limit)
+}
+
+// triePrefix returns p masked with any IPv4-mapped address unmapped, and
+// whether it's a valid prefix at all.
+func triePrefix(p netip.Prefix) (netip.Prefix, bool) {
+	if !p.IsValid() {
+		return p, false
+	}
+	a := p.Addr()
+	b := p.Bits()
+	if a.Is4In6() {
+		a = a.Unmap()
+		b = max(b-96, 0)
+	}
+	return netip.PrefixFrom(a.WithZone(""), b).Masked(), true
+}
+
+// root returns the root of the family p belongs to.
+func (t *Trie[V]) root(p netip.Prefix) **trieNode[V] {
+	if p.Addr().Is4() {
+		return &t.v4
+	}
+	return &t.v6
+}
+
+// Len returns the amount of prefixes in the trie.
+func (t *Trie[V]) Len() int {
+	return t.len
+}
+
+// Insert sets the value of p, replacing any value it already had. It
+// returns whether p is new to the trie. Invalid prefixes are ignored.
+func (t *Trie[V]) Insert(p netip.Prefix, v V) bool {
+	p, ok := triePrefix(p)
+	if !ok {
+		return false
+	}
+	k := keyOf(p.Addr())
+	l := p.Bits()
+
+	leaf := newTrieNode[V](p)
+	leaf.value, leaf.set = v, true
+
+	slot := t.root(p)
+	for {
+		n := *slot
+		if n == nil {
+			*slot = leaf
+			t.len++
+			return true
+		}
+
+		c := k.common(n.key, min(l, int(n.bits)))
+		if c == int(n.bits) {
+			if c == l {
+				added := !n.set
+				n.value, n.set = v, true
+				if added {
+					t.len++
+				}
+				return added
+			}
+			slot = &n.child[k.bit(c)]
+			continue
+		}
+
+		// p diverges from n, or sits above it. Either p takes n's place,
+		// or a node joining the two does.
+		if c == l {
+			leaf.child[n.key.bit(c)] = n
+			*slot = leaf
+		} else {
+			join := newTrieNode[V](netip.PrefixFrom(p.Addr(), c).Masked())
+			join.child[k.bit(c)] = leaf
+			join.child[n.key.bit(c)] = n
+			*slot = join
+		}
+		t.len++
+		return true
+	}
+}
+
+// Delete removes p, returning whether it was in the trie.
+func (t *Trie[V]) Delete(p netip.Prefix) bool {
+	p, ok := triePrefix(p)
+	if !ok {
+		return false
+	}
+	k := keyOf(p.Addr())
+	l := p.Bits()
+
+	var parent **trieNode[V]
+	slot := t.root(p)
+	for {
+		n := *slot
+		if n == nil || int(n.bits) > l || k.common(n.key, int(n.bits)) < int(n.bits) {
+			return false
+		}
+		if int(n.bits) < l {
+			parent, slot = slot, &n.child[k.bit(int(n.bits))]
+			continue
+		}
+		if !n.set {
+			return false
+		}
+
+		var zero V
+		n.value, n.set = zero, false
+		t.len--
+
+		// Keep the trie compressed. A node without a value needs both
+		// children, so removing a leaf can leave its parent redundant.
+		switch {
+		case n.child[0] != nil && n.child[1] != nil:
+		case n.child[0] != nil:
+			*slot = n.child[0]
+		case n.child[1] != nil:
+			*slot = n.child[1]
+		default:
+			*slot = nil
+			if parent != nil && !(*parent).set {
+				pn := *parent
+				if pn.child[0] != nil {
+					*parent = pn.child[0]
+				} else {
+					*parent = pn.child[1]
+				}
+			}
+		}
+		return true
+	}
+}
+
+// Get returns the value of exactly p.
+func (t *Trie[V]) Get(p netip.Prefix) (V, bool) {
+	var zero V
+	p, ok := triePrefix(p)
+	if !ok {
+		return zero, false
+	}
+	k := keyOf(p.Addr())
+	l := p.Bits()
+
+	n := *t.root(p)
+	for n != nil && int(n.bits) <= l && k.common(n.key, int(n.bits)) == int(n.bits) {
+		if int(n.bits) == l {
+			if n.set {
+				return n.value, true
+			}
+			break
+		}
+		n = n.child[k.bit(int(n.bits))]
+	}
+	return zero, false
+}
+
+// Lookup returns the longest prefix holding a, and its value.
+func (t *Trie[V]) Lookup(a netip.Addr) (netip.Prefix, V, bool) {
+	return t.LongestMatch(netip.PrefixFrom(a, a.BitLen()))
+}
+
+// LongestMatch returns the longest prefix covering p, which may be p
+// itself, and its value.
+func (t *Trie[V]) LongestMatch(p netip.Prefix) (netip.Prefix, V, bool) {
+	var best *trieNode[V]
+	t.covering(p, func(n *trieNode[V]) bool {
+		best = n
+		return true
+	})
+	if best == nil {
+		var zero V
+		return netip.Prefix{}, zero, false
+	}
+	return best.prefix(), best.value, true
+}
+
+// Covering returns every prefix covering p, including p itself, from the
+// shortest to the longest.
+func (t *Trie[V]) Covering(p netip.Prefix) iter.Seq2[netip.Prefix, V] {
+	return func(yield func(netip.Prefix, V) bool) {
+		t.covering(p, func(n *trieNode[V]) bool {
+			return yield(n.prefix(), n.value)
+		})
+	}
+}
+
+// covering calls fn with the nodes holding a value that cover p, shortest
+// first, until fn returns false.
+func (t *Trie[V]) covering(p netip.Prefix, fn func(*trieNode[V]) bool) {
+	p, ok := triePrefix(p)
+	if !ok {
+		return
+	}
+	k := keyOf(p.Addr())
+	l := p.Bits()
+
+	n := *t.root(p)
+	for n != nil && int(n.bits) <= l && k.common(n.key, int(n.bits)) == int(n.bits) {
+		if n.set && !fn(n) {
+			return
+		}
+		if int(n.bits) == l {
+			return
+		}
+		n = n.child[k.bit(int(n.bits))]
+	}
+}
+
+// Covered returns every prefix covered by p, including p itself, in order.
+func (t *Trie[V]) Covered(p netip.Prefix) iter.Seq2[netip.Prefix, V] {
+	return func(yield func(netip.Prefix, V) bool) {
+		p, ok := triePrefix(p)
+		if !ok {
+			return
+		}
+		k := keyOf(p.Addr())
+		l := p.Bits()
+
+		n := *t.root(p)
+		for n != nil {
+			if int(n.bits) >= l {
+				if k.common(n.key, l) == l {
+					n.walk(yield)
+				}
+				return
+			}
+			if k.common(n.key, int(n.bits)) < int(n.bits) {
+				return
+			}
+			n = n.child[k.bit(int(n.bits))]
+		}
+	}
+}
+
+// All walks every prefix in order, IPv4 first. Prefixes are ordered by
+// address, then by length.
+func (t *Trie[V]) All() iter.Seq2[netip.Prefix, V] {
+	return func(yield func(netip.Prefix, V) bool) {
+		if t.v4.walk(yield) {
+			t.v6.walk(yield)
+		}
+	}
+}
+
+// walk yields n and everything below it in order, returning false once
+// yield does.
+func (n *trieNode[V]) walk(yield func(netip.Prefix, V) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.set && !yield(n.prefix(), n.value) {
+		return false
+	}
+	return n.child[0].walk(yield) && n.child[1].walk(yield)
+}
@@ -0,0 +1,312 @@
+package common
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"net/netip"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// entry is a prefix and its value, as yielded by the trie.
+type entry struct {
+	p netip.Prefix
+	v int
+}
+
+func collect(seq func(func(netip.Prefix, int) bool)) []entry {
+	var e []entry
+	for p, v := range seq {
+		e = append(e, entry{p, v})
+	}
+	return e
+}
+
+func comparePrefix(a, b netip.Prefix) int {
+	return cmp.Or(a.Addr().Compare(b.Addr()), cmp.Compare(a.Bits(), b.Bits()))
+}
+
+func TestTrie(t *testing.T) {
+	var tr Trie[int]
+	for i, p := range []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "10.2.0.0/16", "0.0.0.0/0", "2001:db8::/32", "2001:db8:1::/48"} {
+		if !tr.Insert(netip.MustParsePrefix(p), i) {
+			t.Errorf("%s: should be new", p)
+		}
+	}
+	// Replacing a value, and an unmasked IPv4-mapped prefix.
+	if tr.Insert(netip.MustParsePrefix("::ffff:10.1.2.3/120"), 20) {
+		t.Errorf("10.1.2.0/24 shouldn't be new")
+	}
+	if got := tr.Len(); got != 7 {
+		t.Errorf("Got %d, Wanted %d", got, 7)
+	}
+
+	lookups := []struct {
+		addr   string
+		prefix string
+		value  int
+	}{
+		{addr: "10.1.2.3", prefix: "10.1.2.0/24", value: 20},
+		{addr: "10.1.3.3", prefix: "10.1.0.0/16", value: 1},
+		{addr: "10.3.0.1", prefix: "10.0.0.0/8", value: 0},
+		{addr: "192.0.2.1", prefix: "0.0.0.0/0", value: 4},
+		{addr: "2001:db8:1::1", prefix: "2001:db8:1::/48", value: 6},
+		{addr: "2001:db8:2::1", prefix: "2001:db8::/32", value: 5},
+	}
+	for _, tc := range lookups {
+		p, v, ok := tr.Lookup(netip.MustParseAddr(tc.addr))
+		if !ok || p.String() != tc.prefix || v != tc.value {
+			t.Errorf("%s: Got %s %d %t, Wanted %s %d", tc.addr, p, v, ok, tc.prefix, tc.value)
+		}
+	}
+	if p, _, ok := tr.Lookup(netip.MustParseAddr("2002::1")); ok {
+		t.Errorf("Got %s, Wanted nothing", p)
+	}
+
+	got := collect(tr.Covering(netip.MustParsePrefix("10.1.2.128/25")))
+	want := []entry{
+		{netip.MustParsePrefix("0.0.0.0/0"), 4},
+		{netip.MustParsePrefix("10.0.0.0/8"), 0},
+		{netip.MustParsePrefix("10.1.0.0/16"), 1},
+		{netip.MustParsePrefix("10.1.2.0/24"), 20},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+
+	got = collect(tr.Covered(netip.MustParsePrefix("10.0.0.0/8")))
+	want = []entry{
+		{netip.MustParsePrefix("10.0.0.0/8"), 0},
+		{netip.MustParsePrefix("10.1.0.0/16"), 1},
+		{netip.MustParsePrefix("10.1.2.0/24"), 20},
+		{netip.MustParsePrefix("10.2.0.0/16"), 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+
+	if !tr.Delete(netip.MustParsePrefix("10.1.0.0/16")) || tr.Delete(netip.MustParsePrefix("10.1.0.0/16")) {
+		t.Errorf("10.1.0.0/16 should be deleted once")
+	}
+	if _, ok := tr.Get(netip.MustParsePrefix("10.1.0.0/16")); ok {
+		t.Errorf("10.1.0.0/16 should be gone")
+	}
+	if v, ok := tr.Get(netip.MustParsePrefix("10.1.2.0/24")); !ok || v != 20 {
+		t.Errorf("Got %d %t, Wanted %d", v, ok, 20)
+	}
+
+	got = collect(tr.All())
+	want = []entry{
+		{netip.MustParsePrefix("0.0.0.0/0"), 4},
+		{netip.MustParsePrefix("10.0.0.0/8"), 0},
+		{netip.MustParsePrefix("10.1.2.0/24"), 20},
+		{netip.MustParsePrefix("10.2.0.0/16"), 3},
+		{netip.MustParsePrefix("2001:db8::/32"), 5},
+		{netip.MustParsePrefix("2001:db8:1::/48"), 6},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+
+	// Stopping early.
+	for range tr.All() {
+		break
+	}
+}
+
+// TestTrieRandom checks the trie against a plain map, with prefixes drawn
+// from a small space so that they overlap a lot.
+func TestTrieRandom(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	random := func() netip.Prefix {
+		if r.IntN(4) == 0 {
+			a := netip.AddrFrom16([16]byte{0x20, 0x01, 0x0d, byte(r.IntN(4) << 6), byte(r.IntN(4) << 6)})
+			return netip.PrefixFrom(a, 24+r.IntN(17)).Masked()
+		}
+		a := netip.AddrFrom4([4]byte{10, byte(r.IntN(8) << 5), byte(r.IntN(4) << 6), 0})
+		return netip.PrefixFrom(a, 8+r.IntN(17)).Masked()
+	}
+
+	var tr Trie[int]
+	m := make(map[netip.Prefix]int)
+	for i := range 5000 {
+		p := random()
+		if r.IntN(3) == 0 {
+			_, had := m[p]
+			delete(m, p)
+			if got := tr.Delete(p); got != had {
+				t.Fatalf("Delete %s: Got %t, Wanted %t", p, got, had)
+			}
+			continue
+		}
+		_, had := m[p]
+		m[p] = i
+		if got := tr.Insert(p, i); got == had {
+			t.Fatalf("Insert %s: Got %t, Wanted %t", p, got, !had)
+		}
+	}
+	if tr.Len() != len(m) {
+		t.Fatalf("Got %d, Wanted %d", tr.Len(), len(m))
+	}
+
+	var all []entry
+	for p, v := range m {
+		all = append(all, entry{p, v})
+	}
+	slices.SortFunc(all, func(a, b entry) int { return comparePrefix(a.p, b.p) })
+	if got := collect(tr.All()); !reflect.DeepEqual(got, all) {
+		t.Fatalf("Got %v, Wanted %v", got, all)
+	}
+
+	for range 1000 {
+		q := random()
+		var covering, covered []entry
+		for _, e := range all {
+			if e.p.Bits() <= q.Bits() && e.p.Contains(q.Addr()) {
+				covering = append(covering, e)
+			}
+			if e.p.Bits() >= q.Bits() && q.Contains(e.p.Addr()) {
+				covered = append(covered, e)
+			}
+		}
+		slices.SortFunc(covering, func(a, b entry) int { return cmp.Compare(a.p.Bits(), b.p.Bits()) })
+
+		if got := collect(tr.Covering(q)); !reflect.DeepEqual(got, covering) {
+			t.Errorf("Covering %s: Got %v, Wanted %v", q, got, covering)
+		}
+		if got := collect(tr.Covered(q)); !reflect.DeepEqual(got, covered) {
+			t.Errorf("Covered %s: Got %v, Wanted %v", q, got, covered)
+		}
+		p, v, ok := tr.LongestMatch(q)
+		if len(covering) == 0 {
+			if ok {
+				t.Errorf("LongestMatch %s: Got %s, Wanted nothing", q, p)
+			}
+		} else if last := covering[len(covering)-1]; !ok || p != last.p || v != last.v {
+			t.Errorf("LongestMatch %s: Got %s %d, Wanted %s %d", q, p, v, last.p, last.v)
+		}
+	}
+}
+
+var (
+	fullTableOnce sync.Once
+	fullTable     []netip.Prefix
+)
+
+// benchTable returns a million prefixes shaped roughly like a full table,
+// 900k IPv4 and 100k IPv6, mostly /24 and /48.
+func benchTable() []netip.Prefix {
+	fullTableOnce.Do(func() {
+		r := rand.New(rand.NewPCG(1, 2))
+		v4 := []int{24, 24, 24, 24, 24, 24, 23, 22, 21, 20, 19, 16}
+		v6 := []int{48, 48, 48, 48, 44, 40, 36, 32, 29}
+		seen := make(map[netip.Prefix]bool)
+		for len(seen) < 1_000_000 {
+			var p netip.Prefix
+			if len(seen) < 900_000 {
+				a := netip.AddrFrom4([4]byte{byte(1 + r.IntN(222)), byte(r.Uint32()), byte(r.Uint32())})
+				p = netip.PrefixFrom(a, v4[r.IntN(len(v4))]).Masked()
+			} else {
+				var b [16]byte
+				b[0], b[1] = 0x20, byte(r.IntN(16))
+				for i := 2; i < 6; i++ {
+					b[i] = byte(r.Uint32())
+				}
+				p = netip.PrefixFrom(netip.AddrFrom16(b), v6[r.IntN(len(v6))]).Masked()
+			}
+			if !seen[p] {
+				seen[p] = true
+				fullTable = append(fullTable, p)
+			}
+		}
+	})
+	return fullTable
+}
+
+// benchTrie returns a trie holding benchTable.
+func benchTrie(b *testing.B) *Trie[int] {
+	b.Helper()
+	var tr Trie[int]
+	for i, p := range benchTable() {
+		tr.Insert(p, i)
+	}
+	return &tr
+}
+
+func BenchmarkTrieInsert(b *testing.B) {
+	table := benchTable()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var tr Trie[int]
+		for j, p := range table {
+			tr.Insert(p, j)
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(table)), "ns/route")
+}
+
+func BenchmarkTrieDelete(b *testing.B) {
+	table := benchTable()
+	tr := benchTrie(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := table[i%len(table)]
+		tr.Delete(p)
+		b.StopTimer()
+		tr.Insert(p, i)
+		b.StartTimer()
+	}
+}
+
+func BenchmarkTrieLookup(b *testing.B) {
+	tr := benchTrie(b)
+	r := rand.New(rand.NewPCG(3, 4))
+	addrs := make([]netip.Addr, 1<<16)
+	for i := range addrs {
+		addrs[i] = netip.AddrFrom4([4]byte{byte(1 + r.IntN(222)), byte(r.Uint32()), byte(r.Uint32()), byte(r.Uint32())})
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.Lookup(addrs[i%len(addrs)])
+	}
+}
+
+func BenchmarkTrieLookup6(b *testing.B) {
+	table := benchTable()[900_000:]
+	tr := benchTrie(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.Lookup(table[i%len(table)].Addr())
+	}
+}
+
+func BenchmarkTrieCovering(b *testing.B) {
+	table := benchTable()
+	tr := benchTrie(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for range tr.Covering(table[i%len(table)]) {
+		}
+	}
+}
+
+func BenchmarkTrieCovered(b *testing.B) {
+	tr := benchTrie(b)
+	q := netip.MustParsePrefix("10.0.0.0/8")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for range tr.Covered(q) {
+		}
+	}
+}
+
+func BenchmarkTrieAll(b *testing.B) {
+	tr := benchTrie(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for range tr.All() {
+		}
+	}
+}
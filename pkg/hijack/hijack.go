@@ -0,0 +1,267 @@
+// Package hijack finds possible origin hijacks by comparing successive
+// snapshots of the origin ASNs seen for every prefix in the table.
+//
+// Three kinds of event are reported:
+//   - a prefix newly announced by more than one origin (MOAS)
+//   - a more specific prefix newly announced by an origin that doesn't
+//     announce the nearest covering prefix
+//   - a prefix moving from one set of origins to another entirely
+//
+// The first snapshot is taken as the baseline, so conflicts already in the
+// table when the detector starts aren't reported.
+package hijack
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"time"
+
+	com "github.com/mellowdrifter/bgp_infrastructure/pkg/common"
+)
+
+// Kind is the kind of an origin event.
+type Kind int
+
+const (
+	// MOAS is a prefix announced by more than one origin.
+	MOAS Kind = iota + 1
+	// SubPrefix is a more specific prefix announced by a different origin
+	// than its covering prefix.
+	SubPrefix
+	// OriginChange is a prefix that's moved to an entirely new origin.
+	OriginChange
+)
+
+// String returns the name of the kind as stored in the database.
+func (k Kind) String() string {
+	switch k {
+	case MOAS:
+		return "moas"
+	case SubPrefix:
+		return "sub_prefix"
+	case OriginChange:
+		return "origin_change"
+	}
+	return fmt.Sprintf("kind(%d)", int(k))
+}
+
+// Snapshot holds the origin ASNs seen for every prefix at one time.
+type Snapshot map[netip.Prefix][]uint32
+
+// ParseSnapshot returns a Snapshot from origins keyed by prefix strings, as
+// returned by a Decoder. Origins are sorted and deduplicated.
+func ParseSnapshot(origins map[string][]uint32) (Snapshot, error) {
+	s := make(Snapshot, len(origins))
+	for p, asns := range origins {
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix %q: %w", p, err)
+		}
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()).Masked()
+		o := append(s[prefix], asns...)
+		slices.Sort(o)
+		s[prefix] = slices.Compact(o)
+	}
+	return s, nil
+}
+
+// Event is a single origin conflict. For MOAS and origin changes, the old
+// origin was seen before the new one. For sub-prefixes, the old origin is
+// the origin of the covering prefix. An event that continues over several
+// snapshots keeps its first seen time. Origin changes are only seen once.
+type Event struct {
+	Kind                 Kind
+	Prefix               netip.Prefix
+	OldOrigin, NewOrigin uint32
+	FirstSeen, LastSeen  time.Time
+}
+
+// conflict is a MOAS or sub-prefix conflict present in a snapshot. MOAS
+// conflicts have a < b, as the order they were seen in isn't known.
+// Sub-prefix conflicts only hold the origin of the sub-prefix in b, so the
+// covering prefix changing origin isn't a new conflict.
+type conflict struct {
+	kind   Kind
+	prefix netip.Prefix
+	a, b   uint32
+}
+
+// Detector compares each snapshot with the last. It isn't safe for
+// concurrent use.
+type Detector struct {
+	prev      Snapshot
+	conflicts map[conflict]bool
+	active    map[conflict]Event
+	// unsent holds the events returned since the last Commit, keyed by the
+	// event without its last seen time.
+	unsent map[Event]Event
+}
+
+// NewDetector returns a Detector waiting for its baseline snapshot.
+func NewDetector() *Detector {
+	return &Detector{
+		active: make(map[conflict]Event),
+		unsent: make(map[Event]Event),
+	}
+}
+
+// Update compares s, taken at now, with the previous snapshot. It returns
+// every new origin change, plus every MOAS and sub-prefix conflict that has
+// appeared since the baseline and is still present, oldest first. Events
+// returned since the last Commit are returned again, so none are lost when
+// they couldn't be delivered.
+func (d *Detector) Update(s Snapshot, now time.Time) []Event {
+	t := s.trie()
+	cur := conflicts(s, t)
+	if d.prev == nil {
+		d.prev, d.conflicts = s, cur
+		return nil
+	}
+
+	var events []Event
+	for c := range cur {
+		e, ok := d.active[c]
+		switch {
+		case ok:
+		case d.conflicts[c]:
+			// Part of the baseline, or already there before.
+			continue
+		default:
+			e = d.newEvent(t, c, now)
+		}
+		e.LastSeen = now
+		d.active[c] = e
+		events = append(events, e)
+	}
+	for c := range d.active {
+		if !cur[c] {
+			delete(d.active, c)
+		}
+	}
+
+	for p, origins := range s {
+		old, ok := d.prev[p]
+		if !ok || len(old) == 0 || len(origins) == 0 || overlaps(old, origins) {
+			continue
+		}
+		events = append(events, Event{
+			Kind:      OriginChange,
+			Prefix:    p,
+			OldOrigin: old[0],
+			NewOrigin: origins[0],
+			FirstSeen: now,
+			LastSeen:  now,
+		})
+	}
+
+	d.prev, d.conflicts = s, cur
+	for _, e := range events {
+		key := e
+		key.LastSeen = time.Time{}
+		d.unsent[key] = e
+	}
+	if len(d.unsent) == 0 {
+		return nil
+	}
+
+	events = slices.Collect(maps.Values(d.unsent))
+	slices.SortFunc(events, func(x, y Event) int {
+		return cmp.Or(
+			x.FirstSeen.Compare(y.FirstSeen),
+			cmp.Compare(x.Kind, y.Kind),
+			x.Prefix.Addr().Compare(y.Prefix.Addr()),
+			cmp.Compare(x.Prefix.Bits(), y.Prefix.Bits()),
+			cmp.Compare(x.OldOrigin, y.OldOrigin),
+			cmp.Compare(x.NewOrigin, y.NewOrigin),
+		)
+	})
+	return events
+}
+
+// Commit marks the events returned by Update as delivered, so they're only
+// returned again while they continue.
+func (d *Detector) Commit() {
+	clear(d.unsent)
+}
+
+// newEvent returns the event for a conflict in the snapshot held in t, first
+// seen at now. A MOAS origin that was already announcing the prefix is the
+// old origin.
+func (d *Detector) newEvent(t *com.Trie[[]uint32], c conflict, now time.Time) Event {
+	e := Event{
+		Kind:      c.kind,
+		Prefix:    c.prefix,
+		OldOrigin: c.a,
+		NewOrigin: c.b,
+		FirstSeen: now,
+	}
+	switch c.kind {
+	case MOAS:
+		prev := d.prev[c.prefix]
+		if slices.Contains(prev, c.b) && !slices.Contains(prev, c.a) {
+			e.OldOrigin, e.NewOrigin = c.b, c.a
+		}
+	case SubPrefix:
+		covering, _ := cover(t, c.prefix)
+		e.OldOrigin = covering[0]
+	}
+	return e
+}
+
+// conflicts returns every MOAS and sub-prefix conflict in s, which t holds.
+// A sub-prefix is only compared with its nearest covering prefix, and
+// conflicts with it for each origin the covering prefix doesn't share.
+func conflicts(s Snapshot, t *com.Trie[[]uint32]) map[conflict]bool {
+	c := make(map[conflict]bool)
+	for p, origins := range s {
+		for i := 1; i < len(origins); i++ {
+			for j := range i {
+				c[conflict{kind: MOAS, prefix: p, a: origins[j], b: origins[i]}] = true
+			}
+		}
+
+		covering, ok := cover(t, p)
+		if !ok || len(covering) == 0 {
+			continue
+		}
+		for _, o := range origins {
+			if !slices.Contains(covering, o) {
+				c[conflict{kind: SubPrefix, prefix: p, b: o}] = true
+			}
+		}
+	}
+	return c
+}
+
+// trie returns the origins of s keyed by prefix, so the nearest covering
+// prefix can be found without looking up every shorter length.
+func (s Snapshot) trie() *com.Trie[[]uint32] {
+	t := new(com.Trie[[]uint32])
+	for p, origins := range s {
+		t.Insert(p, origins)
+	}
+	return t
+}
+
+// cover returns the origins of the nearest prefix in t covering p, not
+// counting p itself.
+func cover(t *com.Trie[[]uint32], p netip.Prefix) ([]uint32, bool) {
+	if p.Bits() == 0 {
+		return nil, false
+	}
+	_, origins, ok := t.LongestMatch(netip.PrefixFrom(p.Addr(), p.Bits()-1).Masked())
+	return origins, ok
+}
+
+// overlaps reports whether the sorted origins a and b share any ASN.
+func overlaps(a, b []uint32) bool {
+	for _, o := range a {
+		if _, found := slices.BinarySearch(b, o); found {
+			return true
+		}
+	}
+	return false
+}
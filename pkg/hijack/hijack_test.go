@@ -0,0 +1,170 @@
+package hijack
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mustSnapshot(t *testing.T, origins map[string][]uint32) Snapshot {
+	t.Helper()
+	s, err := ParseSnapshot(origins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParseSnapshot(t *testing.T) {
+	got := mustSnapshot(t, map[string][]uint32{
+		"1.1.1.0/24":    {13335, 3356, 13335},
+		"10.1.2.3/8":    {64512},
+		"2001:db8::/32": nil,
+	})
+	want := Snapshot{
+		netip.MustParsePrefix("1.1.1.0/24"):    {3356, 13335},
+		netip.MustParsePrefix("10.0.0.0/8"):    {64512},
+		netip.MustParsePrefix("2001:db8::/32"): nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+
+	if _, err := ParseSnapshot(map[string][]uint32{"1.1.1.0/33": {13335}}); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestDetector(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	at := func(i int) time.Time { return start.Add(time.Duration(i) * 5 * time.Minute) }
+	p := netip.MustParsePrefix
+
+	snapshots := []map[string][]uint32{
+		// The baseline already has a MOAS and a sub-prefix conflict.
+		{
+			"1.1.1.0/24":     {13335},
+			"8.0.0.0/9":      {3356},
+			"8.8.8.0/24":     {15169},
+			"9.9.9.0/24":     {19281, 42},
+			"2606:4700::/32": {13335},
+		},
+		// 1.1.1.0/24 gains a second origin, and 2606:4700::/48 appears
+		// from another origin.
+		{
+			"1.1.1.0/24":        {13335, 666},
+			"8.0.0.0/9":         {3356},
+			"8.8.8.0/24":        {15169},
+			"9.9.9.0/24":        {19281, 42},
+			"2606:4700::/32":    {13335},
+			"2606:4700:1::/48":  {666},
+			"2606:4700:10::/48": {13335},
+		},
+		// Both continue, and 8.0.0.0/9 moves to a new origin.
+		{
+			"1.1.1.0/24":       {13335, 666},
+			"8.0.0.0/9":        {174},
+			"8.8.8.0/24":       {15169},
+			"9.9.9.0/24":       {19281, 42},
+			"2606:4700::/32":   {13335},
+			"2606:4700:1::/48": {666},
+		},
+		// Everything is back to normal.
+		{
+			"1.1.1.0/24":     {13335},
+			"8.0.0.0/9":      {174},
+			"8.8.8.0/24":     {15169},
+			"9.9.9.0/24":     {19281, 42},
+			"2606:4700::/32": {13335},
+		},
+	}
+	want := [][]Event{
+		nil,
+		{
+			{Kind: MOAS, Prefix: p("1.1.1.0/24"), OldOrigin: 13335, NewOrigin: 666, FirstSeen: at(1), LastSeen: at(1)},
+			{Kind: SubPrefix, Prefix: p("2606:4700:1::/48"), OldOrigin: 13335, NewOrigin: 666, FirstSeen: at(1), LastSeen: at(1)},
+		},
+		{
+			{Kind: MOAS, Prefix: p("1.1.1.0/24"), OldOrigin: 13335, NewOrigin: 666, FirstSeen: at(1), LastSeen: at(2)},
+			{Kind: SubPrefix, Prefix: p("2606:4700:1::/48"), OldOrigin: 13335, NewOrigin: 666, FirstSeen: at(1), LastSeen: at(2)},
+			{Kind: OriginChange, Prefix: p("8.0.0.0/9"), OldOrigin: 3356, NewOrigin: 174, FirstSeen: at(2), LastSeen: at(2)},
+		},
+		nil,
+	}
+
+	d := NewDetector()
+	for i, origins := range snapshots {
+		got := d.Update(mustSnapshot(t, origins), at(i))
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("%d: Got %v, Wanted %v", i, got, want[i])
+		}
+		d.Commit()
+	}
+}
+
+func TestDetectorUnsent(t *testing.T) {
+	p := netip.MustParsePrefix
+	snapshots := []map[string][]uint32{
+		{"1.1.1.0/24": {13335}, "8.0.0.0/9": {3356}},
+		{"1.1.1.0/24": {13335, 666}, "8.0.0.0/9": {174}},
+		{"1.1.1.0/24": {13335}, "8.0.0.0/9": {174}},
+		{"1.1.1.0/24": {13335}, "8.0.0.0/9": {174}},
+	}
+	// The events of the second snapshot aren't committed, so are returned
+	// again with the third although they've ended.
+	want := [][]Event{
+		nil,
+		{
+			{Kind: MOAS, Prefix: p("1.1.1.0/24"), OldOrigin: 13335, NewOrigin: 666, FirstSeen: time.Unix(300, 0), LastSeen: time.Unix(300, 0)},
+			{Kind: OriginChange, Prefix: p("8.0.0.0/9"), OldOrigin: 3356, NewOrigin: 174, FirstSeen: time.Unix(300, 0), LastSeen: time.Unix(300, 0)},
+		},
+		{
+			{Kind: MOAS, Prefix: p("1.1.1.0/24"), OldOrigin: 13335, NewOrigin: 666, FirstSeen: time.Unix(300, 0), LastSeen: time.Unix(300, 0)},
+			{Kind: OriginChange, Prefix: p("8.0.0.0/9"), OldOrigin: 3356, NewOrigin: 174, FirstSeen: time.Unix(300, 0), LastSeen: time.Unix(300, 0)},
+		},
+		nil,
+	}
+	commit := []bool{true, false, true, true}
+
+	d := NewDetector()
+	for i, origins := range snapshots {
+		got := d.Update(mustSnapshot(t, origins), time.Unix(int64(i)*300, 0))
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("%d: Got %v, Wanted %v", i, got, want[i])
+		}
+		if commit[i] {
+			d.Commit()
+		}
+	}
+}
+
+func TestDetectorNewPrefix(t *testing.T) {
+	// A new prefix with two origins at once has no old origin, so the
+	// lowest is taken as the old one.
+	d := NewDetector()
+	d.Update(mustSnapshot(t, map[string][]uint32{"8.0.0.0/9": {3356}}), time.Unix(0, 0))
+	got := d.Update(mustSnapshot(t, map[string][]uint32{
+		"8.0.0.0/9":  {3356},
+		"1.1.1.0/24": {13335, 666},
+	}), time.Unix(300, 0))
+	want := []Event{{
+		Kind:      MOAS,
+		Prefix:    netip.MustParsePrefix("1.1.1.0/24"),
+		OldOrigin: 666,
+		NewOrigin: 13335,
+		FirstSeen: time.Unix(300, 0),
+		LastSeen:  time.Unix(300, 0),
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+}
+
+func TestKindString(t *testing.T) {
+	for k, want := range map[Kind]string{MOAS: "moas", SubPrefix: "sub_prefix", OriginChange: "origin_change", 0: "kind(0)"} {
+		if got := k.String(); got != want {
+			t.Errorf("Got %q, Wanted %q", got, want)
+		}
+	}
+}
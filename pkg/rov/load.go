@@ -0,0 +1,192 @@
+package rov
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Load returns a Table holding the VRPs exported by a validator to name.
+// Both JSON and CSV exports are understood, as written by rpki-client and
+// by Routinator.
+func Load(name string) (*Table, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// JSON exports are an object, anything else should be CSV.
+	r := bufio.NewReader(f)
+	read := ReadCSV
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("unable to load %s: %w", name, err)
+		}
+		if unicode.IsSpace(rune(b)) {
+			continue
+		}
+		if b == '{' {
+			read = ReadJSON
+		}
+		r.UnreadByte()
+		break
+	}
+
+	vrps, err := read(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load %s: %w", name, err)
+	}
+	return NewTable(vrps), nil
+}
+
+// jsonASN is an ASN in a JSON export. rpki-client writes a number, while
+// Routinator writes a string prefixed with AS.
+type jsonASN uint32
+
+// UnmarshalJSON reads an ASN written as either a number or a string.
+func (a *jsonASN) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		s = string(b)
+	}
+	n, err := parseASN(s)
+	if err != nil {
+		return err
+	}
+	*a = jsonASN(n)
+	return nil
+}
+
+// parseASN parses an ASN with or without an AS prefix.
+func parseASN(s string) (uint32, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > 2 && strings.EqualFold(s[:2], "AS") {
+		s = s[2:]
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ASN %q", s)
+	}
+	return uint32(n), nil
+}
+
+// export is the part of a JSON export holding ROAs.
+type export struct {
+	ROAs []struct {
+		ASN       *jsonASN `json:"asn"`
+		Prefix    string   `json:"prefix"`
+		MaxLength *uint8   `json:"maxLength"`
+	} `json:"roas"`
+}
+
+// ReadJSON returns the VRPs of an rpki-client or Routinator JSON export.
+// Anything else in the export is ignored.
+func ReadJSON(r io.Reader) ([]VRP, error) {
+	var ex export
+	if err := json.NewDecoder(r).Decode(&ex); err != nil {
+		return nil, err
+	}
+
+	vrps := make([]VRP, 0, len(ex.ROAs))
+	for _, roa := range ex.ROAs {
+		if roa.ASN == nil {
+			return nil, fmt.Errorf("ROA for %q without an ASN", roa.Prefix)
+		}
+		v, err := newVRP(roa.Prefix, roa.MaxLength, uint32(*roa.ASN))
+		if err != nil {
+			return nil, err
+		}
+		vrps = append(vrps, v)
+	}
+	return vrps, nil
+}
+
+// ReadCSV returns the VRPs of an rpki-client or Routinator CSV export.
+// Columns are found by the header, so any beyond the ASN, prefix and max
+// length are ignored.
+func ReadCSV(r io.Reader) ([]VRP, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read header: %w", err)
+	}
+	cols := map[string]int{"asn": -1, "ip prefix": -1, "max length": -1}
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if _, ok := cols[h]; ok {
+			cols[h] = i
+		}
+	}
+	for h, i := range cols {
+		if i < 0 {
+			return nil, fmt.Errorf("no %q column in header", h)
+		}
+	}
+
+	var vrps []VRP
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return vrps, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec) < len(header) {
+			return nil, fmt.Errorf("short record: %q", rec)
+		}
+
+		asn, err := parseASN(rec[cols["asn"]])
+		if err != nil {
+			return nil, err
+		}
+		var maxLen *uint8
+		if s := strings.TrimSpace(rec[cols["max length"]]); s != "" {
+			n, err := strconv.ParseUint(s, 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid max length %q", s)
+			}
+			m := uint8(n)
+			maxLen = &m
+		}
+		v, err := newVRP(rec[cols["ip prefix"]], maxLen, asn)
+		if err != nil {
+			return nil, err
+		}
+		vrps = append(vrps, v)
+	}
+}
+
+// newVRP returns the VRP for an exported ROA. Without a max length, only
+// the prefix itself is authorised.
+func newVRP(prefix string, maxLen *uint8, asn uint32) (VRP, error) {
+	p, err := netip.ParsePrefix(strings.TrimSpace(prefix))
+	if err != nil {
+		return VRP{}, err
+	}
+	v := VRP{Prefix: p, MaxLen: uint8(p.Bits()), ASN: asn}
+	if maxLen != nil {
+		v.MaxLen = *maxLen
+	}
+	if int(v.MaxLen) < p.Bits() || int(v.MaxLen) > p.Addr().BitLen() {
+		return VRP{}, fmt.Errorf("invalid max length %d for %s", v.MaxLen, p)
+	}
+	return v, nil
+}
+
+// Table returns t, so a loaded Table can stand in for a synced one.
+func (t *Table) Table() *Table {
+	return t
+}
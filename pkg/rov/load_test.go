@@ -0,0 +1,86 @@
+package rov
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	exported := []VRP{
+		{Prefix: netip.MustParsePrefix("1.1.1.0/24"), MaxLen: 24, ASN: 13335},
+		{Prefix: netip.MustParsePrefix("8.0.0.0/8"), MaxLen: 9, ASN: 15169},
+		{Prefix: netip.MustParsePrefix("8.8.8.0/24"), MaxLen: 24, ASN: 15169},
+		{Prefix: netip.MustParsePrefix("2001:4860::/32"), MaxLen: 48, ASN: 15169},
+		{Prefix: netip.MustParsePrefix("2606:4700::/32"), MaxLen: 32, ASN: 0},
+	}
+
+	tests := []struct {
+		file string
+		want []VRP
+	}{
+		{
+			file: "../aspa/testdata/rpki-client.json",
+			want: []VRP{
+				{Prefix: netip.MustParsePrefix("1.1.1.0/24"), MaxLen: 24, ASN: 13335},
+				{Prefix: netip.MustParsePrefix("8.8.8.0/24"), MaxLen: 24, ASN: 15169},
+				{Prefix: netip.MustParsePrefix("2001:4860::/32"), MaxLen: 48, ASN: 15169},
+				{Prefix: netip.MustParsePrefix("2606:4700::/32"), MaxLen: 48, ASN: 13335},
+			},
+		},
+		{file: "testdata/rpki-client.csv", want: exported},
+		{file: "testdata/routinator.json", want: exported},
+		{file: "testdata/routinator.csv", want: exported},
+	}
+	for _, tc := range tests {
+		table, err := Load(tc.file)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.file, err)
+		}
+		if got := table.All(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: Got %v, Wanted %v", tc.file, got, tc.want)
+		}
+	}
+
+	// An exported table validates like any other.
+	table, err := Load("testdata/routinator.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := table.Validate(netip.MustParsePrefix("8.0.0.0/9"), 3356); got != Invalid {
+		t.Errorf("Got %v, Wanted %v", got, Invalid)
+	}
+	if table.Table() != table {
+		t.Errorf("Table should return itself")
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	csvs := []string{
+		"",
+		"ASN,IP Prefix,Trust Anchor\nAS13335,1.1.1.0/24,apnic\n",
+		"ASN,IP Prefix,Max Length\nASX,1.1.1.0/24,24\n",
+		"ASN,IP Prefix,Max Length\nAS13335,1.1.1.0/24,16\n",
+		"ASN,IP Prefix,Max Length\nAS13335,1.1.1.0/24,33\n",
+		"ASN,IP Prefix,Max Length\nAS13335,1.1.1.0,24\n",
+		"ASN,IP Prefix,Max Length\nAS13335,1.1.1.0/24\n",
+	}
+	for _, c := range csvs {
+		if _, err := ReadCSV(strings.NewReader(c)); err == nil {
+			t.Errorf("%q: expected an error", c)
+		}
+	}
+
+	jsons := []string{
+		`{"roas": [{"prefix": "1.1.1.0/24", "maxLength": 24}]}`,
+		`{"roas": [{"asn": "13335x", "prefix": "1.1.1.0/24", "maxLength": 24}]}`,
+		`{"roas": [{"asn": 13335, "prefix": "1.1.1.0/24", "maxLength": 129}]}`,
+		`{"roas": {}}`,
+	}
+	for _, j := range jsons {
+		if _, err := ReadJSON(strings.NewReader(j)); err == nil {
+			t.Errorf("%q: expected an error", j)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Package rov validates route origins against Validated ROA Payloads, as
+// described in RFC 6811.
+package rov
+
+import (
+	"cmp"
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+// State is the validation state of a route. The values match the ROA
+// states used throughout clidecode.
+type State int
+
+const (
+	// NotFound is a route with no VRP covering it.
+	NotFound State = iota
+	// Valid is a route matched by a VRP.
+	Valid
+	// Invalid is a route covered by VRPs, none of which match it.
+	Invalid
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case NotFound:
+		return "not_found"
+	case Valid:
+		return "valid"
+	case Invalid:
+		return "invalid"
+	}
+	return fmt.Sprintf("state(%d)", int(s))
+}
+
+// VRP is a Validated ROA Payload. AS0 never matches a route.
+type VRP struct {
+	Prefix netip.Prefix
+	MaxLen uint8
+	ASN    uint32
+}
+
+// Compare orders VRPs by prefix, then max length, then ASN.
+func (v VRP) Compare(o VRP) int {
+	return cmp.Or(
+		v.Prefix.Addr().Compare(o.Prefix.Addr()),
+		cmp.Compare(v.Prefix.Bits(), o.Prefix.Bits()),
+		cmp.Compare(v.MaxLen, o.MaxLen),
+		cmp.Compare(v.ASN, o.ASN),
+	)
+}
+
+// Table is an immutable set of VRPs to validate routes against.
+type Table struct {
+	byPrefix map[netip.Prefix][]VRP
+	byASN    map[uint32][]VRP
+	// The prefix lengths holding VRPs for each family, longest first, so
+	// a lookup only tries lengths that can match.
+	lengths4, lengths6 []int
+	len                int
+}
+
+// NewTable returns a Table holding vrps. Duplicates are dropped and
+// IPv4-mapped IPv6 prefixes are treated as IPv4.
+func NewTable(vrps []VRP) *Table {
+	t := &Table{
+		byPrefix: make(map[netip.Prefix][]VRP),
+		byASN:    make(map[uint32][]VRP),
+	}
+	seen := make(map[VRP]bool, len(vrps))
+	lengths := make(map[bool]map[int]bool)
+	for _, v := range vrps {
+		v.Prefix = canonical(v.Prefix)
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		t.byPrefix[v.Prefix] = append(t.byPrefix[v.Prefix], v)
+		t.byASN[v.ASN] = append(t.byASN[v.ASN], v)
+
+		is4 := v.Prefix.Addr().Is4()
+		if lengths[is4] == nil {
+			lengths[is4] = make(map[int]bool)
+		}
+		lengths[is4][v.Prefix.Bits()] = true
+	}
+	t.len = len(seen)
+
+	for _, v := range t.byASN {
+		slices.SortFunc(v, VRP.Compare)
+	}
+	for is4, l := range lengths {
+		var sorted []int
+		for bits := range l {
+			sorted = append(sorted, bits)
+		}
+		slices.Sort(sorted)
+		slices.Reverse(sorted)
+		if is4 {
+			t.lengths4 = sorted
+		} else {
+			t.lengths6 = sorted
+		}
+	}
+
+	return t
+}
+
+// canonical returns p masked, with any IPv4-mapped address unmapped.
+func canonical(p netip.Prefix) netip.Prefix {
+	a := p.Addr()
+	bits := p.Bits()
+	if a.Is4In6() {
+		a = a.Unmap()
+		bits = max(bits-96, 0)
+	}
+	return netip.PrefixFrom(a, bits).Masked()
+}
+
+// Len returns the amount of VRPs in the table.
+func (t *Table) Len() int {
+	return t.len
+}
+
+// Validate returns the state of a route for prefix originated by origin.
+func (t *Table) Validate(prefix netip.Prefix, origin uint32) State {
+	prefix = canonical(prefix)
+	lengths := t.lengths6
+	if prefix.Addr().Is4() {
+		lengths = t.lengths4
+	}
+
+	state := NotFound
+	for _, bits := range lengths {
+		if bits > prefix.Bits() {
+			continue
+		}
+		covering := netip.PrefixFrom(prefix.Addr(), bits).Masked()
+		for _, v := range t.byPrefix[covering] {
+			if v.ASN != 0 && v.ASN == origin && prefix.Bits() <= int(v.MaxLen) {
+				return Valid
+			}
+			state = Invalid
+		}
+	}
+	return state
+}
+
+// VRPs returns every VRP for asn, sorted.
+func (t *Table) VRPs(asn uint32) []VRP {
+	return slices.Clone(t.byASN[asn])
+}
+
+// All returns every VRP in the table, sorted.
+func (t *Table) All() []VRP {
+	all := make([]VRP, 0, t.len)
+	for _, v := range t.byPrefix {
+		all = append(all, v...)
+	}
+	slices.SortFunc(all, VRP.Compare)
+	return all
+}
@@ -0,0 +1,79 @@
+package rov
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+var testVRPs = []VRP{
+	{Prefix: netip.MustParsePrefix("1.1.1.0/24"), MaxLen: 24, ASN: 13335},
+	{Prefix: netip.MustParsePrefix("8.8.8.0/24"), MaxLen: 24, ASN: 15169},
+	{Prefix: netip.MustParsePrefix("8.0.0.0/9"), MaxLen: 9, ASN: 3356},
+	// A duplicate, which is dropped.
+	{Prefix: netip.MustParsePrefix("8.0.0.0/9"), MaxLen: 9, ASN: 3356},
+	// AS0 says nothing should originate 10.0.0.0/8.
+	{Prefix: netip.MustParsePrefix("10.0.0.0/8"), MaxLen: 32, ASN: 0},
+	{Prefix: netip.MustParsePrefix("2606:4700::/32"), MaxLen: 48, ASN: 13335},
+	{Prefix: netip.MustParsePrefix("2001:4860::/32"), MaxLen: 48, ASN: 15169},
+}
+
+func TestValidate(t *testing.T) {
+	table := NewTable(testVRPs)
+
+	tests := []struct {
+		prefix string
+		origin uint32
+		want   State
+	}{
+		{prefix: "1.1.1.0/24", origin: 13335, want: Valid},
+		{prefix: "1.1.1.0/24", origin: 666, want: Invalid},
+		// Longer than the max length.
+		{prefix: "1.1.1.0/25", origin: 13335, want: Invalid},
+		{prefix: "1.1.0.0/23", origin: 13335, want: NotFound},
+		// Covered by 8.0.0.0/9 too, but matched by 8.8.8.0/24.
+		{prefix: "8.8.8.0/24", origin: 15169, want: Valid},
+		{prefix: "8.8.4.0/24", origin: 15169, want: Invalid},
+		{prefix: "8.0.0.0/9", origin: 3356, want: Valid},
+		{prefix: "9.9.9.0/24", origin: 19281, want: NotFound},
+		{prefix: "10.1.0.0/16", origin: 0, want: Invalid},
+		{prefix: "2606:4700::/32", origin: 13335, want: Valid},
+		{prefix: "2606:4700:10::/48", origin: 13335, want: Valid},
+		{prefix: "2606:4700:10::/64", origin: 13335, want: Invalid},
+		{prefix: "2a00::/12", origin: 13335, want: NotFound},
+		{prefix: "::ffff:1.1.1.0/120", origin: 13335, want: Valid},
+	}
+	for _, tc := range tests {
+		if got := table.Validate(netip.MustParsePrefix(tc.prefix), tc.origin); got != tc.want {
+			t.Errorf("%s AS%d: Got %v, Wanted %v", tc.prefix, tc.origin, got, tc.want)
+		}
+	}
+}
+
+func TestVRPs(t *testing.T) {
+	table := NewTable(testVRPs)
+	if got := table.Len(); got != 6 {
+		t.Errorf("Got %d, Wanted %d", got, 6)
+	}
+
+	got := table.VRPs(13335)
+	want := []VRP{testVRPs[0], testVRPs[5]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+	if got := table.VRPs(64496); got != nil {
+		t.Errorf("Got %v, Wanted nil", got)
+	}
+
+	all := table.All()
+	if len(all) != 6 || all[0] != testVRPs[0] || all[5] != testVRPs[5] {
+		t.Errorf("Got %v", all)
+	}
+}
+
+func TestValidateEmpty(t *testing.T) {
+	var table Table
+	if got := table.Validate(netip.MustParsePrefix("1.1.1.0/24"), 13335); got != NotFound {
+		t.Errorf("Got %v, Wanted %v", got, NotFound)
+	}
+}
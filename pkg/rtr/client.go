@@ -0,0 +1,314 @@
+// Package rtr is an RPKI-to-Router protocol client, as described in
+// RFC 8210 and draft-ietf-sidrops-8210bis. It keeps the VRPs, and from
+// version 2 the ASPAs, of any RTR cache in memory so routes can be
+// validated without the router doing it.
+package rtr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/aspa"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/rov"
+)
+
+// Intervals used until the cache sends its own, from RFC 8210 section 6.
+const (
+	defaultRefresh = time.Hour
+	defaultRetry   = 10 * time.Minute
+	defaultExpire  = 2 * time.Hour
+)
+
+// Client keeps the data of a single RTR cache. Table and ASPAs are safe to
+// call while Run is syncing.
+type Client struct {
+	addr    string
+	dial    func(ctx context.Context, network, addr string) (net.Conn, error)
+	version uint8
+
+	table  atomic.Pointer[rov.Table]
+	aspas  atomic.Pointer[aspa.Engine]
+	synced chan struct{}
+	once   sync.Once
+
+	// The data of the last complete sync, only touched by Run.
+	hasState               bool
+	session                uint16
+	serial                 uint32
+	vrps                   map[rov.VRP]bool
+	providers              map[uint32][]uint32
+	refresh, retry, expire time.Duration
+	lastSync               time.Time
+}
+
+// NewClient returns a Client for the cache at addr, i.e. rtr.example.net:323.
+// It starts with version 2, dropping to whatever the cache supports.
+func NewClient(addr string) *Client {
+	var d net.Dialer
+	return &Client{
+		addr:    addr,
+		dial:    d.DialContext,
+		version: Version2,
+		synced:  make(chan struct{}),
+		refresh: defaultRefresh,
+		retry:   defaultRetry,
+		expire:  defaultExpire,
+	}
+}
+
+// Table returns the VRPs of the last complete sync, or nil before the
+// first sync and once the data has expired.
+func (c *Client) Table() *rov.Table {
+	return c.table.Load()
+}
+
+// ASPAs returns the ASPAs of the last complete sync. It's nil unless the
+// cache talks version 2.
+func (c *Client) ASPAs() *aspa.Engine {
+	return c.aspas.Load()
+}
+
+// Synced is closed once the first sync completes.
+func (c *Client) Synced() <-chan struct{} {
+	return c.synced
+}
+
+// Run keeps the client in sync with the cache until ctx is done. Broken
+// sessions are retried after the retry interval, and data that hasn't been
+// refreshed within the expire interval is dropped.
+func (c *Client) Run(ctx context.Context) error {
+	for {
+		err := c.run(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var e *Error
+		if errors.As(err, &e) && e.Code == ErrUnsupportedVersion && e.Version < c.version {
+			log.Printf("rtr: %s only supports version %d", c.addr, e.Version)
+			c.version = e.Version
+			c.hasState = false
+			continue
+		}
+		log.Printf("rtr: session with %s ended: %v", c.addr, err)
+
+		c.expireData()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.retry):
+		}
+	}
+}
+
+// expireData drops the data if it hasn't been refreshed within the expire
+// interval.
+func (c *Client) expireData() {
+	if c.hasState && time.Since(c.lastSync) > c.expire {
+		log.Printf("rtr: data from %s has expired", c.addr)
+		c.hasState = false
+		c.table.Store(nil)
+		c.aspas.Store(nil)
+	}
+}
+
+// read is a PDU read from the cache.
+type read struct {
+	version uint8
+	pdu     PDU
+	err     error
+}
+
+// transfer holds the changes sent between a Cache Response and End of Data.
+// They're only applied once End of Data arrives.
+type transfer struct {
+	reset    bool
+	session  uint16
+	prefixes []Prefix
+	aspas    []ASPA
+}
+
+// run holds a single session with the cache, until it fails or ctx is done.
+func (c *Client) run(ctx context.Context) error {
+	conn, err := c.dial(ctx, "tcp", c.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	done := make(chan struct{})
+	defer close(done)
+	reads := make(chan read)
+	go func() {
+		for {
+			v, p, err := ReadPDU(conn)
+			select {
+			case reads <- read{version: v, pdu: p, err: err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	query := func() error {
+		if c.hasState {
+			return WritePDU(conn, c.version, SerialQuery{Session: c.session, Serial: c.serial})
+		}
+		return WritePDU(conn, c.version, ResetQuery{})
+	}
+	// fail reports an error to the cache before giving up on the session.
+	fail := func(code uint16, err error) error {
+		WritePDU(conn, c.version, ErrorReport{Code: code, Text: err.Error()})
+		return err
+	}
+
+	// A query is sent every refresh interval, and the cache answers within
+	// the retry interval, so a session with nothing to read for longer than
+	// both has stalled.
+	deadline := func() {
+		conn.SetReadDeadline(time.Now().Add(c.refresh + c.retry))
+	}
+
+	deadline()
+	if err := query(); err != nil {
+		return err
+	}
+	refresh := time.NewTimer(c.refresh)
+	defer refresh.Stop()
+	var tx *transfer
+	for {
+		var r read
+		select {
+		case <-refresh.C:
+			c.expireData()
+			if tx != nil {
+				// A transfer has taken the whole refresh interval.
+				return errors.New("transfer stalled")
+			}
+			if err := query(); err != nil {
+				return err
+			}
+			refresh.Reset(c.refresh)
+			continue
+		case r = <-reads:
+		}
+		if r.err != nil {
+			return r.err
+		}
+		deadline()
+
+		if e, ok := r.pdu.(ErrorReport); ok {
+			return &Error{Version: r.version, Code: e.Code, Text: e.Text}
+		}
+		if r.version != c.version {
+			// A cache may answer the first query with an older version.
+			if c.hasState || tx != nil || r.version > c.version {
+				return fail(ErrUnexpectedVersion, fmt.Errorf("unexpected version %d", r.version))
+			}
+			c.version = r.version
+		}
+
+		switch p := r.pdu.(type) {
+		case SerialNotify:
+			if tx == nil && (!c.hasState || p.Serial != c.serial) {
+				if err := query(); err != nil {
+					return err
+				}
+			}
+		case CacheResponse:
+			if tx != nil {
+				return fail(ErrCorruptData, errors.New("cache response during a transfer"))
+			}
+			if c.hasState && p.Session != c.session {
+				// The cache has restarted, so the next session starts
+				// again from a Reset Query. The old data is used until then.
+				c.hasState = false
+				return fmt.Errorf("session changed from %d to %d", c.session, p.Session)
+			}
+			tx = &transfer{reset: !c.hasState, session: p.Session}
+		case Prefix:
+			if tx == nil {
+				return fail(ErrCorruptData, errors.New("prefix outside a transfer"))
+			}
+			tx.prefixes = append(tx.prefixes, p)
+		case ASPA:
+			if tx == nil || c.version < Version2 {
+				return fail(ErrCorruptData, errors.New("unexpected ASPA"))
+			}
+			tx.aspas = append(tx.aspas, p)
+		case RouterKey:
+			// BGPsec router keys aren't used.
+		case EndOfData:
+			if tx == nil {
+				return fail(ErrCorruptData, errors.New("end of data outside a transfer"))
+			}
+			c.commit(tx, p)
+			tx = nil
+			refresh.Reset(c.refresh)
+			deadline()
+		case CacheReset:
+			c.hasState = false
+			if err := query(); err != nil {
+				return err
+			}
+		default:
+			return fail(ErrUnsupportedPDU, fmt.Errorf("unsupported PDU %T", p))
+		}
+	}
+}
+
+// commit applies a completed transfer, then publishes the result.
+func (c *Client) commit(tx *transfer, eod EndOfData) {
+	if tx.reset {
+		c.vrps = make(map[rov.VRP]bool)
+		c.providers = make(map[uint32][]uint32)
+	}
+	for _, p := range tx.prefixes {
+		v := rov.VRP{Prefix: p.Prefix, MaxLen: p.MaxLen, ASN: p.ASN}
+		if p.Flags&FlagAnnounce != 0 {
+			c.vrps[v] = true
+		} else {
+			delete(c.vrps, v)
+		}
+	}
+	for _, a := range tx.aspas {
+		if a.Flags&FlagAnnounce != 0 {
+			c.providers[a.Customer] = a.Providers
+		} else {
+			delete(c.providers, a.Customer)
+		}
+	}
+
+	c.hasState = true
+	c.session, c.serial = tx.session, eod.Serial
+	// Version 0 caches don't send intervals.
+	if eod.Refresh > 0 {
+		c.refresh = time.Duration(eod.Refresh) * time.Second
+	}
+	if eod.Retry > 0 {
+		c.retry = time.Duration(eod.Retry) * time.Second
+	}
+	if eod.Expire > 0 {
+		c.expire = time.Duration(eod.Expire) * time.Second
+	}
+	c.lastSync = time.Now()
+
+	c.table.Store(rov.NewTable(slices.Collect(maps.Keys(c.vrps))))
+	if c.version >= Version2 {
+		c.aspas.Store(aspa.New(c.providers))
+	}
+	c.once.Do(func() { close(c.synced) })
+}
@@ -0,0 +1,191 @@
+package rtr_test
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/rov"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/rtr"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/rtr/rtrtest"
+)
+
+var (
+	cloudflare = rov.VRP{Prefix: netip.MustParsePrefix("1.1.1.0/24"), MaxLen: 24, ASN: 13335}
+	google     = rov.VRP{Prefix: netip.MustParsePrefix("8.8.8.0/24"), MaxLen: 24, ASN: 15169}
+	google6    = rov.VRP{Prefix: netip.MustParsePrefix("2001:4860::/32"), MaxLen: 48, ASN: 15169}
+)
+
+// startClient runs a client against the cache at addr until the test ends,
+// and waits for its first sync.
+func startClient(t *testing.T, addr string) *rtr.Client {
+	t.Helper()
+	c := rtr.NewClient(addr)
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	select {
+	case <-c.Synced():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the first sync")
+	}
+	return c
+}
+
+// waitFor polls the client's table until ok returns true.
+func waitFor(t *testing.T, c *rtr.Client, ok func(*rov.Table) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if table := c.Table(); table != nil && ok(table) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timed out waiting for the table")
+}
+
+func TestClient(t *testing.T) {
+	s, err := rtrtest.NewServer(rtr.Version2, []rov.VRP{cloudflare, google}, map[uint32][]uint32{13335: {6939, 3356}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c := startClient(t, s.Addr)
+
+	if got, want := c.Table().All(), []rov.VRP{cloudflare, google}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+	if got, want := c.Table().Validate(netip.MustParsePrefix("1.1.1.0/24"), 13335), rov.Valid; got != want {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+	providers, ok := c.ASPAs().Providers(13335)
+	if want := []uint32{3356, 6939}; !ok || !reflect.DeepEqual(providers, want) {
+		t.Errorf("Got %v, %t, Wanted %v", providers, ok, want)
+	}
+
+	// The Serial Notify has the client ask for the changes.
+	s.Update([]rov.VRP{google, google6}, map[uint32][]uint32{15169: {3356}})
+	waitFor(t, c, func(table *rov.Table) bool { return table.Len() == 2 && len(table.VRPs(13335)) == 0 })
+	if got, want := c.Table().All(), []rov.VRP{google, google6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+	if _, ok := c.ASPAs().Providers(13335); ok {
+		t.Error("Got withdrawn ASPA for 13335")
+	}
+	if _, ok := c.ASPAs().Providers(15169); !ok {
+		t.Error("Missing ASPA for 15169")
+	}
+
+	// Without the history, the cache resets the client.
+	s.Reset([]rov.VRP{cloudflare}, nil)
+	waitFor(t, c, func(table *rov.Table) bool { return table.Len() == 1 })
+	if got, want := c.Table().All(), []rov.VRP{cloudflare}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+}
+
+func TestClientVersion1(t *testing.T) {
+	// The client starts at version 2, so has to drop back.
+	s, err := rtrtest.NewServer(rtr.Version1, []rov.VRP{cloudflare, google6}, map[uint32][]uint32{13335: {6939}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c := startClient(t, s.Addr)
+
+	if got, want := c.Table().All(), []rov.VRP{cloudflare, google6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, Wanted %v", got, want)
+	}
+	if c.ASPAs() != nil {
+		t.Error("Got ASPAs from a version 1 cache")
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	s, err := rtrtest.NewServer(rtr.Version2, []rov.VRP{cloudflare}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := startClient(t, s.Addr)
+
+	// Take the server away, and bring it back on the same address. The
+	// data is kept while the client retries.
+	addr := s.Addr
+	s.Close()
+	s, err = rtrtest.NewServerOn(addr, rtr.Version2, []rov.VRP{google}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if c.Table() == nil {
+		t.Fatal("Lost the table on disconnect")
+	}
+	waitFor(t, c, func(table *rov.Table) bool { return len(table.VRPs(15169)) == 1 })
+}
+
+func TestClientStalled(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// The first query gets a full sync with short intervals. Every query
+	// after that starts a transfer that never finishes.
+	var synced atomic.Bool
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					if _, _, err := rtr.ReadPDU(conn); err != nil {
+						return
+					}
+					if synced.Swap(true) {
+						rtr.WritePDU(conn, rtr.Version2, rtr.CacheResponse{Session: 1})
+						continue
+					}
+					for _, p := range []rtr.PDU{
+						rtr.CacheResponse{Session: 1},
+						rtr.Prefix{Flags: rtr.FlagAnnounce, Prefix: cloudflare.Prefix, MaxLen: cloudflare.MaxLen, ASN: cloudflare.ASN},
+						rtr.EndOfData{Session: 1, Serial: 1, Refresh: 1, Retry: 1, Expire: 2},
+					} {
+						rtr.WritePDU(conn, rtr.Version2, p)
+					}
+				}
+			}()
+		}
+	}()
+
+	c := startClient(t, ln.Addr().String())
+	if c.Table() == nil {
+		t.Fatal("Missing the table after the first sync")
+	}
+
+	// The stalled transfer is given up on, and the data dropped once it
+	// expires.
+	deadline := time.Now().Add(10 * time.Second)
+	for c.Table() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the data to expire")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
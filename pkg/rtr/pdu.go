@@ -0,0 +1,309 @@
+package rtr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+)
+
+// Protocol versions. Version 2 adds ASPA PDUs.
+const (
+	Version0 uint8 = 0
+	Version1 uint8 = 1
+	Version2 uint8 = 2
+)
+
+// PDU types, from the IANA RPKI-Router Protocol registry.
+const (
+	typeSerialNotify  uint8 = 0
+	typeSerialQuery   uint8 = 1
+	typeResetQuery    uint8 = 2
+	typeCacheResponse uint8 = 3
+	typeIPv4Prefix    uint8 = 4
+	typeIPv6Prefix    uint8 = 6
+	typeEndOfData     uint8 = 7
+	typeCacheReset    uint8 = 8
+	typeRouterKey     uint8 = 9
+	typeErrorReport   uint8 = 10
+	typeASPA          uint8 = 11
+)
+
+// Error Report codes.
+const (
+	ErrCorruptData        uint16 = 0
+	ErrInternal           uint16 = 1
+	ErrNoData             uint16 = 2
+	ErrInvalidRequest     uint16 = 3
+	ErrUnsupportedVersion uint16 = 4
+	ErrUnsupportedPDU     uint16 = 5
+	ErrUnknownWithdrawal  uint16 = 6
+	ErrDuplicateAnnounce  uint16 = 7
+	ErrUnexpectedVersion  uint16 = 8
+	ErrASPAProviderList   uint16 = 9
+)
+
+// FlagAnnounce is set on prefix and ASPA PDUs announcing a record, and
+// clear on those withdrawing one.
+const FlagAnnounce uint8 = 1
+
+const headerLen = 8
+
+// maxPDULen bounds the length read from a header, well beyond the largest
+// ASPA or Error Report a cache should send.
+const maxPDULen = 1 << 20
+
+// PDU is a single RTR protocol data unit.
+type PDU interface {
+	pduType() uint8
+}
+
+// SerialNotify tells the router the cache has new data.
+type SerialNotify struct {
+	Session uint16
+	Serial  uint32
+}
+
+// SerialQuery asks the cache for changes since Serial.
+type SerialQuery struct {
+	Session uint16
+	Serial  uint32
+}
+
+// ResetQuery asks the cache for all of its data.
+type ResetQuery struct{}
+
+// CacheResponse starts the data answering a query.
+type CacheResponse struct {
+	Session uint16
+}
+
+// Prefix announces or withdraws a VRP. The address family is taken from
+// the prefix.
+type Prefix struct {
+	Flags  uint8
+	Prefix netip.Prefix
+	MaxLen uint8
+	ASN    uint32
+}
+
+// EndOfData ends the data answering a query. The intervals are in seconds,
+// and are only carried from version 1.
+type EndOfData struct {
+	Session                uint16
+	Serial                 uint32
+	Refresh, Retry, Expire uint32
+}
+
+// CacheReset tells the router the cache can't answer a Serial Query.
+type CacheReset struct{}
+
+// RouterKey carries a BGPsec router key. It's read so it can be skipped.
+type RouterKey struct {
+	Flags uint8
+	Body  []byte
+}
+
+// ErrorReport reports an error in the PDU it carries, if any.
+type ErrorReport struct {
+	Code uint16
+	PDU  []byte
+	Text string
+}
+
+// ASPA announces the providers of a customer ASN, or withdraws its ASPA
+// when Flags doesn't have FlagAnnounce set.
+type ASPA struct {
+	Flags     uint8
+	Customer  uint32
+	Providers []uint32
+}
+
+func (SerialNotify) pduType() uint8  { return typeSerialNotify }
+func (SerialQuery) pduType() uint8   { return typeSerialQuery }
+func (ResetQuery) pduType() uint8    { return typeResetQuery }
+func (CacheResponse) pduType() uint8 { return typeCacheResponse }
+func (EndOfData) pduType() uint8     { return typeEndOfData }
+func (CacheReset) pduType() uint8    { return typeCacheReset }
+func (RouterKey) pduType() uint8     { return typeRouterKey }
+func (ErrorReport) pduType() uint8   { return typeErrorReport }
+func (ASPA) pduType() uint8          { return typeASPA }
+
+func (p Prefix) pduType() uint8 {
+	if p.Prefix.Addr().Is4() {
+		return typeIPv4Prefix
+	}
+	return typeIPv6Prefix
+}
+
+// Error is an Error Report received from the other side.
+type Error struct {
+	Version uint8
+	Code    uint16
+	Text    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rtr error report %d: %s", e.Code, e.Text)
+}
+
+// errCorrupt is returned for PDUs that can't be decoded.
+var errCorrupt = errors.New("corrupt PDU")
+
+// ReadPDU reads a single PDU from r, returning it with the version in its
+// header. Unknown PDU types are an error.
+func ReadPDU(r io.Reader) (uint8, PDU, error) {
+	var hdr [headerLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	version, typ := hdr[0], hdr[1]
+	field := binary.BigEndian.Uint16(hdr[2:4])
+	length := binary.BigEndian.Uint32(hdr[4:8])
+	if length < headerLen || length > maxPDULen {
+		return version, nil, fmt.Errorf("%w: length %d", errCorrupt, length)
+	}
+	body := make([]byte, length-headerLen)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return version, nil, err
+	}
+
+	p, err := decode(typ, field, body)
+	if err != nil {
+		return version, nil, fmt.Errorf("type %d: %w", typ, err)
+	}
+	return version, p, nil
+}
+
+// decode returns the PDU of type typ, with field the 16 bits after the type
+// in the header and body everything after the length.
+func decode(typ uint8, field uint16, body []byte) (PDU, error) {
+	be := binary.BigEndian
+	switch typ {
+	case typeSerialNotify, typeSerialQuery:
+		if len(body) != 4 {
+			return nil, errCorrupt
+		}
+		if typ == typeSerialNotify {
+			return SerialNotify{Session: field, Serial: be.Uint32(body)}, nil
+		}
+		return SerialQuery{Session: field, Serial: be.Uint32(body)}, nil
+	case typeResetQuery:
+		return ResetQuery{}, nil
+	case typeCacheResponse:
+		return CacheResponse{Session: field}, nil
+	case typeCacheReset:
+		return CacheReset{}, nil
+	case typeIPv4Prefix, typeIPv6Prefix:
+		size := 4
+		if typ == typeIPv6Prefix {
+			size = 16
+		}
+		if len(body) != 4+size+4 {
+			return nil, errCorrupt
+		}
+		addr, _ := netip.AddrFromSlice(body[4 : 4+size])
+		prefix, err := addr.Prefix(int(body[1]))
+		if err != nil || body[2] < body[1] || int(body[2]) > addr.BitLen() {
+			return nil, errCorrupt
+		}
+		return Prefix{
+			Flags:  body[0],
+			Prefix: prefix,
+			MaxLen: body[2],
+			ASN:    be.Uint32(body[4+size:]),
+		}, nil
+	case typeEndOfData:
+		e := EndOfData{Session: field}
+		switch len(body) {
+		case 4:
+		case 16:
+			e.Refresh = be.Uint32(body[4:])
+			e.Retry = be.Uint32(body[8:])
+			e.Expire = be.Uint32(body[12:])
+		default:
+			return nil, errCorrupt
+		}
+		e.Serial = be.Uint32(body)
+		return e, nil
+	case typeRouterKey:
+		return RouterKey{Flags: uint8(field >> 8), Body: body}, nil
+	case typeErrorReport:
+		if len(body) < 4 {
+			return nil, errCorrupt
+		}
+		n := be.Uint32(body)
+		if uint64(len(body)) < 8+uint64(n) {
+			return nil, errCorrupt
+		}
+		e := ErrorReport{Code: field, PDU: body[4 : 4+n]}
+		rest := body[4+n:]
+		t := be.Uint32(rest)
+		if uint64(len(rest)) != 4+uint64(t) {
+			return nil, errCorrupt
+		}
+		e.Text = string(rest[4:])
+		return e, nil
+	case typeASPA:
+		if len(body) < 4 || len(body)%4 != 0 {
+			return nil, errCorrupt
+		}
+		a := ASPA{Flags: uint8(field >> 8), Customer: be.Uint32(body)}
+		for i := 4; i < len(body); i += 4 {
+			a.Providers = append(a.Providers, be.Uint32(body[i:]))
+		}
+		return a, nil
+	}
+	return nil, fmt.Errorf("unsupported PDU type")
+}
+
+// WritePDU writes p to w with version in its header.
+func WritePDU(w io.Writer, version uint8, p PDU) error {
+	var field uint16
+	var body []byte
+	be := binary.BigEndian
+	switch p := p.(type) {
+	case SerialNotify:
+		field, body = p.Session, be.AppendUint32(nil, p.Serial)
+	case SerialQuery:
+		field, body = p.Session, be.AppendUint32(nil, p.Serial)
+	case ResetQuery, CacheReset:
+	case CacheResponse:
+		field = p.Session
+	case Prefix:
+		body = []byte{p.Flags, uint8(p.Prefix.Bits()), p.MaxLen, 0}
+		body = append(body, p.Prefix.Addr().AsSlice()...)
+		body = be.AppendUint32(body, p.ASN)
+	case EndOfData:
+		field, body = p.Session, be.AppendUint32(nil, p.Serial)
+		if version > Version0 {
+			body = be.AppendUint32(body, p.Refresh)
+			body = be.AppendUint32(body, p.Retry)
+			body = be.AppendUint32(body, p.Expire)
+		}
+	case RouterKey:
+		field, body = uint16(p.Flags)<<8, p.Body
+	case ErrorReport:
+		field = p.Code
+		body = be.AppendUint32(nil, uint32(len(p.PDU)))
+		body = append(body, p.PDU...)
+		body = be.AppendUint32(body, uint32(len(p.Text)))
+		body = append(body, p.Text...)
+	case ASPA:
+		field = uint16(p.Flags) << 8
+		body = be.AppendUint32(nil, p.Customer)
+		for _, asn := range p.Providers {
+			body = be.AppendUint32(body, asn)
+		}
+	default:
+		return fmt.Errorf("unknown PDU %T", p)
+	}
+
+	buf := make([]byte, headerLen, headerLen+len(body))
+	buf[0], buf[1] = version, p.pduType()
+	be.PutUint16(buf[2:], field)
+	be.PutUint32(buf[4:], uint32(headerLen+len(body)))
+	_, err := w.Write(append(buf, body...))
+	return err
+}
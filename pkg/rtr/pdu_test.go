@@ -0,0 +1,73 @@
+package rtr
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestPDURoundTrip(t *testing.T) {
+	tests := []struct {
+		version uint8
+		pdu     PDU
+		len     int
+	}{
+		{version: Version1, pdu: SerialNotify{Session: 7, Serial: 42}, len: 12},
+		{version: Version1, pdu: SerialQuery{Session: 7, Serial: 42}, len: 12},
+		{version: Version1, pdu: ResetQuery{}, len: 8},
+		{version: Version1, pdu: CacheResponse{Session: 7}, len: 8},
+		{version: Version1, pdu: Prefix{Flags: FlagAnnounce, Prefix: netip.MustParsePrefix("1.1.1.0/24"), MaxLen: 24, ASN: 13335}, len: 20},
+		{version: Version1, pdu: Prefix{Prefix: netip.MustParsePrefix("2606:4700::/32"), MaxLen: 48, ASN: 13335}, len: 32},
+		{version: Version0, pdu: EndOfData{Session: 7, Serial: 42}, len: 12},
+		{version: Version1, pdu: EndOfData{Session: 7, Serial: 42, Refresh: 3600, Retry: 600, Expire: 7200}, len: 24},
+		{version: Version1, pdu: CacheReset{}, len: 8},
+		{version: Version1, pdu: ErrorReport{Code: ErrNoData, PDU: []byte{1, 2, 0, 0, 0, 0, 0, 8}, Text: "no data"}, len: 31},
+		{version: Version2, pdu: ASPA{Flags: FlagAnnounce, Customer: 13335, Providers: []uint32{3356, 6939}}, len: 20},
+		{version: Version2, pdu: ASPA{Customer: 13335}, len: 12},
+	}
+	for _, tc := range tests {
+		var buf bytes.Buffer
+		if err := WritePDU(&buf, tc.version, tc.pdu); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() != tc.len {
+			t.Errorf("%T: Got length %d, Wanted %d", tc.pdu, buf.Len(), tc.len)
+		}
+		version, got, err := ReadPDU(&buf)
+		if err != nil {
+			t.Fatalf("%T: %v", tc.pdu, err)
+		}
+		if version != tc.version || !reflect.DeepEqual(got, tc.pdu) {
+			t.Errorf("Got %d %#v, Wanted %d %#v", version, got, tc.version, tc.pdu)
+		}
+	}
+}
+
+func TestReadPDUErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{name: "Short length", in: []byte{1, 2, 0, 0, 0, 0, 0, 4}},
+		{name: "Huge length", in: []byte{1, 2, 0, 0, 0xff, 0xff, 0xff, 0xff}},
+		{name: "Unknown type", in: []byte{1, 5, 0, 0, 0, 0, 0, 8}},
+		{name: "Short serial", in: []byte{1, 0, 0, 0, 0, 0, 0, 10, 0, 0}},
+		{name: "Prefix too long", in: []byte{1, 4, 0, 0, 0, 0, 0, 20, 1, 33, 33, 0, 1, 1, 1, 0, 0, 0, 0x34, 0x17}},
+		{name: "Max length too short", in: []byte{1, 4, 0, 0, 0, 0, 0, 20, 1, 24, 16, 0, 1, 1, 1, 0, 0, 0, 0x34, 0x17}},
+		{name: "Bad end of data", in: []byte{1, 7, 0, 0, 0, 0, 0, 16, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{name: "Bad error report", in: []byte{1, 10, 0, 0, 0, 0, 0, 16, 0, 0, 0, 9, 0, 0, 0, 0}},
+		{name: "Bad ASPA", in: []byte{2, 11, 1, 0, 0, 0, 0, 14, 0, 0, 0x34, 0x17, 0, 0}},
+	}
+	for _, tc := range tests {
+		if _, _, err := ReadPDU(bytes.NewReader(tc.in)); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+
+	if _, _, err := ReadPDU(bytes.NewReader([]byte{1, 2, 0})); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Got %v, Wanted %v", err, io.ErrUnexpectedEOF)
+	}
+}
@@ -0,0 +1,242 @@
+// Package rtrtest provides an RTR cache for tests, serving a fixed set of
+// VRPs and ASPAs on a local port.
+package rtrtest
+
+import (
+	"maps"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/rov"
+	"github.com/mellowdrifter/bgp_infrastructure/pkg/rtr"
+)
+
+// data is the state of the cache at one serial.
+type data struct {
+	vrps  map[rov.VRP]bool
+	aspas map[uint32][]uint32
+}
+
+// Server is an RTR cache listening on the loopback address.
+type Server struct {
+	// Addr is the address of the server, i.e. 127.0.0.1:50323.
+	Addr string
+
+	ln      net.Listener
+	version uint8
+
+	mu      sync.Mutex
+	session uint16
+	serial  uint32
+	// Every serial the cache can still answer a Serial Query from.
+	history map[uint32]data
+	conns   map[*conn]bool
+}
+
+// conn is a single router connection. Writes are serialised so a Serial
+// Notify can't land in the middle of a transfer.
+type conn struct {
+	mu      sync.Mutex
+	c       net.Conn
+	version uint8
+}
+
+// sessions gives every server its own session ID, as a restarted cache
+// would have.
+var sessions atomic.Uint32
+
+// NewServer starts a cache talking up to version, serving vrps and aspas
+// at serial 1. Close it when done.
+func NewServer(version uint8, vrps []rov.VRP, aspas map[uint32][]uint32) (*Server, error) {
+	return NewServerOn("127.0.0.1:0", version, vrps, aspas)
+}
+
+// NewServerOn is NewServer listening on addr, i.e. to bring a cache back
+// on the address of one that's been closed.
+func NewServerOn(addr string, version uint8, vrps []rov.VRP, aspas map[uint32][]uint32) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Addr:    ln.Addr().String(),
+		ln:      ln,
+		version: version,
+		session: uint16(sessions.Add(1)),
+		serial:  1,
+		history: map[uint32]data{1: newData(vrps, aspas)},
+		conns:   make(map[*conn]bool),
+	}
+	go s.serve()
+	return s, nil
+}
+
+func newData(vrps []rov.VRP, aspas map[uint32][]uint32) data {
+	d := data{vrps: make(map[rov.VRP]bool), aspas: maps.Clone(aspas)}
+	for _, v := range vrps {
+		d.vrps[v] = true
+	}
+	if d.aspas == nil {
+		d.aspas = make(map[uint32][]uint32)
+	}
+	return d
+}
+
+// Close stops the server and drops every connection.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.c.Close()
+	}
+	return err
+}
+
+// Update moves the cache to the next serial with new data, and notifies
+// every router.
+func (s *Server) Update(vrps []rov.VRP, aspas map[uint32][]uint32) {
+	s.mu.Lock()
+	s.serial++
+	s.history[s.serial] = newData(vrps, aspas)
+	s.mu.Unlock()
+	s.notify()
+}
+
+// Reset replaces the data and forgets every earlier serial, so routers
+// have to start again from a Reset Query.
+func (s *Server) Reset(vrps []rov.VRP, aspas map[uint32][]uint32) {
+	s.mu.Lock()
+	s.serial++
+	s.history = map[uint32]data{s.serial: newData(vrps, aspas)}
+	s.mu.Unlock()
+	s.notify()
+}
+
+// notify sends a Serial Notify to every router.
+func (s *Server) notify() {
+	s.mu.Lock()
+	session, serial := s.session, s.serial
+	conns := slices.Collect(maps.Keys(s.conns))
+	s.mu.Unlock()
+	for _, c := range conns {
+		c.write(rtr.SerialNotify{Session: session, Serial: serial})
+	}
+}
+
+func (s *Server) serve() {
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &conn{c: nc}
+		s.mu.Lock()
+		s.conns[c] = true
+		s.mu.Unlock()
+		go func() {
+			s.handle(c)
+			nc.Close()
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func (c *conn) setVersion(v uint8) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version = v
+}
+
+func (c *conn) write(pdus ...rtr.PDU) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, p := range pdus {
+		if err := rtr.WritePDU(c.c, c.version, p); err != nil {
+			return
+		}
+	}
+}
+
+// handle answers the queries of a single router until it goes away.
+func (s *Server) handle(c *conn) {
+	for {
+		version, p, err := rtr.ReadPDU(c.c)
+		if err != nil {
+			return
+		}
+		if version > s.version {
+			c.setVersion(s.version)
+			c.write(rtr.ErrorReport{Code: rtr.ErrUnsupportedVersion, Text: "unsupported version"})
+			return
+		}
+		c.setVersion(version)
+
+		s.mu.Lock()
+		session, serial, cur := s.session, s.serial, s.history[s.serial]
+		var from data
+		var ok bool
+		if q, isSerial := p.(rtr.SerialQuery); isSerial {
+			from, ok = s.history[q.Serial]
+			ok = ok && q.Session == session
+		}
+		s.mu.Unlock()
+
+		switch p.(type) {
+		case rtr.ResetQuery:
+			ok = true
+		case rtr.SerialQuery:
+			if !ok {
+				c.write(rtr.CacheReset{})
+				continue
+			}
+		default:
+			c.write(rtr.ErrorReport{Code: rtr.ErrInvalidRequest, Text: "unexpected PDU"})
+			return
+		}
+
+		pdus := []rtr.PDU{rtr.CacheResponse{Session: session}}
+		pdus = append(pdus, diff(from, cur, version)...)
+		pdus = append(pdus, rtr.EndOfData{Session: session, Serial: serial, Refresh: 3600, Retry: 1, Expire: 7200})
+		c.write(pdus...)
+	}
+}
+
+// diff returns the PDUs moving a router from one state to another. The
+// zero from is an empty cache.
+func diff(from, to data, version uint8) []rtr.PDU {
+	var pdus []rtr.PDU
+	for _, v := range sortedVRPs(from.vrps) {
+		if !to.vrps[v] {
+			pdus = append(pdus, rtr.Prefix{Prefix: v.Prefix, MaxLen: v.MaxLen, ASN: v.ASN})
+		}
+	}
+	for _, v := range sortedVRPs(to.vrps) {
+		if !from.vrps[v] {
+			pdus = append(pdus, rtr.Prefix{Flags: rtr.FlagAnnounce, Prefix: v.Prefix, MaxLen: v.MaxLen, ASN: v.ASN})
+		}
+	}
+	if version < rtr.Version2 {
+		return pdus
+	}
+	for _, customer := range slices.Sorted(maps.Keys(from.aspas)) {
+		if _, ok := to.aspas[customer]; !ok {
+			pdus = append(pdus, rtr.ASPA{Customer: customer})
+		}
+	}
+	for _, customer := range slices.Sorted(maps.Keys(to.aspas)) {
+		p := to.aspas[customer]
+		if old, ok := from.aspas[customer]; !ok || !slices.Equal(old, p) {
+			pdus = append(pdus, rtr.ASPA{Flags: rtr.FlagAnnounce, Customer: customer, Providers: p})
+		}
+	}
+	return pdus
+}
+
+func sortedVRPs(vrps map[rov.VRP]bool) []rov.VRP {
+	return slices.SortedFunc(maps.Keys(vrps), rov.VRP.Compare)
+}